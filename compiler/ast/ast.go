@@ -0,0 +1,271 @@
+// Package ast declares the typed syntax tree of a jack class, built from the
+// generic parse tree.
+package ast
+
+import "github.com/schattian/nand2tetris/compiler/token"
+
+// Node is implemented by every node of the tree. Pos is the position of the
+// first char of the node and End the position following its last char
+type Node interface {
+	Pos() token.Pos
+	End() token.Pos
+}
+
+type Expr interface {
+	Node
+	exprNode()
+}
+
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+type Ident struct {
+	Name    string
+	NamePos token.Pos
+}
+
+type ClassDecl struct {
+	Class       token.Pos
+	Name        *Ident
+	Vars        []*VarDecl
+	Subroutines []*SubroutineDecl
+	Rbrace      token.Pos
+}
+
+// VarDecl declares static and field vars of a class or local vars of a
+// subroutine
+type VarDecl struct {
+	Kind      token.Token // STATIC, FIELD or VAR
+	KindPos   token.Pos
+	Type      *Ident
+	Names     []*Ident
+	Semicolon token.Pos
+}
+
+type SubroutineDecl struct {
+	Kind    token.Token // CONSTRUCTOR, FUNCTION or METHOD
+	KindPos token.Pos
+	// Return is named void for subroutines without return value
+	Return *Ident
+	Name   *Ident
+	Params []*Param
+	Body   *Block
+}
+
+type Param struct {
+	Type *Ident
+	Name *Ident
+}
+
+// Block is a braced list of statements
+type Block struct {
+	Lbrace token.Pos
+	// Locals is only held by the body of a subroutine
+	Locals []*VarDecl
+	Stmts  []Stmt
+	Rbrace token.Pos
+}
+
+// Assign is the assignment of a let or of the init and post statements of a
+// for
+type Assign struct {
+	Name *Ident
+	// Index is nil unless the statement assigns an array element
+	Index Expr
+	Op    token.Token // EQ or, in the dialect, a compound assignment like ADD_ASSIGN
+	OpPos token.Pos
+	Value Expr
+}
+
+type (
+	LetStmt struct {
+		Let token.Pos
+		*Assign
+		Semicolon token.Pos
+	}
+
+	IfStmt struct {
+		If   token.Pos
+		Cond Expr
+		Then *Block
+		// Else is nil for ifs without else branch, and an *IfStmt for the else
+		// ifs of the dialect
+		Else Stmt
+	}
+
+	WhileStmt struct {
+		While token.Pos
+		Cond  Expr
+		Body  *Block
+	}
+
+	// ForStmt is only parsed in the dialect. Init and Post may be nil
+	ForStmt struct {
+		For  token.Pos
+		Init *Assign
+		Cond Expr
+		Post *Assign
+		Body *Block
+	}
+
+	DoStmt struct {
+		Do        token.Pos
+		Call      *CallExpr
+		Semicolon token.Pos
+	}
+
+	ReturnStmt struct {
+		Return token.Pos
+		// Value is nil for void returns
+		Value     Expr
+		Semicolon token.Pos
+	}
+)
+
+type (
+	IntLit struct {
+		ValuePos token.Pos
+		Literal  string
+		Value    int
+	}
+
+	// CharLit is a char literal of the dialect, evaluating to its code
+	CharLit struct {
+		ValuePos token.Pos
+		Literal  string
+		Value    int
+	}
+
+	StringLit struct {
+		ValuePos token.Pos
+		Value    string
+	}
+
+	// KeywordLit is one of true, false, null and this
+	KeywordLit struct {
+		ValuePos token.Pos
+		Token    token.Token
+	}
+
+	// IndexExpr is an array access like name[index]
+	IndexExpr struct {
+		Name   *Ident
+		Index  Expr
+		Rbrack token.Pos
+	}
+
+	CallExpr struct {
+		// Receiver is the class or var the subroutine is called on, nil when
+		// calling a method of this
+		Receiver *Ident
+		Name     *Ident
+		Args     []Expr
+		Rparen   token.Pos
+	}
+
+	// BinaryExpr evaluates its operands from left to right. As jack has no
+	// operator precedence, operators are left associative unless parsed with
+	// the dialect
+	BinaryExpr struct {
+		X     Expr
+		Op    token.Token
+		OpPos token.Pos
+		Y     Expr
+	}
+
+	UnaryExpr struct {
+		Op    token.Token // SUB or NOT
+		OpPos token.Pos
+		X     Expr
+	}
+
+	ParenExpr struct {
+		Lparen token.Pos
+		X      Expr
+		Rparen token.Pos
+	}
+)
+
+func after(pos token.Pos, n int) token.Pos {
+	return token.Pos{Line: pos.Line, Col: pos.Col + n}
+}
+
+func (n *Ident) Pos() token.Pos          { return n.NamePos }
+func (n *Ident) End() token.Pos          { return after(n.NamePos, len(n.Name)) }
+func (n *ClassDecl) Pos() token.Pos      { return n.Class }
+func (n *ClassDecl) End() token.Pos      { return after(n.Rbrace, 1) }
+func (n *VarDecl) Pos() token.Pos        { return n.KindPos }
+func (n *VarDecl) End() token.Pos        { return after(n.Semicolon, 1) }
+func (n *SubroutineDecl) Pos() token.Pos { return n.KindPos }
+func (n *SubroutineDecl) End() token.Pos { return n.Body.End() }
+func (n *Param) Pos() token.Pos          { return n.Type.Pos() }
+func (n *Param) End() token.Pos          { return n.Name.End() }
+func (n *Block) Pos() token.Pos          { return n.Lbrace }
+func (n *Block) End() token.Pos          { return after(n.Rbrace, 1) }
+func (n *Assign) Pos() token.Pos         { return n.Name.Pos() }
+func (n *Assign) End() token.Pos         { return n.Value.End() }
+
+func (n *LetStmt) Pos() token.Pos    { return n.Let }
+func (n *LetStmt) End() token.Pos    { return after(n.Semicolon, 1) }
+func (n *IfStmt) Pos() token.Pos     { return n.If }
+func (n *WhileStmt) Pos() token.Pos  { return n.While }
+func (n *WhileStmt) End() token.Pos  { return n.Body.End() }
+func (n *ForStmt) Pos() token.Pos    { return n.For }
+func (n *ForStmt) End() token.Pos    { return n.Body.End() }
+func (n *DoStmt) Pos() token.Pos     { return n.Do }
+func (n *DoStmt) End() token.Pos     { return after(n.Semicolon, 1) }
+func (n *ReturnStmt) Pos() token.Pos { return n.Return }
+func (n *ReturnStmt) End() token.Pos { return after(n.Semicolon, 1) }
+
+func (n *IfStmt) End() token.Pos {
+	if n.Else != nil {
+		return n.Else.End()
+	}
+	return n.Then.End()
+}
+
+func (n *IntLit) Pos() token.Pos     { return n.ValuePos }
+func (n *IntLit) End() token.Pos     { return after(n.ValuePos, len(n.Literal)) }
+func (n *CharLit) Pos() token.Pos    { return n.ValuePos }
+func (n *CharLit) End() token.Pos    { return after(n.ValuePos, len(n.Literal)+2) }
+func (n *StringLit) Pos() token.Pos  { return n.ValuePos }
+func (n *StringLit) End() token.Pos  { return after(n.ValuePos, len(n.Value)+2) }
+func (n *KeywordLit) Pos() token.Pos { return n.ValuePos }
+func (n *KeywordLit) End() token.Pos { return after(n.ValuePos, len(n.Token.String())) }
+func (n *IndexExpr) Pos() token.Pos  { return n.Name.Pos() }
+func (n *IndexExpr) End() token.Pos  { return after(n.Rbrack, 1) }
+func (n *CallExpr) End() token.Pos   { return after(n.Rparen, 1) }
+func (n *BinaryExpr) Pos() token.Pos { return n.X.Pos() }
+func (n *BinaryExpr) End() token.Pos { return n.Y.End() }
+func (n *UnaryExpr) Pos() token.Pos  { return n.OpPos }
+func (n *UnaryExpr) End() token.Pos  { return n.X.End() }
+func (n *ParenExpr) Pos() token.Pos  { return n.Lparen }
+func (n *ParenExpr) End() token.Pos  { return after(n.Rparen, 1) }
+
+func (n *CallExpr) Pos() token.Pos {
+	if n.Receiver != nil {
+		return n.Receiver.Pos()
+	}
+	return n.Name.Pos()
+}
+
+func (*Block) stmtNode()      {}
+func (*LetStmt) stmtNode()    {}
+func (*IfStmt) stmtNode()     {}
+func (*WhileStmt) stmtNode()  {}
+func (*ForStmt) stmtNode()    {}
+func (*DoStmt) stmtNode()     {}
+func (*ReturnStmt) stmtNode() {}
+
+func (*Ident) exprNode()      {}
+func (*IntLit) exprNode()     {}
+func (*CharLit) exprNode()    {}
+func (*StringLit) exprNode()  {}
+func (*KeywordLit) exprNode() {}
+func (*IndexExpr) exprNode()  {}
+func (*CallExpr) exprNode()   {}
+func (*BinaryExpr) exprNode() {}
+func (*UnaryExpr) exprNode()  {}
+func (*ParenExpr) exprNode()  {}
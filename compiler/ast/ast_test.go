@@ -0,0 +1,180 @@
+package ast
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+func TestParse(t *testing.T) {
+	src := `class A {
+  field int x, y;
+  method int f(int a, Array b) {
+    var int i;
+    let b[i] = -a + (x * 2);
+    if (~(a = 0)) { do Output.printString("s"); } else { do g(); }
+    return this;
+  }
+}`
+	class, err := Parse([]byte(src), parser.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class.Name.Name != "A" || len(class.Vars) != 1 || len(class.Vars[0].Names) != 2 {
+		t.Fatalf("unexpected class %+v", class)
+	}
+	sub := class.Subroutines[0]
+	if sub.Kind != token.METHOD || sub.Return.Name != "int" || len(sub.Params) != 2 || sub.Params[1].Type.Name != "Array" {
+		t.Fatalf("unexpected subroutine %+v", sub)
+	}
+	if len(sub.Body.Locals) != 1 || len(sub.Body.Stmts) != 3 {
+		t.Fatalf("unexpected body %+v", sub.Body)
+	}
+
+	let := sub.Body.Stmts[0].(*LetStmt)
+	if let.Index.(*Ident).Name != "i" {
+		t.Errorf("let index = %+v", let.Index)
+	}
+	sum := let.Value.(*BinaryExpr)
+	if sum.Op != token.ADD || sum.X.(*UnaryExpr).Op != token.SUB {
+		t.Errorf("let value = %+v", sum)
+	}
+	if mul := sum.Y.(*ParenExpr).X.(*BinaryExpr); mul.Y.(*IntLit).Value != 2 {
+		t.Errorf("paren expr = %+v", mul)
+	}
+
+	ifStmt := sub.Body.Stmts[1].(*IfStmt)
+	if ifStmt.Cond.(*UnaryExpr).Op != token.NOT || ifStmt.Else == nil {
+		t.Errorf("if = %+v", ifStmt)
+	}
+	call := ifStmt.Then.Stmts[0].(*DoStmt).Call
+	if call.Receiver.Name != "Output" || call.Name.Name != "printString" || call.Args[0].(*StringLit).Value != "s" {
+		t.Errorf("call = %+v", call)
+	}
+	if local := ifStmt.Else.(*Block).Stmts[0].(*DoStmt).Call; local.Receiver != nil || len(local.Args) != 0 {
+		t.Errorf("local call = %+v", local)
+	}
+	if ret := sub.Body.Stmts[2].(*ReturnStmt); ret.Value.(*KeywordLit).Token != token.THIS {
+		t.Errorf("return = %+v", ret)
+	}
+
+	if got, want := ifStmt.Pos(), (token.Pos{Line: 6, Col: 5}); got != want {
+		t.Errorf("IfStmt.Pos() = %v, want %v", got, want)
+	}
+	if got, want := ifStmt.End(), (token.Pos{Line: 6, Col: 67}); got != want {
+		t.Errorf("IfStmt.End() = %v, want %v", got, want)
+	}
+}
+
+func TestFromTree_Dialect(t *testing.T) {
+	src := `class A {
+  function void f() {
+    var int i;
+    for (i = 0; i < 10; i += 1) { let i = 1 + 2 * 'c'; }
+    if (i) { return; } else if (~i) { return; }
+    return;
+  }
+}`
+	p := parser.Config{Mode: scanner.ScanDialect}.New([]byte(src))
+	tree := p.ParseTree()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+	class, err := FromTree(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := class.Subroutines[0].Body.Stmts
+	loop := stmts[0].(*ForStmt)
+	if loop.Init.Op != token.EQ || loop.Post.Op != token.ADD_ASSIGN || loop.Cond.(*BinaryExpr).Op != token.LT {
+		t.Errorf("for = %+v", loop)
+	}
+	sum := loop.Body.Stmts[0].(*LetStmt).Value.(*BinaryExpr)
+	if sum.Op != token.ADD || sum.Y.(*BinaryExpr).Op != token.MUL || sum.Y.(*BinaryExpr).Y.(*CharLit).Value != 'c' {
+		t.Errorf("precedence = %+v", sum)
+	}
+	if elseIf, ok := stmts[1].(*IfStmt).Else.(*IfStmt); !ok || elseIf.Else != nil {
+		t.Errorf("else if = %+v", stmts[1].(*IfStmt).Else)
+	}
+	if end := stmts[1].End(); end != (token.Pos{Line: 5, Col: 48}) {
+		t.Errorf("if.End() = %v", end)
+	}
+}
+
+func TestFromTree_Error(t *testing.T) {
+	tree := parser.New([]byte("class A { function void f() { let x = ; } }")).ParseTree()
+	if _, err := FromTree(tree); err == nil {
+		t.Error("FromTree() expected an error")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	class, err := Parse([]byte("class A { function int f(int a) { return a + A.g(a, 1); } }"), parser.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idents []string
+	Inspect(class, func(n Node) bool {
+		if _, ok := n.(*SubroutineDecl); ok && n.(*SubroutineDecl).Name.Name != "f" {
+			return false
+		}
+		if ident, ok := n.(*Ident); ok {
+			idents = append(idents, ident.Name)
+		}
+		return true
+	})
+	want := []string{"A", "int", "f", "int", "a", "a", "A", "g", "a"}
+	if !reflect.DeepEqual(idents, want) {
+		t.Errorf("Inspect() idents = %v, want %v", idents, want)
+	}
+}
+
+// TestFromTree_Projects builds every class of the projects, checking that the
+// nodes are walked in source order and span the tokens of the class
+func TestFromTree_Projects(t *testing.T) {
+	var filenames []string
+	err := filepath.Walk("../../projects", func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".jack" {
+			filenames = append(filenames, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := parser.New(src).ParseTree()
+		class, err := FromTree(tree)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if end := parse.LastToken(tree.Root).End(); class.End() != end {
+			t.Errorf("%s: ClassDecl.End() = %v, want %v", filename, class.End(), end)
+		}
+		var last token.Pos
+		Inspect(class, func(n Node) bool {
+			if n == nil {
+				return true
+			}
+			if before(n.Pos(), last) || before(n.End(), n.Pos()) {
+				t.Errorf("%s: node %T at %v out of order", filename, n, n.Pos())
+			}
+			last = n.Pos()
+			return true
+		})
+	}
+}
+
+func before(a, b token.Pos) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+}
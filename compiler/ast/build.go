@@ -0,0 +1,389 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+// Parse parses the given source into a class, returning the first syntax
+// error if any
+func Parse(src []byte, cfg parser.Config) (*ClassDecl, error) {
+	p := cfg.New(src)
+	tree := p.ParseTree()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return FromTree(tree)
+}
+
+// FromTree builds the class held by the given parse tree, which is expected to
+// be free of syntax errors
+func FromTree(tree *parse.Tree) (class *ClassDecl, err error) {
+	if tree.Root == nil || tree.Root.Type() != parse.NodeClass {
+		return nil, fmt.Errorf("tree root is not a class")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			buildErr, ok := r.(*parse.Error)
+			if !ok {
+				panic(r)
+			}
+			err = buildErr
+		}
+	}()
+	return buildClass(tree.Root), nil
+}
+
+// cursor walks the children of a parse node, bailing out with a *parse.Error
+// when they don't have the expected shape
+type cursor struct {
+	parent parse.Node
+	nodes  []parse.Node
+	i      int
+}
+
+func newCursor(n parse.Node) *cursor {
+	return &cursor{parent: n, nodes: n.Children()}
+}
+
+func (c *cursor) errorf(format string, args ...interface{}) {
+	var pos token.Pos
+	if c.i < len(c.nodes) {
+		pos = parse.FirstToken(c.nodes[c.i]).Pos
+	} else if last := parse.LastToken(c.parent); last != nil {
+		pos = last.End()
+	}
+	panic(&parse.Error{Pos: pos, Msg: fmt.Sprintf(format, args...) + " in " + c.parent.Type().String()})
+}
+
+func (c *cursor) done() bool {
+	return c.i >= len(c.nodes)
+}
+
+// is tells whether the next child is one of the given tokens
+func (c *cursor) is(toks ...token.Token) bool {
+	if c.done() {
+		return false
+	}
+	for _, tok := range toks {
+		if c.nodes[c.i].Token().Is(tok) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNode tells whether the next child is a node of the given type
+func (c *cursor) isNode(t parse.NodeType) bool {
+	return !c.done() && c.nodes[c.i].Type() == t
+}
+
+// token consumes the next child, which must be one of the given tokens or any
+// token when none is given
+func (c *cursor) token(toks ...token.Token) *parse.Token {
+	if c.done() || c.nodes[c.i].Token() == nil || (len(toks) > 0 && !c.is(toks...)) {
+		c.errorf("expected %s", joinTokens(toks))
+	}
+	tok := c.nodes[c.i].Token()
+	c.i++
+	return tok
+}
+
+func joinTokens(toks []token.Token) string {
+	if len(toks) == 0 {
+		return "token"
+	}
+	var names []string
+	for _, tok := range toks {
+		names = append(names, strconv.Quote(tok.String()))
+	}
+	return strings.Join(names, " or ")
+}
+
+func (c *cursor) ident() *Ident {
+	return newIdent(c.token(token.IDENT))
+}
+
+// typeName consumes a type or void
+func (c *cursor) typeName() *Ident {
+	if c.done() || c.nodes[c.i].Token() == nil || !(token.IsType(c.nodes[c.i].Token().Token) || c.is(token.VOID)) {
+		c.errorf("expected type")
+	}
+	return newIdent(c.token())
+}
+
+func (c *cursor) node(t parse.NodeType) parse.Node {
+	if !c.isNode(t) {
+		c.errorf("expected %s", t)
+	}
+	n := c.nodes[c.i]
+	c.i++
+	return n
+}
+
+func (c *cursor) end() {
+	if !c.done() {
+		c.errorf("unexpected %s", c.nodes[c.i].Type())
+	}
+}
+
+func newIdent(tok *parse.Token) *Ident {
+	return &Ident{Name: tok.Literal, NamePos: tok.Pos}
+}
+
+func buildClass(n parse.Node) *ClassDecl {
+	c := newCursor(n)
+	class := &ClassDecl{Class: c.token(token.CLASS).Pos, Name: c.ident()}
+	c.token(token.LBRACE)
+	for c.isNode(parse.NodeClassVarDec) {
+		class.Vars = append(class.Vars, buildVarDecl(c.node(parse.NodeClassVarDec)))
+	}
+	for c.isNode(parse.NodeSubroutineDec) {
+		class.Subroutines = append(class.Subroutines, buildSubroutine(c.node(parse.NodeSubroutineDec)))
+	}
+	class.Rbrace = c.token(token.RBRACE).Pos
+	c.end()
+	return class
+}
+
+func buildVarDecl(n parse.Node) *VarDecl {
+	c := newCursor(n)
+	kind := c.token(token.STATIC, token.FIELD, token.VAR)
+	decl := &VarDecl{Kind: kind.Token, KindPos: kind.Pos, Type: c.typeName(), Names: []*Ident{c.ident()}}
+	for c.is(token.COMMA) {
+		c.token()
+		decl.Names = append(decl.Names, c.ident())
+	}
+	decl.Semicolon = c.token(token.SEMICOLON).Pos
+	c.end()
+	return decl
+}
+
+func buildSubroutine(n parse.Node) *SubroutineDecl {
+	c := newCursor(n)
+	kind := c.token(token.CONSTRUCTOR, token.FUNCTION, token.METHOD)
+	sub := &SubroutineDecl{Kind: kind.Token, KindPos: kind.Pos, Return: c.typeName(), Name: c.ident()}
+	c.token(token.LPAREN)
+	if c.isNode(parse.NodeParameterList) {
+		params := newCursor(c.node(parse.NodeParameterList))
+		for !params.done() {
+			if len(sub.Params) > 0 {
+				params.token(token.COMMA)
+			}
+			sub.Params = append(sub.Params, &Param{Type: params.typeName(), Name: params.ident()})
+		}
+	}
+	c.token(token.RPAREN)
+
+	body := newCursor(c.node(parse.NodeSubroutineBody))
+	sub.Body = &Block{Lbrace: body.token(token.LBRACE).Pos}
+	for body.isNode(parse.NodeVarDec) {
+		sub.Body.Locals = append(sub.Body.Locals, buildVarDecl(body.node(parse.NodeVarDec)))
+	}
+	sub.Body.Stmts = buildStmts(body)
+	sub.Body.Rbrace = body.token(token.RBRACE).Pos
+	body.end()
+	c.end()
+	return sub
+}
+
+// buildBlock consumes a braced list of statements
+func buildBlock(c *cursor) *Block {
+	b := &Block{Lbrace: c.token(token.LBRACE).Pos}
+	b.Stmts = buildStmts(c)
+	b.Rbrace = c.token(token.RBRACE).Pos
+	return b
+}
+
+func buildStmts(c *cursor) (stmts []Stmt) {
+	for !c.done() && c.nodes[c.i].Token() == nil {
+		stmts = append(stmts, buildStmt(c.nodes[c.i]))
+		c.i++
+	}
+	return
+}
+
+func buildStmt(n parse.Node) Stmt {
+	c := newCursor(n)
+	var stmt Stmt
+	switch n.Type() {
+	case parse.NodeLetStatement:
+		let := &LetStmt{Let: c.token(token.LET).Pos, Assign: buildAssign(c)}
+		let.Semicolon = c.token(token.SEMICOLON).Pos
+		stmt = let
+	case parse.NodeIfStatement:
+		s := &IfStmt{If: c.token(token.IF).Pos}
+		s.Cond = buildCond(c)
+		s.Then = buildBlock(c)
+		if c.is(token.ELSE) {
+			c.token()
+			if c.isNode(parse.NodeIfStatement) {
+				s.Else = buildStmt(c.node(parse.NodeIfStatement))
+			} else {
+				s.Else = buildBlock(c)
+			}
+		}
+		stmt = s
+	case parse.NodeForStatement:
+		s := &ForStmt{For: c.token(token.FOR).Pos}
+		c.token(token.LPAREN)
+		if c.isNode(parse.NodeAssignment) {
+			s.Init = buildAssign(newCursor(c.node(parse.NodeAssignment)))
+		}
+		c.token(token.SEMICOLON)
+		s.Cond = buildExpr(c.node(parse.NodeExpression))
+		c.token(token.SEMICOLON)
+		if c.isNode(parse.NodeAssignment) {
+			s.Post = buildAssign(newCursor(c.node(parse.NodeAssignment)))
+		}
+		c.token(token.RPAREN)
+		s.Body = buildBlock(c)
+		stmt = s
+	case parse.NodeWhileStatement:
+		s := &WhileStmt{While: c.token(token.WHILE).Pos}
+		s.Cond = buildCond(c)
+		s.Body = buildBlock(c)
+		stmt = s
+	case parse.NodeDoStatement:
+		s := &DoStmt{Do: c.token(token.DO).Pos}
+		s.Call = buildCall(c.node(parse.NodeSubroutineCall))
+		s.Semicolon = c.token(token.SEMICOLON).Pos
+		stmt = s
+	case parse.NodeReturnStatement:
+		s := &ReturnStmt{Return: c.token(token.RETURN).Pos}
+		if c.isNode(parse.NodeExpression) {
+			s.Value = buildExpr(c.node(parse.NodeExpression))
+		}
+		s.Semicolon = c.token(token.SEMICOLON).Pos
+		stmt = s
+	default:
+		c.errorf("unexpected statement")
+	}
+	c.end()
+	return stmt
+}
+
+// buildAssign consumes `name ([ index ])? op value`
+func buildAssign(c *cursor) *Assign {
+	a := &Assign{Name: c.ident()}
+	if c.is(token.LBRACK) {
+		c.token()
+		a.Index = buildExpr(c.node(parse.NodeExpression))
+		c.token(token.RBRACK)
+	}
+	op := c.token()
+	if op.Token != token.EQ && !token.IsCompoundAssign(op.Token) {
+		c.i--
+		c.errorf("expected %q", token.EQ.String())
+	}
+	a.Op, a.OpPos = op.Token, op.Pos
+	a.Value = buildExpr(c.node(parse.NodeExpression))
+	return a
+}
+
+// buildCond consumes the parenthesized condition of an if or while
+func buildCond(c *cursor) Expr {
+	c.token(token.LPAREN)
+	cond := buildExpr(c.node(parse.NodeExpression))
+	c.token(token.RPAREN)
+	return cond
+}
+
+func buildExpr(n parse.Node) Expr {
+	c := newCursor(n)
+	x := buildOperand(c)
+	for !c.done() {
+		op := c.token()
+		if !token.IsBinaryOperator(op.Token) {
+			c.i--
+			c.errorf("expected operator")
+		}
+		x = &BinaryExpr{X: x, Op: op.Token, OpPos: op.Pos, Y: buildOperand(c)}
+	}
+	return x
+}
+
+// buildOperand consumes a term or, in the dialect, the expression of
+// operators with higher precedence
+func buildOperand(c *cursor) Expr {
+	if c.isNode(parse.NodeExpression) {
+		return buildExpr(c.node(parse.NodeExpression))
+	}
+	return buildTerm(c.node(parse.NodeTerm))
+}
+
+func buildTerm(n parse.Node) Expr {
+	c := newCursor(n)
+	var x Expr
+	switch {
+	case c.isNode(parse.NodeSubroutineCall):
+		x = buildCall(c.node(parse.NodeSubroutineCall))
+	case c.is(token.SUB, token.NOT):
+		op := c.token()
+		x = &UnaryExpr{Op: op.Token, OpPos: op.Pos, X: buildTerm(c.node(parse.NodeTerm))}
+	case c.is(token.LPAREN):
+		paren := &ParenExpr{Lparen: c.token().Pos}
+		paren.X = buildExpr(c.node(parse.NodeExpression))
+		paren.Rparen = c.token(token.RPAREN).Pos
+		x = paren
+	case c.is(token.IDENT):
+		name := c.ident()
+		if !c.is(token.LBRACK) {
+			x = name
+			break
+		}
+		c.token()
+		index := &IndexExpr{Name: name, Index: buildExpr(c.node(parse.NodeExpression))}
+		index.Rbrack = c.token(token.RBRACK).Pos
+		x = index
+	case c.is(token.INTEGER_CONST, token.CHAR_CONST):
+		tok := c.token()
+		v, err := tok.IntValue()
+		if err != nil {
+			c.i--
+			c.errorf("invalid integer %s", tok.Literal)
+		}
+		if tok.Token == token.CHAR_CONST {
+			x = &CharLit{ValuePos: tok.Pos, Literal: tok.Literal, Value: v}
+			break
+		}
+		x = &IntLit{ValuePos: tok.Pos, Literal: tok.Literal, Value: v}
+	case c.is(token.STRING_CONST):
+		tok := c.token()
+		x = &StringLit{ValuePos: tok.Pos, Value: tok.Literal}
+	case c.is(token.TRUE, token.FALSE, token.NULL, token.THIS):
+		tok := c.token()
+		x = &KeywordLit{ValuePos: tok.Pos, Token: tok.Token}
+	default:
+		c.errorf("expected term")
+	}
+	c.end()
+	return x
+}
+
+func buildCall(n parse.Node) *CallExpr {
+	c := newCursor(n)
+	call := &CallExpr{Name: c.ident()}
+	if c.is(token.DOT) {
+		c.token()
+		call.Receiver, call.Name = call.Name, c.ident()
+	}
+	c.token(token.LPAREN)
+	if c.isNode(parse.NodeExpressionList) {
+		args := newCursor(c.node(parse.NodeExpressionList))
+		for !args.done() {
+			if len(call.Args) > 0 {
+				args.token(token.COMMA)
+			}
+			call.Args = append(call.Args, buildExpr(args.node(parse.NodeExpression)))
+		}
+	}
+	call.Rparen = c.token(token.RPAREN).Pos
+	c.end()
+	return call
+}
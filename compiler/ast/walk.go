@@ -0,0 +1,118 @@
+package ast
+
+// Visitor's Visit is called by Walk for every node. When the returned visitor
+// w is not nil, Walk visits the children of the node with w and then calls
+// w.Visit(nil)
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk traverses the tree in source order, starting with n
+func Walk(v Visitor, n Node) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+
+	switch n := n.(type) {
+	case *ClassDecl:
+		Walk(v, n.Name)
+		for _, decl := range n.Vars {
+			Walk(v, decl)
+		}
+		for _, sub := range n.Subroutines {
+			Walk(v, sub)
+		}
+	case *VarDecl:
+		Walk(v, n.Type)
+		for _, name := range n.Names {
+			Walk(v, name)
+		}
+	case *SubroutineDecl:
+		Walk(v, n.Return)
+		Walk(v, n.Name)
+		for _, param := range n.Params {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+	case *Param:
+		Walk(v, n.Type)
+		Walk(v, n.Name)
+	case *Block:
+		for _, decl := range n.Locals {
+			Walk(v, decl)
+		}
+		for _, stmt := range n.Stmts {
+			Walk(v, stmt)
+		}
+
+	case *Assign:
+		Walk(v, n.Name)
+		if n.Index != nil {
+			Walk(v, n.Index)
+		}
+		Walk(v, n.Value)
+	case *LetStmt:
+		Walk(v, n.Assign)
+	case *IfStmt:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *WhileStmt:
+		Walk(v, n.Cond)
+		Walk(v, n.Body)
+	case *ForStmt:
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+		Walk(v, n.Cond)
+		if n.Post != nil {
+			Walk(v, n.Post)
+		}
+		Walk(v, n.Body)
+	case *DoStmt:
+		Walk(v, n.Call)
+	case *ReturnStmt:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *IndexExpr:
+		Walk(v, n.Name)
+		Walk(v, n.Index)
+	case *CallExpr:
+		if n.Receiver != nil {
+			Walk(v, n.Receiver)
+		}
+		Walk(v, n.Name)
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *BinaryExpr:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *UnaryExpr:
+		Walk(v, n.X)
+	case *ParenExpr:
+		Walk(v, n.X)
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in source order, calling f for every node and
+// then f(nil) once its children were visited. The children of a node are
+// skipped when f returns false
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}
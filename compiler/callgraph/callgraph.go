@@ -0,0 +1,230 @@
+// Package callgraph builds the graph of the calls between the functions of a
+// vm program, finding the functions unreachable from its entry points and the
+// recursion cycles.
+package callgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+// Roots are the entry points of jack programs: Sys.init boots the os, calling
+// the init functions of its classes, which are kept when the program replaces
+// them, and then Main.main
+var Roots = []string{"Sys.init", "Memory.init", "Math.init", "Screen.init", "Output.init", "Keyboard.init", "Main.main"}
+
+type Graph struct {
+	// Functions holds the functions declared by the program, sorted
+	Functions []string
+	// Calls holds the call sites of every function to every callee, which may
+	// be external to the program
+	Calls map[string]map[string]int
+	// Reachable holds the functions called from the roots, directly or not
+	Reachable map[string]bool
+}
+
+// Build builds the call graph of the program, walking it from the given roots
+func Build(program []*vm.Command, roots ...string) *Graph {
+	g := &Graph{Calls: make(map[string]map[string]int), Reachable: make(map[string]bool)}
+	var fn string
+	for _, cmd := range program {
+		switch cmd.Op() {
+		case vm.OpFunction:
+			fn = cmd.Function()
+			g.Functions = append(g.Functions, fn)
+			g.Calls[fn] = make(map[string]int)
+		case vm.OpCall:
+			if fn != "" {
+				g.Calls[fn][cmd.Function()]++
+			}
+		}
+	}
+	sort.Strings(g.Functions)
+
+	var visit func(fn string)
+	visit = func(fn string) {
+		if g.Reachable[fn] {
+			return
+		}
+		g.Reachable[fn] = true
+		for callee := range g.Calls[fn] {
+			visit(callee)
+		}
+	}
+	for _, root := range roots {
+		if _, ok := g.Calls[root]; ok {
+			visit(root)
+		}
+	}
+	return g
+}
+
+// Callees returns the functions called by fn, sorted
+func (g *Graph) Callees(fn string) []string {
+	var callees []string
+	for callee := range g.Calls[fn] {
+		callees = append(callees, callee)
+	}
+	sort.Strings(callees)
+	return callees
+}
+
+// External returns the called functions that the program doesn't declare,
+// sorted
+func (g *Graph) External() []string {
+	seen := make(map[string]bool)
+	var external []string
+	for _, fn := range g.Functions {
+		for _, callee := range g.Callees(fn) {
+			if _, ok := g.Calls[callee]; !ok && !seen[callee] {
+				seen[callee] = true
+				external = append(external, callee)
+			}
+		}
+	}
+	sort.Strings(external)
+	return external
+}
+
+// Unreachable returns the declared functions not reachable from the roots
+func (g *Graph) Unreachable() []string {
+	var fns []string
+	for _, fn := range g.Functions {
+		if !g.Reachable[fn] {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
+}
+
+// Cycles returns the groups of mutually recursive functions, including the
+// ones calling themselves. Every cycle is sorted, and cycles are sorted by
+// their first function
+func (g *Graph) Cycles() [][]string {
+	// tarjan's strongly connected components
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+
+	var connect func(fn string)
+	connect = func(fn string) {
+		index[fn] = len(index)
+		low[fn] = index[fn]
+		stack = append(stack, fn)
+		onStack[fn] = true
+		for _, callee := range g.Callees(fn) {
+			if _, ok := g.Calls[callee]; !ok {
+				continue
+			}
+			if _, visited := index[callee]; !visited {
+				connect(callee)
+				low[fn] = minInt(low[fn], low[callee])
+			} else if onStack[callee] {
+				low[fn] = minInt(low[fn], index[callee])
+			}
+		}
+		if low[fn] != index[fn] {
+			return
+		}
+		var scc []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == fn {
+				break
+			}
+		}
+		if len(scc) > 1 || g.Calls[fn][fn] > 0 {
+			sort.Strings(scc)
+			cycles = append(cycles, scc)
+		}
+	}
+	for _, fn := range g.Functions {
+		if _, visited := index[fn]; !visited {
+			connect(fn)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// WriteDOT writes the graph in the graphviz format. Unreachable functions are
+// dashed and external ones grayed
+func (g *Graph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph calls {"); err != nil {
+		return err
+	}
+	for _, fn := range g.Functions {
+		attrs := ""
+		if !g.Reachable[fn] {
+			attrs = " [style=dashed]"
+		}
+		fmt.Fprintf(w, "\t%q%s;\n", fn, attrs)
+	}
+	for _, fn := range g.External() {
+		fmt.Fprintf(w, "\t%q [color=gray, fontcolor=gray];\n", fn)
+	}
+	for _, fn := range g.Functions {
+		for _, callee := range g.Callees(fn) {
+			attrs := ""
+			if n := g.Calls[fn][callee]; n > 1 {
+				attrs = fmt.Sprintf(" [label=%d]", n)
+			}
+			fmt.Fprintf(w, "\t%q -> %q%s;\n", fn, callee, attrs)
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+type jsonGraph struct {
+	Functions   []jsonFunction `json:"functions"`
+	External    []string       `json:"external"`
+	Unreachable []string       `json:"unreachable"`
+	Cycles      [][]string     `json:"cycles"`
+}
+
+type jsonFunction struct {
+	Name      string     `json:"name"`
+	Reachable bool       `json:"reachable"`
+	Calls     []jsonCall `json:"calls"`
+}
+
+type jsonCall struct {
+	Callee string `json:"callee"`
+	Sites  int    `json:"sites"`
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	jg := jsonGraph{
+		Functions:   []jsonFunction{},
+		External:    append([]string{}, g.External()...),
+		Unreachable: append([]string{}, g.Unreachable()...),
+		Cycles:      append([][]string{}, g.Cycles()...),
+	}
+	for _, fn := range g.Functions {
+		jf := jsonFunction{Name: fn, Reachable: g.Reachable[fn], Calls: []jsonCall{}}
+		for _, callee := range g.Callees(fn) {
+			jf.Calls = append(jf.Calls, jsonCall{Callee: callee, Sites: g.Calls[fn][callee]})
+		}
+		jg.Functions = append(jg.Functions, jf)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jg)
+}
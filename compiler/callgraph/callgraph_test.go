@@ -0,0 +1,89 @@
+package callgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+const program = `function Main.main 0
+call Main.fact 1
+call Main.even 1
+call Output.printInt 1
+return
+function Main.fact 0
+call Main.fact 1
+call Math.multiply 2
+call Math.multiply 2
+return
+function Main.even 0
+call Main.odd 1
+return
+function Main.odd 0
+call Main.even 1
+return
+function Main.unused 0
+call Main.unused2 0
+return
+function Main.unused2 0
+return
+`
+
+func build(t *testing.T) *Graph {
+	t.Helper()
+	cmds, err := vm.Parse("Main", strings.NewReader(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Build(cmds, Roots...)
+}
+
+func TestBuild(t *testing.T) {
+	g := build(t)
+	if got, want := g.Unreachable(), []string{"Main.unused", "Main.unused2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unreachable() = %v, want %v", got, want)
+	}
+	if got, want := g.Cycles(), [][]string{{"Main.even", "Main.odd"}, {"Main.fact"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Cycles() = %v, want %v", got, want)
+	}
+	if got, want := g.External(), []string{"Math.multiply", "Output.printInt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("External() = %v, want %v", got, want)
+	}
+	if n := g.Calls["Main.fact"]["Math.multiply"]; n != 2 {
+		t.Errorf("call sites = %d, want 2", n)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	g := build(t)
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\t\"Main.unused\" [style=dashed];\n",
+		"\t\"Math.multiply\" [color=gray, fontcolor=gray];\n",
+		"\t\"Main.fact\" -> \"Math.multiply\" [label=2];\n",
+		"\t\"Main.main\" -> \"Main.even\";\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteDOT() misses %q in\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var jg jsonGraph
+	if err := json.Unmarshal(buf.Bytes(), &jg); err != nil {
+		t.Fatal(err)
+	}
+	if len(jg.Functions) != 6 || len(jg.Cycles) != 2 || jg.Functions[3].Name != "Main.odd" || jg.Functions[3].Calls[0].Callee != "Main.even" {
+		t.Errorf("WriteJSON() = %s", buf.String())
+	}
+}
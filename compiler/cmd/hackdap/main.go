@@ -0,0 +1,18 @@
+// hackdap serves the debug adapter protocol over stdio, debugging .asm, .vm
+// and .jack programs. Launch requests take the program path, the dir of the
+// os .vm files (osDir) and stopOnEntry. The jack classes of a .asm program
+// can be debugged too when it is written by the compiler with -g -asm.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/schattian/nand2tetris/compiler/dap"
+)
+
+func main() {
+	if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,251 @@
+// hackrun runs a hack program without any screen, reporting the cycles it
+// took and the contents of some ram addresses.
+//
+// usage:
+//
+//	hackrun [-cycles n] [-until label] [-ram addr,...] [-report label|function|line] [-profile file]
+//		[-trace file [-ring n]] [-watch addr[..hi][:min..max]] [-keys file]
+//		[-restore file] [-save file [-save-at cycle]] prog.asm|prog.hack
+//
+// Programs run until they reach the -until label of their asm source, or for
+// -cycles otherwise. Measuring the vm functions compiled by projects/08:
+//
+//	hackrun -until Sys.init\$WHILE -ram 0,261 FibonacciElement.asm
+//
+// Programs run pre-decoded, with their hot blocks compiled, unless profiled,
+// traced or watched, which steps through every instruction.
+//
+// Asm programs can be profiled by the labels, vm functions and source lines
+// of their instructions, -report printing the cycles spent by every one and
+// -profile writing a profile for go tool pprof. Source lines are read from
+// the .srcmap.json written next to the program by projects/08:
+//
+//	hackrun -until PongGame.run -report function Pong.asm
+//	hackrun -until PongGame.run -profile pong.pprof Pong.asm
+//	go tool pprof -top -lines pong.pprof
+//
+// -trace records the executed instructions into a file, as JSON lines when it
+// ends in .jsonl or as a binary trace otherwise, keeping only the last -ring
+// ones when set. -watch stops the program on writes into some ram addresses,
+// or of values out of a range, exiting with status 1:
+//
+//	hackrun -watch SCREEN..24575 -watch SP:256..2047 -trace pong.jsonl -ring 1000 Pong.asm
+//
+// -save writes a snapshot of the cpu when the run ends, or when it reaches
+// the -save-at cycle, which -restore resumes from. Snapshots hold the keyboard
+// events of the -keys script still to play, so the runs resumed from them are
+// the same as the runs they were taken from. Cycles count from the start of
+// the program, across snapshots:
+//
+//	hackrun -keys game.keys -cycles 50000000 -save-at 40000000 -save crash.snap Pong.asm
+//	hackrun -restore crash.snap -cycles 50000000 -trace crash.jsonl Pong.asm
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+var (
+	maxCycles = flag.Uint64("cycles", 10000000, "max cycles to run")
+	until     = flag.String("until", "", "stop when reaching the label")
+	ramAddrs  = flag.String("ram", "", "comma separated ram addresses to print")
+	report    = flag.String("report", "", "print the cycles spent by every label, function or line")
+	profile   = flag.String("profile", "", "write a pprof profile of the cycles to the file")
+	trace     = flag.String("trace", "", "write the executed instructions to the file, as json lines if it ends in .jsonl")
+	ring      = flag.Int("ring", 0, "trace only the last n instructions")
+	watch     watchpoints
+	keysFile  = flag.String("keys", "", "keyboard script to play")
+	restore   = flag.String("restore", "", "resume the run from the snapshot")
+	save      = flag.String("save", "", "write a snapshot of the cpu to the file")
+	saveAt    = flag.Uint64("save-at", 0, "write the snapshot at the cycle, instead of at the end")
+)
+
+func init() {
+	flag.Var(&watch, "watch", "stop on writes into addr[..hi], or of values out of min..max with addr[..hi]:min..max")
+}
+
+type watchpoints []hack.Watchpoint
+
+func (ws *watchpoints) String() string {
+	var s []string
+	for _, w := range *ws {
+		s = append(s, w.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func (ws *watchpoints) Set(s string) error {
+	w, err := hack.ParseWatchpoint(s)
+	if err != nil {
+		return err
+	}
+	*ws = append(*ws, w)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: hackrun [-cycles n] [-until label] [-ram addr,...] [-report label|function|line] [-profile file] [-trace file [-ring n]] [-watch addr[..hi][:min..max]] [-keys file] [-restore file] [-save file [-save-at cycle]] prog.asm|prog.hack")
+	}
+	var rom []uint16
+	var prof *hack.Profile
+	var srcmap *hack.SourceMap
+	stop := -1
+	switch filename := flag.Arg(0); filepath.Ext(filename) {
+	case ".asm":
+		p, err := hack.AssembleFile(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rom = p.ROM
+		if *until != "" {
+			addr, ok := p.Labels[*until]
+			if !ok {
+				log.Fatalf("undefined label: %s", *until)
+			}
+			stop = int(addr)
+		}
+		if *report != "" || *profile != "" {
+			prof = hack.NewProfile(p)
+		}
+		srcmap, err = hack.ReadSourceMapFile(strings.TrimSuffix(filename, ".asm") + ".srcmap.json")
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+	case ".hack":
+		if *until != "" || *report != "" || *profile != "" {
+			log.Fatal("-until, -report and -profile need an asm program")
+		}
+		var err error
+		rom, err = hack.ReadROMFile(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown program: %s", filename)
+	}
+	// a-instructions address 15 bits of rom too
+	if len(rom) > hack.MemSize {
+		log.Fatalf("%d instructions don't fit the rom", len(rom))
+	}
+	var addrs []int
+	if *ramAddrs != "" {
+		for _, s := range strings.Split(*ramAddrs, ",") {
+			addr, err := strconv.Atoi(s)
+			if err != nil || addr < 0 || addr >= hack.MemSize {
+				log.Fatalf("invalid ram address: %s", s)
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+
+	cpu := hack.NewCPU(rom)
+	if *restore != "" {
+		snap, err := hack.ReadSnapshotFile(*restore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = cpu.Restore(snap); err != nil {
+			log.Fatalf("%s: %v", *restore, err)
+		}
+	}
+	if *keysFile != "" {
+		var err error
+		if cpu.Keyboard, err = hack.ParseKeyScriptFile(*keysFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	saveSnapshot := func() {
+		if err := hack.WriteSnapshotFile(*save, cpu.Snapshot()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	cpu.Profile = prof
+	cpu.Watchpoints = watch
+	if *trace != "" {
+		f, err := os.Create(*trace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		cpu.Trace = hack.NewTrace(f, filepath.Ext(*trace) == ".jsonl", *ring)
+	}
+	flushTrace := func() {
+		if cpu.Trace == nil {
+			return
+		}
+		if err := cpu.Trace.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var hit *hack.WatchpointError
+	run := func(end uint64) {
+		if cpu.Cycles >= end {
+			return
+		}
+		err := cpu.RunUntil(end-cpu.Cycles, stop)
+		if errors.As(err, &hit) {
+			return
+		}
+		if err != nil {
+			flushTrace()
+			if *save != "" && *saveAt == 0 {
+				saveSnapshot()
+			}
+			log.Fatalf("cycle %d: %v", cpu.Cycles, err)
+		}
+	}
+	if *save != "" && *saveAt > 0 && *saveAt < *maxCycles {
+		run(*saveAt)
+		if hit == nil && cpu.Cycles == *saveAt && int(cpu.PC) != stop {
+			saveSnapshot()
+		}
+	}
+	if hit == nil {
+		run(*maxCycles)
+	}
+	flushTrace()
+	if *save != "" && *saveAt == 0 {
+		saveSnapshot()
+	}
+	if hit == nil && stop >= 0 && int(cpu.PC) != stop {
+		log.Fatalf("%s not reached in %d cycles", *until, *maxCycles)
+	}
+	fmt.Printf("cycles: %d\n", cpu.Cycles)
+	for _, addr := range addrs {
+		fmt.Printf("RAM[%d]: %d\n", addr, cpu.RAM[addr])
+	}
+	if hit != nil {
+		fmt.Println(hit)
+		if m := srcmap.Lookup(hit.PC); m != nil {
+			fmt.Printf("%s:%d: %s\n", m.Module, m.Line, m.Command)
+		}
+		os.Exit(1)
+	}
+	if *report != "" {
+		if err := prof.Report(os.Stdout, *report, srcmap); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *profile != "" {
+		f, err := os.Create(*profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err = prof.WritePprof(f, srcmap); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// hackterm runs a hack program in the terminal, rendering the screen with
+// unicode characters and mapping the keystrokes into the keyboard register.
+//
+// usage:
+//
+//	hackterm [flags] prog.hack|prog.asm|prog.vm|dir
+//
+// A dir holding .jack files is compiled, otherwise its .vm files are loaded.
+// Vm programs link the os classes they don't implement from -os.
+//
+// -record writes the keystrokes as a keyboard script, at the cycles they were
+// pressed and released, which replays the session with -keys. -save writes a
+// snapshot of the emulator on quitting, and -restore resumes from it.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/schattian/nand2tetris/compiler/codegen"
+	"github.com/schattian/nand2tetris/compiler/hack"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+var (
+	hz          = flag.Uint64("hz", 2000000, "instructions (or vm commands) run per second")
+	fps         = flag.Uint64("fps", 30, "screen refreshes per second")
+	renderMode  = flag.String("render", "braille", "screen rendering: braille or halfblock")
+	keysFile    = flag.String("keys", "", "keyboard script to play")
+	osDir       = flag.String("os", "", "dir of the os .vm files")
+	hold        = flag.Duration("hold", 150*time.Millisecond, "time a key is held after its last keystroke")
+	recordFile  = flag.String("record", "", "write the keystrokes as a keyboard script to the file")
+	restoreFile = flag.String("restore", "", "resume from the snapshot")
+	saveFile    = flag.String("save", "", "write a snapshot to the file on quitting")
+)
+
+type emulator struct {
+	ram      *hack.Memory
+	run      func(cycles uint64) error
+	keyboard **hack.KeyScript
+	// cycles returns the instructions (or vm commands) run so far
+	cycles   func() uint64
+	snapshot func() *hack.Snapshot
+	restore  func(s *hack.Snapshot) error
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: hackterm [flags] prog.hack|prog.asm|prog.vm|dir")
+	}
+	render, ok := renderers[*renderMode]
+	if !ok {
+		log.Fatalf("unknown render mode: %s", *renderMode)
+	}
+	if *fps == 0 {
+		log.Fatal("fps must be positive")
+	}
+
+	emu, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *restoreFile != "" {
+		snap, err := hack.ReadSnapshotFile(*restoreFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = emu.restore(snap); err != nil {
+			log.Fatalf("%s: %v", *restoreFile, err)
+		}
+	}
+	if *keysFile != "" {
+		*emu.keyboard, err = hack.ParseKeyScriptFile(*keysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	restore, err := makeRaw()
+	if err != nil {
+		log.Fatalf("makeRaw: %v", err)
+	}
+	rec := &hack.KeyScript{}
+	err = loop(emu, render, rec)
+	restore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *recordFile != "" {
+		if err = writeKeyScript(*recordFile, rec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *saveFile != "" {
+		if err = hack.WriteSnapshotFile(*saveFile, emu.snapshot()); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeKeyScript(filename string, ks *hack.KeyScript) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err = ks.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func load(filename string) (*emulator, error) {
+	switch filepath.Ext(filename) {
+	case ".hack":
+		rom, err := hack.ReadROMFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return cpuEmulator(rom), nil
+	case ".asm":
+		p, err := hack.AssembleFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return cpuEmulator(p.ROM), nil
+	case ".vm":
+		program, err := vm.ParseFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return vmEmulator(program)
+	}
+
+	jackFiles, err := codegen.JackFiles(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(jackFiles) > 0 {
+		classes, err := codegen.CompileDir(filename, codegen.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return vmEmulator(codegen.Program(classes))
+	}
+	program, err := vm.ParseDir(filename)
+	if err != nil {
+		return nil, err
+	}
+	return vmEmulator(program)
+}
+
+func cpuEmulator(rom []uint16) *emulator {
+	cpu := hack.NewCPU(rom)
+	return &emulator{
+		ram:      &cpu.RAM,
+		run:      cpu.Run,
+		keyboard: &cpu.Keyboard,
+		cycles:   func() uint64 { return cpu.Cycles },
+		snapshot: cpu.Snapshot,
+		restore:  cpu.Restore,
+	}
+}
+
+func vmEmulator(program []*vm.Command) (*emulator, error) {
+	if *osDir != "" {
+		lib, err := vm.ParseDir(*osDir)
+		if err != nil {
+			return nil, err
+		}
+		program = vm.AddLibrary(program, lib)
+	}
+	m, err := vm.NewMachine(program)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.Boot(); err != nil {
+		return nil, err
+	}
+	return &emulator{
+		ram:      &m.RAM,
+		run:      m.Run,
+		keyboard: &m.Keyboard,
+		cycles:   func() uint64 { return m.Steps },
+		snapshot: m.Snapshot,
+		restore:  m.Restore,
+	}, nil
+}
+
+// loop runs the emulator until quitting, recording the keystrokes into rec
+func loop(emu *emulator, render func(w *bufio.Writer, ram *hack.Memory), rec *hack.KeyScript) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	keys := readKeys(os.Stdin)
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(w, hideCursor+clearScreen)
+	defer func() {
+		fmt.Fprint(w, showCursor)
+		w.Flush()
+	}()
+
+	ticker := time.NewTicker(time.Second / time.Duration(*fps))
+	defer ticker.Stop()
+	var lastScreen [hack.ScreenSize]int16
+	var lastKey time.Time
+	var halted, held, drawn bool
+	for {
+		select {
+		case <-sig:
+			return nil
+		case key, ok := <-keys:
+			if !ok || key == keyQuit {
+				return nil
+			}
+			emu.ram[hack.Kbd] = key
+			rec.Events = append(rec.Events, hack.KeyEvent{Cycle: emu.cycles(), Key: key})
+			lastKey, held = time.Now(), true
+		case <-ticker.C:
+			if held && time.Since(lastKey) > *hold {
+				emu.ram[hack.Kbd], held = 0, false
+				rec.Events = append(rec.Events, hack.KeyEvent{Cycle: emu.cycles()})
+			}
+			if !halted {
+				err := emu.run(*hz / *fps)
+				if errors.Is(err, vm.ErrHalted) || errors.Is(err, hack.ErrPCOutOfRange) {
+					halted = true
+				} else if err != nil {
+					return err
+				}
+			}
+			var screen [hack.ScreenSize]int16
+			copy(screen[:], emu.ram[hack.Screen:hack.Kbd])
+			if drawn && screen == lastScreen {
+				continue
+			}
+			lastScreen, drawn = screen, true
+			fmt.Fprint(w, cursorHome)
+			render(w, emu.ram)
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
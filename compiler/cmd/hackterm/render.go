@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+const (
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+	clearScreen = "\x1b[2J"
+	cursorHome  = "\x1b[H"
+)
+
+var renderers = map[string]func(w *bufio.Writer, ram *hack.Memory){
+	"braille":   renderBraille,
+	"halfblock": renderHalfBlock,
+}
+
+// brailleDots holds the dot bit of every pixel of a 2x4 braille cell
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// renderBraille draws the screen as 256x64 braille cells
+func renderBraille(w *bufio.Writer, ram *hack.Memory) {
+	for y := 0; y < hack.ScreenHeight; y += 4 {
+		for x := 0; x < hack.ScreenWidth; x += 2 {
+			cell := rune(0x2800)
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					if ram.Pixel(x+dx, y+dy) {
+						cell |= brailleDots[dy][dx]
+					}
+				}
+			}
+			w.WriteRune(cell)
+		}
+		w.WriteString("\r\n")
+	}
+}
+
+// renderHalfBlock draws the screen as 512x128 cells of two stacked pixels
+func renderHalfBlock(w *bufio.Writer, ram *hack.Memory) {
+	for y := 0; y < hack.ScreenHeight; y += 2 {
+		for x := 0; x < hack.ScreenWidth; x++ {
+			top, bottom := ram.Pixel(x, y), ram.Pixel(x, y+1)
+			switch {
+			case top && bottom:
+				w.WriteRune('█')
+			case top:
+				w.WriteRune('▀')
+			case bottom:
+				w.WriteRune('▄')
+			default:
+				w.WriteByte(' ')
+			}
+		}
+		w.WriteString("\r\n")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+const keyQuit int16 = -1
+
+// makeRaw disables the line buffering and echo of the terminal, returning
+// the func that restores its previous state
+func makeRaw() (restore func(), err error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	_, err = stty("-icanon", "-echo", "-ixon", "min", "1")
+	if err != nil {
+		return nil, err
+	}
+	return func() { stty(state) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func readKeys(r io.Reader) <-chan int16 {
+	keys := make(chan int16)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			for _, key := range parseKeys(buf[:n]) {
+				keys <- key
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
+
+var escapeSequences = map[string]int16{
+	"[A": hack.KeyUp, "[B": hack.KeyDown, "[C": hack.KeyRight, "[D": hack.KeyLeft,
+	"OA": hack.KeyUp, "OB": hack.KeyDown, "OC": hack.KeyRight, "OD": hack.KeyLeft,
+	"[H": hack.KeyHome, "OH": hack.KeyHome, "[1~": hack.KeyHome,
+	"[F": hack.KeyEnd, "OF": hack.KeyEnd, "[4~": hack.KeyEnd,
+	"[2~": hack.KeyInsert, "[3~": hack.KeyDelete,
+	"[5~": hack.KeyPageUp, "[6~": hack.KeyPageDown,
+	"OP": hack.KeyF1, "OQ": hack.KeyF1 + 1, "OR": hack.KeyF1 + 2, "OS": hack.KeyF1 + 3,
+	"[15~": hack.KeyF1 + 4, "[17~": hack.KeyF1 + 5, "[18~": hack.KeyF1 + 6, "[19~": hack.KeyF1 + 7,
+	"[20~": hack.KeyF1 + 8, "[21~": hack.KeyF1 + 9, "[23~": hack.KeyF1 + 10, "[24~": hack.KeyF1 + 11,
+}
+
+// parseKeys maps the bytes read from the terminal into hack key codes
+func parseKeys(b []byte) (keys []int16) {
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == 0x1b:
+			seq, ok := matchEscapeSequence(b[i+1:])
+			if !ok {
+				keys = append(keys, hack.KeyEsc)
+				continue
+			}
+			keys = append(keys, escapeSequences[seq])
+			i += len(seq)
+		case c == '\r' || c == '\n':
+			keys = append(keys, hack.KeyNewLine)
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, hack.KeyBackspace)
+		case c == 0x11:
+			keys = append(keys, keyQuit)
+		case c >= ' ' && c < 0x7f:
+			keys = append(keys, int16(c))
+		}
+	}
+	return
+}
+
+func matchEscapeSequence(b []byte) (string, bool) {
+	for seq := range escapeSequences {
+		if strings.HasPrefix(string(b), seq) {
+			return seq, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+func Test_parseKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want []int16
+	}{
+		{name: "printable", b: []byte("aZ "), want: []int16{'a', 'Z', ' '}},
+		{name: "arrows", b: []byte("\x1b[A\x1b[D\x1bOC"), want: []int16{hack.KeyUp, hack.KeyLeft, hack.KeyRight}},
+		{name: "lone esc", b: []byte("\x1b"), want: []int16{hack.KeyEsc}},
+		{name: "enter and backspace", b: []byte("\r\x7f"), want: []int16{hack.KeyNewLine, hack.KeyBackspace}},
+		{name: "function keys", b: []byte("\x1bOP\x1b[24~"), want: []int16{hack.KeyF1, hack.KeyF12}},
+		{name: "quit", b: []byte{0x11}, want: []int16{keyQuit}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseKeys(tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// hacktrace prints the binary traces written by hackrun as JSON lines.
+//
+// usage:
+//
+//	hacktrace [-from cycle] [-pc addr] trace.bin
+//
+// -from skips the instructions executed before the cycle, and -pc prints only
+// the ones at a rom address.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+var (
+	from = flag.Uint64("from", 0, "skip the instructions before the cycle")
+	pc   = flag.Int("pc", -1, "print only the instructions at the rom address")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: hacktrace [-from cycle] [-pc addr] trace.bin")
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	tr, err := hack.NewTraceReader(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	t := hack.NewTrace(os.Stdout, true, 0)
+	for {
+		e, err := tr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if e.Cycle >= *from && (*pc < 0 || int(e.PC) == *pc) {
+			t.Record(e)
+		}
+	}
+	if err = t.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
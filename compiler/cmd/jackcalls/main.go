@@ -0,0 +1,86 @@
+// jackcalls builds the call graph of a jack program, reporting the
+// subroutines unreachable from Main.main and the recursion cycles.
+//
+// usage:
+//
+//	jackcalls [-os dir] [-format text|dot|json] dir
+//
+// The os classes are read as .vm files from the -os dir, so that the graph
+// follows the calls made by the os too. Drawing the graph:
+//
+//	jackcalls -format dot projects/11/Pong | dot -Tsvg > pong.svg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/callgraph"
+	"github.com/schattian/nand2tetris/compiler/codegen"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+var (
+	osDir   = flag.String("os", "", "dir of the .vm files of the os")
+	format  = flag.String("format", "text", "output format: text, dot or json")
+	dialect = flag.Bool("dialect", false, "parse sources using the extensions of the dialect")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: jackcalls [-os dir] [-format text|dot|json] dir")
+	}
+	classes, err := codegen.CompileDir(flag.Arg(0), codegen.Options{Parser: config()})
+	if err != nil {
+		log.Fatal(err)
+	}
+	program := codegen.Program(classes)
+	if *osDir != "" {
+		vmOS, err := vm.ParseDir(*osDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		program = vm.AddLibrary(program, vmOS)
+	}
+	graph := callgraph.Build(program, callgraph.Roots...)
+
+	switch *format {
+	case "text":
+		report("unreachable", graph.Unreachable())
+		var cycles []string
+		for _, cycle := range graph.Cycles() {
+			cycles = append(cycles, strings.Join(cycle, " <-> "))
+		}
+		report("recursion cycles", cycles)
+	case "dot":
+		err = graph.WriteDOT(os.Stdout)
+	case "json":
+		err = graph.WriteJSON(os.Stdout)
+	default:
+		log.Fatalf("unknown format: %s", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func report(title string, lines []string) {
+	fmt.Printf("%s: %d\n", title, len(lines))
+	for _, line := range lines {
+		fmt.Printf("\t%s\n", line)
+	}
+}
+
+// config returns the parser configuration selected by the flags
+func config() parser.Config {
+	if *dialect {
+		return parser.Config{Mode: scanner.ScanDialect}
+	}
+	return parser.Config{}
+}
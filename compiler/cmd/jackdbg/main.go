@@ -0,0 +1,280 @@
+// jackdbg debugs a jack program at the source level.
+//
+// usage:
+//
+//	jackdbg [-os dir] dir
+//
+// Commands:
+//
+//	break|b [file:]line    set a breakpoint
+//	delete|d [file:]line   delete a breakpoint (all if no line is given)
+//	info breakpoints       list the breakpoints
+//	continue|c             run until a breakpoint is reached
+//	step|s                 step into the next line
+//	next|n                 step over the next line
+//	finish                 run until the current subroutine returns
+//	backtrace|bt           print the call stack
+//	frame|f n              select the nth frame of the stack
+//	locals|args|fields|statics
+//	print|p name           print a var of the selected frame
+//	list|l                 print the source around the selected frame
+//	ram addr [n]           print n words of ram starting at addr
+//	quit|q
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/debugger"
+)
+
+var (
+	osDir = flag.String("os", "", "dir of the os .vm files")
+	limit = flag.Uint64("limit", 100000000, "max vm commands run by a single command, 0 meaning no limit")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: jackdbg [-os dir] dir")
+	}
+	s, err := debugger.Load(flag.Arg(0), *osDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repl(&cli{s: s, w: os.Stdout}, os.Stdin)
+}
+
+type cli struct {
+	s     *debugger.Session
+	w     io.Writer
+	frame int
+	file  string
+}
+
+func repl(c *cli, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	var last []string
+	for {
+		fmt.Fprint(c.w, "(jackdbg) ")
+		if !sc.Scan() {
+			return
+		}
+		args := strings.Fields(sc.Text())
+		if len(args) == 0 {
+			args = last
+		}
+		if len(args) == 0 {
+			continue
+		}
+		last = args
+		if args[0] == "quit" || args[0] == "q" {
+			return
+		}
+		if err := c.exec(args); err != nil {
+			fmt.Fprintln(c.w, "error:", err)
+		}
+	}
+}
+
+func (c *cli) exec(args []string) error {
+	switch args[0] {
+	case "break", "b":
+		file, line, err := c.parseLocation(args[1:])
+		if err != nil {
+			return err
+		}
+		n, err := c.s.SetBreakpoint(file, line)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.w, "breakpoint at %s:%d (%d statements)\n", file, line, n)
+	case "delete", "d":
+		if len(args) == 1 {
+			c.s.ClearBreakpoints()
+			return nil
+		}
+		file, line, err := c.parseLocation(args[1:])
+		if err != nil {
+			return err
+		}
+		return c.s.ClearBreakpoint(file, line)
+	case "info":
+		for _, loc := range c.s.Breakpoints() {
+			fmt.Fprintln(c.w, loc)
+		}
+	case "continue", "c":
+		return c.stop(c.s.Continue(*limit))
+	case "step", "s":
+		return c.stop(c.s.StepInto(*limit))
+	case "next", "n":
+		return c.stop(c.s.StepOver(*limit))
+	case "finish":
+		return c.stop(c.s.StepOut(*limit))
+	case "backtrace", "bt":
+		for i, f := range c.s.Stack() {
+			fmt.Fprintf(c.w, "#%d %s at %s\n", i, f.Function, f.Location)
+		}
+	case "frame", "f":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: frame n")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= len(c.s.Stack()) {
+			return fmt.Errorf("no frame %d", n)
+		}
+		c.frame = n
+		c.printFrame()
+	case "locals", "args", "fields", "statics":
+		return c.printVars(map[string]debugger.VarKind{
+			"locals":  debugger.KindLocal,
+			"args":    debugger.KindArg,
+			"fields":  debugger.KindField,
+			"statics": debugger.KindStatic,
+		}[args[0]], "")
+	case "print", "p":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: print name")
+		}
+		return c.printVars("", args[1])
+	case "list", "l":
+		return c.list()
+	case "ram":
+		return c.ram(args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	return nil
+}
+
+// parseLocation parses [file:]line, defaulting to the file being debugged
+func (c *cli) parseLocation(args []string) (file string, line int, err error) {
+	if len(args) != 1 {
+		return "", 0, fmt.Errorf("missing location")
+	}
+	file = c.file
+	lineArg := args[0]
+	if i := strings.LastIndex(lineArg, ":"); i >= 0 {
+		file, lineArg = lineArg[:i], lineArg[i+1:]
+	}
+	if file == "" {
+		return "", 0, fmt.Errorf("missing file")
+	}
+	line, err = strconv.Atoi(lineArg)
+	return
+}
+
+func (c *cli) stop(reason debugger.StopReason, err error) error {
+	if err != nil {
+		return err
+	}
+	c.frame = 0
+	switch reason {
+	case debugger.StopHalted:
+		fmt.Fprintln(c.w, "program ended")
+		return nil
+	case debugger.StopLimit:
+		fmt.Fprintf(c.w, "stopped after %d commands\n", *limit)
+	case debugger.StopBreakpoint:
+		fmt.Fprint(c.w, "breakpoint, ")
+	}
+	c.printFrame()
+	return nil
+}
+
+func (c *cli) printFrame() {
+	stack := c.s.Stack()
+	f := stack[c.frame]
+	fmt.Fprintf(c.w, "%s at %s\n", f.Function, f.Location)
+	if !f.Location.Valid() {
+		return
+	}
+	c.file = f.Location.Debug.File
+	if src := sourceLine(f.Location.Debug.File, f.Location.Line); src != "" {
+		fmt.Fprintf(c.w, "%d\t%s\n", f.Location.Line, src)
+	}
+}
+
+func (c *cli) printVars(kind debugger.VarKind, name string) error {
+	vars, err := c.s.Variables(c.frame)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, v := range vars {
+		if (kind != "" && v.Kind != kind) || (name != "" && v.Name != name) {
+			continue
+		}
+		found = true
+		fmt.Fprintf(c.w, "%s %s %s = %s\n", v.Kind, v.Type, v.Name, v.Display())
+	}
+	if name != "" && !found {
+		return fmt.Errorf("no var %s in scope", name)
+	}
+	return nil
+}
+
+func (c *cli) list() error {
+	f := c.s.Stack()[c.frame]
+	if !f.Location.Valid() {
+		return fmt.Errorf("no source for %s", f.Function)
+	}
+	src, err := os.ReadFile(f.Location.Debug.File)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(src), "\n")
+	for i := f.Location.Line - 5; i <= f.Location.Line+5; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		marker := " "
+		if i == f.Location.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(c.w, "%s%d\t%s\n", marker, i, lines[i-1])
+	}
+	return nil
+}
+
+func (c *cli) ram(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: ram addr [n]")
+	}
+	addr, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	n := 1
+	if len(args) == 2 {
+		if n, err = strconv.Atoi(args[1]); err != nil {
+			return err
+		}
+	}
+	for i := addr; i < addr+n && i >= 0 && i < len(c.s.M.RAM); i++ {
+		fmt.Fprintf(c.w, "RAM[%d] = %d\n", i, c.s.M.RAM[i])
+	}
+	return nil
+}
+
+func sourceLine(filename string, line int) string {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(src), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
@@ -0,0 +1,93 @@
+// jackdoc writes the api reference of jack classes from their /** */ doc
+// comments.
+//
+// usage:
+//
+//	jackdoc [-format html|md] [-o file] dir|file.jack ...
+//
+// The classes of all the given paths are written to a single reference, which
+// links the mentions of each other. For the os:
+//
+//	jackdoc -format md -o API.md projects/12
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/schattian/nand2tetris/compiler/doc"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+)
+
+var (
+	format  = flag.String("format", "html", "output format: html or md")
+	out     = flag.String("o", "", "write the reference to the file instead of stdout")
+	dialect = flag.Bool("dialect", false, "parse sources using the extensions of the dialect")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("no dir or file given")
+	}
+	render := doc.HTML
+	switch *format {
+	case "html":
+	case "md":
+		render = doc.Markdown
+	default:
+		log.Fatalf("unknown format: %s", *format)
+	}
+
+	var classes []*doc.Class
+	for _, path := range flag.Args() {
+		cs, err := parsePath(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		classes = append(classes, cs...)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := render(w, classes); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parsePath(path string) ([]*doc.Class, error) {
+	if filepath.Ext(path) != ".jack" {
+		return doc.ParseDir(path, config())
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	class, err := doc.Parse(src, config())
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return []*doc.Class{class}, nil
+}
+
+// config returns the parser configuration selected by the flags
+func config() parser.Config {
+	if *dialect {
+		return parser.Config{Mode: scanner.ScanDialect}
+	}
+	return parser.Config{}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the hunks turning a into b, based on the longest common
+// subsequence of their lines
+func unifiedDiff(a, b []byte) string {
+	x := splitLines(string(a))
+	y := splitLines(string(b))
+
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = maxInt(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, diffLine{' ', x[i]})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', x[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', y[j]})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	aLine, bLine := 1, 1
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			aLine++
+			bLine++
+			start++
+			continue
+		}
+		// extend the hunk while changes are closer than twice the context
+		from := maxInt(start-diffContext, 0)
+		end := start
+		for k := start; k < len(lines) && k-end <= 2*diffContext; k++ {
+			if lines[k].kind != ' ' {
+				end = k + 1
+			}
+		}
+		to := minInt(end+diffContext, len(lines))
+
+		aStart, bStart := aLine-(start-from), bLine-(start-from)
+		var aLen, bLen int
+		for _, l := range lines[from:to] {
+			if l.kind != '+' {
+				aLen++
+			}
+			if l.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, l := range lines[from:to] {
+			sb.WriteByte(l.kind)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		for _, l := range lines[start:to] {
+			if l.kind != '+' {
+				aLine++
+			}
+			if l.kind != '-' {
+				bLine++
+			}
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,114 @@
+// jackfmt formats jack classes.
+//
+// usage:
+//
+//	jackfmt [-l] [-d] [-w] [-dialect] [path ...]
+//
+// Without paths it formats the standard input. Directories are walked for
+// .jack files. Checking a tree in CI:
+//
+//	test -z "$(jackfmt -l dir)"
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/schattian/nand2tetris/compiler/format"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+)
+
+var (
+	list    = flag.Bool("l", false, "list the files whose formatting differs from jackfmt's")
+	diff    = flag.Bool("d", false, "print the diffs instead of the formatted sources")
+	write   = flag.Bool("w", false, "write the result to the source file instead of stdout")
+	dialect = flag.Bool("dialect", false, "format sources using the extensions of the dialect")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		if *write {
+			log.Fatal("cannot use -w with standard input")
+		}
+		if err := process("<standard input>", os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		err := filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (filename != path && filepath.Ext(filename) != ".jack") {
+				return nil
+			}
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := process(filename, f); err != nil {
+				log.Print(err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(2)
+	}
+}
+
+func process(filename string, r io.Reader) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	res, err := format.Source(src, config())
+	if err != nil {
+		return fmt.Errorf("%s:%w", filename, err)
+	}
+	if !*list && !*diff && !*write {
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if *list {
+		fmt.Println(filename)
+	}
+	if *write {
+		if err := os.WriteFile(filename, res, 0644); err != nil {
+			return err
+		}
+	}
+	if *diff {
+		fmt.Printf("--- %s\n+++ %s (formatted)\n", filename, filename)
+		os.Stdout.WriteString(unifiedDiff(src, res))
+	}
+	return nil
+}
+
+// config returns the parser configuration selected by the flags
+func config() parser.Config {
+	if *dialect {
+		return parser.Config{Mode: scanner.ScanDialect}
+	}
+	return parser.Config{}
+}
@@ -0,0 +1,15 @@
+// jacklsp serves the language server protocol for jack over stdio.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/schattian/nand2tetris/compiler/lsp"
+)
+
+func main() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
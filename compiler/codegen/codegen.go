@@ -0,0 +1,588 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/parse/symbol"
+	"github.com/schattian/nand2tetris/compiler/token"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+type generator struct {
+	opts      Options
+	className string
+	class     *symbol.Table
+	local     *symbol.Table
+
+	fnName  string
+	labelSz int
+	line    int
+
+	cmds  []*vm.Command
+	debug *Debug
+}
+
+type Class struct {
+	Name     string
+	Commands []*vm.Command
+	Debug    *Debug
+}
+
+// Options configure the compilation of the classes
+type Options struct {
+	// Parser configures the parsing of the files compiled by CompileFile and
+	// CompileDir
+	Parser parser.Config
+	// Optimize enables constant folding and strength reduction
+	Optimize bool
+	// Extended emits the operations out of the standard vm: mul and div
+	// instead of calling Math.multiply and Math.divide, and indirect accesses
+	// to arrays
+	Extended bool
+}
+
+// Compile generates the vm commands of the class held by the given tree
+func Compile(tree *parse.Tree, opts Options) (class *Class, err error) {
+	if tree.Root == nil || tree.Root.Type() != parse.NodeClass {
+		return nil, fmt.Errorf("tree root is not a class")
+	}
+	g := &generator{opts: opts, class: symbol.NewTable(), debug: &Debug{}}
+	defer func() {
+		if r := recover(); r != nil {
+			genErr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = genErr
+		}
+	}()
+	g.compileClass(tree.Root)
+	vm.SetModule(g.cmds, g.className)
+	g.debug.Class = g.className
+	return &Class{Name: g.className, Commands: g.cmds, Debug: g.debug}, nil
+}
+
+// Program joins the commands of the given classes
+func Program(classes []*Class) (cmds []*vm.Command) {
+	for _, class := range classes {
+		cmds = append(cmds, class.Commands...)
+	}
+	return
+}
+
+// SetROM sets the rom address of every command of the classes, given the ones
+// returned by vm.Translate for the program translated from them
+func SetROM(classes []*Class, addrs []int) {
+	for _, class := range classes {
+		n := len(class.Commands)
+		class.Debug.ROM, addrs = addrs[:n+1], addrs[n:]
+	}
+}
+
+// Prune removes the subroutines for which keep returns false, along with
+// their debug info
+func (c *Class) Prune(keep func(fn string) bool) {
+	var cmds []*vm.Command
+	debug := *c.Debug
+	debug.Lines, debug.Stmts, debug.Subroutines = nil, nil, nil
+	for _, sub := range c.Debug.Subroutines {
+		if !keep(sub.Name) {
+			continue
+		}
+		offset := len(cmds) - sub.Start
+		cmds = append(cmds, c.Commands[sub.Start:sub.End]...)
+		debug.Lines = append(debug.Lines, c.Debug.Lines[sub.Start:sub.End]...)
+		for _, stmt := range c.Debug.Stmts {
+			if stmt >= sub.Start && stmt < sub.End {
+				debug.Stmts = append(debug.Stmts, stmt+offset)
+			}
+		}
+		sub.Start += offset
+		sub.End += offset
+		debug.Subroutines = append(debug.Subroutines, sub)
+	}
+	c.Commands, c.Debug = cmds, &debug
+}
+
+type Error struct {
+	Class string
+	Fn    string
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	if e.Fn != "" {
+		return fmt.Sprintf("%s.%s: %s", e.Class, e.Fn, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Class, e.Msg)
+}
+
+func (g *generator) errorf(format string, args ...interface{}) {
+	panic(&Error{Class: g.className, Fn: g.fnName, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (g *generator) emit(cmd *vm.Command) {
+	g.cmds = append(g.cmds, cmd)
+	g.debug.Lines = append(g.debug.Lines, g.line)
+}
+
+func (g *generator) newLabel(prefix string) string {
+	label := fmt.Sprintf("%s%d", prefix, g.labelSz)
+	g.labelSz += 1
+	return label
+}
+
+func (g *generator) compileClass(n parse.Node) {
+	children := n.Children()
+	g.className = children[1].Token().Literal
+	for _, child := range children[3:] {
+		switch child.Type() {
+		case parse.NodeClassVarDec:
+			if child.Children()[0].Token().Is(token.FIELD) {
+				g.debug.Fields = append(g.debug.Fields, g.declare(g.class, child, symbol.KIND_FIELD)...)
+			} else {
+				g.debug.Statics = append(g.debug.Statics, g.declare(g.class, child, symbol.KIND_STATIC)...)
+			}
+		case parse.NodeSubroutineDec:
+			g.compileSubroutine(child)
+		}
+	}
+}
+
+// declare adds every var of a declaration like `kind type name (, name)* ;`
+func (g *generator) declare(t *symbol.Table, n parse.Node, kind symbol.Kind) (vars []Var) {
+	children := n.Children()
+	typ := children[1].Token()
+	for _, child := range children[2:] {
+		if child.Token().Is(token.IDENT) {
+			vars = append(vars, addSymbol(t, child.Token().Literal, kind, typ))
+		}
+	}
+	return
+}
+
+func addSymbol(t *symbol.Table, name string, kind symbol.Kind, typ *parse.Token) Var {
+	s := t.Add(name, kind, symbolType(typ))
+	if s.Type == symbol.TYPE_CLASS_NAME {
+		s.ClassName = typ.Literal
+	}
+	return Var{Name: name, Type: typ.Literal, Index: s.Index}
+}
+
+func symbolType(typ *parse.Token) symbol.Type {
+	switch typ.Token {
+	case token.INT:
+		return symbol.TYPE_INT
+	case token.CHAR:
+		return symbol.TYPE_CHAR
+	case token.BOOLEAN:
+		return symbol.TYPE_BOOLEAN
+	}
+	return symbol.TYPE_CLASS_NAME
+}
+
+func (g *generator) compileSubroutine(n parse.Node) {
+	children := n.Children()
+	kind := children[0].Token().Token
+	g.fnName = children[2].Token().Literal
+	g.local = symbol.NewTable()
+	g.labelSz = 0
+	g.line = children[0].Token().Pos.Line
+	sub := &Subroutine{
+		Name:  g.className + "." + g.fnName,
+		Kind:  children[0].Token().Literal,
+		Line:  g.line,
+		Start: len(g.cmds),
+	}
+	g.debug.Subroutines = append(g.debug.Subroutines, sub)
+
+	if kind == token.METHOD {
+		g.local.Add("this", symbol.KIND_ARG, symbol.TYPE_CLASS_NAME).ClassName = g.className
+		sub.Args = append(sub.Args, Var{Name: "this", Type: g.className})
+	}
+	var body parse.Node
+	for _, child := range children[3:] {
+		switch child.Type() {
+		case parse.NodeParameterList:
+			sub.Args = append(sub.Args, g.compileParameterList(child)...)
+		case parse.NodeSubroutineBody:
+			body = child
+		}
+	}
+	for _, child := range body.Children() {
+		if child.Type() == parse.NodeVarDec {
+			sub.Locals = append(sub.Locals, g.declare(g.local, child, symbol.KIND_LOCAL)...)
+		}
+	}
+
+	g.emit(vm.NewFunctionCommand(g.className+"."+g.fnName, uint16(g.local.Count(symbol.KIND_LOCAL))))
+	switch kind {
+	case token.CONSTRUCTOR:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(g.class.Count(symbol.KIND_FIELD))))
+		g.emit(vm.NewCallCommand("Memory.alloc", 1))
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegPointer, 0))
+	case token.METHOD:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegArg, 0))
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegPointer, 0))
+	}
+	g.compileStatements(body.Children())
+	sub.End = len(g.cmds)
+	g.fnName = ""
+}
+
+func (g *generator) compileParameterList(n parse.Node) (vars []Var) {
+	var typ *parse.Token
+	for _, child := range n.Children() {
+		tok := child.Token()
+		if tok.Is(token.COMMA) {
+			continue
+		}
+		if typ == nil {
+			typ = tok
+			continue
+		}
+		vars = append(vars, addSymbol(g.local, tok.Literal, symbol.KIND_ARG, typ))
+		typ = nil
+	}
+	return
+}
+
+func (g *generator) compileStatements(nodes []parse.Node) {
+	line := g.line
+	defer func() { g.line = line }()
+	for _, n := range nodes {
+		if !isStatement(n) {
+			continue
+		}
+		g.line = n.Children()[0].Token().Pos.Line
+		g.debug.Stmts = append(g.debug.Stmts, len(g.cmds))
+		switch n.Type() {
+		case parse.NodeLetStatement:
+			g.compileLet(n)
+		case parse.NodeIfStatement:
+			g.compileIf(n)
+		case parse.NodeWhileStatement:
+			g.compileWhile(n)
+		case parse.NodeForStatement:
+			g.compileFor(n)
+		case parse.NodeDoStatement:
+			g.compileSubroutineCall(n.Children()[1])
+			g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegTemp, 0))
+		case parse.NodeReturnStatement:
+			g.compileReturn(n)
+		}
+	}
+}
+
+func isStatement(n parse.Node) bool {
+	switch n.Type() {
+	case parse.NodeLetStatement, parse.NodeIfStatement, parse.NodeWhileStatement, parse.NodeDoStatement, parse.NodeReturnStatement, parse.NodeForStatement:
+		return true
+	}
+	return false
+}
+
+func (g *generator) compileLet(n parse.Node) {
+	children := n.Children()
+	g.compileAssignment(children[1 : len(children)-1])
+}
+
+// compileAssignment compiles `name ([ index ])? op value`, where a compound
+// assignment like += applies its operator to the current value
+func (g *generator) compileAssignment(nodes []parse.Node) {
+	name := nodes[0].Token().Literal
+	op := nodes[len(nodes)-2].Token().Token
+	value := nodes[len(nodes)-1]
+	if !nodes[1].Token().Is(token.LBRACK) {
+		if op != token.EQ {
+			g.emit(g.access(vm.OpPush, name))
+		}
+		g.compileExpression(value)
+		if op != token.EQ {
+			g.emit(g.binaryOp(token.CompoundOperator(op)))
+		}
+		g.emit(g.access(vm.OpPop, name))
+		return
+	}
+	// let name[index] = value
+	g.emit(g.access(vm.OpPush, name))
+	g.compileExpression(nodes[2])
+	g.emit(vm.NewArithmeticCommand(vm.OpAdd))
+	if g.opts.Extended {
+		if op != token.EQ {
+			g.emit(vm.NewArithmeticCommand(vm.OpDup))
+			g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegIndirect, 0))
+		}
+		g.compileExpression(value)
+		if op != token.EQ {
+			g.emit(g.binaryOp(token.CompoundOperator(op)))
+		}
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegIndirect, 0))
+		return
+	}
+	if op != token.EQ {
+		// keeps the address while reading the element
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegPointer, 1))
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegPointer, 1))
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegThat, 0))
+	}
+	g.compileExpression(value)
+	if op != token.EQ {
+		g.emit(g.binaryOp(token.CompoundOperator(op)))
+	}
+	g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegTemp, 0))
+	g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegPointer, 1))
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegTemp, 0))
+	g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegThat, 0))
+}
+
+func (g *generator) compileIf(n parse.Node) {
+	children := n.Children()
+	elseLabel, endLabel := g.newLabel("IF_ELSE"), g.newLabel("IF_END")
+	g.compileExpression(children[2])
+	g.emit(vm.NewArithmeticCommand(vm.OpNot))
+	g.emit(vm.NewFlowControlCommand(vm.OpIfGoto, elseLabel))
+
+	// if ( expr ) { stmts } else { stmts }
+	thenEnd := 5
+	for !children[thenEnd].Token().Is(token.RBRACE) {
+		thenEnd += 1
+	}
+	g.compileStatements(children[5:thenEnd])
+	g.emit(vm.NewFlowControlCommand(vm.OpGoto, endLabel))
+	g.emit(vm.NewFlowControlCommand(vm.OpLabel, elseLabel))
+	g.compileStatements(children[thenEnd+1:])
+	g.emit(vm.NewFlowControlCommand(vm.OpLabel, endLabel))
+}
+
+func (g *generator) compileWhile(n parse.Node) {
+	children := n.Children()
+	expLabel, endLabel := g.newLabel("WHILE_EXP"), g.newLabel("WHILE_END")
+	g.emit(vm.NewFlowControlCommand(vm.OpLabel, expLabel))
+	g.compileExpression(children[2])
+	g.emit(vm.NewArithmeticCommand(vm.OpNot))
+	g.emit(vm.NewFlowControlCommand(vm.OpIfGoto, endLabel))
+	g.compileStatements(children[5:])
+	g.emit(vm.NewFlowControlCommand(vm.OpGoto, expLabel))
+	g.emit(vm.NewFlowControlCommand(vm.OpLabel, endLabel))
+}
+
+// compileFor compiles `for (init; cond; post) { stmts }` as init followed by
+// a while loop running stmts and post
+func (g *generator) compileFor(n parse.Node) {
+	var cond, post parse.Node
+	for _, child := range n.Children() {
+		switch {
+		case child.Type() == parse.NodeExpression:
+			cond = child
+		case child.Type() == parse.NodeAssignment && cond == nil:
+			g.compileAssignment(child.Children())
+		case child.Type() == parse.NodeAssignment:
+			post = child
+		}
+	}
+	expLabel, endLabel := g.newLabel("FOR_EXP"), g.newLabel("FOR_END")
+	g.emit(vm.NewFlowControlCommand(vm.OpLabel, expLabel))
+	g.compileExpression(cond)
+	g.emit(vm.NewArithmeticCommand(vm.OpNot))
+	g.emit(vm.NewFlowControlCommand(vm.OpIfGoto, endLabel))
+	g.compileStatements(n.Children())
+	if post != nil {
+		g.compileAssignment(post.Children())
+	}
+	g.emit(vm.NewFlowControlCommand(vm.OpGoto, expLabel))
+	g.emit(vm.NewFlowControlCommand(vm.OpLabel, endLabel))
+}
+
+func (g *generator) compileReturn(n parse.Node) {
+	children := n.Children()
+	if children[1].Type() == parse.NodeExpression {
+		g.compileExpression(children[1])
+	} else {
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 0))
+	}
+	g.emit(vm.NewReturnCommand())
+}
+
+var binaryOps = map[token.Token]vm.Operation{
+	token.ADD: vm.OpAdd,
+	token.SUB: vm.OpSub,
+	token.AND: vm.OpAnd,
+	token.OR:  vm.OpOr,
+	token.LT:  vm.OpLt,
+	token.GT:  vm.OpGt,
+	token.EQ:  vm.OpEq,
+}
+
+func (g *generator) binaryOp(op token.Token) *vm.Command {
+	switch {
+	case g.opts.Extended && op == token.MUL:
+		return vm.NewArithmeticCommand(vm.OpMul)
+	case g.opts.Extended && op == token.DIV:
+		return vm.NewArithmeticCommand(vm.OpDiv)
+	}
+	switch op {
+	case token.MUL:
+		return vm.NewCallCommand("Math.multiply", 2)
+	case token.DIV:
+		return vm.NewCallCommand("Math.divide", 2)
+	}
+	return vm.NewArithmeticCommand(binaryOps[op])
+}
+
+func (g *generator) compileExpression(n parse.Node) {
+	children := n.Children()
+	if g.opts.Optimize {
+		g.compileOptimized(children)
+		return
+	}
+	g.compileOperand(children[0])
+	for i := 1; i+1 < len(children); i += 2 {
+		g.compileOperand(children[i+1])
+		g.emit(g.binaryOp(children[i].Token().Token))
+	}
+}
+
+// compileOperand compiles a term, or the nested expression of operators with
+// higher precedence of the dialect
+func (g *generator) compileOperand(n parse.Node) {
+	if n.Type() == parse.NodeExpression {
+		g.compileExpression(n)
+		return
+	}
+	g.compileTerm(n)
+}
+
+func (g *generator) compileTerm(n parse.Node) {
+	children := n.Children()
+	first := children[0]
+	if first.Type() == parse.NodeSubroutineCall {
+		g.compileSubroutineCall(first)
+		return
+	}
+
+	tok := first.Token()
+	switch tok.Token {
+	case token.INTEGER_CONST, token.CHAR_CONST:
+		g.compileIntConst(tok)
+	case token.STRING_CONST:
+		g.compileStringConst(tok.Literal)
+	case token.TRUE:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 0))
+		g.emit(vm.NewArithmeticCommand(vm.OpNot))
+	case token.FALSE, token.NULL:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 0))
+	case token.THIS:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegPointer, 0))
+	case token.LPAREN:
+		g.compileExpression(children[1])
+	case token.SUB, token.NOT:
+		g.compileTerm(children[1])
+		if tok.Is(token.SUB) {
+			g.emit(vm.NewArithmeticCommand(vm.OpNeg))
+		} else {
+			g.emit(vm.NewArithmeticCommand(vm.OpNot))
+		}
+	case token.IDENT:
+		g.emit(g.access(vm.OpPush, tok.Literal))
+		if len(children) > 1 {
+			// name[index]
+			g.compileExpression(children[2])
+			g.emit(vm.NewArithmeticCommand(vm.OpAdd))
+			if g.opts.Extended {
+				g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegIndirect, 0))
+				break
+			}
+			g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegPointer, 1))
+			g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegThat, 0))
+		}
+	default:
+		g.errorf("unexpected term: %s", tok.Literal)
+	}
+}
+
+func (g *generator) compileIntConst(tok *parse.Token) {
+	i, err := tok.IntValue()
+	if err != nil {
+		g.errorf("integer constant out of range: %s", tok.Literal)
+	}
+	if i > 32767 {
+		// only reachable by hex constants, pushed as the negation of their
+		// complement
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(0xffff-i)))
+		g.emit(vm.NewArithmeticCommand(vm.OpNot))
+		return
+	}
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(i)))
+}
+
+func (g *generator) compileStringConst(lit string) {
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(len(lit))))
+	g.emit(vm.NewCallCommand("String.new", 1))
+	for _, c := range []byte(lit) {
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(c)))
+		g.emit(vm.NewCallCommand("String.appendChar", 2))
+	}
+}
+
+func (g *generator) compileSubroutineCall(n parse.Node) {
+	children := n.Children()
+	var fnName string
+	var argSz uint16
+	var rest []parse.Node
+	if children[1].Token().Is(token.DOT) {
+		receiver, name := children[0].Token().Literal, children[2].Token().Literal
+		rest = children[3:]
+		if s := g.lookup(receiver); s != nil {
+			if s.Type != symbol.TYPE_CLASS_NAME {
+				g.errorf("%s is not an object", receiver)
+			}
+			g.emit(g.access(vm.OpPush, receiver))
+			fnName, argSz = s.ClassName+"."+name, 1
+		} else {
+			fnName = receiver + "." + name
+		}
+	} else {
+		// method called on this
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegPointer, 0))
+		fnName, argSz = g.className+"."+children[0].Token().Literal, 1
+		rest = children[1:]
+	}
+
+	for _, child := range rest {
+		if child.Type() != parse.NodeExpressionList {
+			continue
+		}
+		for _, expr := range child.Children() {
+			if expr.Type() == parse.NodeExpression {
+				g.compileExpression(expr)
+				argSz += 1
+			}
+		}
+	}
+	g.emit(vm.NewCallCommand(fnName, argSz))
+}
+
+func (g *generator) lookup(name string) *symbol.Symbol {
+	if s := g.local.Get(name); s != nil {
+		return s
+	}
+	return g.class.Get(name)
+}
+
+var kindSegments = map[symbol.Kind]vm.Segment{
+	symbol.KIND_FIELD:  vm.SegThis,
+	symbol.KIND_STATIC: vm.SegStatic,
+	symbol.KIND_LOCAL:  vm.SegLcl,
+	symbol.KIND_ARG:    vm.SegArg,
+}
+
+func (g *generator) access(op vm.Operation, name string) *vm.Command {
+	s := g.lookup(name)
+	if s == nil {
+		g.errorf("undefined variable: %s", name)
+	}
+	return vm.NewAccessCommand(op, kindSegments[s.Kind], uint16(s.Index))
+}
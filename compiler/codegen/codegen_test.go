@@ -0,0 +1,286 @@
+package codegen
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+// readCmp parses the RAM[addr] columns of a .cmp file
+func readCmp(t *testing.T, filename string) map[int]int16 {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	var rows [][]string
+	for s.Scan() {
+		rows = append(rows, strings.Split(strings.Trim(s.Text(), "|"), "|"))
+	}
+	want := make(map[int]int16)
+	for i, col := range rows[0] {
+		addr, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(col), "RAM["), "]"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(rows[1][i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[addr] = int16(v)
+	}
+	return want
+}
+
+func TestCompile_OSTests(t *testing.T) {
+	vmOS, err := vm.ParseDir("../../tools/OS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		"ArrayTest", "MathTest", "MemoryTest",
+		"ArrayTest-O", "MathTest-O", "MemoryTest-O",
+		"ArrayTest-X", "MathTest-OX", "MemoryTest-X",
+	} {
+		t.Run(name, func(t *testing.T) {
+			name, flags := name, ""
+			if i := strings.Index(name, "-"); i >= 0 {
+				name, flags = name[:i], name[i+1:]
+			}
+			opts := Options{Optimize: strings.Contains(flags, "O"), Extended: strings.Contains(flags, "X")}
+			dir := "../../projects/12/" + name
+			classes, err := CompileDir(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := vm.NewMachine(vm.AddLibrary(Program(classes), vmOS))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = m.Boot(); err != nil {
+				t.Fatal(err)
+			}
+			// unlike the supplied emulator, the os runs as vm code instead of builtins
+			if err = m.Run(10000000); err != nil {
+				t.Fatal(err)
+			}
+			for addr, want := range readCmp(t, dir+"/"+name+".cmp") {
+				if got := m.RAM[addr]; got != want {
+					t.Errorf("RAM[%d] = %d, want %d", addr, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompile_ConvertToBin(t *testing.T) {
+	vmOS, err := vm.ParseDir("../../tools/OS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes, err := CompileDir("../../projects/11/ConvertToBin", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := vm.NewMachine(vm.AddLibrary(Program(classes), vmOS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	const value = 0b0110_0000_1010_0011
+	m.RAM[8000] = value
+	if err = m.Run(10000000); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 16; i++ {
+		want := int16(value >> i & 1)
+		if got := m.RAM[8001+i]; got != want {
+			t.Errorf("RAM[%d] = %d, want %d", 8001+i, got, want)
+		}
+	}
+}
+
+const dialectSrc = `class Main {
+    function void main() {
+        var Array a;
+        var int i, sum;
+        let a = 8000;
+        let a[0] = 2 + 3 * 4;
+        let a[1] = (2 + 3) * 4;
+        let a[2] = 1 + 2 < 4 & (3 > 2);
+        let a[3] = 'A';
+        let a[4] = 0x7FFF;
+        let a[5] = 0xFFFF;
+        for (i = 0; i < 5; i += 1) {
+            let sum += i;
+        }
+        let a[6] = sum;
+        let a[7] = 10;
+        let a[7] *= 3;
+        let a[7] -= 1;
+        if (sum < 5) {
+            let a[8] = 1;
+        } else if (sum < 20) {
+            let a[8] = 2;
+        } else {
+            let a[8] = 3;
+        }
+        let a[9] = 20 - 16 / 4 / 2 - 1;
+        let a[10] = '\'';
+        return;
+    }
+}
+`
+
+func TestCompile_Dialect(t *testing.T) {
+	vmOS, err := vm.ParseDir("../../tools/OS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.NewBackend([]byte(dialectSrc), scanner.ScanDialect, parser.SchemaBackend)
+	tree := p.ParseTree()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+	class, err := Compile(tree, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := vm.NewMachine(vm.AddLibrary(Program([]*Class{class}), vmOS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Run(10000000); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int16{14, 20, -1, 'A', 32767, -1, 10, 29, 2, 17, '\''} {
+		if got := m.RAM[8000+i]; got != want {
+			t.Errorf("RAM[%d] = %d, want %d", 8000+i, got, want)
+		}
+	}
+}
+
+const optimizeSrc = `class Main {
+    function void main() {
+        var Array a;
+        var int x;
+        let a = 8000;
+        let x = 7;
+        let a[0] = 3 + 4 * x;
+        let a[1] = x * 2;
+        let a[2] = x * -3;
+        let a[3] = 5 * x - 1;
+        let a[4] = x * 0 + 1;
+        let a[5] = (x + 1) / 1 - (-x / -1);
+        let a[6] = x * 1000;
+        let a[7] = x * 12345;
+        let a[8] = (1 < 2) & ~(3 = 4) | 0;
+        let a[9] = -32767 - 1;
+        let a[10] = x / 16;
+        let a[11] = (2 * 3) * (x * 16) + 0;
+        let a[12] = -x / 4;
+        let a[13] = x / -2;
+        let a[14] = (x - 100) / 8;
+        let a[15] = (x * 4000) / 32;
+        let a[16] = (x - x - 32767 - 1) / 2;
+        let a[17] = (x * 4000) / 16384;
+        return;
+    }
+}
+`
+
+func TestCompile_Optimize(t *testing.T) {
+	vmOS, err := vm.ParseDir("../../tools/OS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results [4][]int16
+	var multiplies, divides [4]int
+	for i, flags := range [][2]bool{{false, false}, {true, false}, {false, true}, {true, true}} {
+		tree := parser.Config{}.New([]byte(optimizeSrc)).ParseTree()
+		class, err := Compile(tree, Options{Optimize: flags[0], Extended: flags[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		multiplies[i] = vm.CallCounts(class.Commands)["Math.multiply"]
+		divides[i] = vm.CallCounts(class.Commands)["Math.divide"]
+		for _, cmd := range class.Commands {
+			if cmd.Op() == vm.OpDiv {
+				divides[i]++
+			}
+		}
+		m, err := vm.NewMachine(vm.AddLibrary(Program([]*Class{class}), vmOS))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = m.Boot(); err != nil {
+			t.Fatal(err)
+		}
+		if err = m.Run(10000000); err != nil {
+			t.Fatal(err)
+		}
+		results[i] = append([]int16(nil), m.RAM[8000:8018]...)
+	}
+	for i := 1; i < len(results); i++ {
+		if !reflect.DeepEqual(results[i], results[0]) {
+			t.Errorf("results %d = %v, want %v", i, results[i], results[0])
+		}
+	}
+	if multiplies != [4]int{12, 1, 0, 0} {
+		t.Errorf("Math.multiply calls = %v, want [12 1 0 0]", multiplies)
+	}
+	if divides != [4]int{9, 0, 9, 0} {
+		t.Errorf("divisions = %v, want [9 0 9 0]", divides)
+	}
+}
+
+func TestClass_Prune(t *testing.T) {
+	src := `class Main {
+    function void unused() { do Output.printInt(1); return; }
+    function void main() { do Main.f(); return; }
+    function void f() { var int i; let i = 1; return; }
+}`
+	class, err := Compile(parser.Config{}.New([]byte(src)).ParseTree(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, cmd := range class.Commands[class.Debug.Subroutines[1].Start:] {
+		want = append(want, cmd.String())
+	}
+	wantLines := append([]int(nil), class.Debug.Lines[class.Debug.Subroutines[1].Start:]...)
+
+	class.Prune(func(fn string) bool { return fn != "Main.unused" })
+	var got []string
+	for _, cmd := range class.Commands {
+		got = append(got, cmd.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pruned commands = %q, want %q", got, want)
+	}
+	d := class.Debug
+	if !reflect.DeepEqual(d.Lines, wantLines) {
+		t.Errorf("pruned lines = %v, want %v", d.Lines, wantLines)
+	}
+	if len(d.Subroutines) != 2 || d.Subroutines[0].Start != 0 || d.Subroutines[1].Start != d.Subroutines[0].End || d.Subroutines[1].End != len(got) {
+		t.Errorf("pruned subroutines = %+v", d.Subroutines)
+	}
+	if !reflect.DeepEqual(d.Stmts, []int{1, 3, 6, 8}) {
+		t.Errorf("pruned stmts = %v", d.Stmts)
+	}
+}
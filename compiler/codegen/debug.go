@@ -0,0 +1,55 @@
+package codegen
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Debug links the vm commands of a compiled class back to its jack source.
+// Commands are referenced by their index, which is their 0-based line in the
+// .vm file as written by vm.Write
+type Debug struct {
+	File  string `json:"file"`
+	Class string `json:"class"`
+	// Lines holds the jack line of every command
+	Lines []int `json:"lines"`
+	// Stmts holds the first command of every statement, sorted
+	Stmts []int `json:"stmts"`
+	// ROM holds the rom address of every command followed by the end of the
+	// last one, once the program is translated to hack assembly
+	ROM []int `json:"rom,omitempty"`
+
+	Fields      []Var         `json:"fields,omitempty"`
+	Statics     []Var         `json:"statics,omitempty"`
+	Subroutines []*Subroutine `json:"subroutines"`
+}
+
+type Subroutine struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Line int    `json:"line"`
+	// Start and End delimit the commands of the subroutine
+	Start int `json:"start"`
+	End   int `json:"end"`
+
+	Args   []Var `json:"args,omitempty"`
+	Locals []Var `json:"locals,omitempty"`
+}
+
+type Var struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+func (d *Debug) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+func ReadDebug(r io.Reader) (*Debug, error) {
+	d := &Debug{}
+	err := json.NewDecoder(r).Decode(d)
+	return d, err
+}
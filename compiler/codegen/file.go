@@ -0,0 +1,53 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func CompileFile(filename string, opts Options) (*Class, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := opts.Parser.New(src)
+	tree := p.ParseTree()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s:%w", filename, errs[0])
+	}
+	class, err := Compile(tree, opts)
+	if err != nil {
+		return nil, err
+	}
+	class.Debug.File = filename
+	return class, nil
+}
+
+// JackFiles lists the .jack files of the given dir sorted by name
+func JackFiles(dirname string) ([]string, error) {
+	filenames, err := filepath.Glob(filepath.Join(dirname, "*.jack"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// CompileDir compiles every class of the given dir
+func CompileDir(dirname string, opts Options) ([]*Class, error) {
+	filenames, err := JackFiles(dirname)
+	if err != nil {
+		return nil, err
+	}
+	var classes []*Class
+	for _, filename := range filenames {
+		class, err := CompileFile(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
@@ -0,0 +1,296 @@
+package codegen
+
+import (
+	"math/bits"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/token"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+// maxAdditions bounds the doublings and additions of an inlined
+// multiplication, above which calling Math.multiply is cheaper
+const maxAdditions = 16
+
+// compileOptimized compiles an expression folding its constant operands and
+// replacing multiplications by constants with additions, and divisions by
+// powers of two with bit tests, or shifts when extended
+func (g *generator) compileOptimized(nodes []parse.Node) {
+	v, constant := constValue(nodes[0])
+	i := 1
+	for ; constant && i+1 < len(nodes); i += 2 {
+		y, ok := constValue(nodes[i+1])
+		if ok {
+			y, ok = fold(nodes[i].Token().Token, v, y)
+		}
+		if !ok {
+			break
+		}
+		v = y
+	}
+
+	switch {
+	case !constant:
+		g.compileOperand(nodes[0])
+	case i+1 < len(nodes) && nodes[i].Token().Is(token.MUL) && multipliable(v):
+		// c * x is compiled as x * c
+		g.compileOperand(nodes[i+1])
+		g.multiply(v)
+		i += 2
+	default:
+		g.pushConst(v)
+	}
+
+	for ; i+1 < len(nodes); i += 2 {
+		op := nodes[i].Token().Token
+		if y, ok := constValue(nodes[i+1]); ok && g.reduce(op, y) {
+			continue
+		}
+		g.compileOperand(nodes[i+1])
+		g.emit(g.binaryOp(op))
+	}
+}
+
+// reduce applies op with the constant y to the value on top of the stack,
+// telling whether it could do better than the generic operation
+func (g *generator) reduce(op token.Token, y int16) bool {
+	switch {
+	case y == 0 && (op == token.ADD || op == token.SUB || op == token.OR),
+		y == -1 && op == token.AND,
+		y == 1 && op == token.DIV:
+		return true
+	case y == -1 && op == token.DIV:
+		g.emit(vm.NewArithmeticCommand(vm.OpNeg))
+		return true
+	case op == token.MUL && multipliable(y):
+		g.multiply(y)
+		return true
+	case op == token.DIV && y != -32768 && bits.OnesCount16(abs16(y)) == 1:
+		g.divide(y)
+		return true
+	}
+	return false
+}
+
+// divide divides the value on top of the stack by c, a power of two
+func (g *generator) divide(c int16) {
+	u := abs16(c)
+	k := bits.TrailingZeros16(u)
+	if g.opts.Extended {
+		g.divideShift(u, k)
+	} else {
+		g.divideBits(k)
+	}
+	if c < 0 {
+		g.emit(vm.NewArithmeticCommand(vm.OpNeg))
+	}
+}
+
+// divideShift divides with an arithmetic shift. Negative values are added
+// 2^k-1 first, so that the shift rounds them towards zero as div does
+func (g *generator) divideShift(u uint16, k int) {
+	g.emit(vm.NewArithmeticCommand(vm.OpDup))
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 15))
+	g.emit(vm.NewArithmeticCommand(vm.OpShr))
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, u-1))
+	g.emit(vm.NewArithmeticCommand(vm.OpAnd))
+	g.emit(vm.NewArithmeticCommand(vm.OpAdd))
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(k)))
+	g.emit(vm.NewArithmeticCommand(vm.OpShr))
+}
+
+// divideBits divides by 2^k without shifts: the bits of the magnitude of the
+// value above the kth one are tested one by one into the quotient, whose sign
+// is then restored. Temp 0 holds the magnitude, temp 1 the quotient and temp 2
+// the sign, -1 for negative values
+func (g *generator) divideBits(k int) {
+	push := func(i uint16) { g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegTemp, i)) }
+	pop := func(i uint16) { g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegTemp, i)) }
+	arith := func(op vm.Operation) { g.emit(vm.NewArithmeticCommand(op)) }
+	// negate returns x - ((x + x) & sign), which is -x for negative values
+	negate := func(i uint16) {
+		push(i)
+		push(i)
+		push(i)
+		arith(vm.OpAdd)
+		push(2)
+		arith(vm.OpAnd)
+		arith(vm.OpSub)
+	}
+
+	pop(0)
+	push(0)
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 0))
+	arith(vm.OpLt)
+	pop(2)
+	negate(0)
+	pop(0)
+	// every tested bit adds its value minus one, (a & bit) = 0 being -1 for
+	// unset bits, which is made up for by the final addition
+	for bit := 15; bit >= k; bit-- {
+		if bit < 15 {
+			pop(1)
+			push(1)
+			push(1)
+			arith(vm.OpAdd)
+		}
+		push(0)
+		g.pushConst(int16(uint16(1) << bit))
+		arith(vm.OpAnd)
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 0))
+		arith(vm.OpEq)
+		if bit < 15 {
+			arith(vm.OpAdd)
+		}
+	}
+	g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 1<<(16-k)-1))
+	arith(vm.OpAdd)
+	pop(1)
+	negate(1)
+}
+
+func multipliable(c int16) bool {
+	u := abs16(c)
+	return u == 0 || bits.Len16(u)+bits.OnesCount16(u)-2 <= maxAdditions
+}
+
+// multiply multiplies the value on top of the stack by c, doubling it for
+// every bit of c and adding it back for the set ones
+func (g *generator) multiply(c int16) {
+	u := abs16(c)
+	if u == 0 {
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegTemp, 0))
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 0))
+		return
+	}
+	if g.opts.Extended {
+		if bits.OnesCount16(u) == 1 {
+			g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(bits.TrailingZeros16(u))))
+			g.emit(vm.NewArithmeticCommand(vm.OpShl))
+		} else {
+			g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, u))
+			g.emit(vm.NewArithmeticCommand(vm.OpMul))
+		}
+		if c < 0 {
+			g.emit(vm.NewArithmeticCommand(vm.OpNeg))
+		}
+		return
+	}
+	keep := bits.OnesCount16(u) > 1
+	if keep {
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegTemp, 1))
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegTemp, 1))
+	}
+	for bit := bits.Len16(u) - 2; bit >= 0; bit-- {
+		g.emit(vm.NewAccessCommand(vm.OpPop, vm.SegTemp, 0))
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegTemp, 0))
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegTemp, 0))
+		g.emit(vm.NewArithmeticCommand(vm.OpAdd))
+		if u&(1<<bit) != 0 {
+			g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegTemp, 1))
+			g.emit(vm.NewArithmeticCommand(vm.OpAdd))
+		}
+	}
+	if c < 0 {
+		g.emit(vm.NewArithmeticCommand(vm.OpNeg))
+	}
+}
+
+// pushConst pushes any 16-bit value, as push constant only takes 0..32767
+func (g *generator) pushConst(v int16) {
+	switch {
+	case v >= 0:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(v)))
+	case v == -32768:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, 32767))
+		g.emit(vm.NewArithmeticCommand(vm.OpNot))
+	default:
+		g.emit(vm.NewAccessCommand(vm.OpPush, vm.SegConst, uint16(-v)))
+		g.emit(vm.NewArithmeticCommand(vm.OpNeg))
+	}
+}
+
+func abs16(v int16) uint16 {
+	if v < 0 {
+		return uint16(-int32(v))
+	}
+	return uint16(v)
+}
+
+// constValue evaluates expressions and terms made only of constants, with the
+// 16-bit arithmetic of the vm
+func constValue(n parse.Node) (int16, bool) {
+	children := n.Children()
+	switch n.Type() {
+	case parse.NodeExpression:
+		v, ok := constValue(children[0])
+		for i := 1; ok && i+1 < len(children); i += 2 {
+			var y int16
+			if y, ok = constValue(children[i+1]); ok {
+				v, ok = fold(children[i].Token().Token, v, y)
+			}
+		}
+		return v, ok
+	case parse.NodeTerm:
+	default:
+		return 0, false
+	}
+
+	tok := children[0].Token()
+	switch {
+	case tok == nil:
+		return 0, false
+	case tok.Is(token.INTEGER_CONST), tok.Is(token.CHAR_CONST):
+		v, err := tok.IntValue()
+		return int16(v), err == nil
+	case tok.Is(token.TRUE):
+		return -1, true
+	case tok.Is(token.FALSE), tok.Is(token.NULL):
+		return 0, true
+	case tok.Is(token.LPAREN):
+		return constValue(children[1])
+	case tok.Is(token.SUB), tok.Is(token.NOT):
+		v, ok := constValue(children[1])
+		if tok.Is(token.SUB) {
+			return -v, ok
+		}
+		return ^v, ok
+	}
+	return 0, false
+}
+
+// fold applies the binary operator to constants. Divisions by zero are left
+// to Math.divide, which reports them at runtime
+func fold(op token.Token, x, y int16) (int16, bool) {
+	switch op {
+	case token.ADD:
+		return x + y, true
+	case token.SUB:
+		return x - y, true
+	case token.MUL:
+		return x * y, true
+	case token.DIV:
+		if y == 0 || x == -32768 || y == -32768 {
+			return 0, false
+		}
+		return x / y, true
+	case token.AND:
+		return x & y, true
+	case token.OR:
+		return x | y, true
+	case token.LT:
+		return boolValue(x < y), true
+	case token.GT:
+		return boolValue(x > y), true
+	case token.EQ:
+		return boolValue(x == y), true
+	}
+	return 0, false
+}
+
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
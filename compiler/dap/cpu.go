@@ -0,0 +1,227 @@
+package dap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/schattian/nand2tetris/compiler/codegen"
+	"github.com/schattian/nand2tetris/compiler/debugger"
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+// jmp is the 0;JMP instruction
+const jmp = 0xEA87
+
+// cpuTarget debugs hack assembly, one instruction per step. The jack classes
+// of the program can be debugged too when their debug maps, written by the
+// compiler with -g -asm, are next to the .asm file
+type cpuTarget struct {
+	cpu     *hack.CPU
+	program *hack.Program
+	path    string
+	debugs  []*codegen.Debug
+	// files holds the breakpoints of every file, which are merged into
+	// breakpoints
+	files       map[string][]uint16
+	breakpoints map[uint16]bool
+	paused      int32
+}
+
+func newCPUTarget(path string) (*cpuTarget, error) {
+	p, err := hack.AssembleFile(path)
+	if err != nil {
+		return nil, err
+	}
+	debugs, err := readDebugs(filepath.Dir(path), len(p.ROM))
+	if err != nil {
+		return nil, err
+	}
+	return &cpuTarget{
+		cpu:         hack.NewCPU(p.ROM),
+		program:     p,
+		path:        path,
+		debugs:      debugs,
+		files:       make(map[string][]uint16),
+		breakpoints: make(map[uint16]bool),
+	}, nil
+}
+
+// readDebugs reads the debug maps of the dir holding rom addresses within the
+// rom size, setting their files to the jack files next to them
+func readDebugs(dirname string, size int) ([]*codegen.Debug, error) {
+	filenames, err := filepath.Glob(filepath.Join(dirname, "*.dbg.json"))
+	if err != nil {
+		return nil, err
+	}
+	var debugs []*codegen.Debug
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		d, err := codegen.ReadDebug(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		if len(d.ROM) != len(d.Lines)+1 || d.ROM[len(d.Lines)] > size {
+			continue
+		}
+		d.File = strings.TrimSuffix(filename, ".dbg.json") + ".jack"
+		debugs = append(debugs, d)
+	}
+	return debugs, nil
+}
+
+func (t *cpuTarget) setBreakpoints(path string, lines []int) []bool {
+	verified := make([]bool, len(lines))
+	t.files[path] = nil
+	for i, line := range lines {
+		if pc, ok := t.addrAt(path, line); ok {
+			t.files[path] = append(t.files[path], pc)
+			verified[i] = true
+		}
+	}
+	t.breakpoints = make(map[uint16]bool)
+	for _, pcs := range t.files {
+		for _, pc := range pcs {
+			t.breakpoints[pc] = true
+		}
+	}
+	return verified
+}
+
+// addrAt returns the rom address of the first instruction of the given line,
+// of the .asm file or of a jack class
+func (t *cpuTarget) addrAt(path string, line int) (uint16, bool) {
+	if samePath(path, t.path) {
+		for pc, l := range t.program.Lines {
+			if l == line {
+				return uint16(pc), true
+			}
+		}
+		return 0, false
+	}
+	for _, d := range t.debugs {
+		if !samePath(path, d.File) {
+			continue
+		}
+		for _, stmt := range d.Stmts {
+			if d.Lines[stmt] == line {
+				return uint16(d.ROM[stmt]), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// jackAt returns the debug map and the command holding the rom address, if
+// any
+func (t *cpuTarget) jackAt(pc uint16) (*codegen.Debug, int, bool) {
+	for _, d := range t.debugs {
+		rom := d.ROM
+		if int(pc) < rom[0] || int(pc) >= rom[len(rom)-1] {
+			continue
+		}
+		i := sort.Search(len(rom)-1, func(i int) bool { return rom[i] > int(pc) })
+		return d, i - 1, true
+	}
+	return nil, 0, false
+}
+
+// halted reports whether the cpu reached the end of the rom or the infinite
+// loop ending the program
+func (t *cpuTarget) halted() bool {
+	rom, pc := t.cpu.ROM, int(t.cpu.PC)
+	if pc >= len(rom) {
+		return true
+	}
+	isEnd := func(pc int) bool {
+		return pc >= 0 && pc+1 < len(rom) && int(rom[pc]) == pc && rom[pc+1] == jmp
+	}
+	return isEnd(pc) || (isEnd(pc-1) && int(t.cpu.A) == pc-1)
+}
+
+func (t *cpuTarget) resume(step stepKind) (debugger.StopReason, error) {
+	for {
+		if atomic.CompareAndSwapInt32(&t.paused, 1, 0) {
+			return debugger.StopPause, nil
+		}
+		if t.halted() {
+			return debugger.StopHalted, nil
+		}
+		err := t.cpu.Step()
+		if errors.Is(err, hack.ErrPCOutOfRange) {
+			return debugger.StopHalted, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if t.breakpoints[t.cpu.PC] {
+			return debugger.StopBreakpoint, nil
+		}
+		if step != stepContinue {
+			return debugger.StopStep, nil
+		}
+	}
+}
+
+func (t *cpuTarget) pause() {
+	atomic.StoreInt32(&t.paused, 1)
+}
+
+// stack returns the instruction run next, at its jack line when it belongs
+// to a class with debug map
+func (t *cpuTarget) stack() []frame {
+	f := frame{name: fmt.Sprintf("ROM[%d]", t.cpu.PC), path: t.path}
+	if d, cmd, ok := t.jackAt(t.cpu.PC); ok {
+		for _, sub := range d.Subroutines {
+			if cmd >= sub.Start && cmd < sub.End {
+				f.name = fmt.Sprintf("%s (%s)", sub.Name, f.name)
+			}
+		}
+		f.path, f.line = d.File, d.Lines[cmd]
+	} else if pc := int(t.cpu.PC); pc < len(t.program.Lines) {
+		f.line = t.program.Lines[pc]
+	}
+	return []frame{f}
+}
+
+func (t *cpuTarget) scopes(frame int) ([]varScope, error) {
+	if frame != 0 {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	c := t.cpu
+	regs := []variable{
+		pointerVar("A", c.A),
+		intVar("D", c.D),
+		intVar("M", c.RAM[uint16(c.A)&(hack.MemSize-1)]),
+		{Name: "PC", Value: fmt.Sprint(c.PC), Type: "int"},
+	}
+	regs = append(regs, registers(&c.RAM)...)
+
+	var names []string
+	for name := range t.program.Variables {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return t.program.Variables[names[i]] < t.program.Variables[names[j]]
+	})
+	var vars []variable
+	for _, name := range names {
+		addr := t.program.Variables[name]
+		v := intVar(name, c.RAM[addr])
+		v.MemoryReference = fmt.Sprint(addr)
+		vars = append(vars, v)
+	}
+	return []varScope{{"Registers", regs}, {"Variables", vars}}, nil
+}
+
+func (t *cpuTarget) ram() *hack.Memory {
+	return &t.cpu.RAM
+}
@@ -0,0 +1,116 @@
+package dap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/schattian/nand2tetris/compiler/debugger"
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+// jackTarget debugs jack code, one statement per step
+type jackTarget struct {
+	s *debugger.Session
+	// lines holds the breakpoints of every file
+	lines map[string][]int
+}
+
+func newJackTarget(path, osDir string) (*jackTarget, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		path = filepath.Dir(path)
+	}
+	s, err := debugger.Load(path, osDir)
+	if err != nil {
+		return nil, err
+	}
+	return &jackTarget{s: s, lines: make(map[string][]int)}, nil
+}
+
+func (t *jackTarget) setBreakpoints(path string, lines []int) []bool {
+	for _, line := range t.lines[path] {
+		t.s.ClearBreakpoint(path, line)
+	}
+	t.lines[path] = nil
+	verified := make([]bool, len(lines))
+	for i, line := range lines {
+		if _, err := t.s.SetBreakpoint(path, line); err == nil {
+			verified[i] = true
+			t.lines[path] = append(t.lines[path], line)
+		}
+	}
+	return verified
+}
+
+func (t *jackTarget) resume(step stepKind) (debugger.StopReason, error) {
+	switch step {
+	case stepIn:
+		return t.s.StepInto(0)
+	case stepOver:
+		return t.s.StepOver(0)
+	case stepOut:
+		return t.s.StepOut(0)
+	}
+	return t.s.Continue(0)
+}
+
+func (t *jackTarget) pause() {
+	t.s.Pause()
+}
+
+func (t *jackTarget) stack() (frames []frame) {
+	for _, f := range t.s.Stack() {
+		fr := frame{name: f.Function}
+		if f.Location.Valid() {
+			fr.path, fr.line = f.Location.Debug.File, f.Location.Line
+		}
+		frames = append(frames, fr)
+	}
+	return
+}
+
+func (t *jackTarget) scopes(frame int) ([]varScope, error) {
+	stack := t.s.Stack()
+	if frame < 0 || frame >= len(stack) {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	regs := append([]variable{{Name: "PC", Value: fmt.Sprint(stack[frame].PC), Type: "int"}}, registers(&t.s.M.RAM)...)
+	vars, err := t.s.Variables(frame)
+	if err != nil {
+		// subroutines without debug info, such as the os ones
+		return []varScope{{"Registers", regs}}, nil
+	}
+	scopes := []varScope{
+		{name: "Arguments"},
+		{name: "Locals"},
+		{name: "Fields"},
+		{name: "Statics"},
+	}
+	kinds := map[debugger.VarKind]int{
+		debugger.KindArg:    0,
+		debugger.KindLocal:  1,
+		debugger.KindField:  2,
+		debugger.KindStatic: 3,
+	}
+	for _, v := range vars {
+		dv := variable{Name: v.Name, Value: v.Display(), Type: v.Type}
+		switch v.Type {
+		case "int", "char", "boolean":
+		default:
+			if v.Value != 0 {
+				dv.MemoryReference = fmt.Sprint(uint16(v.Value))
+			}
+		}
+		i := kinds[v.Kind]
+		scopes[i].vars = append(scopes[i].vars, dv)
+	}
+	return append(scopes, varScope{"Registers", regs}), nil
+}
+
+func (t *jackTarget) ram() *hack.Memory {
+	return &t.s.M.RAM
+}
@@ -0,0 +1,356 @@
+// Package dap implements a debug adapter protocol server over the hack cpu
+// and the vm emulators, debugging .asm, .vm and .jack programs.
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/schattian/nand2tetris/compiler/debugger"
+)
+
+const (
+	threadID = 1
+	// scopesPerFrame bounds the scopes of a frame to encode variables references
+	scopesPerFrame = 16
+)
+
+var (
+	errNotLaunched = errors.New("no program launched")
+	errRunning     = errors.New("program is running")
+)
+
+// Server serves a single debug session
+type Server struct {
+	r *bufio.Reader
+
+	wmu sync.Mutex
+	w   io.Writer
+	seq int
+
+	// mu guards the target and its options, and busy is held by the requests
+	// using the target and by the goroutine running it
+	mu          sync.Mutex
+	busy        sync.Mutex
+	target      target
+	stopOnEntry bool
+	noDebug     bool
+	// running is set while the target runs, so that requests needing the
+	// target fail instead of waiting for it to stop
+	running int32
+}
+
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{r: bufio.NewReader(r), w: w}
+}
+
+// Serve handles requests until the client disconnects
+func (s *Server) Serve() error {
+	for {
+		req, err := ReadMessage(s.r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		body, err := s.handle(req)
+		if err != nil {
+			s.respond(req, nil, err)
+			continue
+		}
+		s.respond(req, body, nil)
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "configurationDone":
+			if s.stopOnEntry && !s.noDebug {
+				s.event("stopped", stoppedEvent{Reason: "entry", ThreadID: threadID, AllThreadsStopped: true})
+			} else {
+				s.resume(stepContinue)
+			}
+		case "continue":
+			s.resume(stepContinue)
+		case "next":
+			s.resume(stepOver)
+		case "stepIn":
+			s.resume(stepIn)
+		case "stepOut":
+			s.resume(stepOut)
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req *Message) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsReadMemoryRequest:        true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		t, err := launch(args)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.target, s.stopOnEntry, s.noDebug = t, args.StopOnEntry, args.NoDebug
+		return nil, nil
+	case "disconnect", "terminate":
+		if t := s.launched(); t != nil {
+			t.pause()
+		}
+		if req.Command == "terminate" {
+			s.event("terminated", nil)
+		}
+		return nil, nil
+	case "pause":
+		if t := s.launched(); t != nil && atomic.LoadInt32(&s.running) != 0 {
+			t.pause()
+		}
+		return nil, nil
+	case "configurationDone", "setExceptionBreakpoints":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []thread{{ID: threadID, Name: "main"}}}, nil
+	}
+
+	if atomic.LoadInt32(&s.running) != 0 {
+		return nil, errRunning
+	}
+	s.busy.Lock()
+	defer s.busy.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.target == nil {
+		return nil, errNotLaunched
+	}
+	switch req.Command {
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		return s.scopes(req.Arguments)
+	case "variables":
+		return s.variables(req.Arguments)
+	case "evaluate":
+		return s.evaluate(req.Arguments)
+	case "readMemory":
+		return s.readMemory(req.Arguments)
+	case "continue", "next", "stepIn", "stepOut":
+		if req.Command == "continue" {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request: %s", req.Command)
+}
+
+// launched returns the target, nil until launched
+func (s *Server) launched() target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.target
+}
+
+// resume runs the target in background, sending the event that stops it
+func (s *Server) resume(step stepKind) {
+	s.busy.Lock()
+	t := s.launched()
+	if t == nil {
+		s.busy.Unlock()
+		return
+	}
+	atomic.StoreInt32(&s.running, 1)
+	go func() {
+		defer s.busy.Unlock()
+		reason, err := t.resume(step)
+		atomic.StoreInt32(&s.running, 0)
+		if err != nil {
+			s.event("output", map[string]string{"category": "stderr", "output": err.Error() + "\n"})
+			reason = debugger.StopHalted
+		}
+		if reason == debugger.StopHalted {
+			s.event("terminated", nil)
+			return
+		}
+		stopped := stoppedEvent{Reason: "step", ThreadID: threadID, AllThreadsStopped: true}
+		switch reason {
+		case debugger.StopBreakpoint:
+			stopped.Reason = "breakpoint"
+		case debugger.StopPause:
+			stopped.Reason = "pause"
+		}
+		s.event("stopped", stopped)
+	}()
+}
+
+func (s *Server) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	lines := args.Lines
+	if args.Breakpoints != nil {
+		lines = nil
+		for _, bp := range args.Breakpoints {
+			lines = append(lines, bp.Line)
+		}
+	}
+	verified := s.target.setBreakpoints(args.Source.Path, lines)
+	bps := make([]breakpoint, len(lines))
+	for i, line := range lines {
+		bps[i] = breakpoint{Verified: verified[i], Line: line, Source: &args.Source}
+		if !verified[i] {
+			bps[i].Message = "no code at this line"
+		}
+	}
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+func (s *Server) stackTrace() (interface{}, error) {
+	var frames []stackFrame
+	for i, f := range s.target.stack() {
+		sf := stackFrame{ID: i, Name: f.name, Line: f.line, Column: 1}
+		if f.path != "" {
+			sf.Source = &source{Name: filepath.Base(f.path), Path: f.path}
+		}
+		frames = append(frames, sf)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) scopes(arguments json.RawMessage) (interface{}, error) {
+	var args scopesArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	scopes, err := s.target.scopes(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	var body []scope
+	for i, sc := range scopes {
+		body = append(body, scope{Name: sc.name, VariablesReference: args.FrameID*scopesPerFrame + i + 1})
+	}
+	return map[string]interface{}{"scopes": body}, nil
+}
+
+func (s *Server) variables(arguments json.RawMessage) (interface{}, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	ref := args.VariablesReference - 1
+	frame, i := ref/scopesPerFrame, ref%scopesPerFrame
+	scopes, err := s.target.scopes(frame)
+	if err != nil {
+		return nil, err
+	}
+	if ref < 0 || i >= len(scopes) {
+		return nil, fmt.Errorf("invalid variables reference: %d", args.VariablesReference)
+	}
+	vars := scopes[i].vars
+	if vars == nil {
+		vars = []variable{}
+	}
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+// evaluate looks the expression up among the vars of the frame, or reads
+// RAM[addr]
+func (s *Server) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	value, ok, err := evalRAM(s.target.ram(), args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return map[string]interface{}{"result": value, "variablesReference": 0}, nil
+	}
+	scopes, err := s.target.scopes(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sc := range scopes {
+		for _, v := range sc.vars {
+			if v.Name == args.Expression {
+				return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": 0, "memoryReference": v.MemoryReference}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown name: %s", args.Expression)
+}
+
+// readMemory reads the ram. Memory references, offsets, counts and the
+// address returned are all in words, every word being read as 2 little endian
+// bytes
+func (s *Server) readMemory(arguments json.RawMessage) (interface{}, error) {
+	var args readMemoryArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	base, err := strconv.ParseInt(args.MemoryReference, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory reference: %s", args.MemoryReference)
+	}
+	ram := s.target.ram()
+	start := int(base) + args.Offset
+	var data []byte
+	for addr := start; addr < start+args.Count; addr++ {
+		if addr < 0 || addr >= len(ram) {
+			break
+		}
+		data = append(data, byte(ram[addr]), byte(uint16(ram[addr])>>8))
+	}
+	return map[string]interface{}{
+		"address":         fmt.Sprint(start),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": 2*args.Count - len(data),
+	}, nil
+}
+
+func (s *Server) respond(req *Message, body interface{}, err error) {
+	success := err == nil
+	msg := &Message{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: body}
+	if err != nil {
+		msg.ErrMessage = err.Error()
+	}
+	s.send(msg)
+}
+
+func (s *Server) event(event string, body interface{}) {
+	s.send(&Message{Type: "event", Event: event, Body: body})
+}
+
+func (s *Server) send(msg *Message) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	msg.Seq = s.seq
+	WriteMessage(s.w, msg)
+}
@@ -0,0 +1,379 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schattian/nand2tetris/compiler/codegen"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+// client scripts a debug session against a server
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	events []*Message
+}
+
+func newClient(t *testing.T) *client {
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	go func() {
+		if err := NewServer(reqR, respW).Serve(); err != nil {
+			t.Error(err)
+		}
+		respW.Close()
+	}()
+	t.Cleanup(func() { reqW.Close() })
+	return &client{t: t, w: reqW, r: bufio.NewReader(respR)}
+}
+
+func (c *client) read() *Message {
+	c.t.Helper()
+	msgs := make(chan *Message)
+	go func() {
+		msg, err := ReadMessage(c.r)
+		if err != nil {
+			c.t.Error(err)
+		}
+		msgs <- msg
+	}()
+	select {
+	case msg := <-msgs:
+		if msg == nil {
+			c.t.FailNow()
+		}
+		return msg
+	case <-time.After(10 * time.Second):
+		c.t.Fatal("timeout waiting for the server")
+	}
+	return nil
+}
+
+// request sends the request and decodes the body of its response into body,
+// queuing the events read meanwhile
+func (c *client) request(command string, args interface{}, body interface{}) {
+	c.t.Helper()
+	if err := c.tryRequest(command, args, body); err != nil {
+		c.t.Fatalf("%s: %s", command, err)
+	}
+}
+
+func (c *client) tryRequest(command string, args interface{}, body interface{}) error {
+	c.t.Helper()
+	c.seq++
+	rawArgs, _ := json.Marshal(args)
+	if err := WriteMessage(c.w, &Message{Seq: c.seq, Type: "request", Command: command, Arguments: rawArgs}); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq {
+			c.t.Fatalf("response to %d, want %d", msg.RequestSeq, c.seq)
+		}
+		if msg.Success == nil || !*msg.Success {
+			return &requestError{msg.ErrMessage}
+		}
+		if body != nil {
+			decode(c.t, msg.Body, body)
+		}
+		return nil
+	}
+}
+
+type requestError struct{ msg string }
+
+func (e *requestError) Error() string { return e.msg }
+
+func (c *client) waitEvent(event string) *Message {
+	c.t.Helper()
+	for {
+		var msg *Message
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type == "event" && msg.Event == event {
+			return msg
+		}
+	}
+}
+
+func (c *client) waitStopped(reason string) {
+	c.t.Helper()
+	var body stoppedEvent
+	decode(c.t, c.waitEvent("stopped").Body, &body)
+	if body.Reason != reason {
+		c.t.Fatalf("stopped by %s, want %s", body.Reason, reason)
+	}
+}
+
+func (c *client) launch(program, osDir string, stopOnEntry bool, path string, lines ...int) {
+	c.t.Helper()
+	c.request("initialize", map[string]string{"adapterID": "hack"}, nil)
+	c.waitEvent("initialized")
+	c.request("launch", launchArguments{Program: program, OSDir: osDir, StopOnEntry: stopOnEntry}, nil)
+	c.setBreakpoints(path, lines...)
+	c.request("configurationDone", nil, nil)
+}
+
+func (c *client) setBreakpoints(path string, lines ...int) []breakpoint {
+	c.t.Helper()
+	var body struct{ Breakpoints []breakpoint }
+	args := setBreakpointsArguments{Source: source{Path: abs(c.t, path)}}
+	for _, line := range lines {
+		args.Breakpoints = append(args.Breakpoints, sourceBreakpoint{Line: line})
+	}
+	c.request("setBreakpoints", args, &body)
+	return body.Breakpoints
+}
+
+func (c *client) stackTrace() []stackFrame {
+	c.t.Helper()
+	var body struct{ StackFrames []stackFrame }
+	c.request("stackTrace", stackTraceArguments{ThreadID: threadID}, &body)
+	return body.StackFrames
+}
+
+// vars returns the values of the vars of the given frame scope
+func (c *client) vars(frame int, scopeName string) map[string]string {
+	c.t.Helper()
+	var scopes struct{ Scopes []scope }
+	c.request("scopes", scopesArguments{FrameID: frame}, &scopes)
+	for _, sc := range scopes.Scopes {
+		if sc.Name != scopeName {
+			continue
+		}
+		var body struct{ Variables []variable }
+		c.request("variables", variablesArguments{VariablesReference: sc.VariablesReference}, &body)
+		vars := make(map[string]string)
+		for _, v := range body.Variables {
+			vars[v.Name] = v.Value
+		}
+		return vars
+	}
+	c.t.Fatalf("no scope %s", scopeName)
+	return nil
+}
+
+func (c *client) checkVars(frame int, scopeName string, want map[string]string) {
+	c.t.Helper()
+	vars := c.vars(frame, scopeName)
+	for name, value := range want {
+		if vars[name] != value {
+			c.t.Errorf("%s: %s = %q, want %q", scopeName, name, vars[name], value)
+		}
+	}
+}
+
+func (c *client) checkLine(path string, line int) {
+	c.t.Helper()
+	frames := c.stackTrace()
+	if len(frames) == 0 || frames[0].Source == nil {
+		c.t.Fatalf("no source at the top frame: %+v", frames)
+	}
+	if got := frames[0].Source.Path; got != abs(c.t, path) || frames[0].Line != line {
+		c.t.Fatalf("stopped at %s:%d, want %s:%d", got, frames[0].Line, path, line)
+	}
+}
+
+func decode(t *testing.T, body interface{}, v interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(raw, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func abs(t *testing.T, path string) string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServer_Asm(t *testing.T) {
+	const program = "../../projects/06/max/Max.asm"
+	c := newClient(t)
+	c.launch(program, "", true, program)
+	c.waitStopped("entry")
+	c.checkLine(program, 8)
+
+	bps := c.setBreakpoints(program, 5, 23)
+	if bps[0].Verified || !bps[1].Verified {
+		t.Errorf("unexpected breakpoints %+v", bps)
+	}
+	c.request("continue", nil, nil)
+	c.waitStopped("breakpoint")
+	c.checkLine(program, 23)
+	c.checkVars(0, "Registers", map[string]string{"A": "2", "D": "0", "PC": "13"})
+
+	c.request("next", nil, nil)
+	c.waitStopped("step")
+	c.checkLine(program, 25)
+
+	var mem struct {
+		Address string
+		Data    string
+	}
+	c.request("readMemory", readMemoryArguments{MemoryReference: "0", Offset: 2, Count: 4}, &mem)
+	if data, _ := base64.StdEncoding.DecodeString(mem.Data); len(data) != 8 || mem.Address != "2" {
+		t.Errorf("read %v at %s, want 4 words at 2", data, mem.Address)
+	}
+
+	c.request("continue", nil, nil)
+	c.waitEvent("terminated")
+	c.request("disconnect", nil, nil)
+}
+
+func TestServer_VM(t *testing.T) {
+	const (
+		program = "../../projects/08/FunctionCalls/FibonacciElement"
+		main    = program + "/Main.vm"
+	)
+	c := newClient(t)
+	c.launch(program, "", false, main, 12)
+	c.waitStopped("breakpoint")
+	c.checkLine(main, 12)
+	c.checkVars(0, "Arguments", map[string]string{"argument 0": "4"})
+	frames := c.stackTrace()
+	if len(frames) != 2 || frames[1].Name != "Sys.init" || frames[1].Line != 13 {
+		t.Errorf("unexpected stack %+v", frames)
+	}
+
+	c.request("continue", nil, nil)
+	c.waitStopped("breakpoint")
+	c.checkVars(0, "Arguments", map[string]string{"argument 0": "2"})
+	if frames := c.stackTrace(); len(frames) != 3 || frames[1].Line != 24 {
+		t.Errorf("unexpected stack %+v", frames)
+	}
+
+	c.request("stepIn", nil, nil)
+	c.waitStopped("step")
+	c.checkLine(main, 13)
+	c.checkVars(0, "Stack", map[string]string{"stack 0": "2"})
+
+	c.setBreakpoints(main)
+	c.request("continue", nil, nil)
+	// Sys.init loops forever once done
+	if err := c.tryRequest("stackTrace", stackTraceArguments{ThreadID: threadID}, nil); err == nil {
+		t.Error("expected error while running")
+	}
+	c.request("pause", nil, nil)
+	c.waitStopped("pause")
+	if frames := c.stackTrace(); len(frames) != 1 || frames[0].Name != "Sys.init" {
+		t.Errorf("unexpected stack %+v", frames)
+	}
+	var result struct{ Result string }
+	c.request("evaluate", evaluateArguments{Expression: "RAM[261]"}, &result)
+	if result.Result != "3" {
+		t.Errorf("fib(4) = %s, want 3", result.Result)
+	}
+}
+
+func TestServer_Jack(t *testing.T) {
+	const (
+		program = "../../projects/11/ConvertToBin/Main.jack"
+		osDir   = "../../tools/OS"
+	)
+	c := newClient(t)
+	c.launch(program, osDir, false, program, 40, 44)
+	c.waitStopped("breakpoint")
+	c.checkLine(program, 44)
+	c.checkVars(0, "Locals", map[string]string{"mask": "0", "position": "1", "loop": "true"})
+
+	c.request("stepIn", nil, nil)
+	c.waitStopped("step")
+	c.checkLine(program, 64)
+	c.checkVars(0, "Arguments", map[string]string{"mask": "0"})
+	var result struct{ Result string }
+	c.request("evaluate", evaluateArguments{Expression: "position", FrameID: 1}, &result)
+	if result.Result != "1" {
+		t.Errorf("position = %s, want 1", result.Result)
+	}
+
+	c.request("stepOut", nil, nil)
+	c.waitStopped("step")
+	c.request("next", nil, nil)
+	c.waitStopped("step")
+	c.checkLine(program, 46)
+	c.checkVars(0, "Locals", map[string]string{"mask": "1"})
+}
+
+func TestServer_JackAsm(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "Main.jack")
+	src, err := os.ReadFile("../../projects/11/ConvertToBin/Main.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(program, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	asm := link(t, dir, "../../tools/OS")
+
+	c := newClient(t)
+	c.launch(asm, "", false, program, 40, 44)
+	c.waitStopped("breakpoint")
+	c.checkLine(program, 44)
+	if frames := c.stackTrace(); !strings.HasPrefix(frames[0].Name, "Main.convert ") {
+		t.Errorf("unexpected stack %+v", frames)
+	}
+	c.request("next", nil, nil)
+	c.waitStopped("step")
+	c.checkLine(program, 44)
+}
+
+// link compiles the classes of the dir into a .asm file along with the os,
+// writing their debug maps with rom addresses
+func link(t *testing.T, dir, osDir string) string {
+	classes, err := codegen.CompileDir(dir, codegen.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := vm.ParseDir(osDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm := filepath.Join(dir, "Program.asm")
+	w, err := os.Create(asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addrs, err := vm.Translate(w, vm.AddLibrary(codegen.Program(classes), lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codegen.SetROM(classes, addrs)
+	for _, class := range classes {
+		dw, err := os.Create(filepath.Join(dir, class.Name+".dbg.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = class.Debug.Write(dw)
+		dw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return asm
+}
@@ -0,0 +1,118 @@
+package dap
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/debugger"
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+type stepKind int
+
+const (
+	stepContinue stepKind = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// target is a program being debugged at some level: hack assembly, vm or jack
+type target interface {
+	// setBreakpoints replaces the breakpoints of the given file, reporting
+	// which lines hold code
+	setBreakpoints(path string, lines []int) []bool
+	// resume runs until the step completes, a breakpoint is reached or pause
+	// is called
+	resume(step stepKind) (debugger.StopReason, error)
+	pause()
+	stack() []frame
+	scopes(frame int) ([]varScope, error)
+	ram() *hack.Memory
+}
+
+type frame struct {
+	name string
+	path string
+	line int
+}
+
+type varScope struct {
+	name string
+	vars []variable
+}
+
+// launch loads the target of the given program according to its extension
+func launch(args launchArguments) (target, error) {
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(program)
+	if ext == "" {
+		ext, err = dirKind(program)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch ext {
+	case ".asm":
+		return newCPUTarget(program)
+	case ".vm":
+		return newVMTarget(program, args.OSDir)
+	case ".jack":
+		return newJackTarget(program, args.OSDir)
+	}
+	return nil, fmt.Errorf("unsupported program: %s", args.Program)
+}
+
+// dirKind reports whether the dir holds .jack or .vm files
+func dirKind(dirname string) (string, error) {
+	for _, ext := range []string{".jack", ".vm"} {
+		matches, err := filepath.Glob(filepath.Join(dirname, "*"+ext))
+		if err != nil {
+			return "", err
+		}
+		if len(matches) > 0 {
+			return ext, nil
+		}
+	}
+	return "", fmt.Errorf("no .jack or .vm files in %s", dirname)
+}
+
+func samePath(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// registers returns the pointers stored in the first ram words
+func registers(ram *hack.Memory) []variable {
+	var vars []variable
+	for i, name := range []string{"SP", "LCL", "ARG", "THIS", "THAT"} {
+		vars = append(vars, pointerVar(name, ram[i]))
+	}
+	return vars
+}
+
+func intVar(name string, v int16) variable {
+	return variable{Name: name, Value: fmt.Sprint(v), Type: "int"}
+}
+
+func pointerVar(name string, v int16) variable {
+	return variable{Name: name, Value: fmt.Sprint(v), Type: "int", MemoryReference: fmt.Sprint(uint16(v))}
+}
+
+// evalRAM evaluates expressions of the form RAM[addr]
+func evalRAM(ram *hack.Memory, expr string) (string, bool, error) {
+	if !strings.HasPrefix(expr, "RAM[") || !strings.HasSuffix(expr, "]") {
+		return "", false, nil
+	}
+	var addr int
+	if _, err := fmt.Sscan(expr[len("RAM["):len(expr)-1], &addr); err != nil {
+		return "", true, err
+	}
+	if addr < 0 || addr >= len(ram) {
+		return "", true, fmt.Errorf("address out of range: %d", addr)
+	}
+	return fmt.Sprint(ram[addr]), true, nil
+}
@@ -0,0 +1,198 @@
+package dap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/schattian/nand2tetris/compiler/debugger"
+	"github.com/schattian/nand2tetris/compiler/hack"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+const (
+	tempBase = 5
+	tempSize = 8
+	// staticsSize is the amount of words of the static segment
+	staticsSize = 240
+)
+
+// vmTarget debugs vm code, one command per step
+type vmTarget struct {
+	m           *vm.Machine
+	paths       map[string]string
+	breakpoints map[int]bool
+	paused      int32
+}
+
+func newVMTarget(path, osDir string) (*vmTarget, error) {
+	paths := make(map[string]string)
+	program, err := parseVM(path, paths)
+	if err != nil {
+		return nil, err
+	}
+	if osDir != "" {
+		lib, err := parseVM(osDir, paths)
+		if err != nil {
+			return nil, err
+		}
+		program = vm.AddLibrary(program, lib)
+	}
+	m, err := vm.NewMachine(program)
+	if err != nil {
+		return nil, err
+	}
+	// programs without Sys.init run from the first command, as the test
+	// scripts of the vm translator do
+	if err = m.Boot(); err != nil {
+		m.RAM[0] = 256
+	}
+	return &vmTarget{m: m, paths: paths, breakpoints: make(map[int]bool)}, nil
+}
+
+// parseVM parses the .vm file or the .vm files of the given dir, recording
+// the path of every module
+func parseVM(path string, paths map[string]string) ([]*vm.Command, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	filenames := []string{path}
+	if info.IsDir() {
+		filenames, err = filepath.Glob(filepath.Join(path, "*.vm"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(filenames)
+	}
+	var cmds []*vm.Command
+	for _, filename := range filenames {
+		fileCmds, err := vm.ParseFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if len(fileCmds) > 0 {
+			paths[fileCmds[0].Module()], _ = filepath.Abs(filename)
+		}
+		cmds = append(cmds, fileCmds...)
+	}
+	return cmds, nil
+}
+
+func (t *vmTarget) setBreakpoints(path string, lines []int) []bool {
+	verified := make([]bool, len(lines))
+	program := t.m.Program()
+	for pc, cmd := range program {
+		if samePath(t.paths[cmd.Module()], path) {
+			delete(t.breakpoints, pc)
+		}
+	}
+	for i, line := range lines {
+		for pc, cmd := range program {
+			if cmd.Line() == line && samePath(t.paths[cmd.Module()], path) {
+				t.breakpoints[pc] = true
+				verified[i] = true
+				break
+			}
+		}
+	}
+	return verified
+}
+
+func (t *vmTarget) resume(step stepKind) (debugger.StopReason, error) {
+	depth := t.m.Depth()
+	for {
+		if atomic.CompareAndSwapInt32(&t.paused, 1, 0) {
+			return debugger.StopPause, nil
+		}
+		err := t.m.Step()
+		if errors.Is(err, vm.ErrHalted) || t.m.Halted() {
+			return debugger.StopHalted, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if t.breakpoints[t.m.PC()] {
+			return debugger.StopBreakpoint, nil
+		}
+		d := t.m.Depth()
+		if step == stepIn || (step == stepOver && d <= depth) || (step == stepOut && d < depth) {
+			return debugger.StopStep, nil
+		}
+	}
+}
+
+func (t *vmTarget) pause() {
+	atomic.StoreInt32(&t.paused, 1)
+}
+
+func (t *vmTarget) stack() (frames []frame) {
+	program := t.m.Program()
+	for i, f := range t.m.Frames() {
+		pc := f.PC
+		// callers show the call being run
+		if i > 0 {
+			pc--
+		}
+		fr := frame{name: f.Function}
+		if pc >= 0 && pc < len(program) {
+			fr.path, fr.line = t.paths[program[pc].Module()], program[pc].Line()
+		}
+		frames = append(frames, fr)
+	}
+	return
+}
+
+func (t *vmTarget) scopes(frame int) ([]varScope, error) {
+	frames := t.m.Frames()
+	if frame < 0 || frame >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	f := frames[frame]
+	ram := &t.m.RAM
+	segment := func(name string, base int16, n int) []variable {
+		var vars []variable
+		for i := 0; i < n; i++ {
+			addr := uint16(base+int16(i)) & (hack.MemSize - 1)
+			v := intVar(fmt.Sprintf("%s %d", name, i), ram[addr])
+			v.MemoryReference = fmt.Sprint(addr)
+			vars = append(vars, v)
+		}
+		return vars
+	}
+
+	regs := append([]variable{{Name: "PC", Value: fmt.Sprint(f.PC), Type: "int"}}, registers(ram)...)
+	scopes := []varScope{
+		{"Registers", regs},
+		{"Arguments", segment("argument", f.ARG, f.Args)},
+		{"Locals", segment("local", f.LCL, f.Locals)},
+	}
+	if frame == 0 {
+		top := f.LCL + int16(f.Locals)
+		scopes = append(scopes, varScope{"Stack", segment("stack", top, int(ram[0]-top))})
+	}
+
+	var statics []variable
+	if pc := f.PC; pc < len(t.m.Program()) {
+		module := t.m.Program()[pc].Module()
+		for i := uint16(0); i < staticsSize; i++ {
+			if addr, ok := t.m.StaticAddr(module, i); ok {
+				v := intVar(fmt.Sprintf("static %d", i), ram[addr])
+				v.MemoryReference = fmt.Sprint(addr)
+				statics = append(statics, v)
+			}
+		}
+	}
+	scopes = append(scopes,
+		varScope{"Statics", statics},
+		varScope{"Temp", segment("temp", tempBase, tempSize)},
+	)
+	return scopes, nil
+}
+
+func (t *vmTarget) ram() *hack.Memory {
+	return &t.m.RAM
+}
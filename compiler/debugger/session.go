@@ -0,0 +1,360 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/schattian/nand2tetris/compiler/codegen"
+	"github.com/schattian/nand2tetris/compiler/hack"
+	"github.com/schattian/nand2tetris/compiler/vm"
+)
+
+type StopReason int
+
+const (
+	StopStep StopReason = iota
+	StopBreakpoint
+	StopHalted
+	StopLimit
+	StopPause
+)
+
+func (r StopReason) String() string {
+	return [...]string{"step", "breakpoint", "halted", "limit", "pause"}[r]
+}
+
+// Session debugs a compiled jack program at the source level, driving a vm machine
+type Session struct {
+	M *vm.Machine
+
+	debugs      map[string]*codegen.Debug
+	subroutines map[string]*codegen.Subroutine
+	// locs holds the source of every program command with debug info
+	locs        []Location
+	stmts       map[int]bool
+	breakpoints map[int]bool
+	paused      int32
+}
+
+type Location struct {
+	Debug *codegen.Debug
+	Line  int
+}
+
+func (l Location) Valid() bool {
+	return l.Debug != nil
+}
+
+func (l Location) String() string {
+	if !l.Valid() {
+		return "??"
+	}
+	return fmt.Sprintf("%s:%d", l.Debug.File, l.Line)
+}
+
+// Load compiles the jack classes of the given dir, links the os found in
+// osDir (if not empty) and boots the machine
+func Load(dirname, osDir string) (*Session, error) {
+	classes, err := codegen.CompileDir(dirname, codegen.Options{})
+	if err != nil {
+		return nil, err
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("no jack files in %s", dirname)
+	}
+	var lib []*vm.Command
+	if osDir != "" {
+		lib, err = vm.ParseDir(osDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return New(classes, lib)
+}
+
+func New(classes []*codegen.Class, lib []*vm.Command) (*Session, error) {
+	s := &Session{
+		debugs:      make(map[string]*codegen.Debug),
+		subroutines: make(map[string]*codegen.Subroutine),
+		stmts:       make(map[int]bool),
+		breakpoints: make(map[int]bool),
+	}
+	for _, class := range classes {
+		start := len(s.locs)
+		for _, line := range class.Debug.Lines {
+			s.locs = append(s.locs, Location{Debug: class.Debug, Line: line})
+		}
+		for _, stmt := range class.Debug.Stmts {
+			s.stmts[start+stmt] = true
+		}
+		s.debugs[class.Name] = class.Debug
+		for _, sub := range class.Debug.Subroutines {
+			s.subroutines[sub.Name] = sub
+		}
+	}
+
+	m, err := vm.NewMachine(vm.AddLibrary(codegen.Program(classes), lib))
+	if err != nil {
+		return nil, err
+	}
+	if err = m.Boot(); err != nil {
+		return nil, err
+	}
+	s.M = m
+	return s, nil
+}
+
+func (s *Session) locationAt(pc int) Location {
+	if pc < 0 || pc >= len(s.locs) {
+		return Location{}
+	}
+	return s.locs[pc]
+}
+
+// Location returns the source location of the next command to run
+func (s *Session) Location() Location {
+	return s.locationAt(s.M.PC())
+}
+
+// SetBreakpoint breaks on every statement starting at the given line of the
+// file, which can be given by path, base name or class name
+func (s *Session) SetBreakpoint(file string, line int) (int, error) {
+	pcs, err := s.statementsAt(file, line)
+	if err != nil {
+		return 0, err
+	}
+	for _, pc := range pcs {
+		s.breakpoints[pc] = true
+	}
+	return len(pcs), nil
+}
+
+func (s *Session) ClearBreakpoint(file string, line int) error {
+	pcs, err := s.statementsAt(file, line)
+	if err != nil {
+		return err
+	}
+	for _, pc := range pcs {
+		delete(s.breakpoints, pc)
+	}
+	return nil
+}
+
+func (s *Session) ClearBreakpoints() {
+	s.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints returns the locations holding a breakpoint
+func (s *Session) Breakpoints() (locs []Location) {
+	seen := make(map[Location]bool)
+	var pcs []int
+	for pc := range s.breakpoints {
+		pcs = append(pcs, pc)
+	}
+	sort.Ints(pcs)
+	for _, pc := range pcs {
+		loc := s.locs[pc]
+		if !seen[loc] {
+			seen[loc] = true
+			locs = append(locs, loc)
+		}
+	}
+	return
+}
+
+func (s *Session) statementsAt(file string, line int) (pcs []int, err error) {
+	d := s.findDebug(file)
+	if d == nil {
+		return nil, fmt.Errorf("unknown file: %s", file)
+	}
+	for pc := range s.stmts {
+		if loc := s.locs[pc]; loc.Debug == d && loc.Line == line {
+			pcs = append(pcs, pc)
+		}
+	}
+	if len(pcs) == 0 {
+		return nil, fmt.Errorf("no statement at %s:%d", file, line)
+	}
+	sort.Ints(pcs)
+	return pcs, nil
+}
+
+func (s *Session) findDebug(file string) *codegen.Debug {
+	if d, ok := s.debugs[file]; ok {
+		return d
+	}
+	for _, d := range s.debugs {
+		if d.File == file || filepath.Base(d.File) == file || filepath.Clean(d.File) == filepath.Clean(file) {
+			return d
+		}
+	}
+	return nil
+}
+
+// Files returns the debug info of every loaded class
+func (s *Session) Files() []*codegen.Debug {
+	var debugs []*codegen.Debug
+	for _, d := range s.debugs {
+		debugs = append(debugs, d)
+	}
+	sort.Slice(debugs, func(i, j int) bool { return debugs[i].File < debugs[j].File })
+	return debugs
+}
+
+// FindFile returns the debug info of the given file, see SetBreakpoint
+func (s *Session) FindFile(file string) *codegen.Debug {
+	return s.findDebug(file)
+}
+
+// run steps the machine until done reports true, a breakpoint is reached or
+// limit (if not 0) commands are run
+func (s *Session) run(limit uint64, done func(pc int) bool) (StopReason, error) {
+	for i := uint64(0); limit == 0 || i < limit; i++ {
+		if atomic.CompareAndSwapInt32(&s.paused, 1, 0) {
+			return StopPause, nil
+		}
+		err := s.M.Step()
+		if errors.Is(err, vm.ErrHalted) || s.M.Halted() {
+			return StopHalted, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		pc := s.M.PC()
+		if s.breakpoints[pc] {
+			return StopBreakpoint, nil
+		}
+		if done(pc) {
+			return StopStep, nil
+		}
+	}
+	return StopLimit, nil
+}
+
+// Pause stops the running command, it can be called from any goroutine
+func (s *Session) Pause() {
+	atomic.StoreInt32(&s.paused, 1)
+}
+
+func (s *Session) Continue(limit uint64) (StopReason, error) {
+	return s.run(limit, func(int) bool { return false })
+}
+
+// StepInto runs until a statement of another line or call is reached
+func (s *Session) StepInto(limit uint64) (StopReason, error) {
+	start, depth := s.Location(), s.M.Depth()
+	return s.run(limit, func(pc int) bool {
+		return s.stmts[pc] && (s.locs[pc] != start || s.M.Depth() != depth)
+	})
+}
+
+// StepOver runs until a statement of another line is reached without
+// stopping within the called subroutines
+func (s *Session) StepOver(limit uint64) (StopReason, error) {
+	start, depth := s.Location(), s.M.Depth()
+	return s.run(limit, func(pc int) bool {
+		d := s.M.Depth()
+		return s.stmts[pc] && (d < depth || (d == depth && s.locs[pc] != start))
+	})
+}
+
+// StepOut runs until the current subroutine returns
+func (s *Session) StepOut(limit uint64) (StopReason, error) {
+	depth := s.M.Depth()
+	return s.run(limit, func(pc int) bool {
+		return s.M.Depth() < depth && s.locationAt(pc).Valid()
+	})
+}
+
+type StackFrame struct {
+	vm.Frame
+	Location Location
+}
+
+func (s *Session) Stack() (stack []StackFrame) {
+	for _, f := range s.M.Frames() {
+		stack = append(stack, StackFrame{Frame: f, Location: s.locationAt(f.PC)})
+	}
+	return
+}
+
+type VarKind string
+
+const (
+	KindArg    VarKind = "argument"
+	KindLocal  VarKind = "local"
+	KindField  VarKind = "field"
+	KindStatic VarKind = "static"
+)
+
+type Variable struct {
+	codegen.Var
+	Kind  VarKind
+	Addr  uint16
+	Value int16
+}
+
+// Display formats the value according to the var type
+func (v Variable) Display() string {
+	switch v.Type {
+	case "int":
+		return fmt.Sprint(v.Value)
+	case "boolean":
+		if v.Value == 0 {
+			return "false"
+		}
+		return "true"
+	case "char":
+		if v.Value >= ' ' && v.Value < 127 {
+			return fmt.Sprintf("%q", rune(v.Value))
+		}
+		return fmt.Sprint(v.Value)
+	}
+	if v.Value == 0 {
+		return "null"
+	}
+	return fmt.Sprintf("%s@%d", v.Type, v.Value)
+}
+
+// Variables returns the vars in scope of the given frame, 0 being the innermost
+func (s *Session) Variables(frame int) ([]Variable, error) {
+	frames := s.M.Frames()
+	if frame < 0 || frame >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	f := frames[frame]
+	sub, ok := s.subroutines[f.Function]
+	if !ok {
+		return nil, fmt.Errorf("no debug info for %s", f.Function)
+	}
+	var vars []Variable
+	// the addresses wrap around the ram like the ones of the machine, as the
+	// pointers may not be set yet
+	add := func(kind VarKind, base int16, vs []codegen.Var) {
+		for _, v := range vs {
+			addr := uint16(base+int16(v.Index)) & (hack.MemSize - 1)
+			vars = append(vars, Variable{Var: v, Kind: kind, Addr: addr, Value: s.M.RAM[addr]})
+		}
+	}
+	add(KindArg, f.ARG, sub.Args)
+	add(KindLocal, f.LCL, sub.Locals)
+
+	className := strings.Split(f.Function, ".")[0]
+	d := s.debugs[className]
+	if sub.Kind != "function" && f.THIS != 0 {
+		add(KindField, f.THIS, d.Fields)
+	}
+	for _, v := range d.Statics {
+		addr, ok := s.M.StaticAddr(className, uint16(v.Index))
+		var value int16
+		if ok {
+			value = s.M.RAM[addr]
+		}
+		vars = append(vars, Variable{Var: v, Kind: KindStatic, Addr: addr, Value: value})
+	}
+	return vars, nil
+}
@@ -0,0 +1,85 @@
+package debugger
+
+import (
+	"testing"
+)
+
+const limit = 10000000
+
+func TestSession_ConvertToBin(t *testing.T) {
+	s, err := Load("../../projects/11/ConvertToBin", "../../tools/OS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.SetBreakpoint("Main.jack", 44); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.SetBreakpoint("Main", 40); err == nil {
+		t.Error("expected error on a line without statements")
+	}
+
+	reason, err := s.Continue(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != StopBreakpoint || s.Location().Line != 44 {
+		t.Fatalf("stopped by %s at %s, want breakpoint at line 44", reason, s.Location())
+	}
+	wantVars := map[string]string{"value": "0", "mask": "0", "position": "1", "loop": "true"}
+	checkVars(t, s, 0, wantVars)
+
+	if _, err = s.StepInto(limit); err != nil {
+		t.Fatal(err)
+	}
+	stack := s.Stack()
+	var fns []string
+	for _, f := range stack {
+		fns = append(fns, f.Function)
+	}
+	if len(fns) != 4 || fns[0] != "Main.nextMask" || fns[1] != "Main.convert" || fns[2] != "Main.main" {
+		t.Fatalf("unexpected stack %v", fns)
+	}
+	if line := stack[0].Location.Line; line != 64 {
+		t.Errorf("stepped into line %d, want 64", line)
+	}
+	if line := stack[1].Location.Line; line != 44 {
+		t.Errorf("caller at line %d, want 44", line)
+	}
+
+	if _, err = s.StepOut(limit); err != nil {
+		t.Fatal(err)
+	}
+	if fn := s.Stack()[0].Function; fn != "Main.convert" {
+		t.Fatalf("stepped out to %s, want Main.convert", fn)
+	}
+	s.ClearBreakpoints()
+	if _, err = s.StepOver(limit); err != nil {
+		t.Fatal(err)
+	}
+	if line := s.Location().Line; line != 46 {
+		t.Errorf("stepped over to line %d, want 46", line)
+	}
+	wantVars["mask"] = "1"
+	checkVars(t, s, 0, wantVars)
+
+	reason, err = s.Continue(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != StopLimit {
+		t.Errorf("stopped by %s, want limit as Sys.halt loops forever", reason)
+	}
+}
+
+func checkVars(t *testing.T, s *Session, frame int, want map[string]string) {
+	t.Helper()
+	vars, err := s.Variables(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vars {
+		if w, ok := want[v.Name]; ok && v.Display() != w {
+			t.Errorf("%s = %s, want %s", v.Name, v.Display(), w)
+		}
+	}
+}
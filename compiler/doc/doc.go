@@ -0,0 +1,175 @@
+// Package doc extracts the api of jack classes along with the /** */ comments
+// preceding their declarations, and renders it as HTML or Markdown references.
+package doc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/ast"
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+type Class struct {
+	Name string
+	Doc  string
+	// Vars holds the static and field declarations
+	Vars        []*Var
+	Subroutines []*Subroutine
+}
+
+type Var struct {
+	Kind  string
+	Type  string
+	Names []string
+	Doc   string
+}
+
+type Subroutine struct {
+	Kind   string
+	Return string
+	Name   string
+	Params []Param
+	Doc    string
+}
+
+type Param struct {
+	Type string
+	Name string
+}
+
+// Signature returns the declaration of the subroutine, as in
+// `function int multiply(int x, int y)`
+func (s *Subroutine) Signature() string {
+	var params []string
+	for _, p := range s.Params {
+		params = append(params, p.Type+" "+p.Name)
+	}
+	return s.Kind + " " + s.Return + " " + s.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// Parse extracts the documentation of the given class
+func Parse(src []byte, cfg parser.Config) (*Class, error) {
+	cfg.Mode |= scanner.ScanTrivia
+	p := cfg.New(src)
+	tree := p.ParseTree()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	decl, err := ast.FromTree(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[token.Pos]string)
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		if tok := n.Token(); tok != nil {
+			if text, ok := docComment(tok.Leading); ok {
+				docs[tok.Pos] = text
+			}
+		}
+		for _, child := range n.Children() {
+			walk(child)
+		}
+	}
+	walk(tree.Root)
+
+	class := &Class{Name: decl.Name.Name, Doc: docs[decl.Class]}
+	for _, v := range decl.Vars {
+		dv := &Var{Kind: v.Kind.String(), Type: v.Type.Name, Doc: docs[v.KindPos]}
+		for _, name := range v.Names {
+			dv.Names = append(dv.Names, name.Name)
+		}
+		class.Vars = append(class.Vars, dv)
+	}
+	for _, sub := range decl.Subroutines {
+		ds := &Subroutine{Kind: sub.Kind.String(), Return: sub.Return.Name, Name: sub.Name.Name, Doc: docs[sub.KindPos]}
+		for _, param := range sub.Params {
+			ds.Params = append(ds.Params, Param{Type: param.Type.Name, Name: param.Name.Name})
+		}
+		class.Subroutines = append(class.Subroutines, ds)
+	}
+	return class, nil
+}
+
+// ParseDir extracts the documentation of the classes of the given dir, sorted
+// by name
+func ParseDir(dirname string, cfg parser.Config) ([]*Class, error) {
+	filenames, err := filepath.Glob(filepath.Join(dirname, "*.jack"))
+	if err != nil {
+		return nil, err
+	}
+	var classes []*Class
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		class, err := Parse(src, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", filename, err)
+		}
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+	return classes, nil
+}
+
+// docComment returns the text of the last comment of the trivia when it is
+// a /** */ comment
+func docComment(trivia []scanner.Trivia) (string, bool) {
+	for i := len(trivia) - 1; i >= 0; i-- {
+		t := trivia[i]
+		if t.Token != token.COMMENT {
+			continue
+		}
+		if !strings.HasPrefix(t.Literal, "/**") || t.Literal == "/**/" {
+			return "", false
+		}
+		return cleanComment(t.Literal), true
+	}
+	return "", false
+}
+
+// cleanComment strips the comment delimiters and the stars and indentation
+// beginning its lines
+func cleanComment(lit string) string {
+	lit = strings.TrimSuffix(strings.TrimPrefix(lit, "/**"), "*/")
+	var lines []string
+	for _, line := range strings.Split(lit, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// paragraphs splits documentation text at its blank lines, keeping the lines
+// of every paragraph as they may list values, as the key codes of
+// Keyboard.keyPressed do
+func paragraphs(text string) (ps [][]string) {
+	for _, p := range strings.Split(text, "\n\n") {
+		var lines []string
+		for _, line := range strings.Split(p, "\n") {
+			if line = flatten(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			ps = append(ps, lines)
+		}
+	}
+	return
+}
+
+// flatten joins the words of the text with single spaces
+func flatten(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
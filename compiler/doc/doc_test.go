@@ -0,0 +1,122 @@
+package doc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+)
+
+const pointSrc = `// Point.jack
+
+/**
+ * A point of the screen.
+ *
+ * See Screen.drawPixel.
+ */
+class Point {
+    /** The coordinates. */
+    field int x, y;
+    // not documented
+    static int count;
+
+    /** Creates a point at x, y. */
+    constructor Point new(int ax, int ay) { return this; }
+
+    /* not a doc comment */
+    method boolean equals(Point other) { return true; }
+}`
+
+const screenSrc = `class Screen {
+    /**
+     * Draws the pixel at p, colored by:
+     * true = black
+     * false = white
+     */
+    function void drawPixel(Point p) { return; }
+}`
+
+func TestParse(t *testing.T) {
+	class, err := Parse([]byte(pointSrc), parser.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class.Name != "Point" || class.Doc != "A point of the screen.\n\nSee Screen.drawPixel." {
+		t.Errorf("class = %q, doc %q", class.Name, class.Doc)
+	}
+	want := []*Var{
+		{Kind: "field", Type: "int", Names: []string{"x", "y"}, Doc: "The coordinates."},
+		{Kind: "static", Type: "int", Names: []string{"count"}},
+	}
+	if !reflect.DeepEqual(class.Vars, want) {
+		t.Errorf("vars = %+v, want %+v", class.Vars, want)
+	}
+	subs := class.Subroutines
+	if len(subs) != 2 || subs[0].Doc != "Creates a point at x, y." || subs[1].Doc != "" {
+		t.Fatalf("subroutines = %+v", subs)
+	}
+	if sig := subs[1].Signature(); sig != "method boolean equals(Point other)" {
+		t.Errorf("Signature() = %q", sig)
+	}
+}
+
+func TestRender(t *testing.T) {
+	var classes []*Class
+	for _, src := range []string{pointSrc, screenSrc} {
+		class, err := Parse([]byte(src), parser.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		classes = append(classes, class)
+	}
+
+	var buf bytes.Buffer
+	if err := HTML(&buf, classes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h2 id="Point">class Point</h2>`,
+		`<p>See <a href="#Screen.drawPixel">Screen.drawPixel</a>.</p>`,
+		`<dt><code>field int x, y</code></dt>`,
+		`<h4 id="Point.new"><code>constructor <a href="#Point">Point</a> new(int ax, int ay)</code></h4>`,
+		`<h4 id="Screen.drawPixel"><code>function void drawPixel(<a href="#Point">Point</a> p)</code></h4>`,
+		"<p>Draws the pixel at p, colored by:<br>\ntrue = black<br>\nfalse = white</p>",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("HTML() misses %q in\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := Markdown(&buf, classes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"- [Point](#point)\n",
+		"## Point\n\nA point of the screen.\n\nSee [Screen.drawPixel](#screen).\n",
+		"- field int x, y: The coordinates.\n- static int count\n",
+		"#### method boolean equals([Point](#point) other)\n\n## Screen",
+		"Draws the pixel at p, colored by:\\\ntrue = black\\\nfalse = white\n\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Markdown() misses %q in\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestParseDir(t *testing.T) {
+	classes, err := ParseDir("../../projects/12", parser.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(classes) != 8 || classes[2].Name != "Math" {
+		t.Fatalf("ParseDir() = %d classes", len(classes))
+	}
+	for _, sub := range classes[2].Subroutines {
+		if sub.Doc == "" {
+			t.Errorf("Math.%s has no doc", sub.Name)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package doc
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const title = "Jack API"
+
+// reference matches the mentions of classes and their subroutines in the docs
+var reference = regexp.MustCompile(`\b[A-Z]\w*(\.\w+)?\b`)
+
+// renderer writes the documentation of the classes, linking the mentions of
+// each other
+type renderer struct {
+	w       *bufio.Writer
+	classes map[string]*Class
+	escape  func(string) string
+	// link returns the link to the given class, or to its subroutine when
+	// sub is not empty
+	link func(text, class, sub string) string
+}
+
+func newRenderer(w io.Writer, classes []*Class) *renderer {
+	r := &renderer{w: bufio.NewWriter(w), classes: make(map[string]*Class)}
+	for _, class := range classes {
+		r.classes[class.Name] = class
+	}
+	return r
+}
+
+func (r *renderer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, format, args...)
+}
+
+// typeName escapes the given type, linking it when it is a documented class
+func (r *renderer) typeName(name string) string {
+	if r.classes[name] != nil {
+		return r.link(name, name, "")
+	}
+	return r.escape(name)
+}
+
+func (r *renderer) signature(s *Subroutine) string {
+	var params []string
+	for _, p := range s.Params {
+		params = append(params, r.typeName(p.Type)+" "+r.escape(p.Name))
+	}
+	return s.Kind + " " + r.typeName(s.Return) + " " + r.escape(s.Name) + "(" + strings.Join(params, ", ") + ")"
+}
+
+// text escapes a paragraph of the docs of the given class, linking its
+// mentions of other classes and of any subroutine
+func (r *renderer) text(class *Class, p string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range reference.FindAllStringIndex(p, -1) {
+		ref := p[loc[0]:loc[1]]
+		name, sub := ref, ""
+		if i := strings.IndexByte(ref, '.'); i >= 0 {
+			name, sub = ref[:i], ref[i+1:]
+		}
+		target := r.classes[name]
+		if target == nil || (sub == "" && target == class) || (sub != "" && !target.has(sub)) {
+			continue
+		}
+		sb.WriteString(r.escape(p[last:loc[0]]))
+		sb.WriteString(r.link(r.escape(ref), name, sub))
+		last = loc[1]
+	}
+	sb.WriteString(r.escape(p[last:]))
+	return sb.String()
+}
+
+// lines renders the lines of a paragraph of the docs of the given class,
+// separated by br
+func (r *renderer) lines(class *Class, lines []string, br string) string {
+	var texts []string
+	for _, line := range lines {
+		texts = append(texts, r.text(class, line))
+	}
+	return strings.Join(texts, br)
+}
+
+func (c *Class) has(sub string) bool {
+	for _, s := range c.Subroutines {
+		if s.Name == sub {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *renderer) vars(v *Var) string {
+	return v.Kind + " " + r.typeName(v.Type) + " " + r.escape(strings.Join(v.Names, ", "))
+}
+
+// HTML writes a single page reference of the given classes
+func HTML(w io.Writer, classes []*Class) error {
+	r := newRenderer(w, classes)
+	r.escape = html.EscapeString
+	r.link = func(text, class, sub string) string {
+		if sub != "" {
+			class += "." + sub
+		}
+		return fmt.Sprintf(`<a href="#%s">%s</a>`, class, text)
+	}
+	writeDoc := func(class *Class, text string) {
+		for _, p := range paragraphs(text) {
+			r.printf("<p>%s</p>\n", r.lines(class, p, "<br>\n"))
+		}
+	}
+
+	r.printf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n", title)
+	r.printf("<h1>%s</h1>\n<ul>\n", title)
+	for _, class := range classes {
+		r.printf("<li>%s</li>\n", r.link(class.Name, class.Name, ""))
+	}
+	r.printf("</ul>\n")
+	for _, class := range classes {
+		r.printf("<h2 id=\"%s\">class %s</h2>\n", class.Name, class.Name)
+		writeDoc(class, class.Doc)
+		if len(class.Vars) > 0 {
+			r.printf("<h3>Variables</h3>\n<dl>\n")
+			for _, v := range class.Vars {
+				r.printf("<dt><code>%s</code></dt>\n", r.vars(v))
+				r.printf("<dd>%s</dd>\n", r.text(class, flatten(v.Doc)))
+			}
+			r.printf("</dl>\n")
+		}
+		if len(class.Subroutines) > 0 {
+			r.printf("<h3>Subroutines</h3>\n")
+		}
+		for _, sub := range class.Subroutines {
+			r.printf("<h4 id=\"%s.%s\"><code>%s</code></h4>\n", class.Name, sub.Name, r.signature(sub))
+			writeDoc(class, sub.Doc)
+		}
+	}
+	r.printf("</body>\n</html>\n")
+	return r.w.Flush()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;", "#", `\#`,
+)
+
+// Markdown writes a reference of the given classes. Links point at the
+// headings of the classes, as anchored by common renderers
+func Markdown(w io.Writer, classes []*Class) error {
+	r := newRenderer(w, classes)
+	r.escape = markdownEscaper.Replace
+	r.link = func(text, class, sub string) string {
+		return fmt.Sprintf("[%s](#%s)", text, strings.ToLower(class))
+	}
+	writeDoc := func(class *Class, text string) {
+		// a backslash ending a line breaks it
+		for _, p := range paragraphs(text) {
+			r.printf("%s\n\n", r.lines(class, p, "\\\n"))
+		}
+	}
+
+	r.printf("# %s\n\n", title)
+	for _, class := range classes {
+		r.printf("- %s\n", r.link(class.Name, class.Name, ""))
+	}
+	r.printf("\n")
+	for _, class := range classes {
+		r.printf("## %s\n\n", class.Name)
+		writeDoc(class, class.Doc)
+		if len(class.Vars) > 0 {
+			r.printf("### Variables\n\n")
+			for _, v := range class.Vars {
+				r.printf("- %s", r.vars(v))
+				if v.Doc != "" {
+					r.printf(": %s", r.text(class, flatten(v.Doc)))
+				}
+				r.printf("\n")
+			}
+			r.printf("\n")
+		}
+		if len(class.Subroutines) > 0 {
+			r.printf("### Subroutines\n\n")
+		}
+		for _, sub := range class.Subroutines {
+			r.printf("#### %s\n\n", r.signature(sub))
+			writeDoc(class, sub.Doc)
+		}
+	}
+	return r.w.Flush()
+}
@@ -0,0 +1,443 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+const indentation = "    "
+
+// Source reprints the given class with consistent indentation, spacing and
+// brace placement, keeping its comments and up to one blank line between
+// declarations and statements
+func Source(src []byte, cfg parser.Config) ([]byte, error) {
+	p := cfg.New(src)
+	tree := p.ParseTree()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	pr := &printer{lineStart: true}
+	pr.collectComments(src, cfg.Mode)
+	pr.class(tree.Root)
+	pr.leading(pr.eof)
+
+	out := pr.buf.Bytes()
+	if bytes.Contains(src, []byte("\r\n")) {
+		out = bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n"))
+	}
+	return out, nil
+}
+
+type comment struct {
+	text    string
+	pos     token.Pos
+	endLine int
+	// cont is set on the comments continuing a trailing comment on the lines
+	// below, at the same column
+	cont bool
+}
+
+func (c *comment) isLine() bool {
+	return strings.HasPrefix(c.text, "//")
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	// comments are attached to the token they follow within the same line, or
+	// else to the token they precede
+	leadingComments  map[token.Pos][]*comment
+	trailingComments map[token.Pos][]*comment
+	eof              token.Pos
+
+	lastLine  int // source line where the last printed token or comment ends
+	lineStart bool
+	wantSpace bool
+	afterOpen bool // the last printed token opened a block
+	pendingNL bool // a line comment ended the current line
+}
+
+func (p *printer) collectComments(src []byte, mode scanner.Mode) {
+	p.leadingComments = make(map[token.Pos][]*comment)
+	p.trailingComments = make(map[token.Pos][]*comment)
+	s := scanner.NewWithMode(src, mode|scanner.ScanComments)
+	var prev *token.Pos
+	var pending []*comment
+	for {
+		tok, lit := s.Scan()
+		pos := s.Pos()
+		switch tok {
+		case token.COMMENT:
+			c := &comment{text: lit, pos: pos, endLine: pos.Line + strings.Count(lit, "\n")}
+			if prev != nil && len(pending) == 0 {
+				trailing := p.trailingComments[*prev]
+				if n := len(trailing); n > 0 {
+					last := trailing[n-1]
+					c.cont = last.isLine() && c.isLine() && c.pos.Line == last.endLine+1 && c.pos.Col == last.pos.Col
+				}
+				if prev.Line == pos.Line || c.cont {
+					p.trailingComments[*prev] = append(trailing, c)
+					continue
+				}
+			}
+			pending = append(pending, c)
+			continue
+		case token.EOF:
+			p.eof = pos
+		}
+		if len(pending) > 0 {
+			p.leadingComments[pos] = pending
+			pending = nil
+		}
+		if tok == token.EOF {
+			return
+		}
+		prev = &pos
+	}
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.lineStart = true
+	p.wantSpace = false
+	p.pendingNL = false
+}
+
+func (p *printer) space() {
+	p.wantSpace = true
+}
+
+// blank separates what follows with an empty line, unless it already is or it
+// would be the first line of a block
+func (p *printer) blank() {
+	if p.buf.Len() == 0 || p.afterOpen || bytes.HasSuffix(p.buf.Bytes(), []byte("\n\n")) {
+		return
+	}
+	if !p.lineStart {
+		p.newline()
+	}
+	p.newline()
+}
+
+// startLine prepares the output to print something found at the given source
+// line, keeping a single blank line from the original when there was one
+func (p *printer) startLine(line int, allowBlank bool) {
+	if p.pendingNL {
+		p.newline()
+	}
+	if p.lineStart {
+		if allowBlank && p.lastLine > 0 && line > p.lastLine+1 {
+			p.blank()
+		}
+		p.write(strings.Repeat(indentation, p.indent))
+		p.lineStart = false
+		p.wantSpace = false
+	} else if p.wantSpace {
+		p.write(" ")
+		p.wantSpace = false
+	}
+}
+
+func (p *printer) leading(pos token.Pos) {
+	for _, c := range p.leadingComments[pos] {
+		if !p.lineStart {
+			p.newline()
+		}
+		p.startLine(c.pos.Line, true)
+		p.comment(c)
+		p.newline()
+	}
+}
+
+func (p *printer) trailing(pos token.Pos) {
+	col := 0
+	for _, c := range p.trailingComments[pos] {
+		if c.cont {
+			p.write("\n" + strings.Repeat(" ", col))
+		} else {
+			p.write(" ")
+			col = p.column()
+		}
+		p.comment(c)
+		p.pendingNL = c.isLine() || c.endLine > c.pos.Line
+		p.wantSpace = true
+	}
+}
+
+func (p *printer) column() int {
+	b := p.buf.Bytes()
+	return len(b) - bytes.LastIndexByte(b, '\n') - 1
+}
+
+func (p *printer) comment(c *comment) {
+	lines := strings.Split(c.text, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if i > 0 {
+			p.write("\n")
+			if trimmed := strings.TrimLeft(line, " \t"); strings.HasPrefix(trimmed, "*") {
+				line = strings.Repeat(indentation, p.indent) + " " + trimmed
+			}
+		}
+		p.write(line)
+	}
+	p.lastLine = c.endLine
+	p.afterOpen = false
+}
+
+func (p *printer) emit(tok *parse.Token) {
+	p.startLine(tok.Pos.Line, !tok.Is(token.RBRACE))
+	p.write(tok.Text())
+	p.lastLine = tok.Pos.Line
+	p.afterOpen = tok.Is(token.LBRACE)
+	p.trailing(tok.Pos)
+}
+
+func (p *printer) token(n parse.Node) {
+	tok := n.Token()
+	p.leading(tok.Pos)
+	p.emit(tok)
+}
+
+// open prints the brace opening a block and indents its content
+func (p *printer) open(n parse.Node) {
+	p.space()
+	p.token(n)
+	p.indent++
+	p.newline()
+}
+
+// close prints the brace closing a block, keeping the comments preceding it
+// at the indentation of the block content
+func (p *printer) close(n parse.Node) {
+	tok := n.Token()
+	p.leading(tok.Pos)
+	p.indent--
+	if !p.lineStart {
+		p.newline()
+	}
+	p.emit(tok)
+}
+
+// words prints the given tokens separated by a space, except for the commas
+// and semicolons
+func (p *printer) words(nodes []parse.Node) {
+	for i, n := range nodes {
+		if i > 0 && !n.Token().Is(token.COMMA) && !n.Token().Is(token.SEMICOLON) {
+			p.space()
+		}
+		p.token(n)
+	}
+}
+
+func (p *printer) class(n parse.Node) {
+	children := n.Children()
+	p.words(children[:2])
+	p.open(children[2])
+	first := true
+	for _, child := range children[3 : len(children)-1] {
+		if child.Type() == parse.NodeSubroutineDec && !first {
+			p.blank()
+		}
+		switch child.Type() {
+		case parse.NodeClassVarDec:
+			p.words(child.Children())
+		case parse.NodeSubroutineDec:
+			p.subroutineDec(child)
+		}
+		p.newline()
+		first = false
+	}
+	p.close(children[len(children)-1])
+	p.newline()
+}
+
+func (p *printer) subroutineDec(n parse.Node) {
+	for i, child := range n.Children() {
+		switch {
+		case child.Type() == parse.NodeParameterList:
+			p.words(child.Children())
+		case child.Type() == parse.NodeSubroutineBody:
+			p.subroutineBody(child)
+		case i > 0 && i < 3:
+			p.space()
+			p.token(child)
+		default:
+			p.token(child)
+		}
+	}
+}
+
+func (p *printer) subroutineBody(n parse.Node) {
+	children := n.Children()
+	p.open(children[0])
+	for _, child := range children[1 : len(children)-1] {
+		if child.Type() == parse.NodeVarDec {
+			p.words(child.Children())
+			p.newline()
+			continue
+		}
+		p.statement(child)
+	}
+	p.close(children[len(children)-1])
+}
+
+func (p *printer) statements(nodes []parse.Node) {
+	for _, n := range nodes {
+		p.statement(n)
+	}
+}
+
+func (p *printer) statement(n parse.Node) {
+	p.clause(n)
+	p.newline()
+}
+
+// clause prints a statement without ending its line
+func (p *printer) clause(n parse.Node) {
+	children := n.Children()
+	switch n.Type() {
+	case parse.NodeLetStatement:
+		p.token(children[0])
+		p.space()
+		p.assignment(children[1 : len(children)-1])
+		p.token(children[len(children)-1])
+	case parse.NodeForStatement:
+		p.token(children[0])
+		p.space()
+		i := 1
+		for ; !children[i].Token().Is(token.RPAREN); i++ {
+			child := children[i]
+			switch {
+			case child.Type() == parse.NodeAssignment:
+				p.assignment(child.Children())
+			case child.Type() == parse.NodeExpression:
+				p.expression(child)
+			default:
+				p.token(child)
+				if child.Token().Is(token.SEMICOLON) && !children[i+1].Token().Is(token.RPAREN) {
+					p.space()
+				}
+			}
+		}
+		p.token(children[i])
+		p.block(children[i+1:])
+	case parse.NodeIfStatement, parse.NodeWhileStatement:
+		p.token(children[0])
+		p.space()
+		p.token(children[1])
+		p.expression(children[2])
+		p.token(children[3])
+		p.block(children[4:])
+	case parse.NodeDoStatement:
+		p.token(children[0])
+		p.space()
+		p.subroutineCall(children[1])
+		p.token(children[2])
+	case parse.NodeReturnStatement:
+		p.token(children[0])
+		if len(children) > 2 {
+			p.space()
+			p.expression(children[1])
+		}
+		p.token(children[len(children)-1])
+	}
+}
+
+// assignment prints `name ([ index ])? op value`
+func (p *printer) assignment(nodes []parse.Node) {
+	p.token(nodes[0])
+	rest := nodes[1:]
+	if rest[0].Token().Is(token.LBRACK) {
+		p.token(rest[0])
+		p.expression(rest[1])
+		p.token(rest[2])
+		rest = rest[3:]
+	}
+	p.space()
+	p.token(rest[0])
+	p.space()
+	p.expression(rest[1])
+}
+
+// block prints the braced statements of an if, while or for, followed by the
+// else branch if any
+func (p *printer) block(nodes []parse.Node) {
+	p.open(nodes[0])
+	end := 1
+	for !nodes[end].Token().Is(token.RBRACE) {
+		end++
+	}
+	p.statements(nodes[1:end])
+	p.close(nodes[end])
+	if rest := nodes[end+1:]; len(rest) > 0 {
+		p.space()
+		p.token(rest[0])
+		if rest[1].Type() == parse.NodeIfStatement {
+			p.space()
+			p.clause(rest[1])
+			return
+		}
+		p.block(rest[1:])
+	}
+}
+
+func (p *printer) expression(n parse.Node) {
+	for i, child := range n.Children() {
+		if child.Token() == nil {
+			p.node(child)
+			continue
+		}
+		// binary operator
+		if i > 0 {
+			p.space()
+		}
+		p.token(child)
+		p.space()
+	}
+}
+
+func (p *printer) term(n parse.Node) {
+	for _, child := range n.Children() {
+		p.node(child)
+	}
+}
+
+func (p *printer) subroutineCall(n parse.Node) {
+	for _, child := range n.Children() {
+		p.node(child)
+	}
+}
+
+func (p *printer) node(n parse.Node) {
+	switch n.Type() {
+	case parse.NodeTerm:
+		p.term(n)
+	case parse.NodeExpression:
+		p.expression(n)
+	case parse.NodeSubroutineCall:
+		p.subroutineCall(n)
+	case parse.NodeExpressionList:
+		for _, child := range n.Children() {
+			if child.Token().Is(token.COMMA) {
+				p.token(child)
+				p.space()
+				continue
+			}
+			p.expression(child)
+		}
+	default:
+		p.token(n)
+	}
+}
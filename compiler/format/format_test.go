@@ -0,0 +1,166 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+func TestSource(t *testing.T) {
+	src := `// Main class
+class Main{
+  static int  n;   // counter
+field Array a,b;
+  /** Entry point */
+  function void main( ) {
+  var int i ;
+
+
+  let i=-i+ (2*a[i]) ;// trailing
+  if(i<0){let i=0;}else{do Output.printInt(i,   n);}
+  while (~(i = 0)) { let i = i - 1; }
+  // before brace
+  return ;
+  }
+  method int get() { return "s"; }
+}
+`
+	want := `// Main class
+class Main {
+    static int n; // counter
+    field Array a, b;
+
+    /** Entry point */
+    function void main() {
+        var int i;
+
+        let i = -i + (2 * a[i]); // trailing
+        if (i < 0) {
+            let i = 0;
+        } else {
+            do Output.printInt(i, n);
+        }
+        while (~(i = 0)) {
+            let i = i - 1;
+        }
+        // before brace
+        return;
+    }
+
+    method int get() {
+        return "s";
+    }
+}
+`
+	got, err := Source([]byte(src), parser.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Source() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSource_Dialect(t *testing.T) {
+	src := `class Main {
+  function void main() {
+    var int i;
+    for(i=0;i<0x10;i+=1){let i*=2+'a';}
+    for(;i>0;){let i=i-1;}
+    if(i<0){let i=0;}else   if(i=1){let i=2;}else{return;}
+    return;
+  }
+}
+`
+	want := `class Main {
+    function void main() {
+        var int i;
+        for (i = 0; i < 0x10; i += 1) {
+            let i *= 2 + 'a';
+        }
+        for (; i > 0;) {
+            let i = i - 1;
+        }
+        if (i < 0) {
+            let i = 0;
+        } else if (i = 1) {
+            let i = 2;
+        } else {
+            return;
+        }
+        return;
+    }
+}
+`
+	got, err := Source([]byte(src), parser.Config{Mode: scanner.ScanDialect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Source() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSource_Error(t *testing.T) {
+	_, err := Source([]byte("class Main { function void main() { let = 1; } }"), parser.Config{})
+	if err == nil {
+		t.Error("Source() expected an error")
+	}
+}
+
+// TestSource_Projects formats every class of the projects, checking that the
+// result is stable and keeps the same tokens and comments
+func TestSource_Projects(t *testing.T) {
+	var filenames []string
+	err := filepath.Walk("../../projects", func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".jack" {
+			filenames = append(filenames, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		t.Fatal("no jack files found")
+	}
+	for _, filename := range filenames {
+		t.Run(filename, func(t *testing.T) {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			once, err := Source(src, parser.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			twice, err := Source(once, parser.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(once) != string(twice) {
+				t.Errorf("Source() is not idempotent:\n%s\n---\n%s", once, twice)
+			}
+			if !reflect.DeepEqual(scan(src, 0), scan(once, 0)) {
+				t.Error("Source() changed the tokens")
+			}
+			if got, want := len(scan(once, scanner.ScanComments)), len(scan(src, scanner.ScanComments)); got != want {
+				t.Errorf("Source() kept %d tokens and comments, want %d", got, want)
+			}
+		})
+	}
+}
+
+func scan(src []byte, mode scanner.Mode) []string {
+	var lits []string
+	s := scanner.NewWithMode(src, mode)
+	for tok, lit := s.Scan(); tok != token.EOF; tok, lit = s.Scan() {
+		lits = append(lits, lit)
+	}
+	return lits
+}
@@ -2,4 +2,4 @@ module github.com/schattian/nand2tetris/compiler
 
 go 1.16
 
-require github.com/google/go-cmp v0.5.6 // indirect
+require github.com/google/go-cmp v0.5.6
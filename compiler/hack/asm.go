@@ -0,0 +1,199 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const variablesStart = 16
+
+var predefinedSymbols = map[string]uint16{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": Screen,
+	"KBD":    Kbd,
+}
+
+func init() {
+	for i := uint16(0); i < 16; i++ {
+		predefinedSymbols[fmt.Sprintf("R%d", i)] = i
+	}
+}
+
+var compToBinary = map[string]uint16{
+	"0":  0b0101010,
+	"1":  0b0111111,
+	"-1": 0b0111010,
+
+	"D":  0b0001100,
+	"A":  0b0110000,
+	"!D": 0b0001101,
+	"!A": 0b0110001,
+	"-D": 0b0001111,
+	"-A": 0b0110011,
+
+	"D+1": 0b0011111,
+	"A+1": 0b0110111,
+	"D-1": 0b0001110,
+	"A-1": 0b0110010,
+	"D+A": 0b0000010,
+	"D-A": 0b0010011,
+	"A-D": 0b0000111,
+	"D&A": 0b0000000,
+	"D|A": 0b0010101,
+
+	"M":  0b1110000,
+	"!M": 0b1110001,
+	"-M": 0b1110011,
+
+	"M+1": 0b1110111,
+	"M-1": 0b1110010,
+	"D+M": 0b1000010,
+	"D-M": 0b1010011,
+	"M-D": 0b1000111,
+	"D&M": 0b1000000,
+	"D|M": 0b1010101,
+}
+
+var destToBinary = map[string]uint16{
+	"":    0b000,
+	"M":   0b001,
+	"D":   0b010,
+	"A":   0b100,
+	"MD":  0b011,
+	"AM":  0b101,
+	"AD":  0b110,
+	"AMD": 0b111,
+}
+
+var jmpToBinary = map[string]uint16{
+	"":    0b000,
+	"JGT": 0b001,
+	"JEQ": 0b010,
+	"JGE": 0b011,
+	"JLT": 0b100,
+	"JNE": 0b101,
+	"JLE": 0b110,
+	"JMP": 0b111,
+}
+
+// Program is an assembled hack program along with its symbol table
+type Program struct {
+	ROM []uint16
+	// Labels maps every label definition to its rom address
+	Labels map[string]uint16
+	// Variables maps every variable to its ram address
+	Variables map[string]uint16
+	// Lines holds the source line of every rom instruction
+	Lines []int
+}
+
+func Assemble(r io.Reader) (*Program, error) {
+	type instruction struct {
+		text string
+		ln   int
+	}
+	var instructions []instruction
+	p := &Program{Labels: make(map[string]uint16), Variables: make(map[string]uint16)}
+
+	s := bufio.NewScanner(r)
+	for ln := 1; s.Scan(); ln++ {
+		text := stripComments(s.Text())
+		if text == "" {
+			continue
+		}
+		if isLabelDef(text) {
+			p.Labels[text[1:len(text)-1]] = uint16(len(instructions))
+			continue
+		}
+		instructions = append(instructions, instruction{text: text, ln: ln})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, inst := range instructions {
+		var code uint16
+		var err error
+		if inst.text[0] == '@' {
+			code, err = p.assembleA(inst.text[1:])
+		} else {
+			code, err = assembleC(inst.text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", inst.ln, err)
+		}
+		p.ROM = append(p.ROM, code)
+		p.Lines = append(p.Lines, inst.ln)
+	}
+	return p, nil
+}
+
+func AssembleFile(filename string) (*Program, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Assemble(f)
+}
+
+func (p *Program) assembleA(symbol string) (uint16, error) {
+	if addr, err := strconv.Atoi(symbol); err == nil {
+		if addr < 0 || addr >= instC {
+			return 0, fmt.Errorf("a instruction out of range: %d", addr)
+		}
+		return uint16(addr), nil
+	}
+	if addr, ok := predefinedSymbols[symbol]; ok {
+		return addr, nil
+	}
+	if addr, ok := p.Labels[symbol]; ok {
+		return addr, nil
+	}
+	addr, ok := p.Variables[symbol]
+	if !ok {
+		addr = variablesStart + uint16(len(p.Variables))
+		p.Variables[symbol] = addr
+	}
+	return addr, nil
+}
+
+func assembleC(text string) (uint16, error) {
+	var dest, jmp string
+	comp := text
+	if i := strings.Index(comp, ";"); i >= 0 {
+		comp, jmp = comp[:i], comp[i+1:]
+	}
+	if i := strings.Index(comp, "="); i >= 0 {
+		dest, comp = comp[:i], comp[i+1:]
+	}
+	compBits, ok := compToBinary[comp]
+	if !ok {
+		return 0, fmt.Errorf("unknown comp: %q", comp)
+	}
+	destBits, ok := destToBinary[dest]
+	if !ok {
+		return 0, fmt.Errorf("unknown dest: %q", dest)
+	}
+	jmpBits, ok := jmpToBinary[jmp]
+	if !ok {
+		return 0, fmt.Errorf("unknown jump: %q", jmp)
+	}
+	return 0b111<<13 | compBits<<6 | destBits<<3 | jmpBits, nil
+}
+
+func isLabelDef(s string) bool {
+	return s[0] == '(' && s[len(s)-1] == ')'
+}
+
+func stripComments(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(strings.Split(s, "//")[0]), " ", "")
+}
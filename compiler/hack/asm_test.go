@@ -0,0 +1,28 @@
+package hack
+
+import (
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	for _, name := range []string{"add/Add", "max/Max", "max/MaxL", "rect/Rect", "pong/Pong", "pong/PongL"} {
+		t.Run(name, func(t *testing.T) {
+			p, err := AssembleFile("../../projects/06/" + name + ".asm")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := ReadROMFile("../../projects/06/" + name + ".hack")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p.ROM) != len(want) {
+				t.Fatalf("len(ROM) = %d, want %d", len(p.ROM), len(want))
+			}
+			for i := range want {
+				if p.ROM[i] != want[i] {
+					t.Fatalf("ROM[%d] = %016b, want %016b", i, p.ROM[i], want[i])
+				}
+			}
+		})
+	}
+}
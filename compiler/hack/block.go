@@ -0,0 +1,131 @@
+package hack
+
+const (
+	// hotBlock is the number of times an address runs before compiling the
+	// block starting at it
+	hotBlock = 16
+	// maxBlock bounds the instructions of the blocks
+	maxBlock = 64
+)
+
+// block is a compiled basic block, the instructions from its start up to the
+// first jump
+type block struct {
+	start, n int
+	run      handler
+}
+
+// code is the rom pre-decoded into a handler per instruction, and the hot
+// blocks compiled so far
+type code struct {
+	rom    []uint16
+	insts  []handler
+	blocks []*block
+	hits   []uint8
+}
+
+func newCode(rom []uint16) *code {
+	x := &code{
+		rom:    rom,
+		insts:  make([]handler, len(rom)),
+		blocks: make([]*block, len(rom)),
+		hits:   make([]uint8, len(rom)),
+	}
+	for pc, inst := range rom {
+		x.insts[pc] = decode(inst, uint16(pc))
+	}
+	return x
+}
+
+// decoded returns the code of the rom, which is decoded again if replaced
+func (c *CPU) decoded() *code {
+	x := c.code
+	if x == nil || len(x.rom) != len(c.ROM) || len(c.ROM) > 0 && &x.rom[0] != &c.ROM[0] {
+		x = newCode(c.ROM)
+		c.code = x
+	}
+	return x
+}
+
+// compile compiles the block starting at pc. Every a-instruction is run along
+// with the c-instruction following it, with a known A
+func (x *code) compile(pc int) *block {
+	var body []op
+	var exit handler
+	end := pc
+	for exit == nil {
+		inst := x.rom[end]
+		switch {
+		case inst&instC == 0 && end+1 < len(x.rom) && end+2-pc <= maxBlock && x.rom[end+1]&instC != 0:
+			a, next := inst, x.rom[end+1]
+			if isJump(next) {
+				j := x.insts[end+1]
+				exit = func(c *CPU) uint16 { c.A = int16(a); return j(c) }
+			} else {
+				body = append(body, decodeConstOp(a, next))
+			}
+			end += 2
+		case isJump(inst):
+			exit = x.insts[end]
+			end++
+		default:
+			if inst&instC == 0 {
+				a := int16(inst)
+				body = append(body, func(c *CPU) { c.A = a })
+			} else {
+				body = append(body, decodeOp(inst))
+			}
+			end++
+		}
+		if exit == nil && (end == len(x.rom) || end-pc == maxBlock) {
+			next := uint16(end)
+			exit = func(c *CPU) uint16 { return next }
+		}
+	}
+	return &block{
+		start: pc,
+		n:     end - pc,
+		run: func(c *CPU) uint16 {
+			for _, f := range body {
+				f(c)
+			}
+			return exit(c)
+		},
+	}
+}
+
+// run runs the pre-decoded instructions, as Step does, for the given cycles
+// or until reaching stop. Blocks run as a whole unless they would pass the
+// cycles, the next key event or stop
+func (c *CPU) run(cycles uint64, stop int) error {
+	x := c.decoded()
+	end := c.Cycles + cycles
+	if end < c.Cycles {
+		end = ^uint64(0)
+	}
+	due := c.Keyboard.due()
+	pc := c.PC
+	defer func() { c.PC = pc }()
+	for c.Cycles < end && int(pc) != stop {
+		if c.Cycles >= due {
+			c.Keyboard.Update(c.Cycles, &c.RAM)
+			due = c.Keyboard.due()
+		}
+		if int(pc) >= len(x.insts) {
+			return ErrPCOutOfRange
+		}
+		if b := x.blocks[pc]; b != nil {
+			n := c.Cycles + uint64(b.n)
+			if n <= end && n <= due && (stop <= b.start || stop >= b.start+b.n) {
+				pc = b.run(c)
+				c.Cycles = n
+				continue
+			}
+		} else if x.hits[pc]++; x.hits[pc] == hotBlock {
+			x.blocks[pc] = x.compile(int(pc))
+		}
+		pc = x.insts[pc](c)
+		c.Cycles++
+	}
+	return nil
+}
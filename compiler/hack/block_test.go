@@ -0,0 +1,178 @@
+package hack
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pongROM = "../../projects/06/pong/Pong.hack"
+
+// stepped returns a cpu running the rom only through Step, which the trace
+// forces
+func stepped(rom []uint16) *CPU {
+	c := NewCPU(rom)
+	c.Trace = NewTrace(nopWriter{}, false, 1)
+	return c
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func assertSameState(t *testing.T, got, want *CPU) {
+	t.Helper()
+	if got.A != want.A || got.D != want.D || got.PC != want.PC || got.Cycles != want.Cycles {
+		t.Fatalf("A=%d D=%d PC=%d cycles=%d, want A=%d D=%d PC=%d cycles=%d",
+			got.A, got.D, got.PC, got.Cycles, want.A, want.D, want.PC, want.Cycles)
+	}
+	if got.RAM != want.RAM {
+		for i := range got.RAM {
+			if got.RAM[i] != want.RAM[i] {
+				t.Fatalf("cycle %d: RAM[%d] = %d, want %d", got.Cycles, i, got.RAM[i], want.RAM[i])
+			}
+		}
+	}
+}
+
+func TestCPU_RunPong(t *testing.T) {
+	rom, err := ReadROMFile(pongROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := ParseKeyScript(strings.NewReader(`
+		3000000 press left
+		+1000003 release
+		+999 press right
+		+2000000 release
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, slow := NewCPU(rom), stepped(rom)
+	fast.Keyboard = ks
+	slow.Keyboard = &KeyScript{Events: ks.Events}
+	for _, n := range []uint64{1, 37, 1000, 999999, 2000001, 3000000, 1234567} {
+		if err = fast.Run(n); err != nil {
+			t.Fatal(err)
+		}
+		if err = slow.Run(n); err != nil {
+			t.Fatal(err)
+		}
+		assertSameState(t, fast, slow)
+	}
+}
+
+func TestCPU_RunUntil(t *testing.T) {
+	p, err := Assemble(strings.NewReader(`
+		@i
+		M=0
+	(LOOP)
+		@i
+		M=M+1
+		D=M
+	(MIDDLE)
+		@100
+		D=D-A
+		@LOOP
+		D;JLT
+	(END)
+		@END
+		0;JMP
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU(p.ROM)
+	// compiles the loop before stopping inside it
+	if err = cpu.Run(198); err != nil {
+		t.Fatal(err)
+	}
+	if err = cpu.RunUntil(100, int(p.Labels["MIDDLE"])); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.PC != p.Labels["MIDDLE"] || cpu.Cycles != 201 {
+		t.Errorf("PC = %d at cycle %d, want %d at cycle 201", cpu.PC, cpu.Cycles, p.Labels["MIDDLE"])
+	}
+	if err = cpu.RunUntil(10000, int(p.Labels["END"])); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.PC != p.Labels["END"] || cpu.RAM[16] != 100 {
+		t.Errorf("PC = %d with i = %d, want %d with i = 100", cpu.PC, cpu.RAM[16], p.Labels["END"])
+	}
+}
+
+// TestCPU_RunRandom runs random programs, which go through every comp, dest
+// and jump, with the pre-decoded instructions and with Step
+func TestCPU_RunRandom(t *testing.T) {
+	var common []uint16
+	for text := range ops {
+		common = append(common, mustAssembleC(text))
+	}
+	for _, jump := range []string{"JGT", "JEQ", "JGE", "JLT", "JNE", "JLE", "JMP"} {
+		common = append(common, mustAssembleC("D;"+jump), mustAssembleC("0;"+jump))
+	}
+	sort.Slice(common, func(i, j int) bool { return common[i] < common[j] })
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		rom := make([]uint16, 256)
+		for pc := range rom {
+			switch r.Intn(3) {
+			case 0:
+				rom[pc] = uint16(r.Intn(len(rom) + 8))
+			case 1:
+				rom[pc] = instC | uint16(r.Intn(instC))
+			default:
+				rom[pc] = common[r.Intn(len(common))]
+			}
+		}
+		fast, slow := NewCPU(rom), stepped(rom)
+		for addr := range rom {
+			fast.RAM[addr] = int16(r.Intn(len(rom)))
+		}
+		slow.RAM = fast.RAM
+		for j := 0; j < 20; j++ {
+			errFast, errSlow := fast.Run(100), slow.Run(100)
+			if errFast != errSlow {
+				t.Fatalf("program %d: Run() = %v, want %v", i, errFast, errSlow)
+			}
+			assertSameState(t, fast, slow)
+			if errFast != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkCPU_Step(b *testing.B) {
+	rom, err := ReadROMFile(pongROM)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cpu := NewCPU(rom)
+	start := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = cpu.Step(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "inst/s")
+}
+
+func BenchmarkCPU_Run(b *testing.B) {
+	rom, err := ReadROMFile(pongROM)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cpu := NewCPU(rom)
+	start := time.Now()
+	b.ResetTimer()
+	if err = cpu.Run(uint64(b.N)); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "inst/s")
+}
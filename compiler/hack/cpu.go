@@ -0,0 +1,149 @@
+package hack
+
+import (
+	"errors"
+)
+
+var ErrPCOutOfRange = errors.New("pc out of rom range")
+
+const (
+	instC = 1 << 15
+	instA = 1 << 12
+
+	destA = 1 << 5
+	destD = 1 << 4
+	destM = 1 << 3
+
+	jumpLT = 1 << 2
+	jumpEQ = 1 << 1
+	jumpGT = 1 << 0
+)
+
+type CPU struct {
+	ROM []uint16
+	RAM Memory
+
+	A, D   int16
+	PC     uint16
+	Cycles uint64
+
+	Keyboard *KeyScript
+	// Profile counts the cycles of every instruction when set
+	Profile *Profile
+	// Trace records the executed instructions when set
+	Trace       *Trace
+	Watchpoints []Watchpoint
+
+	code *code
+}
+
+func NewCPU(rom []uint16) *CPU {
+	return &CPU{ROM: rom}
+}
+
+func (c *CPU) Step() error {
+	if int(c.PC) >= len(c.ROM) {
+		return ErrPCOutOfRange
+	}
+	if c.Keyboard != nil {
+		c.Keyboard.Update(c.Cycles, &c.RAM)
+	}
+	if c.Profile != nil {
+		c.Profile.record(c.PC)
+	}
+	inst := c.ROM[c.PC]
+	c.Cycles += 1
+	if inst&instC == 0 {
+		if c.Trace != nil {
+			c.Trace.Record(TraceEntry{Cycle: c.Cycles - 1, PC: c.PC, Inst: inst, A: int16(inst), D: c.D})
+		}
+		c.A = int16(inst)
+		c.PC += 1
+		return nil
+	}
+	pc := c.PC
+
+	addr := uint16(c.A) & (MemSize - 1)
+	y := c.A
+	if inst&instA != 0 {
+		y = c.RAM[addr]
+	}
+	out := alu(c.D, y, inst>>6)
+
+	old := c.RAM[addr]
+	if inst&destM != 0 {
+		c.RAM[addr] = out
+	}
+	if inst&destD != 0 {
+		c.D = out
+	}
+	jmpAddr := uint16(c.A)
+	if inst&destA != 0 {
+		c.A = out
+	}
+
+	if (inst&jumpLT != 0 && out < 0) || (inst&jumpEQ != 0 && out == 0) || (inst&jumpGT != 0 && out > 0) {
+		c.PC = jmpAddr
+	} else {
+		c.PC += 1
+	}
+
+	if c.Trace != nil {
+		c.Trace.Record(TraceEntry{Cycle: c.Cycles - 1, PC: pc, Inst: inst, A: c.A, D: c.D, Addr: addr, Value: out})
+	}
+	if inst&destM != 0 {
+		for _, w := range c.Watchpoints {
+			if w.hit(addr, out) {
+				return &WatchpointError{Watchpoint: w, Cycle: c.Cycles - 1, PC: pc, Addr: addr, Old: old, Value: out}
+			}
+		}
+	}
+	return nil
+}
+
+// Run runs the given cycles. The rom is pre-decoded the first time it runs,
+// and its hot blocks compiled, unless stepping through every instruction for
+// the profile, trace or watchpoints. The rom must not change afterwards but
+// by being replaced
+func (c *CPU) Run(cycles uint64) error {
+	return c.RunUntil(cycles, -1)
+}
+
+// RunUntil runs like Run, stopping before the instruction at stop, if any
+func (c *CPU) RunUntil(cycles uint64, stop int) error {
+	if c.Profile == nil && c.Trace == nil && len(c.Watchpoints) == 0 {
+		return c.run(cycles, stop)
+	}
+	for i := uint64(0); i < cycles && int(c.PC) != stop; i++ {
+		err := c.Step()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alu computes the hack ALU output given the zx nx zy ny f no control bits
+func alu(x, y int16, ctrl uint16) (out int16) {
+	if ctrl&0x20 != 0 {
+		x = 0
+	}
+	if ctrl&0x10 != 0 {
+		x = ^x
+	}
+	if ctrl&0x08 != 0 {
+		y = 0
+	}
+	if ctrl&0x04 != 0 {
+		y = ^y
+	}
+	if ctrl&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if ctrl&0x01 != 0 {
+		out = ^out
+	}
+	return
+}
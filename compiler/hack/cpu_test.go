@@ -0,0 +1,117 @@
+package hack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCPU_FillAutomatic(t *testing.T) {
+	p, err := AssembleFile("../../projects/04/fill/Fill.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := ParseKeyScript(strings.NewReader(`
+		1000000 press 1
+		2000000 release
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU(p.ROM)
+	cpu.Keyboard = ks
+
+	sampled := []int{0, 1264, 1965, 3060, 4387, 4647, 6212, 7370, 8191}
+	for _, want := range []int16{0, -1, 0} {
+		err = cpu.Run(1000000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range sampled {
+			if got := cpu.RAM[Screen+i]; got != want {
+				t.Fatalf("cycle %d: RAM[%d] = %d, want %d", cpu.Cycles, Screen+i, got, want)
+			}
+		}
+	}
+}
+
+func TestCPU_Step(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		cycles uint64
+		wantD  int16
+		wantPC uint16
+		ram    map[int]int16
+	}{
+		{
+			name: "add",
+			src: `@2
+D=A
+@3
+D=D+A
+@0
+M=D`,
+			cycles: 6,
+			wantD:  5,
+			wantPC: 6,
+			ram:    map[int]int16{0: 5},
+		},
+		{
+			name: "jump taken",
+			src: `@5
+D=-1
+@4
+D;JLT
+D=1
+D=D+1`,
+			cycles: 4,
+			wantD:  -1,
+			wantPC: 4,
+		},
+		{
+			name: "jump not taken",
+			src: `D=0
+@4
+D;JNE
+D=1`,
+			cycles: 4,
+			wantD:  1,
+			wantPC: 4,
+		},
+		{
+			name: "decrement memory",
+			src: `@7
+M=1
+AM=M-1
+D=!A`,
+			cycles: 4,
+			wantD:  -1,
+			wantPC: 4,
+			ram:    map[int]int16{7: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Assemble(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cpu := NewCPU(p.ROM)
+			err = cpu.Run(tt.cycles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cpu.D != tt.wantD {
+				t.Errorf("D = %d, want %d", cpu.D, tt.wantD)
+			}
+			if cpu.PC != tt.wantPC {
+				t.Errorf("PC = %d, want %d", cpu.PC, tt.wantPC)
+			}
+			for addr, want := range tt.ram {
+				if got := cpu.RAM[addr]; got != want {
+					t.Errorf("RAM[%d] = %d, want %d", addr, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package hack
+
+// handler runs a pre-decoded instruction, returning the address of the next
+// one
+type handler func(c *CPU) uint16
+
+// op runs a pre-decoded c-instruction without jump
+type op func(c *CPU)
+
+func (c *CPU) addr() uint16 {
+	return uint16(c.A) & (MemSize - 1)
+}
+
+// ops holds specialized handlers for the instructions most common in the
+// programs translated from the vm
+var ops = map[string]op{
+	"D=M":    func(c *CPU) { c.D = c.RAM[c.addr()] },
+	"D=A":    func(c *CPU) { c.D = c.A },
+	"A=M":    func(c *CPU) { c.A = c.RAM[c.addr()] },
+	"M=D":    func(c *CPU) { c.RAM[c.addr()] = c.D },
+	"M=0":    func(c *CPU) { c.RAM[c.addr()] = 0 },
+	"M=1":    func(c *CPU) { c.RAM[c.addr()] = 1 },
+	"M=-1":   func(c *CPU) { c.RAM[c.addr()] = -1 },
+	"M=!M":   func(c *CPU) { a := c.addr(); c.RAM[a] = ^c.RAM[a] },
+	"M=-M":   func(c *CPU) { a := c.addr(); c.RAM[a] = -c.RAM[a] },
+	"M=M+1":  func(c *CPU) { c.RAM[c.addr()]++ },
+	"M=M-1":  func(c *CPU) { c.RAM[c.addr()]-- },
+	"M=D+1":  func(c *CPU) { c.RAM[c.addr()] = c.D + 1 },
+	"M=D+M":  func(c *CPU) { c.RAM[c.addr()] += c.D },
+	"M=M-D":  func(c *CPU) { c.RAM[c.addr()] -= c.D },
+	"M=D&M":  func(c *CPU) { c.RAM[c.addr()] &= c.D },
+	"M=D|M":  func(c *CPU) { c.RAM[c.addr()] |= c.D },
+	"A=A+1":  func(c *CPU) { c.A++ },
+	"A=A-1":  func(c *CPU) { c.A-- },
+	"A=M+1":  func(c *CPU) { c.A = c.RAM[c.addr()] + 1 },
+	"A=M-1":  func(c *CPU) { c.A = c.RAM[c.addr()] - 1 },
+	"A=D+A":  func(c *CPU) { c.A += c.D },
+	"A=D-A":  func(c *CPU) { c.A = c.D - c.A },
+	"AM=M+1": func(c *CPU) { a := c.addr(); c.RAM[a]++; c.A = c.RAM[a] },
+	"AM=M-1": func(c *CPU) { a := c.addr(); c.RAM[a]--; c.A = c.RAM[a] },
+	"D=D+A":  func(c *CPU) { c.D += c.A },
+	"D=D-A":  func(c *CPU) { c.D -= c.A },
+	"D=D+M":  func(c *CPU) { c.D += c.RAM[c.addr()] },
+	"D=D-M":  func(c *CPU) { c.D -= c.RAM[c.addr()] },
+	"D=M-D":  func(c *CPU) { c.D = c.RAM[c.addr()] - c.D },
+	"D=D&M":  func(c *CPU) { c.D &= c.RAM[c.addr()] },
+	"D=D|M":  func(c *CPU) { c.D |= c.RAM[c.addr()] },
+	"D=M+1":  func(c *CPU) { c.D = c.RAM[c.addr()] + 1 },
+	"D=M-1":  func(c *CPU) { c.D = c.RAM[c.addr()] - 1 },
+	"D=!M":   func(c *CPU) { c.D = ^c.RAM[c.addr()] },
+	"D=-M":   func(c *CPU) { c.D = -c.RAM[c.addr()] },
+	"D=0":    func(c *CPU) { c.D = 0 },
+	"D=-1":   func(c *CPU) { c.D = -1 },
+	"D=D+1":  func(c *CPU) { c.D++ },
+	"D=D-1":  func(c *CPU) { c.D-- },
+	"D=!D":   func(c *CPU) { c.D = ^c.D },
+	"D=-D":   func(c *CPU) { c.D = -c.D },
+}
+
+// constOps holds the handlers of the c-instructions following an
+// a-instruction, which set A to the given address
+var constOps = map[string]func(a uint16) op{
+	"D=M":    func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D = c.RAM[a] } },
+	"D=A":    func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D = int16(a) } },
+	"A=M":    func(a uint16) op { return func(c *CPU) { c.A = c.RAM[a] } },
+	"M=D":    func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.RAM[a] = c.D } },
+	"M=M+1":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.RAM[a]++ } },
+	"M=M-1":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.RAM[a]-- } },
+	"AM=M+1": func(a uint16) op { return func(c *CPU) { c.RAM[a]++; c.A = c.RAM[a] } },
+	"AM=M-1": func(a uint16) op { return func(c *CPU) { c.RAM[a]--; c.A = c.RAM[a] } },
+	"A=M+1":  func(a uint16) op { return func(c *CPU) { c.A = c.RAM[a] + 1 } },
+	"A=M-1":  func(a uint16) op { return func(c *CPU) { c.A = c.RAM[a] - 1 } },
+	"D=D+A":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D += int16(a) } },
+	"D=D-A":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D -= int16(a) } },
+	"D=D+M":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D += c.RAM[a] } },
+	"D=D-M":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D -= c.RAM[a] } },
+	"D=M-D":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.D = c.RAM[a] - c.D } },
+	"A=D+A":  func(a uint16) op { return func(c *CPU) { c.A = c.D + int16(a) } },
+	"M=D+M":  func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.RAM[a] += c.D } },
+	"M=0":    func(a uint16) op { return func(c *CPU) { c.A = int16(a); c.RAM[a] = 0 } },
+}
+
+var (
+	opTable      = map[uint16]op{}
+	constOpTable = map[uint16]func(a uint16) op{}
+)
+
+func init() {
+	for text, f := range ops {
+		opTable[mustAssembleC(text)] = f
+	}
+	for text, f := range constOps {
+		constOpTable[mustAssembleC(text)] = f
+	}
+}
+
+func mustAssembleC(text string) uint16 {
+	inst, err := assembleC(text)
+	if err != nil {
+		panic(err)
+	}
+	return inst
+}
+
+func isJump(inst uint16) bool {
+	return inst&instC != 0 && inst&(jumpLT|jumpEQ|jumpGT) != 0
+}
+
+// decode returns the handler of the instruction at pc
+func decode(inst, pc uint16) handler {
+	next := pc + 1
+	if inst&instC == 0 {
+		a := int16(inst)
+		return func(c *CPU) uint16 { c.A = a; return next }
+	}
+	if isJump(inst) {
+		return decodeJump(inst, next)
+	}
+	f := decodeOp(inst)
+	return func(c *CPU) uint16 { f(c); return next }
+}
+
+func decodeOp(inst uint16) op {
+	if f, ok := opTable[inst]; ok {
+		return f
+	}
+	useM, ctrl := inst&instA != 0, inst>>6
+	setA, setD, setM := inst&destA != 0, inst&destD != 0, inst&destM != 0
+	return func(c *CPU) {
+		addr := c.addr()
+		y := c.A
+		if useM {
+			y = c.RAM[addr]
+		}
+		out := alu(c.D, y, ctrl)
+		if setM {
+			c.RAM[addr] = out
+		}
+		if setD {
+			c.D = out
+		}
+		if setA {
+			c.A = out
+		}
+	}
+}
+
+// decodeConstOp returns the handler of an a-instruction followed by a
+// c-instruction without jump
+func decodeConstOp(a, inst uint16) op {
+	if f, ok := constOpTable[inst]; ok {
+		return f(a)
+	}
+	f := decodeOp(inst)
+	return func(c *CPU) { c.A = int16(a); f(c) }
+}
+
+var (
+	jumpAlways = mustAssembleC("0;JMP")
+	jumpD      = mustAssembleC("D")
+)
+
+func decodeJump(inst, next uint16) handler {
+	if inst == jumpAlways {
+		return func(c *CPU) uint16 { return uint16(c.A) }
+	}
+	if inst&^7 == jumpD {
+		return decodeJumpD(inst&7, next)
+	}
+	useM, ctrl := inst&instA != 0, inst>>6
+	setA, setD, setM := inst&destA != 0, inst&destD != 0, inst&destM != 0
+	lt, eq, gt := inst&jumpLT != 0, inst&jumpEQ != 0, inst&jumpGT != 0
+	return func(c *CPU) uint16 {
+		addr := c.addr()
+		y := c.A
+		if useM {
+			y = c.RAM[addr]
+		}
+		out := alu(c.D, y, ctrl)
+		if setM {
+			c.RAM[addr] = out
+		}
+		if setD {
+			c.D = out
+		}
+		target := uint16(c.A)
+		if setA {
+			c.A = out
+		}
+		if (lt && out < 0) || (eq && out == 0) || (gt && out > 0) {
+			return target
+		}
+		return next
+	}
+}
+
+// decodeJumpD returns the handler of the jumps on D
+func decodeJumpD(jump, next uint16) handler {
+	switch jump {
+	case jumpGT:
+		return func(c *CPU) uint16 {
+			if c.D > 0 {
+				return uint16(c.A)
+			}
+			return next
+		}
+	case jumpEQ:
+		return func(c *CPU) uint16 {
+			if c.D == 0 {
+				return uint16(c.A)
+			}
+			return next
+		}
+	case jumpEQ | jumpGT:
+		return func(c *CPU) uint16 {
+			if c.D >= 0 {
+				return uint16(c.A)
+			}
+			return next
+		}
+	case jumpLT:
+		return func(c *CPU) uint16 {
+			if c.D < 0 {
+				return uint16(c.A)
+			}
+			return next
+		}
+	case jumpLT | jumpGT:
+		return func(c *CPU) uint16 {
+			if c.D != 0 {
+				return uint16(c.A)
+			}
+			return next
+		}
+	case jumpLT | jumpEQ:
+		return func(c *CPU) uint16 {
+			if c.D <= 0 {
+				return uint16(c.A)
+			}
+			return next
+		}
+	}
+	return func(c *CPU) uint16 { return uint16(c.A) }
+}
@@ -0,0 +1,197 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	KeyNewLine   int16 = 128
+	KeyBackspace int16 = 129
+	KeyLeft      int16 = 130
+	KeyUp        int16 = 131
+	KeyRight     int16 = 132
+	KeyDown      int16 = 133
+	KeyHome      int16 = 134
+	KeyEnd       int16 = 135
+	KeyPageUp    int16 = 136
+	KeyPageDown  int16 = 137
+	KeyInsert    int16 = 138
+	KeyDelete    int16 = 139
+	KeyEsc       int16 = 140
+	KeyF1        int16 = 141
+	KeyF12       int16 = 152
+)
+
+var keyNames = map[string]int16{
+	"space":     ' ',
+	"enter":     KeyNewLine,
+	"newline":   KeyNewLine,
+	"backspace": KeyBackspace,
+	"left":      KeyLeft,
+	"up":        KeyUp,
+	"right":     KeyRight,
+	"down":      KeyDown,
+	"home":      KeyHome,
+	"end":       KeyEnd,
+	"pageup":    KeyPageUp,
+	"pagedown":  KeyPageDown,
+	"insert":    KeyInsert,
+	"delete":    KeyDelete,
+	"esc":       KeyEsc,
+}
+
+func init() {
+	for k := KeyF1; k <= KeyF12; k++ {
+		keyNames[fmt.Sprintf("f%d", k-KeyF1+1)] = k
+	}
+}
+
+// KeyCode returns the hack key code of the given key, which is either a key
+// name (enter, left, f1...), a single character or a numeric code
+func KeyCode(key string) (int16, error) {
+	if code, ok := keyNames[strings.ToLower(key)]; ok {
+		return code, nil
+	}
+	if r, sz := utf8.DecodeRuneInString(key); sz == len(key) && r > ' ' && r < 127 {
+		return int16(r), nil
+	}
+	code, err := strconv.ParseInt(key, 10, 16)
+	if err != nil || code < 0 {
+		return 0, fmt.Errorf("unknown key: %q", key)
+	}
+	return int16(code), nil
+}
+
+type KeyEvent struct {
+	Cycle uint64
+	// Key is the code held from Cycle on, 0 meaning released
+	Key int16
+}
+
+// KeyScript drives the keyboard register with timed key presses and releases
+type KeyScript struct {
+	Events []KeyEvent
+	next   int
+}
+
+// ParseKeyScript parses a script made of lines like:
+//
+//	// comment
+//	1000 press enter
+//	+500 release
+//	2000 press a
+//
+// Cycles prefixed with + are relative to the previous event.
+func ParseKeyScript(r io.Reader) (*KeyScript, error) {
+	ks := &KeyScript{}
+	var last uint64
+	s := bufio.NewScanner(r)
+	for ln := 1; s.Scan(); ln++ {
+		fields := strings.Fields(strings.Split(s.Text(), "//")[0])
+		if len(fields) == 0 {
+			continue
+		}
+		ev, err := parseKeyEvent(fields, last)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", ln, err)
+		}
+		ks.Events = append(ks.Events, ev)
+		last = ev.Cycle
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ks.Events, func(i, j int) bool {
+		return ks.Events[i].Cycle < ks.Events[j].Cycle
+	})
+	return ks, nil
+}
+
+func ParseKeyScriptFile(filename string) (*KeyScript, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseKeyScript(f)
+}
+
+func parseKeyEvent(fields []string, last uint64) (ev KeyEvent, err error) {
+	cycle := fields[0]
+	relative := strings.HasPrefix(cycle, "+")
+	ev.Cycle, err = strconv.ParseUint(strings.TrimPrefix(cycle, "+"), 10, 64)
+	if err != nil {
+		return ev, fmt.Errorf("invalid cycle: %q", cycle)
+	}
+	if relative {
+		ev.Cycle += last
+	}
+	if len(fields) < 2 {
+		return ev, fmt.Errorf("missing action")
+	}
+
+	switch fields[1] {
+	case "press":
+		if len(fields) != 3 {
+			return ev, fmt.Errorf("press takes exactly one key")
+		}
+		ev.Key, err = KeyCode(fields[2])
+	case "release":
+		if len(fields) != 2 {
+			return ev, fmt.Errorf("release takes no args")
+		}
+	default:
+		err = fmt.Errorf("unknown action: %q", fields[1])
+	}
+	return
+}
+
+// Update writes into the keyboard register every event due at the given cycle
+func (ks *KeyScript) Update(cycle uint64, mem *Memory) {
+	for ; ks.next < len(ks.Events) && ks.Events[ks.next].Cycle <= cycle; ks.next++ {
+		mem[Kbd] = ks.Events[ks.next].Key
+	}
+}
+
+// due returns the cycle of the next event, or the max cycle if none is left
+func (ks *KeyScript) due() uint64 {
+	if ks == nil || ks.Done() {
+		return ^uint64(0)
+	}
+	return ks.Events[ks.next].Cycle
+}
+
+// Done reports whether every event was already applied
+func (ks *KeyScript) Done() bool {
+	return ks.next >= len(ks.Events)
+}
+
+// Pending returns the events not applied yet
+func (ks *KeyScript) Pending() []KeyEvent {
+	if ks == nil {
+		return nil
+	}
+	return append([]KeyEvent(nil), ks.Events[ks.next:]...)
+}
+
+// WriteTo writes the events in the script format, with absolute cycles and
+// numeric key codes
+func (ks *KeyScript) WriteTo(w io.Writer) (int64, error) {
+	var s strings.Builder
+	for _, ev := range ks.Events {
+		if ev.Key == 0 {
+			fmt.Fprintf(&s, "%d release\n", ev.Cycle)
+		} else {
+			fmt.Fprintf(&s, "%d press %d\n", ev.Cycle, ev.Key)
+		}
+	}
+	n, err := io.WriteString(w, s.String())
+	return int64(n), err
+}
@@ -0,0 +1,86 @@
+package hack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []KeyEvent
+		wantErr bool
+	}{
+		{
+			name: "absolute and relative",
+			src: `// move the bat
+				100 press left
+				+50 release
+				200 press a
+				300 press 130
+				400 release`,
+			want: []KeyEvent{
+				{Cycle: 100, Key: KeyLeft},
+				{Cycle: 150},
+				{Cycle: 200, Key: 'a'},
+				{Cycle: 300, Key: 130},
+				{Cycle: 400},
+			},
+		},
+		{
+			name: "sorted by cycle",
+			src: `20 press F12
+				10 press enter`,
+			want: []KeyEvent{
+				{Cycle: 10, Key: KeyNewLine},
+				{Cycle: 20, Key: KeyF12},
+			},
+		},
+		{
+			name:    "unknown key",
+			src:     `10 press shift`,
+			wantErr: true,
+		},
+		{
+			name:    "release with key",
+			src:     `10 release a`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid cycle",
+			src:     `ten press a`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeyScript(strings.NewReader(tt.src))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Events, tt.want) {
+				t.Errorf("ParseKeyScript() = %v, want %v", got.Events, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyScript_WriteTo(t *testing.T) {
+	ks := &KeyScript{Events: []KeyEvent{{Cycle: 10, Key: 'a'}, {Cycle: 20}, {Cycle: 25, Key: KeyLeft}}}
+	var b strings.Builder
+	if _, err := ks.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseKeyScript(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Events, ks.Events) {
+		t.Errorf("replayed events = %v, want %v", got.Events, ks.Events)
+	}
+}
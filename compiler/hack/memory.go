@@ -0,0 +1,19 @@
+package hack
+
+const (
+	MemSize = 1 << 15
+
+	Screen     = 16384
+	ScreenSize = 8192
+	Kbd        = 24576
+
+	ScreenWidth  = 512
+	ScreenHeight = 256
+)
+
+type Memory [MemSize]int16
+
+func (m *Memory) Pixel(x, y int) bool {
+	word := m[Screen+y*ScreenWidth/16+x/16]
+	return word&(1<<(x%16)) != 0
+}
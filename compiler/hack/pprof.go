@@ -0,0 +1,132 @@
+package hack
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format read by
+// go tool pprof. Every instruction is a location of its function, at its
+// source line
+func (pr *Profile) WritePprof(w io.Writer, sm *SourceMap) error {
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		i, ok := strs[s]
+		if !ok {
+			i = len(table)
+			strs[s] = i
+			table = append(table, s)
+		}
+		return uint64(i)
+	}
+
+	var p protoBuffer
+	valueType := func(typ, unit string) []byte {
+		var b protoBuffer
+		b.uint(1, str(typ))
+		b.uint(2, str(unit))
+		return b
+	}
+	p.bytes(1, valueType("cycles", "count"))
+
+	type function struct {
+		name, file string
+	}
+	functions := make(map[function]uint64)
+	var funcs protoBuffer
+	locations := make(map[uint16]uint64)
+	var locs protoBuffer
+	location := func(addr uint16) uint64 {
+		if id, ok := locations[addr]; ok {
+			return id
+		}
+		fn := function{name: pr.name(addr, ByFunction, sm)}
+		var line int
+		if m := sm.Lookup(addr); m != nil && m.Jack != "" {
+			fn.file, line = m.Jack, m.JackLine
+		} else if m != nil && m.Module != "" {
+			fn.file, line = m.Module, m.Line
+		} else if int(addr) < len(pr.prog.Lines) {
+			line = pr.prog.Lines[addr]
+		}
+		fnID, ok := functions[fn]
+		if !ok {
+			fnID = uint64(len(functions) + 1)
+			functions[fn] = fnID
+			var b protoBuffer
+			b.uint(1, fnID)
+			b.uint(2, str(fn.name))
+			b.uint(3, str(fn.name))
+			b.uint(4, str(fn.file))
+			funcs.bytes(5, b)
+		}
+		id := uint64(len(locations) + 1)
+		locations[addr] = id
+		var ln protoBuffer
+		ln.uint(1, fnID)
+		ln.uint(2, uint64(line))
+		var b protoBuffer
+		b.uint(1, id)
+		b.uint(2, 1)
+		b.uint(3, uint64(addr))
+		b.bytes(4, ln)
+		locs.bytes(4, b)
+		return id
+	}
+
+	for s, n := range pr.samples {
+		var ids, values protoBuffer
+		for _, addr := range pr.stack(s) {
+			ids.varint(location(addr))
+		}
+		values.varint(n)
+		var b protoBuffer
+		b.bytes(1, ids)
+		b.bytes(2, values)
+		p.bytes(2, b)
+	}
+
+	var mapping protoBuffer
+	mapping.uint(1, 1)
+	mapping.uint(3, uint64(len(pr.prog.ROM)))
+	for _, field := range []int{7, 8, 9} { // has functions, filenames and lines
+		mapping.uint(field, 1)
+	}
+	p.bytes(3, mapping)
+	p = append(p, locs...)
+	p = append(p, funcs...)
+	for _, s := range table {
+		p.bytes(6, []byte(s))
+	}
+	p.bytes(11, valueType("cycles", "count"))
+	p.uint(12, 1)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(p); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes the fields of a protocol buffer message
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *protoBuffer) uint(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) bytes(field int, x []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(x)))
+	*b = append(*b, x...)
+}
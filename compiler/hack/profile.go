@@ -0,0 +1,246 @@
+package hack
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Profile counts the cycles spent at every instruction of a program, along
+// with the stack of vm functions calling it.
+//
+// Functions are told apart by the labels written by projects/08: a function
+// is a label with a dot and no '$', or a routine beginning with '$', and owns
+// the labels qualified by it, like Func$label or $MUL.LOOP. Jumping to a
+// function right before one of the return labels of its caller, Func$RET.n,
+// calls it, and reaching the return label returns to Func. Any other jump to
+// a function reuses the frame, like tail calls and the shared call routine do
+type Profile struct {
+	Cycles uint64
+
+	prog *Program
+	// labels holds the last label at or before every address, and functions
+	// the function owning it
+	labels    []string
+	functions []string
+	entries   []bool
+	returns   []bool
+
+	frames  []frame
+	index   map[frame]int
+	samples map[sample]uint64
+	cur     int
+	prevPC  int
+}
+
+type frame struct {
+	parent int
+	fn     string
+	// site is the address of the jump entering the function
+	site uint16
+}
+
+// sample is the frame and the address of an instruction
+type sample struct {
+	frame int
+	pc    uint16
+}
+
+const noFrame = -1
+
+func NewProfile(p *Program) *Profile {
+	pr := &Profile{
+		prog:      p,
+		labels:    make([]string, len(p.ROM)),
+		functions: make([]string, len(p.ROM)),
+		entries:   make([]bool, len(p.ROM)),
+		returns:   make([]bool, len(p.ROM)),
+		index:     make(map[frame]int),
+		samples:   make(map[sample]uint64),
+		cur:       noFrame,
+		prevPC:    -1,
+	}
+	names := make([]string, 0, len(p.Labels))
+	for name := range p.Labels {
+		names = append(names, name)
+	}
+	// the first label of an address names it
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names {
+		addr := int(p.Labels[name])
+		if addr >= len(p.ROM) {
+			continue
+		}
+		pr.labels[addr] = name
+		fn := labelFunction(name)
+		if fn == name && (strings.Contains(name, ".") || strings.HasPrefix(name, "$")) {
+			pr.entries[addr] = true
+		}
+		if i := strings.Index(name, "$"); i > 0 && (strings.HasPrefix(name[i+1:], "RET.") || strings.HasPrefix(name[i+1:], "RET_")) {
+			pr.returns[addr] = true
+		}
+	}
+	for addr := range pr.labels {
+		if pr.labels[addr] == "" && addr > 0 {
+			pr.labels[addr] = pr.labels[addr-1]
+		}
+		pr.functions[addr] = labelFunction(pr.labels[addr])
+	}
+	return pr
+}
+
+// labelFunction returns the function owning the label
+func labelFunction(label string) string {
+	if strings.HasPrefix(label, "$") {
+		if i := strings.Index(label, "."); i >= 0 {
+			return label[:i]
+		}
+		return label
+	}
+	if i := strings.Index(label, "$"); i >= 0 {
+		return label[:i]
+	}
+	return label
+}
+
+// record counts the cycle of the instruction at pc, about to be executed
+func (pr *Profile) record(pc uint16) {
+	prev := pr.prevPC
+	switch {
+	case int(pc) >= len(pr.entries):
+	case pr.entries[pc] && prev >= 0 && prev+1 < len(pr.returns) && pr.returns[prev+1]:
+		pr.cur = pr.frame(frame{parent: pr.cur, fn: pr.functions[pc], site: uint16(prev)})
+	case pr.entries[pc] && (prev < 0 || pr.functions[prev] != pr.functions[pc]):
+		f := frame{parent: noFrame, fn: pr.functions[pc]}
+		if prev >= 0 {
+			f.site = uint16(prev)
+		}
+		if pr.cur != noFrame {
+			f.parent, f.site = pr.frames[pr.cur].parent, pr.frames[pr.cur].site
+		}
+		pr.cur = pr.frame(f)
+	case pr.returns[pc]:
+		if pr.cur != noFrame {
+			pr.cur = pr.frames[pr.cur].parent
+		}
+		for pr.cur != noFrame && pr.frames[pr.cur].fn != pr.functions[pc] {
+			pr.cur = pr.frames[pr.cur].parent
+		}
+	}
+	pr.samples[sample{frame: pr.cur, pc: pc}]++
+	pr.Cycles++
+	pr.prevPC = int(pc)
+}
+
+func (pr *Profile) frame(f frame) int {
+	i, ok := pr.index[f]
+	if !ok {
+		i = len(pr.frames)
+		pr.frames = append(pr.frames, f)
+		pr.index[f] = i
+	}
+	return i
+}
+
+// stack returns the addresses of the sample, from the instruction up to the
+// jump entering the outermost function
+func (pr *Profile) stack(s sample) []uint16 {
+	addrs := []uint16{s.pc}
+	for i := s.frame; i != noFrame; i = pr.frames[i].parent {
+		addrs = append(addrs, pr.frames[i].site)
+	}
+	return addrs
+}
+
+// Granularities of the reports
+const (
+	ByLabel    = "label"
+	ByFunction = "function"
+	ByLine     = "line"
+)
+
+// name returns the label, the function or the source line of the address.
+// Lines are the jack lines of the source map, or its vm lines, or the lines
+// of the assembly when there is no map
+func (pr *Profile) name(addr uint16, by string, sm *SourceMap) string {
+	if int(addr) >= len(pr.prog.ROM) {
+		return "?"
+	}
+	switch {
+	case by == ByLabel && pr.labels[addr] != "":
+		return pr.labels[addr]
+	case by == ByFunction && pr.functions[addr] != "":
+		return pr.functions[addr]
+	case by != ByLine:
+		// the bootstrap has no label
+		if m := sm.Lookup(addr); m != nil && m.Module == "" {
+			return m.Command
+		}
+		return "?"
+	}
+	if m := sm.Lookup(addr); m != nil {
+		switch {
+		case m.Jack != "":
+			return fmt.Sprintf("%s:%d", m.Jack, m.JackLine)
+		case m.Module != "":
+			return fmt.Sprintf("%s:%d", m.Module, m.Line)
+		}
+		return m.Command
+	}
+	return fmt.Sprintf("asm:%d", pr.prog.Lines[addr])
+}
+
+// Report writes the cycles spent by every label, function or source line,
+// the ones taking the most first. Flat cycles are spent at the instructions
+// of the entry, and cumulative cycles in the functions it called too
+func (pr *Profile) Report(w io.Writer, by string, sm *SourceMap) error {
+	switch by {
+	case ByLabel, ByFunction, ByLine:
+	default:
+		return fmt.Errorf("unknown report granularity: %s", by)
+	}
+	flat := make(map[string]uint64)
+	cum := make(map[string]uint64)
+	for s, n := range pr.samples {
+		seen := make(map[string]bool)
+		for i, addr := range pr.stack(s) {
+			name := pr.name(addr, by, sm)
+			if i == 0 {
+				flat[name] += n
+			}
+			if !seen[name] {
+				seen[name] = true
+				cum[name] += n
+			}
+		}
+	}
+	names := make([]string, 0, len(cum))
+	for name := range cum {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := names[i], names[j]
+		if flat[a] != flat[b] {
+			return flat[a] > flat[b]
+		}
+		if cum[a] != cum[b] {
+			return cum[a] > cum[b]
+		}
+		return a < b
+	})
+
+	percent := func(n uint64) float64 {
+		if pr.Cycles == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(pr.Cycles)
+	}
+	var s strings.Builder
+	fmt.Fprintf(&s, "%12s %6s %12s %6s  %s\n", "flat", "flat%", "cum", "cum%", by)
+	for _, name := range names {
+		fmt.Fprintf(&s, "%12d %5.2f%% %12d %5.2f%%  %s\n", flat[name], percent(flat[name]), cum[name], percent(cum[name]), name)
+	}
+	_, err := io.WriteString(w, s.String())
+	return err
+}
@@ -0,0 +1,120 @@
+package hack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// profiledSrc calls Main.f twice from Main.main, which is jumped to from the
+// bootstrap, like the programs translated by projects/08
+const profiledSrc = `
+@Main.main
+0;JMP
+(Main.main)
+@Main.main$RET.0
+D=A
+@R15
+M=D
+@Main.f
+0;JMP
+(Main.main$RET.0)
+@Main.main$RET.1
+D=A
+@R15
+M=D
+@Main.f
+0;JMP
+(Main.main$RET.1)
+(Main.main$END)
+@Main.main$END
+0;JMP
+(Main.f)
+@3
+D=A
+(Main.f$LOOP)
+D=D-1
+@Main.f$LOOP
+D;JGT
+@R15
+A=M
+0;JMP
+`
+
+func TestProfile(t *testing.T) {
+	p, err := Assemble(strings.NewReader(profiledSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof := NewProfile(p)
+	cpu := NewCPU(p.ROM)
+	cpu.Profile = prof
+	for cpu.PC != p.Labels["Main.main$END"] {
+		if err = cpu.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		by   string
+		want map[string][2]uint64
+	}{
+		{by: ByFunction, want: map[string][2]uint64{
+			"?":         {2, 42},
+			"Main.main": {12, 40},
+			"Main.f":    {28, 28},
+		}},
+		{by: ByLabel, want: map[string][2]uint64{
+			"?":               {2, 42},
+			"Main.main":       {6, 20},
+			"Main.main$RET.0": {6, 20},
+			"Main.f":          {4, 4},
+			"Main.f$LOOP":     {24, 24},
+		}},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err = prof.Report(&b, tt.by, nil); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string][2]uint64)
+		for _, ln := range strings.Split(b.String(), "\n")[1:] {
+			fields := strings.Fields(ln)
+			if len(fields) != 5 {
+				continue
+			}
+			flat, _ := strconv.ParseUint(fields[0], 10, 64)
+			cum, _ := strconv.ParseUint(fields[2], 10, 64)
+			got[fields[4]] = [2]uint64{flat, cum}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("by %s: report\n%s", tt.by, b.String())
+		}
+		for name, want := range tt.want {
+			if got[name] != want {
+				t.Errorf("by %s: %s flat, cum = %v, want %v", tt.by, name, got[name], want)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err = prof.WritePprof(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"cycles", "Main.main", "Main.f"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("pprof profile lacks the string %q", s)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func ReadROM(r io.Reader) ([]uint16, error) {
+	var rom []uint16
+	s := bufio.NewScanner(r)
+	for ln := 1; s.Scan(); ln++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		if len(text) != 16 {
+			return nil, fmt.Errorf("line %d: instruction must have 16 bits: %q", ln, text)
+		}
+		inst, err := strconv.ParseUint(text, 2, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", ln, err)
+		}
+		rom = append(rom, uint16(inst))
+	}
+	return rom, s.Err()
+}
+
+func ReadROMFile(filename string) ([]uint16, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadROM(f)
+}
@@ -0,0 +1,125 @@
+package hack
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Snapshot is the complete state of an emulator running a program, which
+// restores it along with the keyboard events still to play. Program is the
+// hash of the program, so snapshots only restore the program they were taken
+// from
+type Snapshot struct {
+	// Machine is the emulator taking the snapshot, cpu or vm
+	Machine string
+	Program string
+
+	RAM  Memory
+	A, D int16
+	PC   int
+	// Cycles counts the instructions, or the vm commands, run so far
+	Cycles uint64
+	// Depth is the number of calls the vm didn't return from yet
+	Depth int
+	Keys  []KeyEvent
+}
+
+// HashROM returns the hash identifying the rom in snapshots
+func HashROM(rom []uint16) string {
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, rom)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *CPU) Snapshot() *Snapshot {
+	return &Snapshot{
+		Machine: "cpu",
+		Program: HashROM(c.ROM),
+		RAM:     c.RAM,
+		A:       c.A,
+		D:       c.D,
+		PC:      int(c.PC),
+		Cycles:  c.Cycles,
+		Keys:    c.Keyboard.Pending(),
+	}
+}
+
+// Restore sets the state of the cpu to the snapshot, which must be taken
+// from a cpu running the same rom
+func (c *CPU) Restore(s *Snapshot) error {
+	if err := s.Check("cpu", HashROM(c.ROM)); err != nil {
+		return err
+	}
+	c.RAM, c.A, c.D, c.PC, c.Cycles = s.RAM, s.A, s.D, uint16(s.PC), s.Cycles
+	c.Keyboard = s.Keyboard()
+	return nil
+}
+
+// Check returns an error unless the snapshot was taken by the machine running
+// the program of the given hash
+func (s *Snapshot) Check(machine, program string) error {
+	if s.Machine != machine {
+		return fmt.Errorf("snapshot of a %s, not a %s", s.Machine, machine)
+	}
+	if s.Program != program {
+		return fmt.Errorf("snapshot of another program: %.12s, not %.12s", s.Program, program)
+	}
+	return nil
+}
+
+// Keyboard returns the script playing the keyboard events of the snapshot,
+// or nil if there are none
+func (s *Snapshot) Keyboard() *KeyScript {
+	if len(s.Keys) == 0 {
+		return nil
+	}
+	return &KeyScript{Events: append([]KeyEvent(nil), s.Keys...)}
+}
+
+// WriteSnapshot writes the snapshot gzipped in the gob encoding
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	gz := gzip.NewWriter(w)
+	if err := gob.NewEncoder(gz).Encode(s); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err = gob.NewDecoder(gz).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func WriteSnapshotFile(filename string, s *Snapshot) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = WriteSnapshot(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func ReadSnapshotFile(filename string) (*Snapshot, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
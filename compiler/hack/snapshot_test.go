@@ -0,0 +1,63 @@
+package hack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCPU_Snapshot(t *testing.T) {
+	p, err := AssembleFile("../../projects/04/fill/Fill.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := func() *KeyScript {
+		ks, err := ParseKeyScript(strings.NewReader(`
+			100000 press 1
+			300000 release
+		`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ks
+	}
+	cpu := NewCPU(p.ROM)
+	cpu.Keyboard = keys()
+	if err = cpu.Run(200000); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err = WriteSnapshot(&b, cpu.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := ReadSnapshot(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Keys) != 1 || snap.Keys[0] != (KeyEvent{Cycle: 300000}) {
+		t.Errorf("snapshot keys = %v, want the pending release", snap.Keys)
+	}
+	restored := NewCPU(p.ROM)
+	if err = restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restored run replays the original one
+	for _, c := range []*CPU{cpu, restored} {
+		if err = c.Run(300000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if restored.Cycles != 500000 || restored.PC != cpu.PC || restored.A != cpu.A || restored.D != cpu.D {
+		t.Errorf("restored cpu at cycle %d, pc %d, want cycle %d, pc %d", restored.Cycles, restored.PC, cpu.Cycles, cpu.PC)
+	}
+	if restored.RAM != cpu.RAM {
+		t.Error("restored ram differs from the original")
+	}
+
+	other := NewCPU(p.ROM[:len(p.ROM)-1])
+	if err = other.Restore(snap); err == nil {
+		t.Error("restored a snapshot of another program")
+	}
+}
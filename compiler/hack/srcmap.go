@@ -0,0 +1,45 @@
+package hack
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// SourceMap maps the rom of a program translated by projects/08 back to its
+// vm commands, and to their jack lines when compiled with -g. The source of
+// an address is the last mapping at or before it
+type SourceMap struct {
+	Mappings []SourceMapping `json:"mappings"`
+}
+
+type SourceMapping struct {
+	ROM      int    `json:"rom"`
+	Module   string `json:"module,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Jack     string `json:"jack,omitempty"`
+	JackLine int    `json:"jackLine,omitempty"`
+	Command  string `json:"command"`
+}
+
+func ReadSourceMapFile(filename string) (*SourceMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sm := &SourceMap{}
+	return sm, json.NewDecoder(f).Decode(sm)
+}
+
+// Lookup returns the mapping of the rom address, or nil if there is none
+func (sm *SourceMap) Lookup(addr uint16) *SourceMapping {
+	if sm == nil {
+		return nil
+	}
+	i := sort.Search(len(sm.Mappings), func(i int) bool { return sm.Mappings[i].ROM > int(addr) })
+	if i == 0 {
+		return nil
+	}
+	return &sm.Mappings[i-1]
+}
@@ -0,0 +1,162 @@
+package hack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// traceMagic begins the binary traces
+const traceMagic = "HACKTRC\x01"
+
+// TraceEntry is an executed instruction, along with the registers it left.
+// Instructions writing into the ram write Value at Addr
+type TraceEntry struct {
+	Cycle uint64
+	PC    uint16
+	Inst  uint16
+	A, D  int16
+	Addr  uint16
+	Value int16
+}
+
+// Write reports whether the instruction wrote into the ram
+func (e *TraceEntry) Write() bool {
+	return e.Inst&instC != 0 && e.Inst&destM != 0
+}
+
+// traceRecordSize is the size of the binary entries: the cycle, then the
+// pc, the instruction, A, D, the address and the value
+const traceRecordSize = 8 + 6*2
+
+// Trace records the instructions executed by the cpu, writing them as they
+// run, or keeping only the last ones in a ring until flushed. Traces are
+// either JSON lines or binary, fixed size little endian records after a magic
+type Trace struct {
+	w     *bufio.Writer
+	jsonl bool
+	ring  []TraceEntry
+	next  int
+	full  bool
+	err   error
+}
+
+// NewTrace returns a trace writing into w, keeping the last ring entries
+// when ring is positive
+func NewTrace(w io.Writer, jsonl bool, ring int) *Trace {
+	t := &Trace{w: bufio.NewWriter(w), jsonl: jsonl}
+	if ring > 0 {
+		t.ring = make([]TraceEntry, ring)
+	}
+	if !jsonl {
+		_, t.err = t.w.WriteString(traceMagic)
+	}
+	return t
+}
+
+// Record adds the entry to the trace
+func (t *Trace) Record(e TraceEntry) {
+	if t.ring == nil {
+		t.write(&e)
+		return
+	}
+	t.ring[t.next] = e
+	t.next++
+	if t.next == len(t.ring) {
+		t.next, t.full = 0, true
+	}
+}
+
+func (t *Trace) write(e *TraceEntry) {
+	if t.err != nil {
+		return
+	}
+	if !t.jsonl {
+		var b [traceRecordSize]byte
+		binary.LittleEndian.PutUint64(b[:], e.Cycle)
+		for i, x := range [6]uint16{e.PC, e.Inst, uint16(e.A), uint16(e.D), e.Addr, uint16(e.Value)} {
+			binary.LittleEndian.PutUint16(b[8+2*i:], x)
+		}
+		_, t.err = t.w.Write(b[:])
+		return
+	}
+	b := make([]byte, 0, 96)
+	b = append(b, `{"cycle":`...)
+	b = strconv.AppendUint(b, e.Cycle, 10)
+	b = append(b, `,"pc":`...)
+	b = strconv.AppendUint(b, uint64(e.PC), 10)
+	b = append(b, `,"inst":`...)
+	b = strconv.AppendUint(b, uint64(e.Inst), 10)
+	b = append(b, `,"a":`...)
+	b = strconv.AppendInt(b, int64(e.A), 10)
+	b = append(b, `,"d":`...)
+	b = strconv.AppendInt(b, int64(e.D), 10)
+	if e.Write() {
+		b = append(b, `,"addr":`...)
+		b = strconv.AppendUint(b, uint64(e.Addr), 10)
+		b = append(b, `,"value":`...)
+		b = strconv.AppendInt(b, int64(e.Value), 10)
+	}
+	b = append(b, "}\n"...)
+	_, t.err = t.w.Write(b)
+}
+
+// Flush writes the entries of the ring, oldest first, and returns the first
+// error writing the trace
+func (t *Trace) Flush() error {
+	if t.ring != nil {
+		if t.full {
+			for i := t.next; i < len(t.ring); i++ {
+				t.write(&t.ring[i])
+			}
+		}
+		for i := 0; i < t.next; i++ {
+			t.write(&t.ring[i])
+		}
+		t.next, t.full = 0, false
+	}
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
+
+// TraceReader reads the entries of a binary trace
+type TraceReader struct {
+	r *bufio.Reader
+	n int
+}
+
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(traceMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, []byte(traceMagic)) {
+		return nil, errors.New("not a binary hack trace")
+	}
+	return &TraceReader{r: br}, nil
+}
+
+// Read returns the next entry, or io.EOF at the end of the trace
+func (tr *TraceReader) Read() (TraceEntry, error) {
+	var b [traceRecordSize]byte
+	if _, err := io.ReadFull(tr.r, b[:]); err == io.EOF {
+		return TraceEntry{}, err
+	} else if err != nil {
+		return TraceEntry{}, fmt.Errorf("entry %d: %w", tr.n, err)
+	}
+	tr.n++
+	u := func(i int) uint16 { return binary.LittleEndian.Uint16(b[8+2*i:]) }
+	return TraceEntry{
+		Cycle: binary.LittleEndian.Uint64(b[:]),
+		PC:    u(0),
+		Inst:  u(1),
+		A:     int16(u(2)),
+		D:     int16(u(3)),
+		Addr:  u(4),
+		Value: int16(u(5)),
+	}, nil
+}
@@ -0,0 +1,89 @@
+package hack
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countSrc counts down RAM[0] from 3, writing it on every iteration
+const countSrc = `@3
+D=A
+(LOOP)
+@0
+M=D
+D=D-1
+@LOOP
+D;JGT`
+
+func runTraced(t *testing.T, jsonl bool, ring int) (string, []TraceEntry) {
+	p, err := Assemble(strings.NewReader(countSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	cpu := NewCPU(p.ROM)
+	cpu.Trace = NewTrace(&b, jsonl, ring)
+	if err = cpu.Run(14); err != nil {
+		t.Fatal(err)
+	}
+	if err = cpu.Trace.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if jsonl {
+		return b.String(), nil
+	}
+	tr, err := NewTraceReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []TraceEntry
+	for {
+		e, err := tr.Read()
+		if err == io.EOF {
+			return "", entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	_, entries := runTraced(t, false, 0)
+	if len(entries) != 14 {
+		t.Fatalf("len(entries) = %d, want 14", len(entries))
+	}
+	var writes []int16
+	for i, e := range entries {
+		if e.Cycle != uint64(i) {
+			t.Errorf("entries[%d].Cycle = %d", i, e.Cycle)
+		}
+		if e.Write() {
+			writes = append(writes, e.Value)
+		}
+	}
+	if want := []int16{3, 2, 1}; !reflect.DeepEqual(writes, want) {
+		t.Errorf("writes = %v, want %v", writes, want)
+	}
+	want := TraceEntry{Cycle: 3, PC: 3, Inst: 0xE308, A: 0, D: 3, Addr: 0, Value: 3}
+	if entries[3] != want {
+		t.Errorf("entries[3] = %+v, want %+v", entries[3], want)
+	}
+
+	_, last := runTraced(t, false, 4)
+	if !reflect.DeepEqual(last, entries[10:]) {
+		t.Errorf("ring entries = %+v, want %+v", last, entries[10:])
+	}
+
+	jsonl, _ := runTraced(t, true, 2)
+	wantJSONL := `{"cycle":12,"pc":2,"inst":0,"a":0,"d":1}
+{"cycle":13,"pc":3,"inst":58120,"a":0,"d":1,"addr":0,"value":1}
+`
+	if jsonl != wantJSONL {
+		t.Errorf("jsonl trace:\n%s", jsonl)
+	}
+}
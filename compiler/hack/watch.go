@@ -0,0 +1,99 @@
+package hack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Watchpoint stops the cpu after an instruction writes into the ram from Lo
+// to Hi. Bounded watchpoints only stop on writes of values out of Min..Max
+type Watchpoint struct {
+	Lo, Hi   uint16
+	Bounded  bool
+	Min, Max int16
+}
+
+// ParseWatchpoint parses a watchpoint of the form addr[..hi][:min..max], the
+// addresses being numbers or predefined symbols. SCREEN..24575 watches the
+// writes into the screen, and SP:256..2047 the stack pointer leaving the
+// stack
+func ParseWatchpoint(s string) (Watchpoint, error) {
+	var w Watchpoint
+	addrs, values := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		addrs, values = s[:i], s[i+1:]
+	}
+	lo, hi := addrs, addrs
+	if i := strings.Index(addrs, ".."); i >= 0 {
+		lo, hi = addrs[:i], addrs[i+2:]
+	}
+	var err error
+	if w.Lo, err = parseWatchAddr(lo); err != nil {
+		return w, err
+	}
+	if w.Hi, err = parseWatchAddr(hi); err != nil {
+		return w, err
+	}
+	if w.Lo > w.Hi {
+		return w, fmt.Errorf("invalid watchpoint: %s, %d is after %d", s, w.Lo, w.Hi)
+	}
+	if values == "" {
+		return w, nil
+	}
+	i := strings.Index(values, "..")
+	if i < 0 {
+		return w, fmt.Errorf("invalid watchpoint values: %s, must be min..max", values)
+	}
+	w.Bounded = true
+	min, err := strconv.ParseInt(values[:i], 10, 16)
+	if err != nil {
+		return w, fmt.Errorf("invalid watchpoint value: %s", values[:i])
+	}
+	max, err := strconv.ParseInt(values[i+2:], 10, 16)
+	if err != nil {
+		return w, fmt.Errorf("invalid watchpoint value: %s", values[i+2:])
+	}
+	w.Min, w.Max = int16(min), int16(max)
+	return w, nil
+}
+
+func parseWatchAddr(s string) (uint16, error) {
+	if addr, ok := predefinedSymbols[s]; ok {
+		return addr, nil
+	}
+	addr, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || addr >= MemSize {
+		return 0, fmt.Errorf("invalid ram address: %s", s)
+	}
+	return uint16(addr), nil
+}
+
+func (w Watchpoint) String() string {
+	s := strconv.Itoa(int(w.Lo))
+	if w.Hi != w.Lo {
+		s += ".." + strconv.Itoa(int(w.Hi))
+	}
+	if w.Bounded {
+		s += fmt.Sprintf(":%d..%d", w.Min, w.Max)
+	}
+	return s
+}
+
+func (w Watchpoint) hit(addr uint16, value int16) bool {
+	return addr >= w.Lo && addr <= w.Hi && (!w.Bounded || value < w.Min || value > w.Max)
+}
+
+// WatchpointError stops the cpu after the instruction at PC writes Value
+// into Addr, which held Old
+type WatchpointError struct {
+	Watchpoint Watchpoint
+	Cycle      uint64
+	PC         uint16
+	Addr       uint16
+	Old, Value int16
+}
+
+func (e *WatchpointError) Error() string {
+	return fmt.Sprintf("watchpoint %s: cycle %d: ROM[%d] wrote RAM[%d] = %d, was %d", e.Watchpoint, e.Cycle, e.PC, e.Addr, e.Value, e.Old)
+}
@@ -0,0 +1,66 @@
+package hack
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseWatchpoint(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Watchpoint
+		wantErr bool
+	}{
+		{s: "SCREEN..24575", want: Watchpoint{Lo: Screen, Hi: 24575}},
+		{s: "SP:256..2047", want: Watchpoint{Lo: 0, Hi: 0, Bounded: true, Min: 256, Max: 2047}},
+		{s: "300..310:-1..1", want: Watchpoint{Lo: 300, Hi: 310, Bounded: true, Min: -1, Max: 1}},
+		{s: "R13", want: Watchpoint{Lo: 13, Hi: 13}},
+		{s: "32768", wantErr: true},
+		{s: "10..5", wantErr: true},
+		{s: "SP:256", wantErr: true},
+		{s: "FOO", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWatchpoint(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWatchpoint(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseWatchpoint(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCPU_Watchpoints(t *testing.T) {
+	p, err := Assemble(strings.NewReader(countSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		watch     string
+		wantCycle uint64
+		wantValue int16
+	}{
+		{watch: "0", wantCycle: 3, wantValue: 3},
+		{watch: "0:2..3", wantCycle: 13, wantValue: 1},
+	}
+	for _, tt := range tests {
+		w, err := ParseWatchpoint(tt.watch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu := NewCPU(p.ROM)
+		cpu.Watchpoints = []Watchpoint{w}
+		err = cpu.Run(100)
+		var hit *WatchpointError
+		if !errors.As(err, &hit) {
+			t.Errorf("%s: Run() = %v, want a watchpoint error", tt.watch, err)
+			continue
+		}
+		if hit.Cycle != tt.wantCycle || hit.Value != tt.wantValue || cpu.RAM[0] != tt.wantValue {
+			t.Errorf("%s: hit %v, want cycle %d writing %d", tt.watch, hit, tt.wantCycle, tt.wantValue)
+		}
+	}
+}
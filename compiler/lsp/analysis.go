@@ -0,0 +1,327 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/parse/symbol"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+var kindNames = map[symbol.Kind]string{
+	symbol.KIND_FIELD:  "field",
+	symbol.KIND_STATIC: "static",
+	symbol.KIND_LOCAL:  "local",
+	symbol.KIND_ARG:    "argument",
+}
+
+type varInfo struct {
+	Name  string
+	Type  string
+	Kind  symbol.Kind
+	Index int
+	Tok   *parse.Token
+}
+
+func (v *varInfo) String() string {
+	return fmt.Sprintf("%s %s %s", kindNames[v.Kind], v.Type, v.Name)
+}
+
+type subInfo struct {
+	Name   string
+	Kind   string
+	Return string
+	Tok    *parse.Token
+	// Start and End delimit the declaration
+	Start, End token.Pos
+	Params     []*varInfo
+	Locals     []*varInfo
+}
+
+func (s *subInfo) signature(className string) string {
+	var params []string
+	for _, p := range s.Params {
+		if p.Name != "this" {
+			params = append(params, p.Type+" "+p.Name)
+		}
+	}
+	return fmt.Sprintf("%s %s %s.%s(%s)", s.Kind, s.Return, className, s.Name, strings.Join(params, ", "))
+}
+
+type refKind int
+
+const (
+	refVar refKind = iota
+	refSub
+	refClass
+)
+
+// ref is an identifier of the source, either declaring or using a symbol
+type ref struct {
+	Tok  *parse.Token
+	Kind refKind
+	// Var is nil for undefined vars
+	Var *varInfo
+	// Class is the referenced class, or the class holding the referenced
+	// subroutine
+	Class string
+	Sub   string
+}
+
+func (r *ref) contains(pos token.Pos) bool {
+	end := r.Tok.End()
+	return pos.Line == r.Tok.Pos.Line && pos.Col >= r.Tok.Pos.Col && pos.Col <= end.Col
+}
+
+// classInfo holds the symbols declared and referenced by a class
+type classInfo struct {
+	Name       string
+	Tok        *parse.Token
+	Start, End token.Pos
+	Vars       []*varInfo
+	Subs       []*subInfo
+	Refs       []*ref
+	Errors     []*parse.Error
+}
+
+// decls returns the name of the class and its subroutines, which the other
+// classes refer to
+func (c *classInfo) decls() string {
+	names := []string{c.Name}
+	for _, s := range c.Subs {
+		names = append(names, s.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func (c *classInfo) sub(name string) *subInfo {
+	for _, s := range c.Subs {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// subAt returns the subroutine holding the given position, defaulting to the
+// last one declared before it as the declaration may be incomplete
+func (c *classInfo) subAt(pos token.Pos) *subInfo {
+	var last *subInfo
+	for _, s := range c.Subs {
+		if before(pos, s.Start) {
+			break
+		}
+		last = s
+	}
+	return last
+}
+
+func (c *classInfo) refAt(pos token.Pos) *ref {
+	for _, r := range c.Refs {
+		if r.contains(pos) {
+			return r
+		}
+	}
+	return nil
+}
+
+func before(a, b token.Pos) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+}
+
+type analyzer struct {
+	c     *classInfo
+	class *symbol.Table
+	vars  map[string]*varInfo
+	local map[string]*varInfo
+}
+
+// analyze parses the source, collecting the symbols of whatever part of the
+// class could be parsed
+func analyze(src []byte) *classInfo {
+	p := parser.Config{}.New(src)
+	tree := p.ParseTree()
+	a := &analyzer{c: &classInfo{Errors: p.Errors()}, class: symbol.NewTable(), vars: make(map[string]*varInfo)}
+	if tree.Root == nil || tree.Root.Type() != parse.NodeClass {
+		return a.c
+	}
+	a.analyzeClass(tree.Root)
+	return a.c
+}
+
+func child(n parse.Node, i int) parse.Node {
+	children := n.Children()
+	if i < 0 || i >= len(children) {
+		return nil
+	}
+	return children[i]
+}
+
+func childToken(n parse.Node, i int) *parse.Token {
+	c := child(n, i)
+	if c == nil {
+		return nil
+	}
+	return c.Token()
+}
+
+func span(n parse.Node) (start, end token.Pos) {
+	if first := parse.FirstToken(n); first != nil {
+		start = first.Pos
+	}
+	if last := parse.LastToken(n); last != nil {
+		end = last.End()
+	}
+	return
+}
+
+func (a *analyzer) analyzeClass(n parse.Node) {
+	a.c.Start, a.c.End = span(n)
+	if tok := childToken(n, 1); tok.Is(token.IDENT) {
+		a.c.Name, a.c.Tok = tok.Literal, tok
+		a.addRef(&ref{Tok: tok, Kind: refClass, Class: tok.Literal})
+	}
+	for _, c := range n.Children() {
+		switch c.Type() {
+		case parse.NodeClassVarDec:
+			kind := symbol.KIND_STATIC
+			if childToken(c, 0).Is(token.FIELD) {
+				kind = symbol.KIND_FIELD
+			}
+			a.c.Vars = append(a.c.Vars, a.declare(c, a.class, a.vars, kind)...)
+		case parse.NodeSubroutineDec:
+			a.analyzeSubroutine(c)
+		}
+	}
+}
+
+func (a *analyzer) addRef(r *ref) {
+	a.c.Refs = append(a.c.Refs, r)
+}
+
+// typeRef records class names used as types
+func (a *analyzer) typeRef(tok *parse.Token) {
+	if tok.Is(token.IDENT) {
+		a.addRef(&ref{Tok: tok, Kind: refClass, Class: tok.Literal})
+	}
+}
+
+func (a *analyzer) declare(n parse.Node, t *symbol.Table, scope map[string]*varInfo, kind symbol.Kind) (vars []*varInfo) {
+	typ := childToken(n, 1)
+	if typ == nil {
+		return
+	}
+	a.typeRef(typ)
+	for _, c := range n.Children()[2:] {
+		if tok := c.Token(); tok.Is(token.IDENT) {
+			vars = append(vars, a.addVar(t, scope, tok, kind, typ.Literal))
+		}
+	}
+	return
+}
+
+func (a *analyzer) addVar(t *symbol.Table, scope map[string]*varInfo, tok *parse.Token, kind symbol.Kind, typ string) *varInfo {
+	v := &varInfo{Name: tok.Literal, Type: typ, Kind: kind, Index: t.Add(tok.Literal, kind, 0).Index, Tok: tok}
+	scope[v.Name] = v
+	a.addRef(&ref{Tok: tok, Kind: refVar, Var: v})
+	return v
+}
+
+func (a *analyzer) analyzeSubroutine(n parse.Node) {
+	kind, ret, name := childToken(n, 0), childToken(n, 1), childToken(n, 2)
+	if ret == nil || !name.Is(token.IDENT) {
+		return
+	}
+	sub := &subInfo{Name: name.Literal, Kind: kind.Literal, Return: ret.Literal, Tok: name}
+	sub.Start, sub.End = span(n)
+	a.c.Subs = append(a.c.Subs, sub)
+	a.typeRef(ret)
+	a.addRef(&ref{Tok: name, Kind: refSub, Class: a.c.Name, Sub: sub.Name})
+
+	local := symbol.NewTable()
+	a.local = make(map[string]*varInfo)
+	if kind.Is(token.METHOD) {
+		this := &varInfo{Name: "this", Type: a.c.Name, Kind: symbol.KIND_ARG, Index: local.Add("this", symbol.KIND_ARG, 0).Index}
+		sub.Params = append(sub.Params, this)
+	}
+	for _, c := range n.Children()[3:] {
+		switch c.Type() {
+		case parse.NodeParameterList:
+			var typ *parse.Token
+			for _, p := range c.Children() {
+				tok := p.Token()
+				switch {
+				case tok.Is(token.COMMA):
+				case typ == nil:
+					typ = tok
+					a.typeRef(typ)
+				default:
+					sub.Params = append(sub.Params, a.addVar(local, a.local, tok, symbol.KIND_ARG, typ.Literal))
+					typ = nil
+				}
+			}
+		case parse.NodeSubroutineBody:
+			for _, b := range c.Children() {
+				if b.Type() == parse.NodeVarDec {
+					sub.Locals = append(sub.Locals, a.declare(b, local, a.local, symbol.KIND_LOCAL)...)
+				} else {
+					a.walk(b)
+				}
+			}
+		}
+	}
+	a.local = nil
+}
+
+func (a *analyzer) lookup(name string) *varInfo {
+	if v, ok := a.local[name]; ok {
+		return v
+	}
+	return a.vars[name]
+}
+
+func (a *analyzer) varRef(tok *parse.Token) {
+	a.addRef(&ref{Tok: tok, Kind: refVar, Var: a.lookup(tok.Literal)})
+}
+
+// walk records the references of statements and expressions
+func (a *analyzer) walk(n parse.Node) {
+	switch n.Type() {
+	case parse.NodeLetStatement:
+		if tok := childToken(n, 1); tok.Is(token.IDENT) {
+			a.varRef(tok)
+		}
+	case parse.NodeTerm:
+		if tok := childToken(n, 0); tok.Is(token.IDENT) {
+			a.varRef(tok)
+		}
+	case parse.NodeSubroutineCall:
+		a.call(n)
+	}
+	for _, c := range n.Children() {
+		a.walk(c)
+	}
+}
+
+func (a *analyzer) call(n parse.Node) {
+	first := childToken(n, 0)
+	if !first.Is(token.IDENT) {
+		return
+	}
+	if !childToken(n, 1).Is(token.DOT) {
+		a.addRef(&ref{Tok: first, Kind: refSub, Class: a.c.Name, Sub: first.Literal})
+		return
+	}
+	class := first.Literal
+	if v := a.lookup(first.Literal); v != nil {
+		a.addRef(&ref{Tok: first, Kind: refVar, Var: v})
+		class = v.Type
+	} else {
+		a.addRef(&ref{Tok: first, Kind: refClass, Class: class})
+	}
+	if name := childToken(n, 2); name.Is(token.IDENT) {
+		a.addRef(&ref{Tok: name, Kind: refSub, Class: class, Sub: name.Literal})
+	}
+}
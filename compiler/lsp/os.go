@@ -0,0 +1,12 @@
+package lsp
+
+import "github.com/schattian/nand2tetris/compiler/types"
+
+var osClasses = make(map[string]*classInfo)
+
+func init() {
+	for _, src := range types.OSSource {
+		c := analyze([]byte(src))
+		osClasses[c.Name] = c
+	}
+}
@@ -0,0 +1,600 @@
+// Package lsp implements a language server for jack, providing diagnostics,
+// go-to-definition, hover, completion and document symbols over the classes
+// of the directory of every open file.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/symbol"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+type document struct {
+	path  string
+	text  []byte
+	open  bool
+	class *classInfo
+	// good is the last analysis without errors
+	good *classInfo
+}
+
+// update analyzes the text again, the whole class being parsed again on each
+// edit
+func (d *document) update(text []byte) {
+	d.text = text
+	d.class = analyze(text)
+	if len(d.class.Errors) == 0 {
+		d.good = d.class
+	}
+}
+
+// Server serves a single client, handling its messages in order
+type Server struct {
+	r    *bufio.Reader
+	w    io.Writer
+	docs map[string]*document
+}
+
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{r: bufio.NewReader(r), w: w, docs: make(map[string]*document)}
+}
+
+// Serve handles messages until the exit notification or the end of input
+func (s *Server) Serve() error {
+	for {
+		msg, err := ReadMessage(s.r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "" {
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(msg.Method, msg.Params)
+		if msg.ID == nil {
+			continue
+		}
+		resp := &Message{ID: msg.ID, Result: result}
+		if err != nil {
+			respErr, ok := err.(*ResponseError)
+			if !ok {
+				respErr = &ResponseError{Code: codeRequestFailed, Message: err.Error()}
+			}
+			resp.Result, resp.Error = nil, respErr
+		} else if result == nil {
+			resp.Result = json.RawMessage("null")
+		}
+		if err = WriteMessage(s.w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// full sync, as the edited class is parsed and analyzed again as a
+				// whole on every change, though ranged changes are applied too
+				"textDocumentSync":       map[string]interface{}{"openClose": true, "change": 1},
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]interface{}{"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]string{"name": "jacklsp"},
+		}, nil
+	case "initialized", "shutdown", "$/cancelRequest", "workspace/didChangeConfiguration", "textDocument/didSave":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.didOpen(p)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.didChange(p)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.didClose(p)
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.definition(p)
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.hover(p)
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.completion(p)
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(p)
+	}
+	return nil, &ResponseError{Code: codeMethodNotFound, Message: "unsupported method: " + method}
+}
+
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported uri: %s", uri)
+	}
+	return filepath.Clean(u.Path), nil
+}
+
+func pathURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	path, err := uriPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[path]
+	if !ok {
+		return nil, fmt.Errorf("unknown document: %s", uri)
+	}
+	return d, nil
+}
+
+// loadDir analyzes the classes of the dir which weren't loaded yet
+func (s *Server) loadDir(dirname string) {
+	filenames, _ := filepath.Glob(filepath.Join(dirname, "*.jack"))
+	for _, filename := range filenames {
+		if _, ok := s.docs[filename]; ok {
+			continue
+		}
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		d := &document{path: filename}
+		d.update(src)
+		s.docs[filename] = d
+	}
+}
+
+func (s *Server) didOpen(p didOpenParams) error {
+	path, err := uriPath(p.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	d, ok := s.docs[path]
+	if !ok {
+		d = &document{path: path}
+		s.docs[path] = d
+	}
+	d.open = true
+	d.update([]byte(p.TextDocument.Text))
+	s.loadDir(filepath.Dir(path))
+	return s.publishDir(filepath.Dir(path))
+}
+
+func (s *Server) didChange(p didChangeParams) error {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	text := d.text
+	for _, change := range p.ContentChanges {
+		if change.Range == nil {
+			text = []byte(change.Text)
+			continue
+		}
+		start, end := offset(text, change.Range.Start), offset(text, change.Range.End)
+		edited := make([]byte, 0, len(text)-(end-start)+len(change.Text))
+		edited = append(edited, text[:start]...)
+		edited = append(edited, change.Text...)
+		text = append(edited, text[end:]...)
+	}
+	decls := d.class.decls()
+	d.update(text)
+	// the diagnostics of the other classes only depend on the name and the
+	// subroutines of the edited one
+	if d.class.decls() != decls {
+		return s.publishDir(filepath.Dir(d.path))
+	}
+	return s.publish(d)
+}
+
+func (s *Server) didClose(p didCloseParams) error {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	d.open = false
+	if src, err := os.ReadFile(d.path); err == nil {
+		d.update(src)
+	} else {
+		delete(s.docs, d.path)
+	}
+	if err = s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: pathURI(d.path), Diagnostics: []Diagnostic{}}); err != nil {
+		return err
+	}
+	return s.publishDir(filepath.Dir(d.path))
+}
+
+// offset converts the position into an offset of the text, the character
+// being counted in utf-16 units
+func offset(text []byte, pos Position) int {
+	i := 0
+	for line := 0; line < pos.Line; line++ {
+		j := bytes.IndexByte(text[i:], '\n')
+		if j < 0 {
+			return len(text)
+		}
+		i += j + 1
+	}
+	for n := 0; n < pos.Character && i < len(text) && text[i] != '\n'; {
+		r, size := utf8.DecodeRune(text[i:])
+		n += len(utf16.Encode([]rune{r}))
+		i += size
+	}
+	return i
+}
+
+func toPosition(pos token.Pos) Position {
+	return Position{Line: pos.Line - 1, Character: pos.Col - 1}
+}
+
+func fromPosition(pos Position) token.Pos {
+	return token.Pos{Line: pos.Line + 1, Col: pos.Character + 1}
+}
+
+func tokenRange(tok *parse.Token) Range {
+	return Range{Start: toPosition(tok.Pos), End: toPosition(tok.End())}
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return WriteMessage(s.w, &Message{Method: method, Params: raw})
+}
+
+func (s *Server) publishDir(dirname string) error {
+	var paths []string
+	for path, d := range s.docs {
+		if d.open && filepath.Dir(path) == dirname {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := s.publish(s.docs[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) publish(d *document) error {
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: pathURI(d.path), Diagnostics: s.diagnostics(d)})
+}
+
+func (s *Server) diagnostics(d *document) []Diagnostic {
+	diags := []Diagnostic{}
+	add := func(r Range, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{Range: r, Severity: severityError, Source: "jack", Message: fmt.Sprintf(format, args...)})
+	}
+	for _, err := range d.class.Errors {
+		pos := toPosition(err.Pos)
+		add(Range{Start: pos, End: Position{Line: pos.Line, Character: pos.Character + 1}}, "%s", err.Msg)
+	}
+	dir := filepath.Dir(d.path)
+	for _, r := range d.class.Refs {
+		switch r.Kind {
+		case refVar:
+			if r.Var == nil {
+				add(tokenRange(r.Tok), "undefined: %s", r.Tok.Literal)
+			}
+		case refClass:
+			if c, _ := s.findClass(dir, r.Class); c == nil {
+				add(tokenRange(r.Tok), "undefined class: %s", r.Class)
+			}
+		case refSub:
+			c, _ := s.findClass(dir, r.Class)
+			if c != nil && c.sub(r.Sub) == nil {
+				add(tokenRange(r.Tok), "%s has no subroutine %s", r.Class, r.Sub)
+			}
+		}
+	}
+	return diags
+}
+
+// findClass looks the class up among the classes of the dir and the os ones
+func (s *Server) findClass(dirname, name string) (*classInfo, *document) {
+	for path, d := range s.docs {
+		if d.class.Name == name && filepath.Dir(path) == dirname {
+			return d.class, d
+		}
+	}
+	return osClasses[name], nil
+}
+
+func (s *Server) refAt(p textDocumentPositionParams) (*document, *ref, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, d.class.refAt(fromPosition(p.Position)), nil
+}
+
+func (s *Server) definition(p textDocumentPositionParams) (interface{}, error) {
+	d, r, err := s.refAt(p)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	switch r.Kind {
+	case refVar:
+		if r.Var != nil {
+			return Location{URI: pathURI(d.path), Range: tokenRange(r.Var.Tok)}, nil
+		}
+	case refClass, refSub:
+		c, cd := s.findClass(filepath.Dir(d.path), r.Class)
+		if cd == nil {
+			return nil, nil
+		}
+		tok := c.Tok
+		if r.Kind == refSub {
+			sub := c.sub(r.Sub)
+			if sub == nil {
+				return nil, nil
+			}
+			tok = sub.Tok
+		}
+		return Location{URI: pathURI(cd.path), Range: tokenRange(tok)}, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) hover(p textDocumentPositionParams) (interface{}, error) {
+	d, r, err := s.refAt(p)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	var code, doc string
+	switch r.Kind {
+	case refVar:
+		if r.Var == nil {
+			return nil, nil
+		}
+		code, doc = r.Var.String(), fmt.Sprintf("%s %d", kindNames[r.Var.Kind], r.Var.Index)
+	case refClass:
+		c, cd := s.findClass(filepath.Dir(d.path), r.Class)
+		if c == nil {
+			return nil, nil
+		}
+		code = "class " + c.Name
+		if cd == nil {
+			doc = "os class"
+		}
+	case refSub:
+		c, _ := s.findClass(filepath.Dir(d.path), r.Class)
+		if c == nil || c.sub(r.Sub) == nil {
+			return nil, nil
+		}
+		code = c.sub(r.Sub).signature(c.Name)
+	}
+	value := "```jack\n" + code + "\n```"
+	if doc != "" {
+		value += "\n" + doc
+	}
+	rng := tokenRange(r.Tok)
+	return Hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: &rng}, nil
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// identBefore returns the identifier ending at the given offset
+func identBefore(text []byte, end int) (string, int) {
+	start := end
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	return string(text[start:end]), start
+}
+
+func (s *Server) completion(p textDocumentPositionParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(d.path)
+	pos := fromPosition(p.Position)
+	prefix, start := identBefore(d.text, offset(d.text, p.Position))
+
+	class := d.class
+	sub := class.subAt(pos)
+	if sub == nil && d.good != nil {
+		class = d.good
+		sub = class.subAt(pos)
+	}
+	lookup := func(name string) *varInfo {
+		if sub != nil {
+			for _, v := range append(append([]*varInfo{}, sub.Params...), sub.Locals...) {
+				if v.Name == name {
+					return v
+				}
+			}
+		}
+		for _, v := range class.Vars {
+			if v.Name == name {
+				return v
+			}
+		}
+		return nil
+	}
+
+	items := []CompletionItem{}
+	add := func(item CompletionItem) {
+		if strings.HasPrefix(item.Label, prefix) {
+			items = append(items, item)
+		}
+	}
+	// addSubs adds the subroutines of the class, only the methods or only the
+	// functions and constructors if filtered
+	addSubs := func(c *classInfo, filter bool, methods bool) {
+		for _, sub := range c.Subs {
+			if filter && (sub.Kind == "method") != methods {
+				continue
+			}
+			item := CompletionItem{Label: sub.Name, Kind: completionFunction, Detail: sub.signature(c.Name)}
+			switch sub.Kind {
+			case "method":
+				item.Kind = completionMethod
+			case "constructor":
+				item.Kind = completionConstructor
+			}
+			add(item)
+		}
+	}
+
+	if start > 0 && d.text[start-1] == '.' {
+		receiver, _ := identBefore(d.text, start-1)
+		if v := lookup(receiver); v != nil {
+			if c, _ := s.findClass(dir, v.Type); c != nil {
+				addSubs(c, true, true)
+			}
+		} else if c, _ := s.findClass(dir, receiver); c != nil {
+			addSubs(c, true, false)
+		}
+		return items, nil
+	}
+
+	if sub != nil {
+		for _, v := range append(append([]*varInfo{}, sub.Params...), sub.Locals...) {
+			if v.Name != "this" {
+				add(CompletionItem{Label: v.Name, Kind: completionVariable, Detail: v.String()})
+			}
+		}
+	}
+	for _, v := range class.Vars {
+		kind := completionVariable
+		if v.Kind == symbol.KIND_FIELD {
+			kind = completionField
+		}
+		add(CompletionItem{Label: v.Name, Kind: kind, Detail: v.String()})
+	}
+	addSubs(class, false, false)
+	for _, name := range s.classNames(dir) {
+		add(CompletionItem{Label: name, Kind: completionClass, Detail: "class " + name})
+	}
+	return items, nil
+}
+
+// classNames returns the names of the classes of the dir and the os ones
+func (s *Server) classNames(dirname string) []string {
+	seen := make(map[string]bool)
+	for path, d := range s.docs {
+		if filepath.Dir(path) == dirname && d.class.Name != "" {
+			seen[d.class.Name] = true
+		}
+	}
+	for name := range osClasses {
+		seen[name] = true
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var subSymbolKinds = map[string]SymbolKind{
+	"constructor": symbolConstructor,
+	"function":    symbolFunction,
+	"method":      symbolMethod,
+}
+
+func (s *Server) documentSymbols(p documentSymbolParams) (interface{}, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	c := d.class
+	if c.Tok == nil {
+		return []DocumentSymbol{}, nil
+	}
+	class := DocumentSymbol{
+		Name:           c.Name,
+		Kind:           symbolClass,
+		Range:          Range{Start: toPosition(c.Start), End: toPosition(c.End)},
+		SelectionRange: tokenRange(c.Tok),
+	}
+	for _, v := range c.Vars {
+		kind := symbolVariable
+		if v.Kind == symbol.KIND_FIELD {
+			kind = symbolField
+		}
+		class.Children = append(class.Children, DocumentSymbol{
+			Name:           v.Name,
+			Detail:         v.String(),
+			Kind:           kind,
+			Range:          tokenRange(v.Tok),
+			SelectionRange: tokenRange(v.Tok),
+		})
+	}
+	for _, sub := range c.Subs {
+		class.Children = append(class.Children, DocumentSymbol{
+			Name:           sub.Name,
+			Detail:         sub.signature(c.Name),
+			Kind:           subSymbolKinds[sub.Kind],
+			Range:          Range{Start: toPosition(sub.Start), End: toPosition(sub.End)},
+			SelectionRange: tokenRange(sub.Tok),
+		})
+	}
+	return []DocumentSymbol{class}, nil
+}
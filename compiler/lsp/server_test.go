@@ -0,0 +1,309 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client scripts a session against a server
+type client struct {
+	t             *testing.T
+	w             io.Writer
+	msgs          chan *Message
+	id            int
+	notifications []*Message
+}
+
+func newClient(t *testing.T) *client {
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	go func() {
+		if err := NewServer(reqR, respW).Serve(); err != nil {
+			t.Error(err)
+		}
+		respW.Close()
+	}()
+	t.Cleanup(func() { reqW.Close() })
+	c := &client{t: t, w: reqW, msgs: make(chan *Message, 100)}
+	// reads in background as the server doesn't wait for the client to
+	// read its notifications
+	go func() {
+		r := bufio.NewReader(respR)
+		for {
+			msg, err := ReadMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	c.request("initialize", map[string]interface{}{}, nil)
+	c.notify("initialized", map[string]interface{}{})
+	return c
+}
+
+func (c *client) read() *Message {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("server closed")
+		}
+		return msg
+	case <-time.After(10 * time.Second):
+		c.t.Fatal("timeout waiting for the server")
+	}
+	return nil
+}
+
+func (c *client) send(msg *Message, params interface{}) {
+	c.t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg.Params = raw
+	if err = WriteMessage(c.w, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(&Message{Method: method}, params)
+}
+
+// request sends the request and decodes its result, queuing the
+// notifications read meanwhile
+func (c *client) request(method string, params interface{}, result interface{}) {
+	c.t.Helper()
+	c.id++
+	id := json.RawMessage(strconv.Itoa(c.id))
+	c.send(&Message{ID: &id, Method: method}, params)
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if msg.Error != nil {
+			c.t.Fatalf("%s: %s", method, msg.Error.Message)
+		}
+		if result != nil {
+			raw, _ := json.Marshal(msg.Result)
+			if err := json.Unmarshal(raw, result); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+// diagnostics waits for the diagnostics of the given path
+func (c *client) diagnostics(path string) []Diagnostic {
+	c.t.Helper()
+	for {
+		var msg *Message
+		if len(c.notifications) > 0 {
+			msg, c.notifications = c.notifications[0], c.notifications[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var p publishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			c.t.Fatal(err)
+		}
+		if p.URI == pathURI(path) {
+			return p.Diagnostics
+		}
+	}
+}
+
+func (c *client) open(path string) {
+	c.t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: pathURI(path), Version: 1, Text: string(src)}})
+}
+
+func at(path string, line, char int) textDocumentPositionParams {
+	return textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: pathURI(path)},
+		Position:     Position{Line: line - 1, Character: char - 1},
+	}
+}
+
+func squarePaths(t *testing.T) (main, game string) {
+	dir, err := filepath.Abs("../../projects/11/Square")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "Main.jack"), filepath.Join(dir, "SquareGame.jack")
+}
+
+func TestServer_Navigation(t *testing.T) {
+	main, game := squarePaths(t)
+	c := newClient(t)
+	c.open(main)
+	if diags := c.diagnostics(main); len(diags) != 0 {
+		t.Errorf("unexpected diagnostics %+v", diags)
+	}
+
+	// SquareGame.new
+	var loc Location
+	c.request("textDocument/definition", at(main, 12, 31), &loc)
+	if loc.URI != pathURI(game) || loc.Range.Start.Line != 24 {
+		t.Errorf("definition at %+v, want SquareGame.jack:25", loc)
+	}
+	// game.run
+	c.request("textDocument/definition", at(main, 13, 17), &loc)
+	if loc.URI != pathURI(game) || loc.Range.Start.Line != 50 {
+		t.Errorf("definition at %+v, want SquareGame.jack:51", loc)
+	}
+	// game
+	c.request("textDocument/definition", at(main, 14, 12), &loc)
+	if loc.URI != pathURI(main) || loc.Range.Start != (Position{Line: 10, Character: 23}) {
+		t.Errorf("definition at %+v, want Main.jack:11:24", loc)
+	}
+
+	var hover Hover
+	c.request("textDocument/hover", at(main, 13, 13), &hover)
+	if !strings.Contains(hover.Contents.Value, "local SquareGame game") || !strings.Contains(hover.Contents.Value, "local 0") {
+		t.Errorf("unexpected hover %q", hover.Contents.Value)
+	}
+	c.request("textDocument/hover", at(main, 13, 17), &hover)
+	if !strings.Contains(hover.Contents.Value, "method void SquareGame.run()") {
+		t.Errorf("unexpected hover %q", hover.Contents.Value)
+	}
+
+	var symbols []DocumentSymbol
+	c.request("textDocument/documentSymbol", documentSymbolParams{TextDocument: textDocumentIdentifier{URI: pathURI(main)}}, &symbols)
+	if len(symbols) != 1 || symbols[0].Name != "Main" || len(symbols[0].Children) != 1 || symbols[0].Children[0].Kind != symbolFunction {
+		t.Errorf("unexpected symbols %+v", symbols)
+	}
+}
+
+// TestServer_Publish checks an edit republishes the diagnostics of the other
+// classes only when it changes the subroutines they may call
+func TestServer_Publish(t *testing.T) {
+	main, game := squarePaths(t)
+	c := newClient(t)
+	c.open(main)
+	c.open(game)
+	c.diagnostics(game)
+
+	published := func(path string, line, char int, text string) []string {
+		c.notify("textDocument/didChange", didChangeParams{
+			TextDocument: textDocumentItem{URI: pathURI(path)},
+			ContentChanges: []contentChange{{
+				Range: &Range{Start: Position{Line: line - 1, Character: char - 1}, End: Position{Line: line - 1, Character: char - 1}},
+				Text:  text,
+			}},
+		})
+		c.request("textDocument/hover", at(main, 13, 13), &Hover{})
+		var uris []string
+		for _, msg := range c.notifications {
+			var p publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &p); err != nil {
+				t.Fatal(err)
+			}
+			uris = append(uris, p.URI)
+		}
+		c.notifications = nil
+		return uris
+	}
+	tests := []struct {
+		path       string
+		line, char int
+		text       string
+		want       []string
+	}{
+		// return; -> return x;
+		{main, 15, 15, " x", []string{pathURI(main)}},
+		// method void run() -> method void runs()
+		{game, 51, 19, "s", []string{pathURI(main), pathURI(game)}},
+		// a comment in the body of runs
+		{game, 51, 24, " // edited", []string{pathURI(game)}},
+	}
+	for _, tt := range tests {
+		if got := published(tt.path, tt.line, tt.char, tt.text); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("edit of %s published %v, want %v", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+}
+
+func TestServer_Edit(t *testing.T) {
+	main, _ := squarePaths(t)
+	c := newClient(t)
+	c.open(main)
+	c.diagnostics(main)
+
+	change := func(line, char int, text string) {
+		c.notify("textDocument/didChange", didChangeParams{
+			TextDocument: textDocumentItem{URI: pathURI(main)},
+			ContentChanges: []contentChange{{
+				Range: &Range{Start: Position{Line: line - 1, Character: char - 1}, End: Position{Line: line - 1, Character: char - 1}},
+				Text:  text,
+			}},
+		})
+	}
+	// do game.run() -> do game.runs()
+	change(13, 20, "s")
+	diags := c.diagnostics(main)
+	if len(diags) != 1 || diags[0].Message != "SquareGame has no subroutine runs" {
+		t.Fatalf("unexpected diagnostics %+v", diags)
+	}
+	// return; -> return x;
+	change(15, 15, " x")
+	diags = c.diagnostics(main)
+	if len(diags) != 2 || diags[1].Message != "undefined: x" || diags[1].Range.Start.Line != 14 {
+		t.Fatalf("unexpected diagnostics %+v", diags)
+	}
+	// do game.runs() -> do game.runs(
+	change(13, 22, "(")
+	diags = c.diagnostics(main)
+	if len(diags) == 0 || !strings.HasPrefix(diags[0].Message, "incomplete") {
+		t.Fatalf("unexpected diagnostics %+v", diags)
+	}
+
+	var items []CompletionItem
+	change(14, 17, "\n        do game.")
+	c.request("textDocument/completion", at(main, 15, 17), &items)
+	labels := make(map[string]bool)
+	for _, item := range items {
+		labels[item.Label] = true
+	}
+	if !labels["run"] || !labels["moveSquare"] || labels["new"] {
+		t.Errorf("unexpected completion %+v", items)
+	}
+
+	items = nil
+	change(15, 17, "Output.print")
+	c.request("textDocument/completion", at(main, 15, 26), &items)
+	if len(items) != 4 {
+		t.Errorf("unexpected completion %+v", items)
+	}
+
+	items = nil
+	c.request("textDocument/completion", at(main, 14, 12), &items)
+	labels = make(map[string]bool)
+	for _, item := range items {
+		labels[item.Label] = true
+	}
+	if !labels["game"] || !labels["Main"] || !labels["SquareGame"] || !labels["Math"] || !labels["main"] {
+		t.Errorf("unexpected completion %+v", items)
+	}
+}
@@ -2,14 +2,129 @@ package main
 
 import (
 	"encoding/xml"
-	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/ast"
+	"github.com/schattian/nand2tetris/compiler/callgraph"
+	"github.com/schattian/nand2tetris/compiler/codegen"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/types"
+	"github.com/schattian/nand2tetris/compiler/vm"
 )
 
+var (
+	debugMap = flag.Bool("g", false, "write a .dbg.json debug map next to every .vm file")
+	dialect  = flag.Bool("dialect", false, "enable operator precedence, else if, for, char and hex literals and compound assignments")
+	calls    = flag.Bool("calls", false, "report the emitted calls to every function of the program")
+	strict   = flag.Bool("strict", false, "type check the program before compiling it")
+	prune    = flag.Bool("prune", false, "skip the subroutines unreachable from Main.main, compiling a dir")
+	asm      = flag.Bool("asm", false, "link the classes with the os and write the program as a .asm file in their dir, setting the rom addresses of the debug maps")
+	osDir    = flag.String("os", "", "dir of the os .vm files linked by -asm")
+	optimize = flag.Bool("O", false, "fold constant expressions and inline multiplications by constants and divisions by powers of two")
+	extended = flag.Bool("ext", false, "emit the extended vm operations, out of the standard vm, for multiplications, divisions and arrays")
+
+	backend = parser.SchemaBackend
+)
+
+func init() {
+	flag.Var(&backend, "parser", "parser backend: schema or descent")
+}
+
+// usage:
+//
+//	compiler [-parser backend] [-dialect] src.jack dst.xml     writes the parse tree of src
+//	compiler [-parser backend] [-dialect] [-g] [-O] [-ext] [-calls] [-strict] [-prune] [-asm [-os dir]] src.jack|dir    writes a .vm file next to every compiled class
 func main() {
-	srcFilename, dstFilename := os.Args[1], os.Args[2]
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal("not enough args")
+	}
+	srcFilename := flag.Arg(0)
+	if flag.NArg() > 1 {
+		analyze(srcFilename, flag.Arg(1))
+		return
+	}
+
+	filenames := []string{srcFilename}
+	dir := filepath.Dir(srcFilename)
+	if filepath.Ext(srcFilename) != ".jack" {
+		var err error
+		filenames, err = codegen.JackFiles(srcFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dir = srcFilename
+	}
+	if *strict && !typeCheck(dir, filenames) {
+		os.Exit(1)
+	}
+	if *prune && filepath.Ext(srcFilename) == ".jack" {
+		log.Fatal("-prune needs the dir of the whole program")
+	}
 
+	var classes []*codegen.Class
+	for _, filename := range filenames {
+		class, err := codegen.CompileFile(filename, options())
+		if err != nil {
+			log.Fatal(err)
+		}
+		classes = append(classes, class)
+	}
+	if *prune {
+		graph := callgraph.Build(codegen.Program(classes), callgraph.Roots...)
+		if !graph.Reachable["Main.main"] {
+			log.Fatal("-prune: Main.main is not declared")
+		}
+		for _, class := range classes {
+			class.Prune(func(fn string) bool { return graph.Reachable[fn] })
+		}
+	}
+	if *asm {
+		if err := link(dir, classes); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for i, class := range classes {
+		if err := write(filenames[i], class); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *calls {
+		reportCalls(os.Stderr, codegen.Program(classes))
+	}
+}
+
+// reportCalls writes the call count of every called function, most called
+// first
+func reportCalls(w io.Writer, program []*vm.Command) {
+	counts := vm.CallCounts(program)
+	var names []string
+	total := 0
+	for name, n := range counts {
+		names = append(names, name)
+		total += n
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Fprintf(w, "%6d %s\n", counts[name], name)
+	}
+	fmt.Fprintf(w, "%6d total\n", total)
+}
+
+func analyze(srcFilename, dstFilename string) {
 	src, err := os.ReadFile(srcFilename)
 	if err != nil {
 		log.Fatal(err)
@@ -20,7 +135,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	tree := parser.New(src).ParseTree()
+	tree := options().Parser.New(src).ParseTree()
 	enc := xml.NewEncoder(w)
 	enc.Indent("", "  ")
 	err = enc.Encode(tree)
@@ -28,3 +143,97 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// typeCheck checks the classes of the dir, reporting the errors of the given
+// files
+func typeCheck(dir string, filenames []string) bool {
+	program, err := codegen.JackFiles(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var classes []*ast.ClassDecl
+	files := make(map[string]string)
+	for _, filename := range program {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		class, err := ast.Parse(src, options().Parser)
+		if err != nil {
+			log.Fatalf("%s:%v", filename, err)
+		}
+		classes = append(classes, class)
+		files[class.Name.Name] = filename
+	}
+	checked := make(map[string]bool)
+	for _, filename := range filenames {
+		checked[filepath.Clean(filename)] = true
+	}
+	ok := true
+	for _, err := range types.Check(classes) {
+		if filename := files[err.Class]; checked[filepath.Clean(filename)] {
+			fmt.Fprintf(os.Stderr, "%s:%s: %s\n", filename, err.Pos, err.Msg)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// link translates the classes along with the os into the .asm file named after
+// the dir, setting the rom address of every command of the classes
+func link(dir string, classes []*codegen.Class) error {
+	var lib []*vm.Command
+	if *osDir != "" {
+		var err error
+		lib, err = vm.ParseDir(*osDir)
+		if err != nil {
+			return err
+		}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(filepath.Join(dir, filepath.Base(abs)+".asm"))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	addrs, err := vm.Translate(w, vm.AddLibrary(codegen.Program(classes), lib))
+	if err != nil {
+		return err
+	}
+	codegen.SetROM(classes, addrs)
+	return nil
+}
+
+// write writes the .vm file of the class compiled from the given file, and
+// its debug map with -g
+func write(filename string, class *codegen.Class) error {
+	basename := strings.TrimSuffix(filename, ".jack")
+	w, err := os.Create(basename + ".vm")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	err = vm.Write(w, class.Commands)
+	if err != nil || !*debugMap {
+		return err
+	}
+
+	dw, err := os.Create(basename + ".dbg.json")
+	if err != nil {
+		return err
+	}
+	defer dw.Close()
+	return class.Debug.Write(dw)
+}
+
+// options returns the compilation options selected by the flags
+func options() codegen.Options {
+	opts := codegen.Options{Parser: parser.Config{Backend: backend}, Optimize: *optimize, Extended: *extended}
+	if *dialect {
+		opts.Parser.Mode = scanner.ScanDialect
+	}
+	return opts
+}
@@ -0,0 +1,440 @@
+// Package descent is a recursive-descent jack parser, building the same trees
+// as the schema-driven parse/parser.
+package descent
+
+import (
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+type node struct {
+	typ      parse.NodeType
+	children []parse.Node
+	tok      *parse.Token
+}
+
+func (n *node) Type() parse.NodeType   { return n.typ }
+func (n *node) Children() []parse.Node { return n.children }
+func (n *node) Token() *parse.Token    { return n.tok }
+
+func (n *node) AddNode(child parse.Node) bool {
+	n.children = append(n.children, child)
+	return true
+}
+
+// bailout unwinds the parser up to the enclosing statement or declaration
+type bailout struct{}
+
+type Parser struct {
+	s       *scanner.Scanner
+	tok     *parse.Token
+	errs    []*parse.Error
+	dialect bool
+}
+
+func New(src []byte) *Parser {
+	return NewWithMode(src, 0)
+}
+
+// NewWithMode parses the tokens scanned with the given mode, attaching their
+// trivia with scanner.ScanTrivia. With scanner.ScanDialect it parses the
+// extensions of the dialect and gives binary operators the usual precedence
+func NewWithMode(src []byte, mode scanner.Mode) *Parser {
+	p := &Parser{s: scanner.NewWithMode(src, mode&^scanner.ScanComments), dialect: mode&scanner.ScanDialect != 0}
+	p.next()
+	return p
+}
+
+// Errors returns the syntax errors found by ParseTree
+func (p *Parser) Errors() []*parse.Error {
+	return p.errs
+}
+
+func (p *Parser) ParseTree() *parse.Tree {
+	tree := &parse.Tree{Name: "tree"}
+	if !p.is(token.CLASS) {
+		p.error("class")
+		return tree
+	}
+	tree.Root = p.class()
+	if !p.is(token.EOF) {
+		p.error("")
+		return tree
+	}
+	tree.Trailing = p.tok.Leading
+	return tree
+}
+
+func (p *Parser) next() {
+	p.tok = parse.NewToken(p.s.Scan())
+	p.tok.Pos = p.s.Pos()
+	p.tok.Leading = p.s.Trivia()
+}
+
+// error reports the current token as unexpected, once per position
+func (p *Parser) error(expected string) {
+	if n := len(p.errs); n > 0 && p.errs[n-1].Pos == p.tok.Pos {
+		return
+	}
+	p.errs = append(p.errs, parse.Unexpected(p.tok, expected))
+}
+
+func (p *Parser) is(toks ...token.Token) bool {
+	for _, tok := range toks {
+		if p.tok.Token == tok {
+			return true
+		}
+	}
+	return false
+}
+
+// expect adds the current token to n if it is one of the given ones, bailing
+// out otherwise
+func (p *Parser) expect(n *node, toks ...token.Token) {
+	p.must(toks...)
+	p.add(n)
+}
+
+// must bails out unless the current token is one of the given ones
+func (p *Parser) must(toks ...token.Token) {
+	if p.is(toks...) {
+		return
+	}
+	var names []string
+	for _, tok := range toks {
+		if tok == token.IDENT {
+			names = append(names, "identifier")
+		} else {
+			names = append(names, tok.String())
+		}
+	}
+	p.error(strings.Join(names, " or "))
+	panic(bailout{})
+}
+
+func (p *Parser) expectType(n *node, orVoid bool) {
+	if !token.IsType(p.tok.Token) && !(orVoid && p.is(token.VOID)) {
+		p.error("type")
+		panic(bailout{})
+	}
+	p.add(n)
+}
+
+// add consumes the current token as a child of n
+func (p *Parser) add(n *node) {
+	n.AddNode(p.take())
+}
+
+// take consumes the current token
+func (p *Parser) take() parse.Node {
+	n := &node{typ: parse.NodeToken, tok: p.tok}
+	p.next()
+	return n
+}
+
+// recover stops a bailout, skipping tokens until one of the given ones or the
+// end of file is found. The tokens to stop at are consumed when consume is set
+func (p *Parser) recover(consume []token.Token, stop ...token.Token) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(bailout); !ok {
+		panic(r)
+	}
+	for !p.is(token.EOF) {
+		if p.is(consume...) {
+			p.next()
+			return
+		}
+		if p.is(stop...) {
+			return
+		}
+		p.next()
+	}
+}
+
+var (
+	declStart = []token.Token{token.STATIC, token.FIELD, token.CONSTRUCTOR, token.FUNCTION, token.METHOD, token.RBRACE}
+	stmtStart = []token.Token{token.LET, token.IF, token.WHILE, token.DO, token.RETURN, token.FOR}
+	stmtSync  = append([]token.Token{token.VAR, token.RBRACE}, stmtStart...)
+)
+
+func (p *Parser) class() *node {
+	n := &node{typ: parse.NodeClass}
+	defer p.recover(nil)
+	p.add(n)
+	p.expect(n, token.IDENT)
+	p.expect(n, token.LBRACE)
+	for p.is(token.STATIC, token.FIELD) {
+		n.AddNode(p.classVarDec())
+	}
+	for p.is(token.CONSTRUCTOR, token.FUNCTION, token.METHOD) {
+		n.AddNode(p.subroutineDec())
+	}
+	p.expect(n, token.RBRACE)
+	return n
+}
+
+func (p *Parser) classVarDec() (n *node) {
+	n = &node{typ: parse.NodeClassVarDec}
+	defer p.recover([]token.Token{token.SEMICOLON}, declStart...)
+	p.varDec(n)
+	return n
+}
+
+// varDec parses `kind type name (, name)* ;`
+func (p *Parser) varDec(n *node) {
+	p.add(n)
+	p.expectType(n, false)
+	p.expect(n, token.IDENT)
+	for p.is(token.COMMA) {
+		p.add(n)
+		p.expect(n, token.IDENT)
+	}
+	p.expect(n, token.SEMICOLON)
+}
+
+func (p *Parser) subroutineDec() (n *node) {
+	n = &node{typ: parse.NodeSubroutineDec}
+	defer p.recover(nil, declStart[:len(declStart)-1]...)
+	p.add(n)
+	p.expectType(n, true)
+	p.expect(n, token.IDENT)
+	p.expect(n, token.LPAREN)
+	if !p.is(token.RPAREN) {
+		n.AddNode(p.parameterList())
+	}
+	p.expect(n, token.RPAREN)
+	n.AddNode(p.subroutineBody())
+	return n
+}
+
+func (p *Parser) parameterList() *node {
+	n := &node{typ: parse.NodeParameterList}
+	p.expectType(n, false)
+	p.expect(n, token.IDENT)
+	for p.is(token.COMMA) {
+		p.add(n)
+		p.expectType(n, false)
+		p.expect(n, token.IDENT)
+	}
+	return n
+}
+
+func (p *Parser) subroutineBody() *node {
+	n := &node{typ: parse.NodeSubroutineBody}
+	p.expect(n, token.LBRACE)
+	for p.is(token.VAR) {
+		n.AddNode(p.localVarDec())
+	}
+	p.statements(n)
+	p.expect(n, token.RBRACE)
+	return n
+}
+
+func (p *Parser) localVarDec() (n *node) {
+	n = &node{typ: parse.NodeVarDec}
+	defer p.recover([]token.Token{token.SEMICOLON}, stmtSync...)
+	p.varDec(n)
+	return n
+}
+
+// statements adds the statements found up to a closing brace to n
+func (p *Parser) statements(n *node) {
+	for p.is(stmtStart...) {
+		n.AddNode(p.statement())
+	}
+}
+
+func (p *Parser) statement() (n *node) {
+	defer p.recover([]token.Token{token.SEMICOLON}, stmtSync...)
+	switch p.tok.Token {
+	case token.LET:
+		n = &node{typ: parse.NodeLetStatement}
+		p.add(n)
+		p.assignment(n)
+		p.expect(n, token.SEMICOLON)
+	case token.IF:
+		n = &node{typ: parse.NodeIfStatement}
+		p.condBlock(n)
+		if p.is(token.ELSE) {
+			p.add(n)
+			if p.dialect && p.is(token.IF) {
+				n.AddNode(p.statement())
+			} else {
+				p.block(n)
+			}
+		}
+	case token.FOR:
+		n = &node{typ: parse.NodeForStatement}
+		p.add(n)
+		p.expect(n, token.LPAREN)
+		if !p.is(token.SEMICOLON) {
+			n.AddNode(p.forAssignment())
+		}
+		p.expect(n, token.SEMICOLON)
+		n.AddNode(p.expression())
+		p.expect(n, token.SEMICOLON)
+		if !p.is(token.RPAREN) {
+			n.AddNode(p.forAssignment())
+		}
+		p.expect(n, token.RPAREN)
+		p.block(n)
+	case token.WHILE:
+		n = &node{typ: parse.NodeWhileStatement}
+		p.condBlock(n)
+	case token.DO:
+		n = &node{typ: parse.NodeDoStatement}
+		p.add(n)
+		p.must(token.IDENT)
+		n.AddNode(p.subroutineCall(p.take()))
+		p.expect(n, token.SEMICOLON)
+	case token.RETURN:
+		n = &node{typ: parse.NodeReturnStatement}
+		p.add(n)
+		if !p.is(token.SEMICOLON) {
+			n.AddNode(p.expression())
+		}
+		p.expect(n, token.SEMICOLON)
+	}
+	return n
+}
+
+// assignment parses `name ([ expression ])? = expression`, where the dialect
+// also allows compound assignments like +=
+func (p *Parser) assignment(n *node) {
+	p.expect(n, token.IDENT)
+	if p.is(token.LBRACK) {
+		p.add(n)
+		n.AddNode(p.expression())
+		p.expect(n, token.RBRACK)
+	}
+	if token.IsCompoundAssign(p.tok.Token) {
+		p.add(n)
+	} else {
+		p.expect(n, token.EQ)
+	}
+	n.AddNode(p.expression())
+}
+
+func (p *Parser) forAssignment() *node {
+	n := &node{typ: parse.NodeAssignment}
+	p.assignment(n)
+	return n
+}
+
+// condBlock parses `keyword ( expression ) { statements }`
+func (p *Parser) condBlock(n *node) {
+	p.add(n)
+	p.expect(n, token.LPAREN)
+	n.AddNode(p.expression())
+	p.expect(n, token.RPAREN)
+	p.block(n)
+}
+
+func (p *Parser) block(n *node) {
+	p.expect(n, token.LBRACE)
+	p.statements(n)
+	p.expect(n, token.RBRACE)
+}
+
+func (p *Parser) expression() *node {
+	if p.dialect {
+		x := p.operand(1)
+		if n, ok := x.(*node); ok && n.typ == parse.NodeExpression {
+			return n
+		}
+		return &node{typ: parse.NodeExpression, children: []parse.Node{x}}
+	}
+	n := &node{typ: parse.NodeExpression}
+	n.AddNode(p.term())
+	for token.IsBinaryOperator(p.tok.Token) {
+		p.add(n)
+		n.AddNode(p.term())
+	}
+	return n
+}
+
+// precedences of the binary operators in the dialect
+var precedences = map[token.Token]int{
+	token.AND: 1, token.OR: 1,
+	token.LT: 2, token.GT: 2, token.EQ: 2,
+	token.ADD: 3, token.SUB: 3,
+	token.MUL: 4, token.DIV: 4,
+}
+
+const maxPrecedence = 4
+
+// operand parses the operators of the given precedence and higher, nesting
+// an expression node for every chain of operators of the same precedence
+func (p *Parser) operand(prec int) parse.Node {
+	if prec > maxPrecedence {
+		return p.term()
+	}
+	x := p.operand(prec + 1)
+	if precedences[p.tok.Token] != prec {
+		return x
+	}
+	n := &node{typ: parse.NodeExpression, children: []parse.Node{x}}
+	for precedences[p.tok.Token] == prec {
+		p.add(n)
+		n.AddNode(p.operand(prec + 1))
+	}
+	return n
+}
+
+func (p *Parser) term() *node {
+	n := &node{typ: parse.NodeTerm}
+	switch {
+	case p.is(token.INTEGER_CONST, token.STRING_CONST, token.CHAR_CONST, token.TRUE, token.FALSE, token.NULL, token.THIS):
+		p.add(n)
+	case p.is(token.IDENT):
+		name := p.take()
+		if p.is(token.LPAREN, token.DOT) {
+			n.AddNode(p.subroutineCall(name))
+			break
+		}
+		n.AddNode(name)
+		if p.is(token.LBRACK) {
+			p.add(n)
+			n.AddNode(p.expression())
+			p.expect(n, token.RBRACK)
+		}
+	case p.is(token.LPAREN):
+		p.add(n)
+		n.AddNode(p.expression())
+		p.expect(n, token.RPAREN)
+	case token.IsUnaryOperator(p.tok.Token):
+		p.add(n)
+		n.AddNode(p.term())
+	default:
+		p.error("expression")
+		panic(bailout{})
+	}
+	return n
+}
+
+// subroutineCall parses the call following the already consumed name
+func (p *Parser) subroutineCall(name parse.Node) *node {
+	n := &node{typ: parse.NodeSubroutineCall, children: []parse.Node{name}}
+	if p.is(token.DOT) {
+		p.add(n)
+		p.expect(n, token.IDENT)
+	}
+	p.expect(n, token.LPAREN)
+	if !p.is(token.RPAREN) {
+		list := &node{typ: parse.NodeExpressionList}
+		list.AddNode(p.expression())
+		for p.is(token.COMMA) {
+			p.add(list)
+			list.AddNode(p.expression())
+		}
+		n.AddNode(list)
+	}
+	p.expect(n, token.RPAREN)
+	return n
+}
@@ -0,0 +1,93 @@
+package descent
+
+import (
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+)
+
+func TestParseTree_Recovery(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		want  []string
+		stmts int // statements kept in the body of the last subroutine
+	}{
+		{
+			name:  "valid",
+			src:   "class A { function void f() { if (x) { let a = 1; } return; } }",
+			stmts: 2,
+		},
+		{
+			name:  "bad-statements",
+			src:   "class A { function void f() { let = 1; do g(; let b = 2; return; } }",
+			want:  []string{`1:35: unexpected "=", expected identifier`, `1:45: unexpected ";", expected expression`},
+			stmts: 4,
+		},
+		{
+			name:  "bad-declaration",
+			src:   "class A { field x; function void f() { return; } }",
+			want:  []string{`1:18: unexpected ";", expected identifier`},
+			stmts: 1,
+		},
+		{
+			name:  "bad-subroutine",
+			src:   "class A { function f() { return; } method void g() { return; } }",
+			want:  []string{`1:21: unexpected "(", expected identifier`},
+			stmts: 1,
+		},
+		{
+			name: "missing-rbrace",
+			src:  "class A {\n  function void f() {\n    return;\n  }\n",
+			want: []string{"5:1: unexpected end of file, expected }"},
+		},
+		{
+			name: "trailing-tokens",
+			src:  "class A { } }",
+			want: []string{`1:13: unexpected "}"`},
+		},
+		{
+			name: "illegal-char",
+			src:  "class A { function void f() { let x = #; return; } }",
+			want: []string{`1:39: illegal character "#"`},
+		},
+		{
+			name: "empty",
+			src:  "",
+			want: []string{"1:1: unexpected end of file, expected class"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New([]byte(tt.src))
+			tree := p.ParseTree()
+			var got []string
+			for _, err := range p.Errors() {
+				got = append(got, err.Error())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Errors() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Errors()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if tt.stmts == 0 {
+				return
+			}
+			class := tree.Root.Children()
+			sub := class[len(class)-2].Children()
+			body := sub[len(sub)-1]
+			var stmts int
+			for _, child := range body.Children() {
+				if child.Token() == nil && child.Type() != parse.NodeVarDec {
+					stmts++
+				}
+			}
+			if stmts != tt.stmts {
+				t.Errorf("body holds %d statements, want %d", stmts, tt.stmts)
+			}
+		})
+	}
+}
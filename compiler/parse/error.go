@@ -0,0 +1,73 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+// Error is a syntax error found at the given position
+type Error struct {
+	Pos token.Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// Unexpected reports the given token, along with what was expected instead if
+// not empty
+func Unexpected(tok *Token, expected string) *Error {
+	var msg string
+	switch tok.Token {
+	case token.EOF:
+		msg = "unexpected end of file" + withExpected(expected)
+	case token.ILLEGAL:
+		switch tok.Literal[0] {
+		case '"':
+			msg = "unterminated string"
+		case '\'':
+			msg = fmt.Sprintf("invalid char literal %s", tok.Literal)
+		default:
+			msg = fmt.Sprintf("illegal character %q", tok.Literal)
+		}
+	default:
+		msg = fmt.Sprintf("unexpected %q", tok.Literal) + withExpected(expected)
+	}
+	return &Error{Pos: tok.Pos, Msg: msg}
+}
+
+func withExpected(expected string) string {
+	if expected == "" {
+		return ""
+	}
+	return ", expected " + expected
+}
+
+// FirstToken returns the first token held by the node
+func FirstToken(n Node) *Token {
+	if n.Token() != nil {
+		return n.Token()
+	}
+	for _, child := range n.Children() {
+		if tok := FirstToken(child); tok != nil {
+			return tok
+		}
+	}
+	return nil
+}
+
+// LastToken returns the last token held by the node
+func LastToken(n Node) *Token {
+	if n.Token() != nil {
+		return n.Token()
+	}
+	children := n.Children()
+	for i := len(children) - 1; i >= 0; i-- {
+		if tok := LastToken(children[i]); tok != nil {
+			return tok
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/parse/descent"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+)
+
+// Backend is a parser implementation, all of them building the same trees
+type Backend string
+
+const (
+	// SchemaBackend is the state machine driven by the node schemas
+	SchemaBackend Backend = "schema"
+	// DescentBackend is the recursive-descent parser, which recovers from
+	// errors at statement and declaration boundaries
+	DescentBackend Backend = "descent"
+)
+
+// Set implements flag.Value
+func (b *Backend) Set(s string) error {
+	switch Backend(s) {
+	case SchemaBackend, DescentBackend:
+		*b = Backend(s)
+		return nil
+	}
+	return fmt.Errorf("unknown parser backend: %s", s)
+}
+
+func (b *Backend) String() string {
+	return string(*b)
+}
+
+// NewBackend returns a parser of the given backend. The dialect is only
+// supported by the descent backend, which is always used with scanner.ScanDialect
+func NewBackend(src []byte, mode scanner.Mode, b Backend) parse.Parser {
+	if b == DescentBackend || mode&scanner.ScanDialect != 0 {
+		return descent.NewWithMode(src, mode)
+	}
+	return NewWithMode(src, mode)
+}
+
+// Config selects the backend of a parser and the mode of its scanner, the
+// zero value being the schema backend
+type Config struct {
+	Backend Backend
+	Mode    scanner.Mode
+}
+
+// New returns a parser of the configured backend
+func (c Config) New(src []byte) parse.Parser {
+	return NewBackend(src, c.Mode, c.Backend)
+}
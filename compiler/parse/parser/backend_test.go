@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+)
+
+func jackFiles(t testing.TB, dir string) []string {
+	var filenames []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".jack" {
+			filenames = append(filenames, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filenames
+}
+
+func dump(sb *strings.Builder, n parse.Node, depth int) {
+	fmt.Fprintf(sb, "%s%s", strings.Repeat(" ", depth), n.Type())
+	if tok := n.Token(); tok != nil {
+		fmt.Fprintf(sb, " %v %q %v", tok.Token, tok.Literal, tok.Pos)
+	}
+	sb.WriteByte('\n')
+	for _, child := range n.Children() {
+		dump(sb, child, depth+1)
+	}
+}
+
+func marshal(t *testing.T, tree *parse.Tree) string {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestBackends_SameTree checks that the descent backend builds the same trees
+// as the schema one, including the trivia of the tokens
+func TestBackends_SameTree(t *testing.T) {
+	for _, filename := range jackFiles(t, "../../../projects") {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dumps, xmls [2]string
+		for i, b := range []Backend{SchemaBackend, DescentBackend} {
+			p := NewBackend(src, scanner.ScanTrivia, b)
+			tree := p.ParseTree()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("%s: %s: %v", filename, b, p.Errors()[0])
+			}
+			if tree.String() != string(src) {
+				t.Errorf("%s: %s: Tree.String() differs from the source", filename, b)
+			}
+			var sb strings.Builder
+			dump(&sb, tree.Root, 0)
+			dumps[i], xmls[i] = sb.String(), marshal(t, tree)
+		}
+		if dumps[0] != dumps[1] {
+			t.Errorf("%s: descent tree differs from the schema one", filename)
+		}
+		if xmls[0] != xmls[1] {
+			t.Errorf("%s: descent xml differs from the schema one", filename)
+		}
+	}
+}
+
+func BenchmarkParseTree(b *testing.B) {
+	var srcs [][]byte
+	for _, filename := range jackFiles(b, "../../../projects/10") {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			b.Fatal(err)
+		}
+		srcs = append(srcs, src)
+	}
+	for _, backend := range []Backend{SchemaBackend, DescentBackend} {
+		b.Run(string(backend), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, src := range srcs {
+					NewBackend(src, 0, backend).ParseTree()
+				}
+			}
+		})
+	}
+}
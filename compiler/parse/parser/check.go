@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+// check reports the tokens left unparsed and the incomplete nodes of the tree
+func (p *parser) check(root parse.Node) {
+	if root == nil || root.Type() != parse.NodeClass {
+		p.errorf(p.token, "class")
+		return
+	}
+	checkNode(root, &p.errs)
+	p.next()
+	if p.token.Token != token.EOF {
+		p.errorf(p.token, "")
+	}
+}
+
+func (p *parser) errorf(tok *parse.Token, expected string) {
+	p.errs = append(p.errs, parse.Unexpected(tok, expected))
+}
+
+// checkNode reports the deepest incomplete nodes, returning whether any
+// was found
+func checkNode(n parse.Node, errs *[]*parse.Error) bool {
+	bad := false
+	for _, child := range n.Children() {
+		if checkNode(child, errs) {
+			bad = true
+		}
+	}
+	if bad || isComplete(n) {
+		return bad
+	}
+	var at token.Pos
+	if last := parse.LastToken(n); last != nil {
+		at = last.End()
+	}
+	*errs = append(*errs, &parse.Error{Pos: at, Msg: "incomplete " + n.Type().String()})
+	return true
+}
+
+func isComplete(n parse.Node) bool {
+	nn, ok := n.(*node)
+	if !ok || nn.Closed || n.Type() == parse.NodeToken {
+		return true
+	}
+	children := n.Children()
+	last := func() parse.Node {
+		if len(children) == 0 {
+			return nil
+		}
+		return children[len(children)-1]
+	}
+	switch n.Type() {
+	case parse.NodeIfStatement:
+		for _, child := range children {
+			if child.Token().Is(token.ELSE) {
+				return false
+			}
+		}
+		return len(children) >= 6 && last().Token().Is(token.RBRACE)
+	case parse.NodeTerm:
+		return len(children) == 1 && children[0].Token().Is(token.IDENT)
+	case parse.NodeExpression:
+		return len(children)%2 == 1 && last().Type() == parse.NodeTerm
+	case parse.NodeExpressionList:
+		return len(children) == 0 || last().Type() == parse.NodeExpression
+	case parse.NodeParameterList:
+		return len(children)%3 == 2 && last().Token().Is(token.IDENT)
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+)
+
+func TestParseTree_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "valid",
+			src:  "class A { function void f() { if (x) { let a = 1; } return; } }",
+		},
+		{
+			name: "missing-semicolon",
+			src:  "class A { function void f() { let x = 1 let y = 2; return; } }",
+			want: []string{"1:40: incomplete letStatement"},
+		},
+		{
+			name: "missing-expression",
+			src:  "class A { function void f() { let x = ; return; } }",
+			want: []string{"1:38: incomplete letStatement", `1:39: unexpected ";"`},
+		},
+		{
+			name: "missing-rbrace",
+			src:  "class A {\n  function void f() {\n    return;\n  }\n",
+			want: []string{"4:4: incomplete class"},
+		},
+		{
+			name: "trailing-tokens",
+			src:  "class A { } }",
+			want: []string{`1:13: unexpected "}"`},
+		},
+		{
+			name: "illegal-char",
+			src:  "class A { field int x # }",
+			want: []string{"1:22: incomplete classVarDec", `1:23: illegal character "#"`},
+		},
+		{
+			name: "empty",
+			src:  "",
+			want: []string{"1:1: unexpected end of file, expected class"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New([]byte(tt.src))
+			p.ParseTree()
+			var got []string
+			for _, err := range p.Errors() {
+				got = append(got, err.Error())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Errors() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Errors()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseTree_IfWithoutElse(t *testing.T) {
+	p := New([]byte("class A { function void f() { if (x) { let a = 1; } return; } }"))
+	tree := p.ParseTree()
+	body := tree.Root.Children()[3].Children()[5]
+	var types []parse.NodeType
+	for _, child := range body.Children() {
+		types = append(types, child.Type())
+	}
+	want := []parse.NodeType{parse.NodeToken, parse.NodeIfStatement, parse.NodeReturnStatement, parse.NodeToken}
+	if len(types) != len(want) {
+		t.Fatalf("body children = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("body children = %v, want %v", types, want)
+		}
+	}
+}
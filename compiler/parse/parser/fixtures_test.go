@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// statements returns every statement of the xml parse tree, in document
+// order, with the tokens it spans
+func statements(t *testing.T, src string) []string {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(src))
+	var open []int
+	var stmts []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return stmts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if strings.HasSuffix(tok.Name.Local, "Statement") {
+				open = append(open, len(stmts))
+				stmts = append(stmts, tok.Name.Local+":")
+			}
+		case xml.EndElement:
+			if strings.HasSuffix(tok.Name.Local, "Statement") {
+				open = open[:len(open)-1]
+			}
+		case xml.CharData:
+			if lit := strings.TrimSpace(string(tok)); lit != "" {
+				for _, i := range open {
+					stmts[i] += " " + lit
+				}
+			}
+		}
+	}
+}
+
+// TestParseTree_Fixtures compares the statements of the trees with the ones of
+// the projects/10 xml fixtures, which lay out the rest of nodes differently.
+// Statements following an if without else don't belong to it
+func TestParseTree_Fixtures(t *testing.T) {
+	filenames, err := filepath.Glob("../../../projects/10/*/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range filenames {
+		t.Run(filename, func(t *testing.T) {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fixture, err := os.ReadFile(strings.TrimSuffix(filename, ".jack") + ".xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := statements(t, marshal(t, New(src).ParseTree()))
+			want := statements(t, string(fixture))
+			if len(got) != len(want) {
+				t.Fatalf("%d statements, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("statement %d = %s\nwant %s", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
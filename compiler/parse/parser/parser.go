@@ -14,10 +14,18 @@ type parser struct {
 	prevToken *parse.Token
 	nextToken *parse.Token
 	parent    *node
+
+	errs []*parse.Error
 }
 
 func New(src []byte) *parser {
-	s := scanner.New(src)
+	return NewWithMode(src, 0)
+}
+
+// NewWithMode parses the tokens scanned with the given mode, attaching their
+// trivia with scanner.ScanTrivia
+func NewWithMode(src []byte, mode scanner.Mode) *parser {
+	s := scanner.NewWithMode(src, mode&^scanner.ScanComments)
 	schema := &nodeSchema{}
 	return &parser{s: s, parent: schema.newNode()}
 }
@@ -26,7 +34,17 @@ type parserFunc func() parse.Node
 
 func (p *parser) ParseTree() *parse.Tree {
 	root := p.Parse()
-	return &parse.Tree{Name: "tree", Root: root}
+	p.check(root)
+	tree := &parse.Tree{Name: "tree", Root: root}
+	if p.token.Is(token.EOF) {
+		tree.Trailing = p.token.Leading
+	}
+	return tree
+}
+
+// Errors returns the syntax errors found by ParseTree
+func (p *parser) Errors() []*parse.Error {
+	return p.errs
 }
 
 func (p *parser) Parse() parse.Node {
@@ -97,6 +115,8 @@ func (p *parser) next() {
 		return
 	}
 	p.token = parse.NewToken(p.s.Scan())
+	p.token.Pos = p.s.Pos()
+	p.token.Leading = p.s.Trivia()
 }
 
 func (p *parser) prev() {
@@ -106,10 +106,11 @@ var (
 
 			fieldLBrace,
 			fieldStatements,
-			fieldRBrace,
+			// the statements following an if without else don't belong to it
+			{required: true, mustOneOfTokens: []token.Token{token.RBRACE}, isSubsetCloser: true, nextState: 3},
 
 			{required: false, mustOneOfTokens: []token.Token{token.ELSE}, subset: 1, isChainer: true},
-			{required: false, mustOneOfTokens: []token.Token{token.LBRACE}, subset: 1},
+			{required: false, mustOneOfTokens: []token.Token{token.LBRACE}, subset: 1, nextState: 2},
 			{required: false, multiple: true, mustNodeTypeRule: isStatement, subset: 1},
 			{required: false, mustOneOfTokens: []token.Token{token.RBRACE}, isCloser: true, subset: 1},
 		},
@@ -228,7 +229,6 @@ var (
 	fieldType       = fieldMustTokenRule(token.IsType)
 
 	fieldLBrace       = fieldMustTokens(token.LBRACE)
-	fieldRBrace       = fieldMustTokens(token.RBRACE)
 	fieldRBraceCloser = &fieldSchema{required: true, mustOneOfTokens: []token.Token{token.RBRACE}, isCloser: true}
 )
 
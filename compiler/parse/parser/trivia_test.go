@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/parse"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+func TestParseTree_Trivia(t *testing.T) {
+	src := "// head\r\nclass A {\n\t/** doc */ field int x; // x\n}\n\n// tail\n"
+	tree := NewWithMode([]byte(src), scanner.ScanTrivia).ParseTree()
+	if got := tree.String(); got != src {
+		t.Errorf("Tree.String() = %q, want %q", got, src)
+	}
+
+	field := parse.FirstToken(tree.Root.Children()[3])
+	want := []scanner.Trivia{
+		{Token: token.WHITESPACE, Literal: "\n\t", Pos: token.Pos{Line: 2, Col: 10}},
+		{Token: token.COMMENT, Literal: "/** doc */", Pos: token.Pos{Line: 3, Col: 2}},
+		{Token: token.WHITESPACE, Literal: " ", Pos: token.Pos{Line: 3, Col: 12}},
+	}
+	if len(field.Leading) != len(want) {
+		t.Fatalf("field trivia = %v, want %v", field.Leading, want)
+	}
+	for i := range want {
+		if field.Leading[i] != want[i] {
+			t.Errorf("field trivia[%d] = %v, want %v", i, field.Leading[i], want[i])
+		}
+	}
+	if n := len(tree.Trailing); n != 3 || tree.Trailing[1].Literal != "// tail" {
+		t.Errorf("Tree.Trailing = %v", tree.Trailing)
+	}
+}
+
+func TestParseTree_RoundTrip(t *testing.T) {
+	var filenames []string
+	err := filepath.Walk("../../../projects", func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".jack" {
+			filenames = append(filenames, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewWithMode(src, scanner.ScanTrivia)
+		tree := p.ParseTree()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("%s: %v", filename, p.Errors()[0])
+		}
+		if tree.String() != string(src) {
+			t.Errorf("%s: Tree.String() differs from the source", filename)
+		}
+	}
+}
@@ -22,4 +22,6 @@ type Symbol struct {
 	Type  Type
 	Kind  Kind
 	Index int
+	// ClassName is only set for TYPE_CLASS_NAME symbols
+	ClassName string
 }
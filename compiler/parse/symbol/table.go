@@ -5,11 +5,15 @@ type Table struct {
 	kindPopulation map[Kind]int
 }
 
+func NewTable() *Table {
+	return &Table{table: make(map[string]*Symbol), kindPopulation: make(map[Kind]int)}
+}
+
 func (t *Table) Get(name string) *Symbol {
 	return t.table[name]
 }
 
-func (t *Table) Add(name string, kind Kind, typ Type) {
+func (t *Table) Add(name string, kind Kind, typ Type) *Symbol {
 	lastIndex, ok := t.kindPopulation[kind]
 	if !ok {
 		lastIndex = -1
@@ -17,4 +21,14 @@ func (t *Table) Add(name string, kind Kind, typ Type) {
 	s := &Symbol{Kind: kind, Type: typ, Index: lastIndex + 1}
 	t.table[name] = s
 	t.kindPopulation[kind] = s.Index
+	return s
+}
+
+// Count returns the amount of symbols of the given kind
+func (t *Table) Count(kind Kind) int {
+	lastIndex, ok := t.kindPopulation[kind]
+	if !ok {
+		return 0
+	}
+	return lastIndex + 1
 }
@@ -1,10 +1,21 @@
 package parse
 
-import "github.com/schattian/nand2tetris/compiler/token"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/scanner"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
 
 type Token struct {
 	Token   token.Token `json:"-"`
 	Literal string      `json:"literal"`
+	Pos     token.Pos   `json:"-"`
+	// Leading holds the whitespace and comments preceding the token when it
+	// was scanned with trivia
+	Leading []scanner.Trivia `json:"-"`
 }
 
 func NewToken(tok token.Token, lit string) *Token {
@@ -17,3 +28,36 @@ func (t *Token) Is(tok token.Token) bool {
 	}
 	return t.Token == tok
 }
+
+// Text returns the token as written in the source
+func (t *Token) Text() string {
+	switch t.Token {
+	case token.STRING_CONST:
+		return `"` + t.Literal + `"`
+	case token.CHAR_CONST:
+		return "'" + t.Literal + "'"
+	}
+	return t.Literal
+}
+
+// IntValue returns the value of an integer constant, either decimal or
+// hexadecimal, or the code of a char constant
+func (t *Token) IntValue() (int, error) {
+	switch t.Token {
+	case token.CHAR_CONST:
+		return int(t.Literal[len(t.Literal)-1]), nil
+	case token.INTEGER_CONST:
+		if hex := strings.TrimPrefix(strings.TrimPrefix(t.Literal, "0x"), "0X"); hex != t.Literal {
+			v, err := strconv.ParseUint(hex, 16, 16)
+			return int(v), err
+		}
+		v, err := strconv.ParseUint(t.Literal, 10, 15)
+		return int(v), err
+	}
+	return 0, fmt.Errorf("%s is not an integer constant", t.Literal)
+}
+
+// End returns the position following the token
+func (t *Token) End() token.Pos {
+	return token.Pos{Line: t.Pos.Line, Col: t.Pos.Col + len(t.Text())}
+}
@@ -2,11 +2,49 @@ package parse
 
 import (
 	"encoding/xml"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/scanner"
 )
 
 type Tree struct {
 	Name string
 	Root Node
+	// Trailing holds the trivia following the last token of the source
+	Trailing []scanner.Trivia
+}
+
+// String prints the tokens of the tree with their trivia, giving back the
+// parsed source byte-for-byte when it was scanned with trivia and had no errors
+func (tree *Tree) String() string {
+	var sb strings.Builder
+	writeTrivia := func(trivia []scanner.Trivia) {
+		for _, t := range trivia {
+			sb.WriteString(t.Literal)
+		}
+	}
+	var walk func(n Node)
+	walk = func(n Node) {
+		if tok := n.Token(); tok != nil {
+			writeTrivia(tok.Leading)
+			sb.WriteString(tok.Text())
+		}
+		for _, child := range n.Children() {
+			walk(child)
+		}
+	}
+	if tree.Root != nil {
+		walk(tree.Root)
+	}
+	writeTrivia(tree.Trailing)
+	return sb.String()
+}
+
+// Parser is implemented by the parser backends
+type Parser interface {
+	ParseTree() *Tree
+	// Errors returns the syntax errors found by ParseTree
+	Errors() []*Error
 }
 
 type Node interface {
@@ -69,6 +107,9 @@ const (
 	NodeWhileStatement
 	NodeDoStatement
 	NodeReturnStatement
+	// NodeForStatement and NodeAssignment are only parsed in the dialect
+	NodeForStatement
+	NodeAssignment
 
 	NodeExpression
 	NodeTerm
@@ -90,6 +131,8 @@ var nodeTypeTemplateNames = map[NodeType]string{
 	NodeWhileStatement:  "whileStatement",
 	NodeDoStatement:     "doStatement",
 	NodeReturnStatement: "returnStatement",
+	NodeForStatement:    "forStatement",
+	NodeAssignment:      "assignment",
 	NodeExpression:      "expression",
 	NodeTerm:            "term",
 	NodeExpressionList:  "expressionList",
@@ -8,23 +8,57 @@ import (
 
 const eof rune = -1
 
+type Mode uint
+
+const (
+	// ScanComments returns comments as COMMENT tokens instead of skipping them
+	ScanComments Mode = 1 << iota
+	// ScanTrivia records the whitespace and comments skipped before every token
+	ScanTrivia
+	// ScanDialect scans the extensions of the jack dialect: the for keyword,
+	// char and hex literals and compound assignments
+	ScanDialect
+)
+
+// Trivia is a run of whitespace or a comment preceding a token
+type Trivia struct {
+	Token   token.Token // WHITESPACE or COMMENT
+	Literal string
+	Pos     token.Pos
+}
+
 type Scanner struct {
 	src    []byte
 	char   rune // current char
 	offset int
+	mode   Mode
+
+	line      int
+	lineStart int
+	pos       token.Pos // pos of the last scanned token
+	trivia    []Trivia  // trivia preceding the last scanned token
 }
 
 func New(src []byte) *Scanner {
-	s := &Scanner{src: src}
+	return NewWithMode(src, 0)
+}
+
+func NewWithMode(src []byte, mode Mode) *Scanner {
+	s := &Scanner{src: src, mode: mode}
 	s.init()
 	return s
 }
 
 func (s *Scanner) init() {
+	s.line = 1
 	s.next()
 }
 
 func (s *Scanner) next() {
+	if s.char == '\n' {
+		s.line += 1
+		s.lineStart = s.offset
+	}
 	if s.offset > len(s.src)-1 {
 		s.char = eof
 	} else {
@@ -33,81 +67,172 @@ func (s *Scanner) next() {
 	s.offset += 1
 }
 
-func (s *Scanner) prev() {
-	s.offset -= 1
-	s.char = rune(s.src[s.offset-1])
+func (s *Scanner) peek() rune {
+	if s.offset > len(s.src)-1 {
+		return eof
+	}
+	return rune(s.src[s.offset])
 }
 
-func (s *Scanner) skipComments() {
-	if s.char != '/' {
-		return
-	}
+func (s *Scanner) isCommentStart() bool {
+	return s.char == '/' && (s.peek() == '/' || s.peek() == '*')
+}
 
+func (s *Scanner) skipComment() {
 	s.next()
-	if s.char != '/' && s.char != '*' {
-		s.prev()
-		return
-	}
-
 	if s.char == '*' {
 		s.next()
 		s.skipWildcardComment()
+		s.next()
+	} else {
+		for s.char != '\n' && s.char != eof {
+			s.next()
+		}
 	}
+}
 
-	for s.char != '\n' && s.char != eof {
-		s.next()
+func (s *Scanner) scanComment() (tok token.Token, lit string) {
+	start := s.offset - 1
+	s.skipComment()
+	return token.COMMENT, s.text(start)
+}
+
+// text returns the source from the given offset up to the current char
+func (s *Scanner) text(start int) string {
+	end := s.offset - 1
+	if end > len(s.src) {
+		end = len(s.src)
 	}
+	return string(s.src[start:end])
 }
 
 func (s *Scanner) skipWildcardComment() {
-	for s.char != '*' {
+	for s.char != '*' && s.char != eof {
 		s.next()
 	}
+	if s.char == eof {
+		return
+	}
 	s.next()
 	if s.char != '/' {
 		s.skipWildcardComment()
 	}
 }
 
+// Pos returns the position of the last scanned token
+func (s *Scanner) Pos() token.Pos {
+	return s.pos
+}
+
+// Trivia returns the trivia preceding the last scanned token, only recorded
+// with ScanTrivia
+func (s *Scanner) Trivia() []Trivia {
+	return s.trivia
+}
+
+func (s *Scanner) skipTrivia() {
+	s.trivia = nil
+	for {
+		pos := s.currentPos()
+		start := s.offset - 1
+		var tok token.Token
+		if unicode.IsSpace(s.char) {
+			for unicode.IsSpace(s.char) {
+				s.next()
+			}
+			tok = token.WHITESPACE
+		} else if s.isCommentStart() && s.mode&ScanComments == 0 {
+			s.skipComment()
+			tok = token.COMMENT
+		} else {
+			return
+		}
+		if s.mode&ScanTrivia != 0 {
+			s.trivia = append(s.trivia, Trivia{Token: tok, Literal: s.text(start), Pos: pos})
+		}
+	}
+}
+
+func (s *Scanner) currentPos() token.Pos {
+	return token.Pos{Line: s.line, Col: s.offset - s.lineStart}
+}
+
 func (s *Scanner) Scan() (tok token.Token, lit string) {
-	s.skipComments()
+	s.skipTrivia()
+	s.pos = s.currentPos()
 	tok, isLL1 := ll1Tokens[s.char]
-	if isLL1 {
+	if s.isCommentStart() {
+		tok, lit = s.scanComment()
+	} else if isLL1 {
 		lit = string(s.char)
 		s.next()
+		if compound, ok := compoundTokens[tok]; ok && s.mode&ScanDialect != 0 && s.char == '=' {
+			tok, lit = compound, lit+"="
+			s.next()
+		}
 	} else if unicode.IsDigit(s.char) {
 		tok, lit = s.scanDigits()
-	} else if unicode.IsSpace(s.char) {
-		s.next()
-		return s.Scan()
 	} else if isStringLiteralStart(s.char) {
 		tok, lit = s.scanStringLiteral()
+	} else if s.char == '\'' && s.mode&ScanDialect != 0 {
+		tok, lit = s.scanCharLiteral()
 	} else if isIdentStart(s.char) {
 		tok, lit = s.scanIdentifier()
 	} else {
-		panic(string(s.char))
+		tok, lit = token.ILLEGAL, string(s.char)
+		s.next()
 	}
 	return
 }
 
 func (s *Scanner) scanStringLiteral() (tok token.Token, lit string) {
 	s.next()
-	tok = token.STRING_CONST
+	start := s.offset - 1
 	for s.char != '"' {
-		lit += string(s.char)
+		if s.char == '\n' || s.char == eof {
+			// unterminated string
+			return token.ILLEGAL, `"` + s.text(start)
+		}
 		s.next()
 	}
+	lit = s.text(start)
 	s.next()
-	return
+	return token.STRING_CONST, lit
+}
+
+// scanCharLiteral scans a char like 'a', where the quote and the backslash are
+// escaped with a backslash. The literal is the source between the quotes
+func (s *Scanner) scanCharLiteral() (tok token.Token, lit string) {
+	s.next()
+	start := s.offset - 1
+	switch s.char {
+	case '\\':
+		s.next()
+		if s.char != '\'' && s.char != '\\' {
+			return token.ILLEGAL, "'" + s.text(start)
+		}
+	case '\'', '\n', eof:
+		return token.ILLEGAL, "'" + s.text(start)
+	}
+	s.next()
+	if s.char != '\'' {
+		return token.ILLEGAL, "'" + s.text(start)
+	}
+	lit = s.text(start)
+	s.next()
+	return token.CHAR_CONST, lit
 }
 
 func (s *Scanner) scanIdentifier() (tok token.Token, lit string) {
+	start := s.offset - 1
 	for isIdentBody(s.char) {
-		lit += string(s.char)
 		s.next()
 	}
+	lit = s.text(start)
 	if kwTok, isKw := llnTokens[lit]; isKw {
 		tok = kwTok
+	} else if lit == "for" && s.mode&ScanDialect != 0 {
+		tok = token.FOR
 	} else {
 		tok = token.IDENT
 	}
@@ -115,12 +240,26 @@ func (s *Scanner) scanIdentifier() (tok token.Token, lit string) {
 }
 
 func (s *Scanner) scanDigits() (tok token.Token, lit string) {
-	tok = token.INTEGER_CONST
+	start := s.offset - 1
+	if s.char == '0' && (s.peek() == 'x' || s.peek() == 'X') && s.mode&ScanDialect != 0 {
+		s.next()
+		s.next()
+		if !isHexDigit(s.char) {
+			return token.ILLEGAL, s.text(start)
+		}
+		for isHexDigit(s.char) {
+			s.next()
+		}
+		return token.INTEGER_CONST, s.text(start)
+	}
 	for unicode.IsDigit(s.char) {
-		lit += string(s.char)
 		s.next()
 	}
-	return
+	return token.INTEGER_CONST, s.text(start)
+}
+
+func isHexDigit(r rune) bool {
+	return unicode.IsDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
 }
 
 func isStringLiteralStart(r rune) bool {
@@ -159,6 +298,15 @@ var ll1Tokens = map[rune]token.Token{
 	'=': token.EQ,
 }
 
+var compoundTokens = map[token.Token]token.Token{
+	token.ADD: token.ADD_ASSIGN,
+	token.SUB: token.SUB_ASSIGN,
+	token.MUL: token.MUL_ASSIGN,
+	token.DIV: token.DIV_ASSIGN,
+	token.AND: token.AND_ASSIGN,
+	token.OR:  token.OR_ASSIGN,
+}
+
 var llnTokens = map[string]token.Token{
 	"null":        token.NULL,
 	"this":        token.THIS,
@@ -231,3 +231,103 @@ func TestScanner_ScanFiveTimes(t *testing.T) {
 		})
 	}
 }
+
+func TestScanner_Pos(t *testing.T) {
+	src := []byte(`class Foo {
+  // comment
+  /** doc
+   */ field int a;
+}`)
+	want := []token.Pos{
+		{Line: 1, Col: 1},
+		{Line: 1, Col: 7},
+		{Line: 1, Col: 11},
+		{Line: 4, Col: 7},
+		{Line: 4, Col: 13},
+		{Line: 4, Col: 17},
+		{Line: 4, Col: 18},
+		{Line: 5, Col: 1},
+	}
+	s := New(src)
+	for _, pos := range want {
+		s.Scan()
+		if s.Pos() != pos {
+			t.Errorf("Scanner.Pos() = %v, want %v", s.Pos(), pos)
+		}
+	}
+}
+
+func TestScanner_Illegal(t *testing.T) {
+	s := New([]byte("let a = #;\nlet s = \"abc\n;"))
+	var got []token.Token
+	var lits []string
+	for tok, lit := s.Scan(); tok != token.EOF; tok, lit = s.Scan() {
+		got = append(got, tok)
+		lits = append(lits, lit)
+	}
+	want := []token.Token{
+		token.LET, token.IDENT, token.EQ, token.ILLEGAL, token.SEMICOLON,
+		token.LET, token.IDENT, token.EQ, token.ILLEGAL, token.SEMICOLON,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scanner.Scan() = %v, want %v", got, want)
+	}
+	if lits[3] != "#" || lits[8] != `"abc` {
+		t.Errorf("illegal literals = %q, %q", lits[3], lits[8])
+	}
+}
+
+func TestScanner_ScanComments(t *testing.T) {
+	src := []byte("// head\nlet a = 1 / 2; /* doc\n */\n// eof")
+	s := NewWithMode(src, ScanComments)
+	var lits []string
+	var toks []token.Token
+	for tok, lit := s.Scan(); tok != token.EOF; tok, lit = s.Scan() {
+		toks = append(toks, tok)
+		lits = append(lits, lit)
+	}
+	want := []token.Token{
+		token.COMMENT, token.LET, token.IDENT, token.EQ, token.INTEGER_CONST,
+		token.DIV, token.INTEGER_CONST, token.SEMICOLON, token.COMMENT, token.COMMENT,
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("Scanner.Scan() = %v, want %v", toks, want)
+	}
+	wantLits := []string{"// head", "/* doc\n */", "// eof"}
+	gotLits := []string{lits[0], lits[8], lits[9]}
+	if !reflect.DeepEqual(gotLits, wantLits) {
+		t.Errorf("comment literals = %q, want %q", gotLits, wantLits)
+	}
+}
+
+func TestScanner_ScanDialect(t *testing.T) {
+	src := []byte(`for x += 0x1F; 'a' '\'' 0xG 'ab' for`)
+	s := NewWithMode(src, ScanDialect)
+	var toks []token.Token
+	var lits []string
+	for tok, lit := s.Scan(); tok != token.EOF; tok, lit = s.Scan() {
+		toks = append(toks, tok)
+		lits = append(lits, lit)
+	}
+	want := []token.Token{
+		token.FOR, token.IDENT, token.ADD_ASSIGN, token.INTEGER_CONST, token.SEMICOLON,
+		token.CHAR_CONST, token.CHAR_CONST, token.ILLEGAL,
+	}
+	if len(toks) < len(want) || !reflect.DeepEqual(toks[:len(want)], want) {
+		t.Fatalf("Scanner.Scan() = %v, want prefix %v", toks, want)
+	}
+	wantLits := []string{"for", "x", "+=", "0x1F", ";", "a", `\'`}
+	if !reflect.DeepEqual(lits[:len(wantLits)], wantLits) {
+		t.Errorf("literals = %q, want %q", lits[:len(wantLits)], wantLits)
+	}
+
+	s = New([]byte("for x += 1"))
+	toks = nil
+	for tok, _ := s.Scan(); tok != token.EOF; tok, _ = s.Scan() {
+		toks = append(toks, tok)
+	}
+	want = []token.Token{token.IDENT, token.IDENT, token.ADD, token.EQ, token.INTEGER_CONST}
+	if !reflect.DeepEqual(toks, want) {
+		t.Errorf("Scanner.Scan() without dialect = %v, want %v", toks, want)
+	}
+}
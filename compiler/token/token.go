@@ -1,7 +1,19 @@
 package token
 
+import "fmt"
+
 type Token uint
 
+// Pos is a 1-based source position
+type Pos struct {
+	Line int `json:"line"`
+	Col  int `json:"col"`
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
 func (t Token) Type() Type {
 	return tokenTypes[t]
 }
@@ -43,6 +55,25 @@ func IsBinaryOperator(t Token) bool {
 	return IsOperator(t) && t != NOT
 }
 
+// IsCompoundAssign tells whether t is an assignment like +=
+func IsCompoundAssign(t Token) bool {
+	return t >= ADD_ASSIGN && t <= OR_ASSIGN
+}
+
+// CompoundOperator returns the binary operator applied by a compound assignment
+func CompoundOperator(t Token) Token {
+	return compoundOperators[t]
+}
+
+var compoundOperators = map[Token]Token{
+	ADD_ASSIGN: ADD,
+	SUB_ASSIGN: SUB,
+	MUL_ASSIGN: MUL,
+	DIV_ASSIGN: DIV,
+	AND_ASSIGN: AND,
+	OR_ASSIGN:  OR,
+}
+
 func IsUnaryOperator(t Token) bool {
 	return t == NOT || t == SUB
 }
@@ -54,15 +85,17 @@ var tokenTypes = map[Token]Type{
 	THIS:          TypeKw,
 	IDENT:         TypeIdent,
 	STRING_CONST:  TypeStrConst,
+	CHAR_CONST:    TypeCharConst,
 	INTEGER_CONST: TypeIntConst,
 }
 
 type Type string
 
 const (
-	TypeKw       Type = "keyword"
-	TypeSymbol   Type = "symbol"
-	TypeIntConst Type = "integerConstant"
-	TypeStrConst Type = "stringConstant"
-	TypeIdent    Type = "identifier"
+	TypeKw        Type = "keyword"
+	TypeSymbol    Type = "symbol"
+	TypeIntConst  Type = "integerConstant"
+	TypeStrConst  Type = "stringConstant"
+	TypeCharConst Type = "charConstant"
+	TypeIdent     Type = "identifier"
 )
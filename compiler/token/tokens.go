@@ -4,6 +4,8 @@ const (
 	ILLEGAL Token = iota
 
 	EOF
+	COMMENT
+	WHITESPACE
 
 	// Keywords
 	keywords_start
@@ -26,6 +28,7 @@ const (
 	ELSE
 	WHILE
 	RETURN
+	FOR // dialect only
 	keywords_end
 
 	// Symbols
@@ -42,6 +45,13 @@ const (
 	RBRACK
 	SEMICOLON
 	COLON
+	// Compound assignments - dialect only
+	ADD_ASSIGN
+	SUB_ASSIGN
+	MUL_ASSIGN
+	DIV_ASSIGN
+	AND_ASSIGN
+	OR_ASSIGN
 	// Operators - Arithmetic
 	operators_start
 	ADD
@@ -67,12 +77,16 @@ const (
 	THIS
 	INTEGER_CONST
 	STRING_CONST
+	CHAR_CONST // dialect only
 	IDENT
 	literals_end
 )
 
 var tokens = [...]string{
-	EOF: "<eof>",
+	ILLEGAL:    "ILLEGAL",
+	EOF:        "<eof>",
+	COMMENT:    "COMMENT",
+	WHITESPACE: "WHITESPACE",
 
 	CLASS:       "class",
 	CONSTRUCTOR: "constructor",
@@ -92,6 +106,7 @@ var tokens = [...]string{
 	ELSE:   "else",
 	WHILE:  "while",
 	RETURN: "return",
+	FOR:    "for",
 
 	LPAREN:    "(",
 	LBRACE:    "{",
@@ -103,16 +118,24 @@ var tokens = [...]string{
 	RBRACK:    "]",
 	SEMICOLON: ";",
 	COLON:     ":",
-	ADD:       "+",
-	SUB:       "-",
-	MUL:       "*",
-	DIV:       "/",
-	AND:       "&",
-	OR:        "|",
-	NOT:       "~",
-	GT:        ">",
-	LT:        "<",
-	EQ:        "=",
+
+	ADD_ASSIGN: "+=",
+	SUB_ASSIGN: "-=",
+	MUL_ASSIGN: "*=",
+	DIV_ASSIGN: "/=",
+	AND_ASSIGN: "&=",
+	OR_ASSIGN:  "|=",
+
+	ADD: "+",
+	SUB: "-",
+	MUL: "*",
+	DIV: "/",
+	AND: "&",
+	OR:  "|",
+	NOT: "~",
+	GT:  ">",
+	LT:  "<",
+	EQ:  "=",
 
 	NULL:  "null",
 	THIS:  "this",
@@ -121,5 +144,6 @@ var tokens = [...]string{
 
 	INTEGER_CONST: "INT_LITERAL",
 	STRING_CONST:  "STRING_LITERAL",
+	CHAR_CONST:    "CHAR_LITERAL",
 	IDENT:         "IDENT",
 }
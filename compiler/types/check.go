@@ -0,0 +1,345 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/schattian/nand2tetris/compiler/ast"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/parse/symbol"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+type class struct {
+	decl *ast.ClassDecl
+	vars *symbol.Table
+	subs map[string]*ast.SubroutineDecl
+}
+
+var osClasses []*ast.ClassDecl
+
+func init() {
+	for _, src := range OSSource {
+		decl, err := ast.Parse([]byte(src), parser.Config{})
+		if err != nil {
+			panic(err)
+		}
+		osClasses = append(osClasses, decl)
+	}
+}
+
+type checker struct {
+	classes map[string]*class
+	errs    []*Error
+
+	class *class
+	sub   *ast.SubroutineDecl
+	local *symbol.Table
+}
+
+// Check type checks the classes of a program, which may use each other and the
+// os classes. Classes named like an os class replace it
+func Check(classes []*ast.ClassDecl) []*Error {
+	c := &checker{classes: make(map[string]*class)}
+	for _, decl := range osClasses {
+		c.declare(decl)
+	}
+	for _, decl := range classes {
+		c.declare(decl)
+	}
+	for _, decl := range classes {
+		c.checkClass(c.classes[decl.Name.Name])
+	}
+	return c.errs
+}
+
+func (c *checker) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.errs = append(c.errs, &Error{Class: c.class.decl.Name.Name, Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) declare(decl *ast.ClassDecl) {
+	cl := &class{decl: decl, vars: symbol.NewTable(), subs: make(map[string]*ast.SubroutineDecl)}
+	for _, v := range decl.Vars {
+		kind := symbol.KIND_STATIC
+		if v.Kind == token.FIELD {
+			kind = symbol.KIND_FIELD
+		}
+		addVars(cl.vars, v, kind)
+	}
+	for _, sub := range decl.Subroutines {
+		cl.subs[sub.Name.Name] = sub
+	}
+	c.classes[decl.Name.Name] = cl
+}
+
+func addVars(t *symbol.Table, v *ast.VarDecl, kind symbol.Kind) {
+	for _, name := range v.Names {
+		addVar(t, name.Name, kind, Named(v.Type.Name))
+	}
+}
+
+func addVar(t *symbol.Table, name string, kind symbol.Kind, typ Type) {
+	t.Add(name, kind, typ.Kind).ClassName = typ.Class
+}
+
+// checkType reports the declared types naming undefined classes
+func (c *checker) checkType(id *ast.Ident) {
+	if t := Named(id.Name); t.IsClass() && c.classes[t.Class] == nil {
+		c.errorf(id.Pos(), "undefined type %s", id.Name)
+	}
+}
+
+func (c *checker) checkClass(cl *class) {
+	c.class = cl
+	for _, v := range cl.decl.Vars {
+		c.checkType(v.Type)
+	}
+	for _, sub := range cl.decl.Subroutines {
+		c.checkSubroutine(sub)
+	}
+}
+
+func (c *checker) checkSubroutine(sub *ast.SubroutineDecl) {
+	c.sub, c.local = sub, symbol.NewTable()
+	c.checkType(sub.Return)
+	if sub.Kind == token.CONSTRUCTOR && sub.Return.Name != c.class.decl.Name.Name {
+		c.errorf(sub.Return.Pos(), "constructor must return %s", c.class.decl.Name.Name)
+	}
+	if sub.Kind == token.METHOD {
+		addVar(c.local, "this", symbol.KIND_ARG, Named(c.class.decl.Name.Name))
+	}
+	for _, param := range sub.Params {
+		c.checkType(param.Type)
+		addVar(c.local, param.Name.Name, symbol.KIND_ARG, Named(param.Type.Name))
+	}
+	for _, v := range sub.Body.Locals {
+		c.checkType(v.Type)
+		addVars(c.local, v, symbol.KIND_LOCAL)
+	}
+	c.checkStmts(sub.Body.Stmts)
+}
+
+func (c *checker) checkStmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		c.checkStmt(stmt)
+	}
+}
+
+func (c *checker) checkStmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.Block:
+		c.checkStmts(s.Stmts)
+	case *ast.LetStmt:
+		c.checkAssign(s.Assign)
+	case *ast.IfStmt:
+		c.checkCond(s.Cond)
+		c.checkStmts(s.Then.Stmts)
+		if s.Else != nil {
+			c.checkStmt(s.Else)
+		}
+	case *ast.WhileStmt:
+		c.checkCond(s.Cond)
+		c.checkStmts(s.Body.Stmts)
+	case *ast.ForStmt:
+		if s.Init != nil {
+			c.checkAssign(s.Init)
+		}
+		c.checkCond(s.Cond)
+		if s.Post != nil {
+			c.checkAssign(s.Post)
+		}
+		c.checkStmts(s.Body.Stmts)
+	case *ast.DoStmt:
+		c.checkCall(s.Call)
+	case *ast.ReturnStmt:
+		ret := Named(c.sub.Return.Name)
+		switch {
+		case s.Value == nil && ret != Void:
+			c.errorf(s.Return, "missing return value of type %s", ret)
+		case s.Value != nil && ret == Void:
+			c.errorf(s.Value.Pos(), "unexpected return value in void %s", c.sub.Name.Name)
+		case s.Value != nil:
+			c.checkAssignable(c.expr(s.Value), ret, s.Value, "return value")
+		}
+	}
+}
+
+func (c *checker) checkAssign(a *ast.Assign) {
+	t := c.varType(a.Name)
+	if a.Index != nil {
+		c.checkIndex(a.Name, t, a.Index)
+		t = Unknown
+	}
+	v := c.expr(a.Value)
+	if a.Op != token.EQ {
+		v = c.binary(t, token.CompoundOperator(a.Op), v, a.OpPos)
+	}
+	c.checkAssignable(v, t, a.Value, a.Name.Name)
+}
+
+func (c *checker) checkAssignable(t, u Type, x ast.Expr, what string) {
+	if !t.AssignableTo(u) {
+		c.errorf(x.Pos(), "cannot use %s as %s in %s", t, u, what)
+	}
+}
+
+func (c *checker) checkCond(x ast.Expr) {
+	if t := c.expr(x); t != Boolean && t != Unknown {
+		c.errorf(x.Pos(), "non-boolean condition of type %s", t)
+	}
+}
+
+func (c *checker) checkIndex(name *ast.Ident, t Type, index ast.Expr) {
+	if t != Array && t != Unknown {
+		c.errorf(name.Pos(), "cannot index %s of type %s", name.Name, t)
+	}
+	if i := c.expr(index); !i.IsNumeric() {
+		c.errorf(index.Pos(), "non-integer index of type %s", i)
+	}
+}
+
+// lookup returns the type of the given var, if declared
+func (c *checker) lookup(name *ast.Ident) (Type, bool) {
+	s := c.local.Get(name.Name)
+	if s == nil {
+		s = c.class.vars.Get(name.Name)
+		if s == nil {
+			return Unknown, false
+		}
+		if s.Kind == symbol.KIND_FIELD && c.sub.Kind == token.FUNCTION {
+			c.errorf(name.Pos(), "field %s used in function %s", name.Name, c.sub.Name.Name)
+		}
+	}
+	return Type{Kind: s.Type, Class: s.ClassName}, true
+}
+
+func (c *checker) varType(name *ast.Ident) Type {
+	t, ok := c.lookup(name)
+	if !ok {
+		c.errorf(name.Pos(), "undefined: %s", name.Name)
+	}
+	return t
+}
+
+func (c *checker) expr(x ast.Expr) Type {
+	switch x := x.(type) {
+	case *ast.IntLit:
+		return Int
+	case *ast.CharLit:
+		return Char
+	case *ast.StringLit:
+		return String
+	case *ast.KeywordLit:
+		switch x.Token {
+		case token.TRUE, token.FALSE:
+			return Boolean
+		case token.NULL:
+			return Null
+		}
+		if c.sub.Kind == token.FUNCTION {
+			c.errorf(x.Pos(), "this used in function %s", c.sub.Name.Name)
+		}
+		return Named(c.class.decl.Name.Name)
+	case *ast.Ident:
+		return c.varType(x)
+	case *ast.IndexExpr:
+		c.checkIndex(x.Name, c.varType(x.Name), x.Index)
+		return Unknown
+	case *ast.CallExpr:
+		return c.checkCall(x)
+	case *ast.ParenExpr:
+		return c.expr(x.X)
+	case *ast.UnaryExpr:
+		t := c.expr(x.X)
+		switch {
+		case x.Op == token.NOT && t == Boolean:
+			return Boolean
+		case !t.IsNumeric():
+			c.errorf(x.OpPos, "invalid operation: %s%s", x.Op, t)
+			return Unknown
+		}
+		return Int
+	case *ast.BinaryExpr:
+		return c.binary(c.expr(x.X), x.Op, c.expr(x.Y), x.OpPos)
+	}
+	return Unknown
+}
+
+func (c *checker) binary(t Type, op token.Token, u Type, pos token.Pos) Type {
+	switch op {
+	case token.EQ:
+		if !t.AssignableTo(u) && !u.AssignableTo(t) {
+			c.errorf(pos, "mismatched types %s and %s", t, u)
+		}
+		return Boolean
+	case token.AND, token.OR:
+		switch {
+		case t == Unknown && u == Unknown:
+			return Unknown
+		case t == Boolean && u.AssignableTo(t), u == Boolean && t.AssignableTo(u):
+			return Boolean
+		}
+	}
+	if !t.IsNumeric() || !u.IsNumeric() {
+		c.errorf(pos, "invalid operation: %s %s %s", t, op, u)
+		return Unknown
+	}
+	if op == token.LT || op == token.GT {
+		return Boolean
+	}
+	return Int
+}
+
+// checkCall checks the called subroutine exists and can be called this way
+// with the given arguments, returning its return type
+func (c *checker) checkCall(call *ast.CallExpr) Type {
+	cl, onObject := c.class, c.sub.Kind != token.FUNCTION
+	if call.Receiver != nil {
+		if t, isVar := c.lookup(call.Receiver); isVar {
+			if !t.IsClass() {
+				c.errorf(call.Receiver.Pos(), "cannot call %s on %s of type %s", call.Name.Name, call.Receiver.Name, t)
+				return c.args(call, "", nil)
+			}
+			// undefined types were reported with the declaration
+			cl, onObject = c.classes[t.Class], true
+		} else {
+			cl, onObject = c.classes[call.Receiver.Name], false
+			if cl == nil {
+				c.errorf(call.Receiver.Pos(), "undefined: %s", call.Receiver.Name)
+			}
+		}
+		if cl == nil {
+			return c.args(call, "", nil)
+		}
+	}
+
+	name := cl.decl.Name.Name + "." + call.Name.Name
+	sub := cl.subs[call.Name.Name]
+	switch {
+	case sub == nil:
+		c.errorf(call.Name.Pos(), "undefined subroutine %s", name)
+	case sub.Kind == token.METHOD && !onObject:
+		c.errorf(call.Name.Pos(), "method %s called without an object", name)
+	case sub.Kind != token.METHOD && call.Receiver != nil && onObject:
+		c.errorf(call.Name.Pos(), "%s %s called on an object", sub.Kind, name)
+	}
+	return c.args(call, name, sub)
+}
+
+// args checks the arguments of the call against the params of sub, if known
+func (c *checker) args(call *ast.CallExpr, name string, sub *ast.SubroutineDecl) Type {
+	var args []Type
+	for _, arg := range call.Args {
+		args = append(args, c.expr(arg))
+	}
+	if sub == nil {
+		return Unknown
+	}
+	if len(args) != len(sub.Params) {
+		c.errorf(call.Name.Pos(), "%s takes %d arguments, got %d", name, len(sub.Params), len(args))
+		return Named(sub.Return.Name)
+	}
+	for i, param := range sub.Params {
+		c.checkAssignable(args[i], Named(param.Type.Name), call.Args[i], fmt.Sprintf("argument %s of %s", param.Name.Name, name))
+	}
+	return Named(sub.Return.Name)
+}
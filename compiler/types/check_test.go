@@ -0,0 +1,149 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/ast"
+	"github.com/schattian/nand2tetris/compiler/parse/parser"
+	"github.com/schattian/nand2tetris/compiler/scanner"
+)
+
+const pointSrc = `class Point {
+    field int x, y;
+    constructor Point new(int ax, int ay) { let x = ax; let y = ay; return this; }
+    method int getX() { return x; }
+    method boolean equals(Point p) { return (x = p.getX()); }
+    function Point origin() { return Point.new(0, 0); }
+}`
+
+func check(t *testing.T, srcs ...string) []string {
+	t.Helper()
+	var classes []*ast.ClassDecl
+	for _, src := range srcs {
+		p := parser.NewBackend([]byte(src), scanner.ScanDialect, parser.DescentBackend)
+		tree := p.ParseTree()
+		if errs := p.Errors(); len(errs) > 0 {
+			t.Fatal(errs[0])
+		}
+		class, err := ast.FromTree(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		classes = append(classes, class)
+	}
+	var errs []string
+	for _, err := range Check(classes) {
+		errs = append(errs, err.Error())
+	}
+	return errs
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"ok", `var Point p; var Array a; var char c; var boolean b;
+            let p = Point.new(1, 2); let a = Array.new(3); let a[1] = p; let p = a[1];
+            let c = 'a' + 1; let b = p.equals(Point.origin()) & (c < 3);
+            if (b | ~b) { do Output.printInt(p.getX() * 2); }
+            for (c = 0; c < 10; c += 1) { do Memory.deAlloc(p); }
+            let p = null;`, nil},
+		{"assign", `var int i; var boolean b; var Point p;
+            let i = true; let b = 1; let p = 3; let i = "s"; let i += b;`, []string{
+			"Main:3:21: cannot use boolean as int in i",
+			"Main:3:35: cannot use int as boolean in b",
+			"Main:3:46: cannot use int as Point in p",
+			"Main:3:57: cannot use String as int in i",
+			"Main:3:68: invalid operation: int + boolean",
+		}},
+		{"arithmetic", `var boolean b; var int i; var Point p;
+            let i = b * 2; let i = -b; let i = p + 1; let b = p = 1; let i = i & b;`, []string{
+			"Main:3:23: invalid operation: boolean * int",
+			"Main:3:36: invalid operation: -boolean",
+			"Main:3:50: invalid operation: Point + int",
+			"Main:3:65: mismatched types Point and int",
+			"Main:3:80: invalid operation: int & boolean",
+		}},
+		{"conditions", `var int i;
+            if (i) { return; } else if (i < 1) { return; }
+            while (i + 1) { let i = 0; }
+            for (; 'a';) { return; }`, []string{
+			"Main:3:17: non-boolean condition of type int",
+			"Main:4:20: non-boolean condition of type int",
+			"Main:5:20: non-boolean condition of type char",
+		}},
+		{"calls", `var Point p; var int i;
+            do p.origin(); do Point.getX(); do p.nope(); do i.getX(); do Nope.f();
+            do Point.new(1); do Point.new(1, true); do Output.printString(3);`, []string{
+			"Main:3:18: function Point.origin called on an object",
+			"Main:3:37: method Point.getX called without an object",
+			"Main:3:50: undefined subroutine Point.nope",
+			"Main:3:61: cannot call getX on i of type int",
+			"Main:3:74: undefined: Nope",
+			"Main:4:22: Point.new takes 2 arguments, got 1",
+			"Main:4:46: cannot use boolean as int in argument ay of Point.new",
+			"Main:4:75: cannot use int as String in argument s of Output.printString",
+		}},
+		{"vars", `var Nope n; let x = 1; let i[0] = 1; do m(); return 1;`, []string{
+			"Main:2:24: undefined type Nope",
+			"Main:2:36: undefined: x",
+			"Main:2:47: undefined: i",
+			"Main:2:60: method Main.m called without an object",
+			"Main:2:72: unexpected return value in void f",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "class Main {\nfunction void f() {" + tt.body + "\n}\nmethod void m() { return; }\n}"
+			got := check(t, src, pointSrc)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck_Subroutines(t *testing.T) {
+	src := `class Main {
+    field int x;
+    constructor Point new() { return this; }
+    function int f() { let x = 1; return this; }
+    method int g() { do f(); return; }
+}`
+	want := []string{
+		"Main:3:17: constructor must return Main",
+		"Main:3:38: cannot use Main as Point in return value",
+		"Main:4:28: field x used in function f",
+		"Main:4:42: this used in function f",
+		"Main:4:42: cannot use Main as int in return value",
+		"Main:5:30: missing return value of type int",
+	}
+	if got := check(t, src, pointSrc); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %q, want %q", got, want)
+	}
+}
+
+func TestCheck_Projects(t *testing.T) {
+	for _, name := range []string{"Average", "ConvertToBin", "Pong", "Seven", "Square"} {
+		filenames, err := filepath.Glob(filepath.Join("../../projects/11", name, "*.jack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var srcs []string
+		for _, filename := range filenames {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srcs = append(srcs, string(src))
+		}
+		if errs := check(t, srcs...); len(errs) > 0 {
+			t.Errorf("%s: Check() = %q", name, errs)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package types implements the optional strict type checking of jack
+// programs, run over the typed syntax trees of all their classes.
+package types
+
+import (
+	"fmt"
+
+	"github.com/schattian/nand2tetris/compiler/parse/symbol"
+	"github.com/schattian/nand2tetris/compiler/token"
+)
+
+// Type is the type of a var or expression. Class is only set for
+// symbol.TYPE_CLASS_NAME
+type Type struct {
+	Kind  symbol.Type
+	Class string
+}
+
+var (
+	Int     = Type{Kind: symbol.TYPE_INT}
+	Char    = Type{Kind: symbol.TYPE_CHAR}
+	Boolean = Type{Kind: symbol.TYPE_BOOLEAN}
+	String  = Type{Kind: symbol.TYPE_CLASS_NAME, Class: "String"}
+	Array   = Type{Kind: symbol.TYPE_CLASS_NAME, Class: "Array"}
+
+	// Void, Null and Unknown are pseudo classes. Null converts to any class
+	// and Unknown, the type of array elements and of erroneous expressions,
+	// converts to and from every type
+	Void    = Type{Kind: symbol.TYPE_CLASS_NAME, Class: "void"}
+	Null    = Type{Kind: symbol.TYPE_CLASS_NAME, Class: "null"}
+	Unknown = Type{Kind: symbol.TYPE_CLASS_NAME, Class: "unknown"}
+)
+
+// Named returns the type declared with the given name
+func Named(name string) Type {
+	switch name {
+	case "int":
+		return Int
+	case "char":
+		return Char
+	case "boolean":
+		return Boolean
+	case "void":
+		return Void
+	}
+	return Type{Kind: symbol.TYPE_CLASS_NAME, Class: name}
+}
+
+func (t Type) String() string {
+	switch t.Kind {
+	case symbol.TYPE_INT:
+		return "int"
+	case symbol.TYPE_CHAR:
+		return "char"
+	case symbol.TYPE_BOOLEAN:
+		return "boolean"
+	}
+	return t.Class
+}
+
+// IsClass tells whether t is a class other than the pseudo ones
+func (t Type) IsClass() bool {
+	return t.Kind == symbol.TYPE_CLASS_NAME && t != Void && t != Null && t != Unknown
+}
+
+// IsNumeric tells whether arithmetic applies to t
+func (t Type) IsNumeric() bool {
+	return t == Int || t == Char || t == Unknown
+}
+
+// AssignableTo tells whether a value of type t can be assigned to a var of
+// type u. Ints and chars convert to each other, and objects to arrays as
+// done by Memory.deAlloc
+func (t Type) AssignableTo(u Type) bool {
+	switch {
+	case t == u, t == Unknown, u == Unknown:
+		return true
+	case t == Null:
+		return u.IsClass()
+	case u == Array:
+		return t.IsClass()
+	}
+	return t.IsNumeric() && u.IsNumeric()
+}
+
+// Error is a type error found in the given class
+type Error struct {
+	Class string
+	Pos   token.Pos
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%s: %s", e.Class, e.Pos, e.Msg)
+}
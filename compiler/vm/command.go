@@ -1,10 +1,13 @@
 package vm
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
-type command struct {
-	op  operation
-	seg memSegment
+type Command struct {
+	op  Operation
+	seg Segment
 
 	arg uint16
 
@@ -13,18 +16,42 @@ type command struct {
 
 	label  string
 	fnName string
+
+	module string
+	fnCtx  string
+	// line is the source line of the parsed commands
+	line int
+}
+
+func (c *Command) Module() string {
+	return c.module
+}
+
+func (c *Command) Line() int {
+	return c.line
+}
+
+func (c *Command) Op() Operation {
+	return c.op
+}
+
+// Function returns the function declared by function commands and the one
+// called by call commands
+func (c *Command) Function() string {
+	return c.fnName
 }
 
-func (c *command) String() (s string) {
+func (c *Command) String() (s string) {
 	switch c.op {
 	case OpPush, OpPop:
 		s += fmt.Sprintf("%s %s %d", c.op, c.seg, c.arg)
-	case OpAdd, OpSub, OpNeg, OpEq, OpGt, OpLt, OpAnd, OpOr, OpNot:
+	case OpAdd, OpSub, OpNeg, OpEq, OpGt, OpLt, OpAnd, OpOr, OpNot,
+		OpMul, OpDiv, OpMod, OpShl, OpShr, OpDup, OpSwap:
 		s += string(c.op)
 	case OpLabel, OpGoto, OpIfGoto:
 		s += fmt.Sprintf("%s %s", c.op, c.label)
 	case OpCall:
-		s += fmt.Sprintf("%s %s", c.op, c.fnName)
+		s += fmt.Sprintf("%s %s %d", c.op, c.fnName, c.argSz)
 	case OpFunction:
 		s += fmt.Sprintf("%s %s %d", c.op, c.fnName, c.localSz)
 	case OpReturn:
@@ -34,26 +61,54 @@ func (c *command) String() (s string) {
 	return
 }
 
-func NewAccessCommand(op operation, seg memSegment, index uint16) *command {
-	return &command{seg: seg, arg: index, op: op}
+func NewAccessCommand(op Operation, seg Segment, index uint16) *Command {
+	return &Command{seg: seg, arg: index, op: op}
 }
 
-func NewArithmeticCommand(op operation) *command {
-	return &command{op: op}
+func NewArithmeticCommand(op Operation) *Command {
+	return &Command{op: op}
 }
 
-func NewFlowControlCommand(op operation, label string) *command {
-	return &command{op: op, label: label}
+func NewFlowControlCommand(op Operation, label string) *Command {
+	return &Command{op: op, label: label}
 }
 
-func NewCallCommand(fnName string, argSz uint16) *command {
-	return &command{op: OpCall, argSz: argSz, fnName: fnName}
+func NewCallCommand(fnName string, argSz uint16) *Command {
+	return &Command{op: OpCall, argSz: argSz, fnName: fnName}
 }
 
-func NewFunctionCommand(name string, localSz uint16) *command {
-	return &command{fnName: name, localSz: localSz}
+func NewFunctionCommand(name string, localSz uint16) *Command {
+	return &Command{op: OpFunction, fnName: name, localSz: localSz}
 }
 
-func NewReturnCommand() *command {
-	return &command{op: OpReturn}
+func NewReturnCommand() *Command {
+	return &Command{op: OpReturn}
+}
+
+// SetModule sets the module whose static segment the commands access
+func SetModule(cmds []*Command, module string) {
+	for _, cmd := range cmds {
+		cmd.module = module
+	}
+}
+
+// CallCounts counts the call commands to every function
+func CallCounts(cmds []*Command) map[string]int {
+	counts := make(map[string]int)
+	for _, cmd := range cmds {
+		if cmd.op == OpCall {
+			counts[cmd.fnName]++
+		}
+	}
+	return counts
+}
+
+func Write(w io.Writer, cmds []*Command) error {
+	for _, cmd := range cmds {
+		_, err := io.WriteString(w, cmd.String())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -1,36 +1,70 @@
 package vm
 
-type operation string
+type Operation string
 
 const (
-	OpPush     operation = "push"
-	OpPop      operation = "pop"
-	OpAdd      operation = "add"
-	OpSub      operation = "sub"
-	OpNeg      operation = "neg"
-	OpEq       operation = "eq"
-	OpGt       operation = "gt"
-	OpLt       operation = "lt"
-	OpAnd      operation = "and"
-	OpOr       operation = "or"
-	OpNot      operation = "not"
-	OpFunction operation = "function"
-	OpCall     operation = "call"
-	OpReturn   operation = "return"
-	OpLabel    operation = "label"
-	OpGoto     operation = "goto"
-	OpIfGoto   operation = "if-goto"
+	OpPush     Operation = "push"
+	OpPop      Operation = "pop"
+	OpAdd      Operation = "add"
+	OpSub      Operation = "sub"
+	OpNeg      Operation = "neg"
+	OpEq       Operation = "eq"
+	OpGt       Operation = "gt"
+	OpLt       Operation = "lt"
+	OpAnd      Operation = "and"
+	OpOr       Operation = "or"
+	OpNot      Operation = "not"
+	OpFunction Operation = "function"
+	OpCall     Operation = "call"
+	OpReturn   Operation = "return"
+	OpLabel    Operation = "label"
+	OpGoto     Operation = "goto"
+	OpIfGoto   Operation = "if-goto"
+
+	// extended operations, out of the standard vm
+	OpMul  Operation = "mul"
+	OpDiv  Operation = "div"
+	OpMod  Operation = "mod"
+	OpShl  Operation = "shl"
+	OpShr  Operation = "shr"
+	OpDup  Operation = "dup"
+	OpSwap Operation = "swap"
 )
 
-type memSegment string
+type Segment string
 
 const (
-	SegLcl     memSegment = "local"
-	SegArg     memSegment = "argument"
-	SegPointer memSegment = "pointer"
-	SegStatic  memSegment = "static"
-	SegTemp    memSegment = "temp"
-	SegConst   memSegment = "constant"
-	SegThis    memSegment = "this"
-	SegThat    memSegment = "that"
+	SegLcl     Segment = "local"
+	SegArg     Segment = "argument"
+	SegPointer Segment = "pointer"
+	SegStatic  Segment = "static"
+	SegTemp    Segment = "temp"
+	SegConst   Segment = "constant"
+	SegThis    Segment = "this"
+	SegThat    Segment = "that"
+	// SegIndirect accesses the address popped from the stack, out of the
+	// standard vm
+	SegIndirect Segment = "indirect"
 )
+
+// segmentSizes holds the amount of addressable indexes of every segment, 0 meaning unbounded
+var segmentSizes = map[Segment]uint16{
+	SegLcl:      0,
+	SegArg:      0,
+	SegThis:     0,
+	SegThat:     0,
+	SegIndirect: 0,
+	SegStatic:   240,
+	SegTemp:     8,
+	SegPointer:  2,
+	SegConst:    32768,
+}
+
+// IsExtended reports whether the operation is out of the standard vm
+func (op Operation) IsExtended() bool {
+	switch op {
+	case OpMul, OpDiv, OpMod, OpShl, OpShr, OpDup, OpSwap:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,370 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+var ErrHalted = errors.New("program ended")
+
+const (
+	regSP = iota
+	regLCL
+	regARG
+	regTHIS
+	regTHAT
+
+	tempBase    = 5
+	staticsBase = 16
+	staticsEnd  = 256
+	stackBase   = 256
+
+	initFunc = "Sys.init"
+)
+
+// Machine emulates the vm over the hack memory, laying out frames the same way
+// the translated assembly does
+type Machine struct {
+	RAM      hack.Memory
+	Keyboard *hack.KeyScript
+	Steps    uint64
+
+	pc        int
+	depth     int
+	program   []*Command
+	functions map[string]int
+	labels    map[string]int
+	statics   map[string]int16
+}
+
+func NewMachine(program []*Command) (*Machine, error) {
+	m := &Machine{
+		program:   program,
+		functions: make(map[string]int),
+		labels:    make(map[string]int),
+		statics:   make(map[string]int16),
+	}
+	err := m.load()
+	return m, err
+}
+
+func (m *Machine) load() error {
+	var fn string
+	for i, cmd := range m.program {
+		cmd.fnCtx = fn
+		switch cmd.op {
+		case OpFunction:
+			if _, ok := m.functions[cmd.fnName]; ok {
+				return fmt.Errorf("duplicated function: %s", cmd.fnName)
+			}
+			fn = cmd.fnName
+			cmd.fnCtx = fn
+			m.functions[fn] = i
+		case OpLabel:
+			m.labels[absLabelName(fn, cmd.label)] = i
+		case OpPush, OpPop:
+			if cmd.seg != SegStatic {
+				continue
+			}
+			name := staticName(cmd.module, cmd.arg)
+			if _, ok := m.statics[name]; ok {
+				continue
+			}
+			addr := staticsBase + len(m.statics)
+			if addr >= staticsEnd {
+				return fmt.Errorf("static segment overflow at %s", name)
+			}
+			m.statics[name] = int16(addr)
+		}
+	}
+
+	for _, cmd := range m.program {
+		switch cmd.op {
+		case OpCall:
+			if _, ok := m.functions[cmd.fnName]; !ok {
+				return fmt.Errorf("%s: undefined function: %s", cmd.fnCtx, cmd.fnName)
+			}
+		case OpGoto, OpIfGoto:
+			if _, ok := m.labels[absLabelName(cmd.fnCtx, cmd.label)]; !ok {
+				return fmt.Errorf("%s: undefined label: %s", cmd.fnCtx, cmd.label)
+			}
+		}
+	}
+	return nil
+}
+
+// Boot sets the stack up and calls Sys.init, as the translator bootstrap code does
+func (m *Machine) Boot() error {
+	if _, ok := m.functions[initFunc]; !ok {
+		return fmt.Errorf("undefined function: %s", initFunc)
+	}
+	m.RAM[regSP] = stackBase
+	m.call(initFunc, 0, len(m.program))
+	return nil
+}
+
+func (m *Machine) PC() int {
+	return m.pc
+}
+
+// Depth returns the amount of calls that didn't return yet
+func (m *Machine) Depth() int {
+	return m.depth
+}
+
+func (m *Machine) Program() []*Command {
+	return m.program
+}
+
+// FunctionAt returns the name of the function holding the given command
+func (m *Machine) FunctionAt(pc int) string {
+	if pc < 0 || pc >= len(m.program) {
+		return ""
+	}
+	return m.program[pc].fnCtx
+}
+
+// StaticAddr returns the address of the given static var, which is only
+// allocated when the program accesses it
+func (m *Machine) StaticAddr(module string, i uint16) (uint16, bool) {
+	addr, ok := m.statics[staticName(module, i)]
+	return uint16(addr), ok
+}
+
+type Frame struct {
+	Function string
+	// PC is the command that runs next within the frame
+	PC                   int
+	LCL, ARG, THIS, THAT int16
+	// Args and Locals are the number of arguments and locals of the function
+	Args, Locals int
+}
+
+// Frames walks the call stack starting from the innermost frame
+func (m *Machine) Frames() []Frame {
+	frames := []Frame{{
+		Function: m.FunctionAt(m.pc),
+		PC:       m.pc,
+		LCL:      m.RAM[regLCL],
+		ARG:      m.RAM[regARG],
+		THIS:     m.RAM[regTHIS],
+		THAT:     m.RAM[regTHAT],
+	}}
+	lcl := m.RAM[regLCL]
+	for d := m.depth; d > 0; d-- {
+		retAddr := int(m.RAM[mask(lcl-5)])
+		if retAddr <= 0 || retAddr >= len(m.program) {
+			break
+		}
+		frames[len(frames)-1].Args = int(m.program[retAddr-1].argSz)
+		caller := Frame{
+			Function: m.FunctionAt(retAddr - 1),
+			PC:       retAddr,
+			LCL:      m.RAM[mask(lcl-4)],
+			ARG:      m.RAM[mask(lcl-3)],
+			THIS:     m.RAM[mask(lcl-2)],
+			THAT:     m.RAM[mask(lcl-1)],
+		}
+		frames = append(frames, caller)
+		lcl = caller.LCL
+	}
+	for i, f := range frames {
+		if pc, ok := m.functions[f.Function]; ok {
+			frames[i].Locals = int(m.program[pc].localSz)
+		}
+	}
+	return frames
+}
+
+func (m *Machine) Halted() bool {
+	return m.pc < 0 || m.pc >= len(m.program)
+}
+
+func (m *Machine) Run(steps uint64) error {
+	for i := uint64(0); i < steps; i++ {
+		err := m.Step()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Machine) Step() error {
+	if m.Halted() {
+		return ErrHalted
+	}
+	if m.Keyboard != nil {
+		m.Keyboard.Update(m.Steps, &m.RAM)
+	}
+	cmd := m.program[m.pc]
+	m.pc += 1
+	m.Steps += 1
+
+	switch cmd.op {
+	case OpPush:
+		switch cmd.seg {
+		case SegConst:
+			m.push(int16(cmd.arg))
+		case SegIndirect:
+			addr := m.pop() + int16(cmd.arg)
+			m.push(m.RAM[mask(addr)])
+		default:
+			m.push(m.RAM[m.addr(cmd)])
+		}
+	case OpPop:
+		switch cmd.seg {
+		case SegConst:
+			return fmt.Errorf("%s: cannot pop into %s", cmd.fnCtx, cmd.seg)
+		case SegIndirect:
+			v := m.pop()
+			addr := m.pop() + int16(cmd.arg)
+			m.RAM[mask(addr)] = v
+		default:
+			addr := m.addr(cmd)
+			m.RAM[addr] = m.pop()
+		}
+	case OpNeg:
+		m.push(-m.pop())
+	case OpNot:
+		m.push(^m.pop())
+	case OpAdd, OpSub, OpEq, OpGt, OpLt, OpAnd, OpOr, OpMul, OpDiv, OpMod, OpShl, OpShr:
+		y, x := m.pop(), m.pop()
+		if y == 0 && (cmd.op == OpDiv || cmd.op == OpMod) {
+			return fmt.Errorf("%s: division by zero", cmd.fnCtx)
+		}
+		m.push(binaryOp(cmd.op, x, y))
+	case OpDup:
+		v := m.pop()
+		m.push(v)
+		m.push(v)
+	case OpSwap:
+		y, x := m.pop(), m.pop()
+		m.push(y)
+		m.push(x)
+	case OpFunction:
+		for i := uint16(0); i < cmd.localSz; i++ {
+			m.push(0)
+		}
+	case OpGoto:
+		m.pc = m.labels[absLabelName(cmd.fnCtx, cmd.label)]
+	case OpIfGoto:
+		if m.pop() != 0 {
+			m.pc = m.labels[absLabelName(cmd.fnCtx, cmd.label)]
+		}
+	case OpCall:
+		m.call(cmd.fnName, cmd.argSz, m.pc)
+	case OpReturn:
+		m.ret()
+	}
+	return nil
+}
+
+func (m *Machine) call(fnName string, argSz uint16, retAddr int) {
+	m.push(int16(retAddr))
+	for _, reg := range [4]int{regLCL, regARG, regTHIS, regTHAT} {
+		m.push(m.RAM[reg])
+	}
+	m.RAM[regARG] = m.RAM[regSP] - 5 - int16(argSz)
+	m.RAM[regLCL] = m.RAM[regSP]
+	m.pc = m.functions[fnName]
+	m.depth += 1
+}
+
+func (m *Machine) ret() {
+	frame := m.RAM[regLCL]
+	retAddr := m.RAM[mask(frame-5)]
+	m.RAM[mask(m.RAM[regARG])] = m.pop()
+	m.RAM[regSP] = m.RAM[regARG] + 1
+	for i, reg := range [4]int{regTHAT, regTHIS, regARG, regLCL} {
+		m.RAM[reg] = m.RAM[mask(frame-int16(i)-1)]
+	}
+	m.pc = int(retAddr)
+	m.depth -= 1
+}
+
+func (m *Machine) push(v int16) {
+	m.RAM[mask(m.RAM[regSP])] = v
+	m.RAM[regSP] += 1
+}
+
+func (m *Machine) pop() int16 {
+	m.RAM[regSP] -= 1
+	return m.RAM[mask(m.RAM[regSP])]
+}
+
+func (m *Machine) addr(cmd *Command) uint16 {
+	i := int16(cmd.arg)
+	var addr int16
+	switch cmd.seg {
+	case SegLcl:
+		addr = m.RAM[regLCL] + i
+	case SegArg:
+		addr = m.RAM[regARG] + i
+	case SegThis:
+		addr = m.RAM[regTHIS] + i
+	case SegThat:
+		addr = m.RAM[regTHAT] + i
+	case SegPointer:
+		addr = regTHIS + i
+	case SegTemp:
+		addr = tempBase + i
+	case SegStatic:
+		addr = m.statics[staticName(cmd.module, cmd.arg)]
+	}
+	return mask(addr)
+}
+
+func mask(addr int16) uint16 {
+	return uint16(addr) & (hack.MemSize - 1)
+}
+
+func binaryOp(op Operation, x, y int16) int16 {
+	switch op {
+	case OpAdd:
+		return x + y
+	case OpSub:
+		return x - y
+	case OpAnd:
+		return x & y
+	case OpOr:
+		return x | y
+	case OpEq:
+		return boolToInt(x == y)
+	case OpGt:
+		return boolToInt(x > y)
+	case OpLt:
+		return boolToInt(x < y)
+	case OpMul:
+		return x * y
+	case OpDiv:
+		return x / y
+	case OpMod:
+		return x % y
+	case OpShl:
+		return x << uint16(y)
+	case OpShr:
+		return x >> uint16(y)
+	}
+	return 0
+}
+
+func boolToInt(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+func absLabelName(fn, label string) string {
+	if fn != "" {
+		return fmt.Sprintf("%s$%s", fn, label)
+	}
+	return label
+}
+
+func staticName(module string, i uint16) string {
+	return fmt.Sprintf("%s.%d", module, i)
+}
@@ -0,0 +1,160 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+func TestMachine_Boot(t *testing.T) {
+	tests := []struct {
+		dir   string
+		steps uint64
+		ram   map[int]int16
+	}{
+		{
+			dir:   "FibonacciElement",
+			steps: 6000,
+			ram:   map[int]int16{0: 262, 261: 3},
+		},
+		{
+			dir:   "StaticsTest",
+			steps: 2500,
+			ram:   map[int]int16{0: 263, 261: -2, 262: 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			program, err := ParseDir("../../projects/08/FunctionCalls/" + tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := NewMachine(program)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = m.Boot(); err != nil {
+				t.Fatal(err)
+			}
+			if err = m.Run(tt.steps); err != nil {
+				t.Fatal(err)
+			}
+			for addr, want := range tt.ram {
+				if got := m.RAM[addr]; got != want {
+					t.Errorf("RAM[%d] = %d, want %d", addr, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMachine_Keyboard(t *testing.T) {
+	program, err := Parse("Main", strings.NewReader(`
+		function Main.main 0
+		push constant 24576
+		pop pointer 1
+		label LOOP
+		push that 0
+		push constant 0
+		eq
+		if-goto LOOP
+		push that 0
+		pop static 0
+		label END
+		goto END
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMachine(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RAM[regSP] = stackBase
+	m.Keyboard = &hack.KeyScript{Events: []hack.KeyEvent{{Cycle: 50, Key: hack.KeyUp}}}
+
+	if err = m.Run(49); err != nil {
+		t.Fatal(err)
+	}
+	if m.RAM[staticsBase] != 0 {
+		t.Fatalf("key read before being pressed: %d", m.RAM[staticsBase])
+	}
+	if err = m.Run(20); err != nil {
+		t.Fatal(err)
+	}
+	if m.RAM[staticsBase] != hack.KeyUp {
+		t.Errorf("static 0 = %d, want %d", m.RAM[staticsBase], hack.KeyUp)
+	}
+}
+
+const extendedSrc = `
+	function Main.main 0
+	push constant 7
+	push constant 6
+	neg
+	mul
+	push constant 7
+	neg
+	push constant 2
+	div
+	push constant 7
+	neg
+	push constant 2
+	mod
+	push constant 1
+	push constant 15
+	shl
+	push constant 32767
+	not
+	push constant 3
+	shr
+	push constant 1
+	push constant 2
+	swap
+	dup
+	push constant 300
+	push constant 5
+	pop indirect 0
+	push constant 299
+	push indirect 1
+	label END
+	goto END
+`
+
+func TestMachine_Extended(t *testing.T) {
+	program, err := Parse("Main", strings.NewReader(extendedSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMachine(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RAM[regSP] = stackBase
+	if err = m.Run(uint64(len(program))); err != nil {
+		t.Fatal(err)
+	}
+	want := []int16{-42, -3, -1, -32768, -4096, 2, 1, 1, 5}
+	if sp := int(m.RAM[regSP]); sp != stackBase+len(want) {
+		t.Fatalf("SP = %d, want %d", sp, stackBase+len(want))
+	}
+	for i, v := range want {
+		if got := m.RAM[stackBase+i]; got != v {
+			t.Errorf("RAM[%d] = %d, want %d", stackBase+i, got, v)
+		}
+	}
+
+	program, err = Parse("Main", strings.NewReader("push constant 1\npush constant 0\ndiv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewMachine(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RAM[regSP] = stackBase
+	if err = m.Run(3); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("Run() = %v, want division by zero", err)
+	}
+}
@@ -0,0 +1,148 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func Parse(module string, r io.Reader) ([]*Command, error) {
+	var cmds []*Command
+	s := bufio.NewScanner(r)
+	for ln := 1; s.Scan(); ln++ {
+		fields := strings.Fields(strings.Split(s.Text(), "//")[0])
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, err := parseCommand(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", module, ln, err)
+		}
+		cmd.module = module
+		cmd.line = ln
+		cmds = append(cmds, cmd)
+	}
+	return cmds, s.Err()
+}
+
+func ParseFile(filename string) ([]*Command, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(moduleName(filename), f)
+}
+
+// ParseDir parses every .vm file of the given dirs, sorted by name within each dir
+func ParseDir(dirnames ...string) ([]*Command, error) {
+	var cmds []*Command
+	for _, dirname := range dirnames {
+		filenames, err := filepath.Glob(filepath.Join(dirname, "*.vm"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(filenames)
+		for _, filename := range filenames {
+			fileCmds, err := ParseFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, fileCmds...)
+		}
+	}
+	return cmds, nil
+}
+
+func moduleName(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func parseCommand(fields []string) (*Command, error) {
+	op := Operation(fields[0])
+	args := fields[1:]
+	switch op {
+	case OpAdd, OpSub, OpNeg, OpEq, OpGt, OpLt, OpAnd, OpOr, OpNot, OpReturn,
+		OpMul, OpDiv, OpMod, OpShl, OpShr, OpDup, OpSwap:
+		if err := checkArity(op, args, 0); err != nil {
+			return nil, err
+		}
+		if op == OpReturn {
+			return NewReturnCommand(), nil
+		}
+		return NewArithmeticCommand(op), nil
+	case OpLabel, OpGoto, OpIfGoto:
+		if err := checkArity(op, args, 1); err != nil {
+			return nil, err
+		}
+		return NewFlowControlCommand(op, args[0]), nil
+	case OpFunction, OpCall:
+		if err := checkArity(op, args, 2); err != nil {
+			return nil, err
+		}
+		n, err := parseUint16(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if op == OpCall {
+			return NewCallCommand(args[0], n), nil
+		}
+		return NewFunctionCommand(args[0], n), nil
+	case OpPush, OpPop:
+		if err := checkArity(op, args, 2); err != nil {
+			return nil, err
+		}
+		seg := Segment(args[0])
+		if _, ok := segmentSizes[seg]; !ok {
+			return nil, fmt.Errorf("unknown segment: %s", seg)
+		}
+		i, err := parseUint16(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if sz := segmentSizes[seg]; sz != 0 && i >= sz {
+			return nil, fmt.Errorf("%s index out of range: %d", seg, i)
+		}
+		if op == OpPop && seg == SegConst {
+			return nil, fmt.Errorf("cannot pop into %s", seg)
+		}
+		return NewAccessCommand(op, seg, i), nil
+	}
+	return nil, fmt.Errorf("unknown operation: %s", op)
+}
+
+func checkArity(op Operation, args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%s takes %d args, got %d", op, n, len(args))
+	}
+	return nil
+}
+
+func parseUint16(arg string) (uint16, error) {
+	i, err := strconv.ParseUint(arg, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", arg)
+	}
+	return uint16(i), nil
+}
+
+// AddLibrary appends the lib modules that are not already defined by the program,
+// the way the OS classes are only used when not implemented by the program itself
+func AddLibrary(program, lib []*Command) []*Command {
+	defined := make(map[string]bool)
+	for _, cmd := range program {
+		defined[cmd.module] = true
+	}
+	for _, cmd := range lib {
+		if !defined[cmd.module] {
+			program = append(program, cmd)
+		}
+	}
+	return program
+}
@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+// Hash returns the hash identifying the program in snapshots. Every command
+// is written on its own line, after its quoted module
+func Hash(program []*Command) string {
+	h := sha256.New()
+	for _, cmd := range program {
+		fmt.Fprintf(h, "%q %s\n", cmd.module, strings.TrimSuffix(cmd.String(), "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *Machine) Snapshot() *hack.Snapshot {
+	return &hack.Snapshot{
+		Machine: "vm",
+		Program: Hash(m.program),
+		RAM:     m.RAM,
+		PC:      m.pc,
+		Cycles:  m.Steps,
+		Depth:   m.depth,
+		Keys:    m.Keyboard.Pending(),
+	}
+}
+
+// Restore sets the state of the machine to the snapshot, which must be taken
+// from a machine running the same program
+func (m *Machine) Restore(s *hack.Snapshot) error {
+	if err := s.Check("vm", Hash(m.program)); err != nil {
+		return err
+	}
+	m.RAM, m.pc, m.Steps, m.depth = s.RAM, s.PC, s.Cycles, s.Depth
+	m.Keyboard = s.Keyboard()
+	return nil
+}
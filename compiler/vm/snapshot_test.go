@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+func TestMachine_Snapshot(t *testing.T) {
+	program, err := ParseDir("../../projects/08/FunctionCalls/FibonacciElement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMachine(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Run(100); err != nil {
+		t.Fatal(err)
+	}
+	snap := m.Snapshot()
+	if snap.Depth == 0 {
+		t.Fatal("snapshot taken out of any call")
+	}
+
+	restored, err := NewMachine(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Run(5900); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.RAM[261]; got != 3 || restored.Steps != 6000 {
+		t.Errorf("RAM[261] = %d after %d steps, want 3 after 6000", got, restored.Steps)
+	}
+	if err = hack.NewCPU(nil).Restore(snap); err == nil {
+		t.Error("restored a vm snapshot into a cpu")
+	}
+}
+
+func TestHash(t *testing.T) {
+	parse := func(sources ...string) (program []*Command) {
+		for i := 0; i < len(sources); i += 2 {
+			cmds, err := Parse(sources[i], strings.NewReader(sources[i+1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			program = append(program, cmds...)
+		}
+		return
+	}
+	base := Hash(parse("A", "push constant 1\nadd"))
+	if Hash(parse("A", "push constant 1\nadd")) != base {
+		t.Error("same program hashed differently")
+	}
+	for _, sources := range [][]string{
+		{"A", "push constant 1\nadd\nadd"},
+		{"A", "push constant 1", "B", "add"},
+		{"B", "push constant 1\nadd"},
+		{"A", "push constant 1\nsub"},
+	} {
+		if Hash(parse(sources...)) == base {
+			t.Errorf("program %q hashed as the base one", sources)
+		}
+	}
+}
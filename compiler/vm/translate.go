@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+const (
+	// endLabel holds the infinite loop run when Sys.init returns
+	endLabel = "$end"
+	// the routines shared by the call, return and comparison commands are
+	// jumped to with their return address in D, keeping the program small
+	// enough to fit the rom along with the os
+	callRoutine   = "$call"
+	returnRoutine = "$return"
+)
+
+// translator writes the hack assembly of the standard vm commands, counting
+// the instructions written to know the rom address of every command
+type translator struct {
+	w     *bufio.Writer
+	rom   int
+	fn    string
+	count int
+}
+
+// Translate writes the hack assembly of the program, booting it the way the
+// machine does, and returns the rom address of every command followed by the
+// size of the rom. The extended operations are not supported
+func Translate(w io.Writer, program []*Command) ([]int, error) {
+	t := &translator{w: bufio.NewWriter(w)}
+	t.emit("@256", "D=A", "@SP", "M=D")
+	t.call(initFunc, 0)
+	t.label(endLabel)
+	t.emit("@"+endLabel, "0;JMP")
+	t.routines()
+
+	addrs := make([]int, len(program), len(program)+1)
+	for i, cmd := range program {
+		addrs[i] = t.rom
+		fmt.Fprintf(t.w, "// %s", cmd)
+		if err := t.command(cmd); err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.TrimSuffix(cmd.String(), "\n"), err)
+		}
+	}
+	// a-instructions address 15 bits of rom too
+	if t.rom > hack.MemSize {
+		return nil, fmt.Errorf("%d instructions don't fit the rom", t.rom)
+	}
+	return append(addrs, t.rom), t.w.Flush()
+}
+
+func (t *translator) emit(insts ...string) {
+	for _, inst := range insts {
+		t.w.WriteString(inst + "\n")
+		t.rom++
+	}
+}
+
+func (t *translator) label(name string) {
+	fmt.Fprintf(t.w, "(%s)\n", name)
+}
+
+// push pushes D
+func (t *translator) push() {
+	t.emit("@SP", "AM=M+1", "A=A-1", "M=D")
+}
+
+// pop pops into D, leaving A on the popped word
+func (t *translator) pop() {
+	t.emit("@SP", "AM=M-1", "D=M")
+}
+
+func (t *translator) command(cmd *Command) error {
+	switch cmd.op {
+	case OpPush:
+		return t.access(cmd, true)
+	case OpPop:
+		return t.access(cmd, false)
+	case OpAdd:
+		t.pop()
+		t.emit("A=A-1", "M=D+M")
+	case OpSub:
+		t.pop()
+		t.emit("A=A-1", "M=M-D")
+	case OpAnd:
+		t.pop()
+		t.emit("A=A-1", "M=D&M")
+	case OpOr:
+		t.pop()
+		t.emit("A=A-1", "M=D|M")
+	case OpNeg:
+		t.emit("@SP", "A=M-1", "M=-M")
+	case OpNot:
+		t.emit("@SP", "A=M-1", "M=!M")
+	case OpEq, OpGt, OpLt:
+		t.jump("$" + string(cmd.op))
+	case OpLabel:
+		t.label(absLabelName(t.fn, cmd.label))
+	case OpGoto:
+		t.emit("@"+absLabelName(t.fn, cmd.label), "0;JMP")
+	case OpIfGoto:
+		t.pop()
+		t.emit("@"+absLabelName(t.fn, cmd.label), "D;JNE")
+	case OpFunction:
+		t.fn = cmd.fnName
+		t.label(cmd.fnName)
+		for i := uint16(0); i < cmd.localSz; i++ {
+			t.emit("@SP", "AM=M+1", "A=A-1", "M=0")
+		}
+	case OpCall:
+		t.call(cmd.fnName, cmd.argSz)
+	case OpReturn:
+		t.emit("@"+returnRoutine, "0;JMP")
+	default:
+		return fmt.Errorf("unsupported operation: %s", cmd.op)
+	}
+	return nil
+}
+
+// unique returns a label not used by any other command
+func (t *translator) unique(kind string) string {
+	t.count++
+	return fmt.Sprintf("$%s.%d", kind, t.count)
+}
+
+// access pushes or pops the segment word of the command
+func (t *translator) access(cmd *Command, push bool) error {
+	i := int(cmd.arg)
+	var base string
+	switch cmd.seg {
+	case SegConst:
+		if !push {
+			return fmt.Errorf("cannot pop into %s", cmd.seg)
+		}
+		t.emit(fmt.Sprintf("@%d", i), "D=A")
+		t.push()
+		return nil
+	case SegLcl:
+		base = "LCL"
+	case SegArg:
+		base = "ARG"
+	case SegThis:
+		base = "THIS"
+	case SegThat:
+		base = "THAT"
+	case SegPointer, SegTemp, SegStatic:
+		addr := fmt.Sprintf("@R%d", regTHIS+i)
+		if cmd.seg == SegTemp {
+			addr = fmt.Sprintf("@R%d", tempBase+i)
+		} else if cmd.seg == SegStatic {
+			addr = "@" + staticName(cmd.module, cmd.arg)
+		}
+		if push {
+			t.emit(addr, "D=M")
+			t.push()
+		} else {
+			t.pop()
+			t.emit(addr, "M=D")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported segment: %s", cmd.seg)
+	}
+
+	if push {
+		t.emit(fmt.Sprintf("@%d", i), "D=A", "@"+base, "A=D+M", "D=M")
+		t.push()
+		return nil
+	}
+	t.emit(fmt.Sprintf("@%d", i), "D=A", "@"+base, "D=D+M", "@R13", "M=D")
+	t.pop()
+	t.emit("@R13", "A=M", "M=D")
+	return nil
+}
+
+// jump jumps to the routine, which returns right after it
+func (t *translator) jump(routine string) {
+	ret := t.unique("ret")
+	t.emit("@"+ret, "D=A", "@"+routine, "0;JMP")
+	t.label(ret)
+}
+
+func (t *translator) call(fn string, argSz uint16) {
+	t.emit(fmt.Sprintf("@%d", 5+int(argSz)), "D=A", "@R13", "M=D", "@"+fn, "D=A", "@R14", "M=D")
+	t.jump(callRoutine)
+}
+
+func (t *translator) routines() {
+	// the call routine lays out the frame of the callee the way Machine.call
+	// does, given the size of the args plus 5 in R13 and the callee in R14
+	t.label(callRoutine)
+	t.push()
+	for _, reg := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		t.emit("@"+reg, "D=M")
+		t.push()
+	}
+	t.emit("@SP", "D=M", "@R13", "D=D-M", "@ARG", "M=D")
+	t.emit("@SP", "D=M", "@LCL", "M=D", "@R14", "A=M", "0;JMP")
+
+	t.label(returnRoutine)
+	t.emit("@LCL", "D=M", "@R13", "M=D", "@5", "A=D-A", "D=M", "@R14", "M=D")
+	t.pop()
+	t.emit("@ARG", "A=M", "M=D", "@ARG", "D=M+1", "@SP", "M=D")
+	for _, reg := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		t.emit("@R13", "AM=M-1", "D=M", "@"+reg, "M=D")
+	}
+	t.emit("@R14", "A=M", "0;JMP")
+
+	for _, op := range []Operation{OpEq, OpGt, OpLt} {
+		routine := "$" + string(op)
+		t.label(routine)
+		t.emit("@R15", "M=D")
+		t.pop()
+		t.emit("A=A-1", "D=M-D", "M=-1", "@"+routine+".true", "D;J"+strings.ToUpper(string(op)), "@SP", "A=M-1", "M=0")
+		t.label(routine + ".true")
+		t.emit("@R15", "A=M", "0;JMP")
+	}
+}
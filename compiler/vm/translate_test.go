@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/schattian/nand2tetris/compiler/hack"
+)
+
+func TestTranslate(t *testing.T) {
+	for _, dir := range []string{"FibonacciElement", "StaticsTest", "NestedCall"} {
+		t.Run(dir, func(t *testing.T) {
+			program, err := ParseDir("../../projects/08/FunctionCalls/" + dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var asm bytes.Buffer
+			addrs, err := Translate(&asm, program)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := hack.Assemble(&asm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != len(program)+1 || addrs[len(program)] != len(p.ROM) {
+				t.Errorf("rom ends at %d, want %d", addrs[len(addrs)-1], len(p.ROM))
+			}
+			for i, cmd := range program {
+				if cmd.op == OpFunction && int(p.Labels[cmd.fnName]) != addrs[i] {
+					t.Errorf("%s at %d, want %d", cmd.fnName, addrs[i], p.Labels[cmd.fnName])
+				}
+			}
+
+			m, err := NewMachine(program)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = m.Boot(); err != nil {
+				t.Fatal(err)
+			}
+			if err = m.Run(5000); err != nil {
+				t.Fatal(err)
+			}
+			cpu := hack.NewCPU(p.ROM)
+			for i := 0; i < 100000; i++ {
+				if err = cpu.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the frames hold return addresses of the rom in place of commands
+			for _, addr := range []int{0, 1, 2, 3, 4, 16, 17, 18, 19, int(m.RAM[0]) - 1} {
+				if cpu.RAM[addr] != m.RAM[addr] {
+					t.Errorf("RAM[%d] = %d, want %d", addr, cpu.RAM[addr], m.RAM[addr])
+				}
+			}
+		})
+	}
+}
+
+func TestTranslate_Extended(t *testing.T) {
+	program := []*Command{NewFunctionCommand(initFunc, 0), NewArithmeticCommand(OpMul)}
+	if _, err := Translate(&bytes.Buffer{}, program); err == nil {
+		t.Error("expected error on an extended operation")
+	}
+}
@@ -14,7 +14,7 @@ A=M
 M=D
 @SP
 M=M+1
-`, addr,r)
+`, addr, r)
 }
 
 func translateGoto(label string) string {
@@ -38,7 +38,7 @@ func translateGetDynamicAddr(seg VMMemSegment, index uint16, destRegister Regist
 	if index != 0 {
 		s += translateAssignConstantD(index)
 		s += fmt.Sprintf(`@%s
-%s=M+D`, seg.ASMSymbol(), destRegister)
+%s=D+M`, seg.ASMSymbol(), destRegister)
 	} else {
 		s += fmt.Sprintf(`@%s
 %s=M`, seg.ASMSymbol(), destRegister)
@@ -51,12 +51,12 @@ func translateGetFixedAddr(seg VMMemSegment, index uint16) (s string) {
 	return fmt.Sprintf("@%d\n", seg.BaseAddr()+index)
 }
 
-func translateGetStaticAddr(moduleName string, index uint16) string {
-	return fmt.Sprintf("@%s.%d\n", moduleName, index)
+func translateGetStaticAddr(base, index uint16) string {
+	return fmt.Sprintf("@%d\n", base+index)
 }
 
 func translateAbsLabelName(ctx, labelName string) string {
-	if ctx != ""{
+	if ctx != "" {
 		return fmt.Sprintf("%s$%s", ctx, labelName)
 	}
 	return labelName
@@ -0,0 +1,58 @@
+# Reports the cycles taken by the translated programs, without and with
+# OPTIMIZE. Sum adds 1000..1 with a tail recursive function calling a leaf
+# one, the calls OPTIMIZE turns into jumps and inlines. Pong is compiled along
+# with the os and measured until its game loop starts; it only fits the rom
+# when optimized and pruned of the functions it never calls, so it is only
+# measured that way, and is then profiled by vm function.
+set -e
+src=$(ls *.go | grep -v _test.go)
+tmp=$(mktemp -d)
+trap 'rm -rf $tmp' EXIT
+(cd ../../compiler && go build -o $tmp/hackrun ./cmd/hackrun)
+mkdir $tmp/Pong $tmp/Sum
+cp ../11/Pong/*.jack ../../tools/OS/*.vm $tmp/Pong
+(cd ../../compiler && go run . $tmp/Pong)
+cat > $tmp/Sum/Sys.vm <<'EOF'
+function Sys.init 0
+push constant 1000
+push constant 0
+call Sys.sum 2
+pop static 0
+label WHILE
+goto WHILE
+function Sys.sum 0
+push argument 0
+if-goto REC
+push argument 1
+return
+label REC
+push argument 0
+push constant 1
+sub
+push argument 1
+push argument 0
+call Sys.add 2
+call Sys.sum 2
+return
+function Sys.add 0
+push argument 0
+push argument 1
+add
+return
+EOF
+
+bench() {
+	echo "$1:"
+	INIT=1 go run $src $2 $tmp/$1.asm
+	$tmp/hackrun -cycles 20000000 -until "$3" $tmp/$1.asm
+	echo "$1 OPTIMIZE:"
+	INIT=1 OPTIMIZE=1 go run $src $2 $tmp/$1.asm
+	$tmp/hackrun -cycles 20000000 -until "$3" $tmp/$1.asm
+}
+
+bench FibonacciElement FunctionCalls/FibonacciElement 'Sys.init$WHILE'
+bench Sum $tmp/Sum 'Sys.init$WHILE'
+
+echo "Pong OPTIMIZE:"
+INIT=1 OPTIMIZE=1 PRUNE=1 go run $src $tmp/Pong $tmp/Pong.asm
+$tmp/hackrun -cycles 20000000 -until PongGame.run -report function $tmp/Pong.asm | head -12
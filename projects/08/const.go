@@ -13,6 +13,12 @@ const (
 	SegConst   VMMemSegment = "constant"
 	SegThis    VMMemSegment = "this"
 	SegThat    VMMemSegment = "that"
+	// SegIndirect accesses the address popped from the stack
+	SegIndirect VMMemSegment = "indirect"
+	// SegFrame holds the arguments, locals and pointers of the inlined
+	// functions and the frames moved by tail calls, in words reserved after
+	// the statics. It is internal to the translator, out of the vm language
+	SegFrame VMMemSegment = "frame"
 
 	OpPush VMOperation = "push"
 	OpPop  VMOperation = "pop"
@@ -34,17 +40,58 @@ const (
 	OpGoto   VMOperation = "goto"
 	OpIfGoto VMOperation = "if-goto"
 
+	// extended operations, out of the standard vm
+	OpMul  VMOperation = "mul"
+	OpDiv  VMOperation = "div"
+	OpMod  VMOperation = "mod"
+	OpShl  VMOperation = "shl"
+	OpShr  VMOperation = "shr"
+	OpDup  VMOperation = "dup"
+	OpSwap VMOperation = "swap"
+
 	internalReg1 = "R13"
 	internalReg2 = "R14"
 	internalReg3 = "R15"
 
+	// return keeps the frame and the return address in R14 and R15 instead of
+	// the FRAME and RET variables, which the assembler would allocate from 16,
+	// over the statics laid out by the linker. The routines of the extended
+	// operations use R13-R15 too, but only until they return
+	frameReg = internalReg2
+	retReg   = internalReg3
+
 	ARegister Register = "A"
 	MRegister Register = "M"
 	DRegister Register = "D"
 
-	initFunc string = "Sys.init"
+	initFunc       string = "Sys.init"
+	bootstrapScope string = "bootstrap"
+	callRoutine    string = "$CALL"
+	returnRoutine  string = "$RETURN"
+	mulRoutine     string = "$MUL"
+	divRoutine     string = "$DIV"
+	shlRoutine     string = "$SHL"
+	shrRoutine     string = "$SHR"
 
 	initSpValue uint16 = 256
+
+	maxConstant = 32767
+	tempSize    = 8
+
+	// scratchSize is the number of words reserved after the statics for the
+	// arithmetic routines
+	scratchSize = 7
+	// frameSize is the number of words reserved after the statics for the
+	// frame segment
+	frameSize = 8
+
+	// maxInlineCommands bounds the body of the functions inlined by optimize
+	maxInlineCommands = 16
+
+	romSize = 1 << 15
+
+	staticBaseAddr uint16 = 16
+	staticMaxAddr         = 255
 )
 
 var (
@@ -52,6 +99,31 @@ var (
 		SegTemp: 5,
 	}
 
+	segMaxIndex = map[VMMemSegment]uint16{
+		SegTemp:    7,
+		SegPointer: 1,
+	}
+
+	opArity = map[VMOperation]int{
+		OpPush:     2,
+		OpPop:      2,
+		OpFunction: 2,
+		OpCall:     2,
+		OpLabel:    1,
+		OpGoto:     1,
+		OpIfGoto:   1,
+	}
+
+	// routineOps holds the shared routine computing every arithmetic
+	// extended operation
+	routineOps = map[VMOperation]string{
+		OpMul: mulRoutine,
+		OpDiv: divRoutine,
+		OpMod: divRoutine,
+		OpShl: shlRoutine,
+		OpShr: shrRoutine,
+	}
+
 	segASMSymbol = map[VMMemSegment]string{
 		SegLcl:  "LCL",
 		SegArg:  "ARG",
@@ -63,11 +135,6 @@ var (
 		1: SegThat,
 	}
 	errInvalidOperation = errors.New("invalid operation")
-
-	initVMCommand = &callVMCommand{
-		vmPc: 12121,
-		funcName: initFunc,
-	}
 )
 
 type Register string
@@ -112,6 +179,14 @@ func (seg VMMemSegment) IsStatic() bool {
 	return seg == SegStatic
 }
 
+func (seg VMMemSegment) IsIndirect() bool {
+	return seg == SegIndirect
+}
+
+func (seg VMMemSegment) IsFrame() bool {
+	return seg == SegFrame
+}
+
 func (seg VMMemSegment) IsFixed() bool {
 	return seg == SegTemp
 }
@@ -120,8 +195,25 @@ func (seg VMMemSegment) BaseAddr() uint16 {
 	return segBaseAddress[seg]
 }
 
+func (seg VMMemSegment) MaxIndex() uint16 {
+	if max, ok := segMaxIndex[seg]; ok {
+		return max
+	}
+	return maxConstant
+}
+
 type VMOperation string
 
+// Arity returns the number of arguments taken by the operation
+func (op VMOperation) Arity() int {
+	return opArity[op]
+}
+
+// IsExtended reports whether the operation is out of the standard vm
+func (op VMOperation) IsExtended() bool {
+	return routineOps[op] != "" || op == OpDup || op == OpSwap
+}
+
 func (op VMOperation) IsMemoryAccess() bool {
 	return op == OpPush || op == OpPop
 }
@@ -9,6 +9,32 @@ import (
 	"strings"
 )
 
+// DecodeError is an error of the vm source, at the given line of the module
+type DecodeError struct {
+	Module string
+	Line   int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Module, e.Line, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList is a list of errors reported at once, one per line
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	var msgs []string
+	for _, err := range l {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
 type VMDecoder struct {
 	moduleName string
 	r          io.Reader
@@ -41,9 +67,13 @@ func (d *VMDecoder) decodeOperation(op string) (VMOperation, error) {
 	case OpFunction:
 	case OpCall:
 	case OpReturn:
+	case OpMul, OpDiv, OpMod, OpShl, OpShr, OpDup, OpSwap:
 	default:
 		return "", fmt.Errorf("unsupported operation: %s", op)
 	}
+	if _, standard := os.LookupEnv("STANDARD"); standard && vmOp.IsExtended() {
+		return "", fmt.Errorf("extended operation: %s", op)
+	}
 	return vmOp, nil
 }
 
@@ -58,71 +88,117 @@ func (d *VMDecoder) decodeMemSegment(memSegment string) (VMMemSegment, error) {
 	case SegStatic:
 	case SegTemp:
 	case SegConst:
+	case SegIndirect:
+		if _, standard := os.LookupEnv("STANDARD"); standard {
+			return "", fmt.Errorf("extended mem segment: %s", memSegment)
+		}
 	default:
 		return "", fmt.Errorf("unsupported mem segment: %s", memSegment)
 	}
 	return vmMemSegment, nil
 }
 
-func (d *VMDecoder) decodeUint16(arg string) (uint16, error) {
-	i, err := strconv.Atoi(arg)
-	if err != nil {
-		return 0, err
+// decodeIndex decodes the index of a segment, between 0 and its max index
+func (d *VMDecoder) decodeIndex(seg VMMemSegment, arg string) (uint16, error) {
+	i, err := strconv.ParseUint(arg, 10, 16)
+	if err != nil || i > uint64(seg.MaxIndex()) {
+		return 0, fmt.Errorf("invalid %s index: %s, must be between 0 and %d", seg, arg, seg.MaxIndex())
 	}
 	return uint16(i), nil
 }
 
-func (d *VMDecoder) decode(ln string) (VMCommand, error) {
-	defer d.incPc()
-	ln = d.stripComments(ln)
-	if ln == "" {
-		return nil, nil
-	}
-	tokens := strings.Split(ln, " ") // op **segment **index
-	op, err := d.decodeOperation(tokens[0])
-	if err != nil {
-		return nil, err
+func (d *VMDecoder) decodeCount(arg string) (uint16, error) {
+	i, err := strconv.ParseUint(arg, 10, 16)
+	if err != nil || i > maxConstant {
+		return 0, fmt.Errorf("invalid count: %s, must be between 0 and %d", arg, maxConstant)
 	}
+	return uint16(i), nil
+}
 
-	var firstArg string
-	var secondArg uint16
-	if len(tokens) > 1 {
-		firstArg = tokens[1]
-	}
-	if len(tokens) > 2 {
-		secondArg, err = d.decodeUint16(tokens[2])
-		if err != nil {
-			return nil, err
-		}
+func (d *VMDecoder) decodeSymbol(arg string) (string, error) {
+	if !isSymbol(arg) {
+		return "", fmt.Errorf("invalid symbol: %s", arg)
 	}
+	return arg, nil
+}
 
-	input := NewVMCommandInput{op: op, vmPc: d.pc, module: d.moduleName}
-	if op.IsMemoryAccess() {
-		input.seg, err = d.decodeMemSegment(firstArg)
-		if err != nil {
-			return nil, err
+// isSymbol reports whether s is a sequence of letters, digits, underscores,
+// dots and colons, not beginning with a digit
+func isSymbol(s string) bool {
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == '.', r == ':':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
 		}
-		input.segIdx = secondArg
 	}
-	if op.IsFunction() {
-		input.funcName = firstArg
-		input.localSize = secondArg
-		d.currentCtx = input.funcName
+	return s != ""
+}
+
+func (d *VMDecoder) decode(ln string) (VMCommand, error) {
+	defer d.incPc()
+	fields := strings.Fields(d.stripComments(ln)) // op **segment **index
+	if len(fields) == 0 {
+		return nil, nil
 	}
-	if op.IsCall() {
-		input.funcName = firstArg
-		input.argSize = secondArg
+	op, err := d.decodeOperation(fields[0])
+	if err != nil {
+		return nil, d.error(err)
 	}
-	if op.IsReturn() {
-		//ctx = ctx[0 : len(ctx)-1]
+	args := fields[1:]
+	if len(args) != op.Arity() {
+		return nil, d.errorf("%s takes %d arguments, got %d", op, op.Arity(), len(args))
 	}
-	if op.IsFlowControl() {
-		input.labelName = firstArg
+
+	input := NewVMCommandInput{op: op, scope: d.scope()}
+	switch {
+	case op.IsMemoryAccess():
+		input.seg, err = d.decodeMemSegment(args[0])
+		if err == nil && op == OpPop && input.seg.IsVirtual() {
+			err = fmt.Errorf("cannot pop to %s", input.seg)
+		}
+		if err == nil {
+			input.segIdx, err = d.decodeIndex(input.seg, args[1])
+		}
+	case op.IsFunction():
+		input.funcName, err = d.decodeSymbol(args[0])
+		if err == nil {
+			input.localSize, err = d.decodeCount(args[1])
+		}
+		d.currentCtx = args[0]
+	case op.IsCall():
+		input.funcName, err = d.decodeSymbol(args[0])
+		if err == nil {
+			input.argSize, err = d.decodeCount(args[1])
+		}
+	case op.IsFlowControl():
+		input.labelName, err = d.decodeSymbol(args[0])
 		input.ctx = d.currentCtx
 	}
+	if err != nil {
+		return nil, d.error(err)
+	}
 	return NewVMCommand(input)
 }
 
+func (d *VMDecoder) errorf(format string, args ...interface{}) error {
+	return d.error(fmt.Errorf(format, args...))
+}
+
+func (d *VMDecoder) error(err error) error {
+	return &DecodeError{Module: d.moduleName, Line: int(d.pc) + 1, Err: err}
+}
+
+// scope returns the function being decoded, qualifying the labels generated
+// for its commands. Commands outside functions are qualified by the module
+func (d *VMDecoder) scope() string {
+	if d.currentCtx != "" {
+		return d.currentCtx
+	}
+	return strings.TrimSuffix(d.moduleName, ".vm")
+}
+
 func (d *VMDecoder) incPc() {
 	d.pc += 1
 }
@@ -143,12 +219,29 @@ func (d *VMDecoder) stripComments(s string) string {
 	return strings.TrimSpace(strings.Split(s, "//")[0])
 }
 
+// routinedVMCommand is a command jumping to a routine written by
+// EncodeRoutines, or to none when its routine is empty
+type routinedVMCommand interface {
+	routine() string
+}
+
 type ASMEncoder struct {
-	w io.Writer
+	w      io.Writer
+	labels *labelAllocator
+	// routines holds the routines jumped to by the encoded commands
+	routines map[string]bool
+	// scratch is the address of the words used by the arithmetic routines
+	scratch uint16
+
+	// srcmap maps the rom written so far to the source position of the
+	// commands, pos being the one of the next command
+	srcmap *sourceMap
+	rom    int
+	pos    sourcePos
 }
 
-func NewASMEncoder(w io.Writer) (*ASMEncoder, error) {
-	enc := &ASMEncoder{w: w}
+func NewASMEncoder(w io.Writer, scratch uint16) (*ASMEncoder, error) {
+	enc := &ASMEncoder{w: w, labels: newLabelAllocator(), routines: make(map[string]bool), scratch: scratch, srcmap: &sourceMap{}}
 	err := enc.init()
 	return enc, err
 }
@@ -157,7 +250,12 @@ func (e *ASMEncoder) init() error {
 	if _, init := os.LookupEnv("INIT"); !init {
 		return nil
 	}
-	callSysInitAsm, err := initVMCommand.MarshalASM()
+	callSysInit := &callVMCommand{funcName: initFunc, scope: bootstrapScope}
+	err := callSysInit.allocLabels(e.labels)
+	if err != nil {
+		return err
+	}
+	callSysInitAsm, err := callSysInit.MarshalASM()
 	var s string
 	s += translateAssignConstantD(initSpValue)
 	s += `@SP
@@ -167,11 +265,57 @@ M=D
 	if err != nil {
 		return err
 	}
-	_, err = e.w.Write([]byte(s))
+	return e.write(s, bootstrapScope)
+}
+
+// write writes the assembly of the command, mapping its instructions to the
+// current source position
+func (e *ASMEncoder) write(asm, command string) error {
+	if n := countInstructions(asm); n > 0 {
+		e.srcmap.Mappings = append(e.srcmap.Mappings, sourceMapping{ROM: e.rom, sourcePos: e.pos, Command: command})
+		e.rom += n
+	}
+	_, err := e.w.Write([]byte(asm))
 	return err
 }
 
+// EncodeRoutines writes the routines jumped to by the encoded commands
+func (e *ASMEncoder) EncodeRoutines() error {
+	ret, err := translateReturnRoutine()
+	if err != nil {
+		return err
+	}
+	e.pos = sourcePos{}
+	for _, r := range []struct {
+		name string
+		asm  string
+	}{
+		{callRoutine, translateCallRoutine()},
+		{returnRoutine, ret},
+		{mulRoutine, translateMulRoutine(e.scratch)},
+		{divRoutine, translateDivRoutine(e.scratch)},
+		{shlRoutine, translateShlRoutine()},
+		{shrRoutine, translateShrRoutine(e.scratch)},
+	} {
+		if !e.routines[r.name] {
+			continue
+		}
+		if err = e.write(r.asm, r.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *ASMEncoder) Encode(vmc VMCommand) error {
+	if l, ok := vmc.(labeledVMCommand); ok {
+		if err := l.allocLabels(e.labels); err != nil {
+			return fmt.Errorf("%s: %w", vmc, err)
+		}
+	}
+	if r, ok := vmc.(routinedVMCommand); ok && r.routine() != "" {
+		e.routines[r.routine()] = true
+	}
 	b, err := vmc.MarshalASM()
 	if err != nil {
 		return err
@@ -179,9 +323,5 @@ func (e *ASMEncoder) Encode(vmc VMCommand) error {
 	if _, debug := os.LookupEnv("DEBUG"); debug {
 		b = fmt.Sprintf("//%s\n", vmc) + b
 	}
-	_, err = e.w.Write([]byte(b))
-	if err != nil {
-		return err
-	}
-	return err
+	return e.write(b, vmc.String())
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVMDecoder_Errors(t *testing.T) {
+	tests := []struct {
+		env []string
+		ln  string
+		err string
+	}{
+		{ln: "push constant 32767 // max"},
+		{ln: "   // only a comment"},
+		{ln: "jump L", err: "unsupported operation: jump"},
+		{ln: "push", err: "push takes 2 arguments, got 0"},
+		{ln: "add 1", err: "add takes 0 arguments, got 1"},
+		{ln: "label A B", err: "label takes 1 arguments, got 2"},
+		{ln: "push heap 0", err: "unsupported mem segment: heap"},
+		{ln: "pop constant 0", err: "cannot pop to constant"},
+		{ln: "push temp 8", err: "invalid temp index: 8, must be between 0 and 7"},
+		{ln: "pop pointer 2", err: "invalid pointer index: 2, must be between 0 and 1"},
+		{ln: "push constant 32768", err: "invalid constant index: 32768, must be between 0 and 32767"},
+		{ln: "push local -1", err: "invalid local index: -1, must be between 0 and 32767"},
+		{ln: "function Main.main x", err: "invalid count: x, must be between 0 and 32767"},
+		{ln: "call 1f 0", err: "invalid symbol: 1f"},
+		{ln: "goto a-b", err: "invalid symbol: a-b"},
+		{ln: "mul"},
+		{ln: "push indirect 0"},
+		{env: []string{"STANDARD"}, ln: "mul", err: "extended operation: mul"},
+		{env: []string{"STANDARD"}, ln: "push indirect 0", err: "extended mem segment: indirect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ln, func(t *testing.T) {
+			setenv(t, tt.env...)
+			d := NewVMDecoder("Main.vm", strings.NewReader("\n"+tt.ln))
+			if _, err := d.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := d.Decode()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Decode() = %v", err)
+				}
+				return
+			}
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("Decode() = %v, want a DecodeError", err)
+			}
+			if want := "Main.vm:2: " + tt.err; err.Error() != want {
+				t.Errorf("Decode() = %q, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestDecodeModule_ErrorList(t *testing.T) {
+	src := `function Main.main 0
+push constant 1
+pop constant 0
+push constant 2
+add 3
+jump END
+return`
+	_, err := decodeModule("Main.vm", strings.NewReader(src), nil)
+	var l ErrorList
+	if !errors.As(err, &l) {
+		t.Fatalf("decodeModule() = %v, want an ErrorList", err)
+	}
+	want := []int{3, 5, 6}
+	if len(l) != len(want) {
+		t.Fatalf("decodeModule() = %v, want errors at lines %v", err, want)
+	}
+	for i, err := range l {
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || decodeErr.Module != "Main.vm" || decodeErr.Line != want[i] {
+			t.Errorf("error %d = %v, want a DecodeError at Main.vm:%d", i, err, want[i])
+		}
+	}
+	if lines := strings.Split(err.Error(), "\n"); len(lines) != len(want) || !strings.HasPrefix(lines[1], "Main.vm:5: ") {
+		t.Errorf("Error() = %q, want an error per line", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// the tests run the translated programs on a minimal hack assembler and cpu
+
+var (
+	testSymbols = map[string]int{"SP": 0, "LCL": 1, "ARG": 2, "THIS": 3, "THAT": 4, "SCREEN": 16384, "KBD": 24576}
+	testComps   = map[string]uint16{
+		"0": 0b0101010, "1": 0b0111111, "-1": 0b0111010,
+		"D": 0b0001100, "A": 0b0110000, "!D": 0b0001101, "!A": 0b0110001, "-D": 0b0001111, "-A": 0b0110011,
+		"D+1": 0b0011111, "A+1": 0b0110111, "D-1": 0b0001110, "A-1": 0b0110010,
+		"D+A": 0b0000010, "D-A": 0b0010011, "A-D": 0b0000111, "D&A": 0b0000000, "D|A": 0b0010101,
+	}
+	testJumps = map[string]uint16{"": 0, "JGT": 1, "JEQ": 2, "JGE": 3, "JLT": 4, "JNE": 5, "JLE": 6, "JMP": 7}
+)
+
+func init() {
+	for i := 0; i < 16; i++ {
+		testSymbols[fmt.Sprintf("R%d", i)] = i
+	}
+	for comp, bits := range testComps {
+		if strings.Contains(comp, "A") {
+			m := strings.ReplaceAll(comp, "A", "M")
+			testComps[m] = bits | 1<<6
+			if strings.HasPrefix(m, "D+") || strings.HasPrefix(m, "D&") || strings.HasPrefix(m, "D|") {
+				testComps[m[2:]+m[1:2]+"D"] = bits | 1<<6
+			}
+		}
+	}
+}
+
+// assemble assembles the program, returning its rom and labels
+func assemble(t *testing.T, asm string) ([]uint16, map[string]int) {
+	t.Helper()
+	labels := make(map[string]int)
+	var lines []string
+	for _, ln := range strings.Split(asm, "\n") {
+		ln = strings.ReplaceAll(strings.TrimSpace(strings.Split(ln, "//")[0]), " ", "")
+		switch {
+		case ln == "":
+		case ln[0] == '(':
+			labels[ln[1:len(ln)-1]] = len(lines)
+		default:
+			lines = append(lines, ln)
+		}
+	}
+	variables := make(map[string]int)
+	var rom []uint16
+	for _, ln := range lines {
+		if ln[0] == '@' {
+			sym := ln[1:]
+			addr, err := strconv.Atoi(sym)
+			if err != nil {
+				var ok bool
+				if addr, ok = testSymbols[sym]; !ok {
+					if addr, ok = labels[sym]; !ok {
+						if addr, ok = variables[sym]; !ok {
+							addr = 16 + len(variables)
+							variables[sym] = addr
+						}
+					}
+				}
+			}
+			rom = append(rom, uint16(addr))
+			continue
+		}
+		comp, dest, jump := ln, "", ""
+		if i := strings.Index(comp, ";"); i >= 0 {
+			comp, jump = comp[:i], comp[i+1:]
+		}
+		if i := strings.Index(comp, "="); i >= 0 {
+			dest, comp = comp[:i], comp[i+1:]
+		}
+		compBits, ok := testComps[comp]
+		if !ok {
+			t.Fatalf("unknown comp: %s", ln)
+		}
+		var destBits uint16
+		for i, r := range "MDA" {
+			if strings.ContainsRune(dest, r) {
+				destBits |= 1 << i
+			}
+		}
+		rom = append(rom, 0b111<<13|compBits<<6|destBits<<3|testJumps[jump])
+	}
+	return rom, labels
+}
+
+// run runs the rom from the given ram for the given cycles or until reaching
+// stop, returning the ram and the cycles run
+func run(rom []uint16, ram [1 << 15]int16, stop, cycles int) ([1 << 15]int16, int) {
+	var a, d int16
+	pc, n := 0, 0
+	for ; n < cycles && pc != stop && pc < len(rom); n++ {
+		inst := rom[pc]
+		if inst&(1<<15) == 0 {
+			a, pc = int16(inst), pc+1
+			continue
+		}
+		addr := uint16(a) & (1<<15 - 1)
+		x, y := d, a
+		if inst&(1<<12) != 0 {
+			y = ram[addr]
+		}
+		ctrl := inst >> 6
+		if ctrl&0x20 != 0 {
+			x = 0
+		}
+		if ctrl&0x10 != 0 {
+			x = ^x
+		}
+		if ctrl&0x08 != 0 {
+			y = 0
+		}
+		if ctrl&0x04 != 0 {
+			y = ^y
+		}
+		out := x & y
+		if ctrl&0x02 != 0 {
+			out = x + y
+		}
+		if ctrl&0x01 != 0 {
+			out = ^out
+		}
+		if inst&(1<<3) != 0 {
+			ram[addr] = out
+		}
+		if inst&(1<<4) != 0 {
+			d = out
+		}
+		target := int(uint16(a))
+		if inst&(1<<5) != 0 {
+			a = out
+		}
+		if (inst&4 != 0 && out < 0) || (inst&2 != 0 && out == 0) || (inst&1 != 0 && out > 0) {
+			pc = target
+		} else {
+			pc++
+		}
+	}
+	return ram, n
+}
+
+// setenv sets the environment variables of the translator for the test
+func setenv(t *testing.T, vars ...string) {
+	for _, v := range vars {
+		if _, ok := os.LookupEnv(v); ok {
+			continue
+		}
+		os.Setenv(v, "1")
+		v := v
+		t.Cleanup(func() { os.Unsetenv(v) })
+	}
+}
+
+// decodeSources decodes the modules given by their names and sources
+func decodeSources(t *testing.T, sources ...string) []*vmModule {
+	t.Helper()
+	var modules []*vmModule
+	for i := 0; i < len(sources); i += 2 {
+		m, err := decodeModule(sources[i], strings.NewReader(sources[i+1]), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modules = append(modules, m)
+	}
+	return modules
+}
+
+// translateSources decodes, links and translates the modules given by their
+// names and sources, returning the assembly
+func translateSources(t *testing.T, sources ...string) string {
+	t.Helper()
+	var asm strings.Builder
+	if _, _, err := translate(decodeSources(t, sources...), &asm); err != nil {
+		t.Fatal(err)
+	}
+	return asm.String()
+}
+
+// runSources translates the modules with the bootstrap and runs them until
+// Sys.init reaches its label END, returning the ram and the cycles run
+func runSources(t *testing.T, sources ...string) ([1 << 15]int16, int) {
+	t.Helper()
+	setenv(t, "INIT")
+	rom, labels := assemble(t, translateSources(t, sources...))
+	end, ok := labels["Sys.init$END"]
+	if !ok {
+		t.Fatal("Sys.init$END not defined")
+	}
+	ram, n := run(rom, [1 << 15]int16{}, end, 1000000)
+	if n == 1000000 {
+		t.Fatal("END not reached")
+	}
+	return ram, n
+}
@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// labelAllocator hands out the labels generated for comparisons and calls,
+// unique across the whole translation. They are qualified by the function
+// (or module) being translated, as in Main.main$RET.3
+type labelAllocator struct {
+	defined map[string]bool
+	counts  map[string]int
+}
+
+type labeledVMCommand interface {
+	allocLabels(a *labelAllocator) error
+}
+
+func newLabelAllocator() *labelAllocator {
+	return &labelAllocator{defined: make(map[string]bool), counts: make(map[string]int)}
+}
+
+// next returns a new label of the given kind, skipping the ones already
+// defined by the program
+func (a *labelAllocator) next(scope, kind string) string {
+	prefix := scope + "$" + kind
+	for {
+		a.counts[prefix]++
+		label := fmt.Sprintf("%s.%d", prefix, a.counts[prefix])
+		if !a.defined[label] {
+			a.defined[label] = true
+			return label
+		}
+	}
+}
+
+// define registers a label defined by the program, failing when it collides
+// with a previous one, either generated or not
+func (a *labelAllocator) define(label string) error {
+	if a.defined[label] {
+		return fmt.Errorf("label %s collides with a previous definition", label)
+	}
+	a.defined[label] = true
+	return nil
+}
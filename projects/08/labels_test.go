@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelAllocator(t *testing.T) {
+	a := newLabelAllocator()
+	steps := []struct {
+		define      string
+		scope, kind string
+		want        string
+	}{
+		{scope: "Main.main", kind: "RET", want: "Main.main$RET.1"},
+		{scope: "Main.main", kind: "IS_EQ", want: "Main.main$IS_EQ.1"},
+		{scope: "Main.f", kind: "RET", want: "Main.f$RET.1"},
+		{define: "Main.main$RET.2"},
+		{define: "Main.main$RET.4"},
+		{scope: "Main.main", kind: "RET", want: "Main.main$RET.3"},
+		{scope: "Main.main", kind: "RET", want: "Main.main$RET.5"},
+		{define: "Main.main$RET.1", want: "label Main.main$RET.1 collides with a previous definition"},
+		{define: "Main.main$RET.4", want: "label Main.main$RET.4 collides with a previous definition"},
+	}
+	for i, s := range steps {
+		if s.define == "" {
+			if got := a.next(s.scope, s.kind); got != s.want {
+				t.Errorf("step %d: next(%q, %q) = %s, want %s", i, s.scope, s.kind, got, s.want)
+			}
+			continue
+		}
+		err := a.define(s.define)
+		if (err == nil) != (s.want == "") || err != nil && err.Error() != s.want {
+			t.Errorf("step %d: define(%q) = %v, want %q", i, s.define, err, s.want)
+		}
+	}
+}
+
+func TestTranslate_Labels(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		labels []string
+		err    string
+	}{
+		{
+			name:   "generated skip the defined",
+			src:    "function Main.f 0\nlabel RET.1\ncall Main.f 0\npush constant 1\npush constant 1\neq\nreturn",
+			labels: []string{"Main.f$RET.1", "Main.f$RET.2", "Main.f$IS_EQ.1", "Main.f$END_EQ.1"},
+		},
+		{
+			name:   "scoped by function",
+			src:    "function Main.f 0\nlabel L\ncall Main.g 0\nreturn\nfunction Main.g 0\nlabel L\ncall Main.f 0\nreturn",
+			labels: []string{"Main.f$L", "Main.g$L", "Main.f$RET.1", "Main.g$RET.1"},
+		},
+		{
+			name: "defined after generated",
+			src:  "function Main.f 0\ncall Main.f 0\nlabel RET.1\nreturn",
+			err:  "label Main.f$RET.1 collides with a previous definition",
+		},
+		{
+			name: "defined twice",
+			src:  "function Main.f 0\nlabel L\nlabel L\nreturn",
+			err:  "label Main.f$L collides with a previous definition",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asm strings.Builder
+			_, _, err := translate(decodeSources(t, "Main.vm", tt.src), &asm)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("translate() = %v, want error %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, labels := assemble(t, asm.String())
+			for _, label := range tt.labels {
+				if _, ok := labels[label]; !ok {
+					t.Errorf("label %s not defined", label)
+				}
+			}
+		})
+	}
+}
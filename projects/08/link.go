@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type vmModule struct {
+	name  string
+	cmds  []VMCommand
+	lines []int
+	// jack is the jack file the module was compiled from, if known, and
+	// jackLines maps the lines of the module to its lines
+	jack      string
+	jackLines map[int]int
+}
+
+type staticRange struct {
+	base  uint16
+	count uint16
+}
+
+type linkMap struct {
+	modules []*vmModule
+	statics map[string]staticRange
+	// functions holds the module defining every function
+	functions map[string]string
+	// scratch holds the words of the arithmetic routines, if any is used
+	scratch staticRange
+	// frame holds the words of the frame segment, when optimizing
+	frame staticRange
+}
+
+// link resolves the calls between the modules against their function
+// definitions and lays out their static segments one after the other, from
+// staticBaseAddr up to staticMaxAddr, followed by the scratch words of the
+// arithmetic routines when the modules use them and the frame segment when
+// optimizing. Static accesses are bound to their absolute addresses, so the
+// assembler doesn't allocate them as variables
+func link(modules []*vmModule) (*linkMap, error) {
+	lm := &linkMap{
+		modules:   modules,
+		statics:   make(map[string]staticRange),
+		functions: make(map[string]string),
+	}
+	var errs []string
+	defs := make(map[string]string)
+	for _, m := range modules {
+		for i, cmd := range m.cmds {
+			fn, ok := cmd.(*functionVMCommand)
+			if !ok {
+				continue
+			}
+			pos := fmt.Sprintf("%s:%d", m.name, m.lines[i])
+			if prev, dup := defs[fn.funcName]; dup {
+				errs = append(errs, fmt.Sprintf("%s: duplicate function %s, first defined at %s", pos, fn.funcName, prev))
+				continue
+			}
+			defs[fn.funcName] = pos
+			lm.functions[fn.funcName] = m.name
+		}
+	}
+
+	if _, init := os.LookupEnv("INIT"); init {
+		if _, ok := lm.functions[initFunc]; !ok {
+			errs = append(errs, fmt.Sprintf("bootstrap: undefined function %s", initFunc))
+		}
+	}
+	base := staticBaseAddr
+	usesRoutines := false
+	for _, m := range modules {
+		var count uint16
+		for i, cmd := range m.cmds {
+			if _, ok := cmd.(*routineVMCommand); ok {
+				usesRoutines = true
+			}
+			switch cmd := cmd.(type) {
+			case *callVMCommand:
+				if _, ok := lm.functions[cmd.funcName]; !ok {
+					errs = append(errs, fmt.Sprintf("%s:%d: undefined function %s", m.name, m.lines[i], cmd.funcName))
+				}
+			case *pushVMCommand:
+				if cmd.seg.IsStatic() && cmd.segIdx >= count {
+					count = cmd.segIdx + 1
+				}
+			case *popVMCommand:
+				if cmd.seg.IsStatic() && cmd.segIdx >= count {
+					count = cmd.segIdx + 1
+				}
+			}
+		}
+		if int(base)+int(count)-1 > staticMaxAddr {
+			errs = append(errs, fmt.Sprintf("%s: static segment overflow: %d statics from %d run past %d", m.name, count, base, staticMaxAddr))
+		}
+		lm.statics[m.name] = staticRange{base: base, count: count}
+		for _, cmd := range m.cmds {
+			switch cmd := cmd.(type) {
+			case *pushVMCommand:
+				cmd.staticBase = base
+			case *popVMCommand:
+				cmd.staticBase = base
+			}
+		}
+		base += count
+	}
+	if usesRoutines {
+		if int(base)+scratchSize-1 > staticMaxAddr {
+			errs = append(errs, fmt.Sprintf("scratch: static segment overflow: %d words from %d run past %d", scratchSize, base, staticMaxAddr))
+		}
+		lm.scratch = staticRange{base: base, count: scratchSize}
+		base += scratchSize
+	}
+	if _, optimized := os.LookupEnv("OPTIMIZE"); optimized {
+		if int(base)+frameSize-1 > staticMaxAddr {
+			errs = append(errs, fmt.Sprintf("frame: static segment overflow: %d words from %d run past %d", frameSize, base, staticMaxAddr))
+		}
+		lm.frame = staticRange{base: base, count: frameSize}
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	return lm, nil
+}
+
+// WriteTo writes the static ranges of the modules and the module defining
+// every function
+func (lm *linkMap) WriteTo(w io.Writer) (int64, error) {
+	var s strings.Builder
+	s.WriteString("statics\n")
+	for _, m := range lm.modules {
+		r := lm.statics[m.name]
+		switch r.count {
+		case 0:
+			fmt.Fprintf(&s, "\t%s\t-\n", m.name)
+		case 1:
+			fmt.Fprintf(&s, "\t%s\t%d\n", m.name, r.base)
+		default:
+			fmt.Fprintf(&s, "\t%s\t%d-%d\n", m.name, r.base, r.base+r.count-1)
+		}
+	}
+	if lm.scratch.count > 0 {
+		fmt.Fprintf(&s, "scratch\t%d-%d\n", lm.scratch.base, lm.scratch.base+lm.scratch.count-1)
+	}
+	if lm.frame.count > 0 {
+		fmt.Fprintf(&s, "frame\t%d-%d\n", lm.frame.base, lm.frame.base+lm.frame.count-1)
+	}
+	s.WriteString("functions\n")
+	var fns []string
+	for fn := range lm.functions {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	for _, fn := range fns {
+		fmt.Fprintf(&s, "\t%s\t%s\n", fn, lm.functions[fn])
+	}
+	n, err := io.WriteString(w, s.String())
+	return int64(n), err
+}
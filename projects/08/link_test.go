@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     []string
+		sources []string
+		statics map[string]staticRange
+		scratch staticRange
+		frame   staticRange
+		err     string
+	}{
+		{
+			name: "statics",
+			sources: []string{
+				"A.vm", "function A.f 0\npush static 2\npop static 0\npush constant 0\nreturn",
+				"B.vm", "function B.f 0\ncall A.f 0\nreturn",
+				"C.vm", "function C.f 0\npush static 0\nreturn",
+			},
+			statics: map[string]staticRange{"A.vm": {16, 3}, "B.vm": {19, 0}, "C.vm": {19, 1}},
+		},
+		{
+			name: "scratch and frame",
+			env:  []string{"OPTIMIZE"},
+			sources: []string{
+				"A.vm", "function A.f 0\npush static 0\npush constant 3\nmul\nreturn",
+			},
+			statics: map[string]staticRange{"A.vm": {16, 1}},
+			scratch: staticRange{17, scratchSize},
+			frame:   staticRange{17 + scratchSize, frameSize},
+		},
+		{
+			name: "last static",
+			sources: []string{
+				"A.vm", "function A.f 0\npush static 200\nreturn",
+				"B.vm", "function B.f 0\npush static 38\nreturn",
+			},
+			statics: map[string]staticRange{"A.vm": {16, 201}, "B.vm": {217, 39}},
+		},
+		{
+			name: "static overflow",
+			sources: []string{
+				"A.vm", "function A.f 0\npush static 200\nreturn",
+				"B.vm", "function B.f 0\npush static 39\nreturn",
+			},
+			err: "B.vm: static segment overflow: 40 statics from 217 run past 255",
+		},
+		{
+			name: "scratch overflow",
+			sources: []string{
+				"A.vm", "function A.f 0\npush static 239\nshl\nreturn",
+			},
+			err: "scratch: static segment overflow",
+		},
+		{
+			name: "frame overflow",
+			env:  []string{"OPTIMIZE"},
+			sources: []string{
+				"A.vm", "function A.f 0\npush static 239\nreturn",
+			},
+			err: "frame: static segment overflow",
+		},
+		{
+			name: "undefined function",
+			sources: []string{
+				"A.vm", "function A.f 0\ncall B.f 0\nreturn",
+			},
+			err: "A.vm:2: undefined function B.f",
+		},
+		{
+			name: "duplicate function",
+			sources: []string{
+				"A.vm", "function A.f 0\nreturn",
+				"B.vm", "push constant 0\nfunction A.f 0\nreturn",
+			},
+			err: "B.vm:2: duplicate function A.f, first defined at A.vm:1",
+		},
+		{
+			name: "undefined Sys.init",
+			env:  []string{"INIT"},
+			sources: []string{
+				"A.vm", "function A.f 0\nreturn",
+			},
+			err: "bootstrap: undefined function Sys.init",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, tt.env...)
+			lm, err := link(decodeSources(t, tt.sources...))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("link() = %v, want error %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.statics {
+				if got := lm.statics[name]; got != want {
+					t.Errorf("statics of %s = %v, want %v", name, got, want)
+				}
+			}
+			if lm.scratch != tt.scratch || lm.frame != tt.frame {
+				t.Errorf("scratch = %v, frame = %v, want %v and %v", lm.scratch, lm.frame, tt.scratch, tt.frame)
+			}
+		})
+	}
+}
+
+var (
+	tstSet    = regexp.MustCompile(`set RAM\[(\d+)\] (-?\d+)`)
+	tstRepeat = regexp.MustCompile(`repeat (\d+)`)
+)
+
+// readTest reads the ram set by the test script of the dir and the cycles it
+// runs, and the ram its compare file expects
+func readTest(t *testing.T, dir string) (ram [1 << 15]int16, cycles int, want map[int]int16) {
+	t.Helper()
+	name := filepath.Join(dir, filepath.Base(dir))
+	tst, err := os.ReadFile(name + ".tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range tstSet.FindAllStringSubmatch(string(tst), -1) {
+		addr, _ := strconv.Atoi(m[1])
+		v, _ := strconv.Atoi(m[2])
+		ram[addr] = int16(v)
+	}
+	cycles, _ = strconv.Atoi(tstRepeat.FindStringSubmatch(string(tst))[1])
+
+	f, err := os.Open(name + ".cmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var rows [][]string
+	for s := bufio.NewScanner(f); s.Scan() && len(rows) < 2; {
+		rows = append(rows, strings.Split(strings.Trim(s.Text(), "|"), "|"))
+	}
+	want = make(map[int]int16)
+	for i, col := range rows[0] {
+		addr, _ := strconv.Atoi(strings.Trim(strings.TrimSpace(col), "RAM[]"))
+		v, _ := strconv.Atoi(strings.TrimSpace(rows[1][i]))
+		want[addr] = int16(v)
+	}
+	return
+}
+
+// TestLink_FunctionCalls runs the programs of FunctionCalls with and without
+// OPTIMIZE, checking the ram their compare files expect and that both leave the
+// same pointers, temp and stack of the last frame
+func TestLink_FunctionCalls(t *testing.T) {
+	dirs, err := filepath.Glob("FunctionCalls/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			if _, err := os.Stat(filepath.Join(dir, "Sys.vm")); err == nil {
+				setenv(t, "INIT")
+			}
+			start, cycles, want := readTest(t, dir)
+			var rams [2][1 << 15]int16
+			for i, optimized := range []bool{false, true} {
+				if optimized {
+					setenv(t, "OPTIMIZE")
+				}
+				modules, err := decodeDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var asm strings.Builder
+				if _, _, err = translate(modules, &asm); err != nil {
+					t.Fatal(err)
+				}
+				rom, _ := assemble(t, asm.String())
+				rams[i], _ = run(rom, start, -1, cycles)
+				for addr, v := range want {
+					if got := rams[i][addr]; got != v {
+						t.Errorf("optimized %v: RAM[%d] = %d, want %d", optimized, addr, got, v)
+					}
+				}
+			}
+			// R13-R15 and the return addresses saved in the frames depend
+			// on the translation
+			plain, optimized := rams[0], rams[1]
+			for addr := 0; addr < int(plain[0]); addr++ {
+				if (addr < 13 || addr >= int(plain[1])) && plain[addr] != optimized[addr] {
+					t.Errorf("RAM[%d] = %d optimized, %d not", addr, optimized[addr], plain[addr])
+				}
+			}
+		})
+	}
+}
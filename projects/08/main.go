@@ -2,84 +2,206 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func main() {
 	if len(os.Args) < 3 {
 		log.Fatal("not enough args")
 	}
+	if os.Args[1] == "lint" {
+		lint(os.Args[2])
+		return
+	}
 	destFilename := os.Args[2]
 
+	modules, err := decodePath(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := os.LookupEnv("VERIFY"); ok {
+		if err = verifyAll(modules); err != nil {
+			log.Fatal(err)
+		}
+	}
 	w, err := os.Create(destFilename)
 	if err != nil {
 		log.Fatalf("os.Create: %v", err)
 	}
 	defer w.Close()
-	enc, err := NewASMEncoder(w)
+	lm, srcmap, err := translate(modules, w)
 	if err != nil {
-		log.Fatalf("NewASMEncoder: %v", err)
+		log.Fatal(err)
 	}
 
-	if filepath.Ext(os.Args[1]) != ".vm" {
-		err = translateDir(os.Args[1], enc)
-	} else {
-		err = translateFile(os.Args[1], enc)
+	mapFile, err := os.Create(strings.TrimSuffix(destFilename, filepath.Ext(destFilename)) + ".map")
+	if err != nil {
+		log.Fatalf("os.Create: %v", err)
+	}
+	defer mapFile.Close()
+	if _, err = lm.WriteTo(mapFile); err != nil {
+		log.Fatal(err)
 	}
+
+	srcMapFile, err := os.Create(sourceMapFilename(destFilename))
 	if err != nil {
+		log.Fatalf("os.Create: %v", err)
+	}
+	defer srcMapFile.Close()
+	if _, err = srcmap.WriteTo(srcMapFile); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func translateDir(dirname string, enc *ASMEncoder) error {
-	entries, err := os.ReadDir(dirname)
+// translate links the modules and writes their assembly, returning the link
+// map and the source map of the program
+func translate(modules []*vmModule, w io.Writer) (*linkMap, *sourceMap, error) {
+	lm, err := link(modules)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	var filenames []string
-	for _, entry := range entries {
-		if filepath.Ext(entry.Name()) == ".vm" {
-			filenames = append(filenames, entry.Name())
+	if _, optimized := os.LookupEnv("OPTIMIZE"); optimized {
+		optimize(modules, lm.frame.base)
+	}
+	if _, pruned := os.LookupEnv("PRUNE"); pruned {
+		if _, init := os.LookupEnv("INIT"); !init {
+			return nil, nil, errors.New("PRUNE needs INIT, which calls the root Sys.init")
 		}
+		prune(modules, initFunc)
 	}
+	enc, err := NewASMEncoder(w, lm.scratch.base)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("NewASMEncoder: %w", err)
 	}
-	for _, filename := range filenames {
-		err = translateFile(dirname+"/"+filename, enc)
-		if err != nil {
-			return err
+	for _, m := range modules {
+		for i, vmc := range m.cmds {
+			enc.pos = m.pos(i)
+			if err = enc.Encode(vmc); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err = enc.EncodeRoutines(); err != nil {
+		return nil, nil, err
+	}
+	return lm, enc.srcmap, nil
+}
+
+// lint verifies the vm code of the path without translating it
+func lint(path string) {
+	modules, err := decodePath(path)
+	if err == nil {
+		err = verifyAll(modules)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func verifyAll(modules []*vmModule) error {
+	var errs ErrorList
+	for _, m := range modules {
+		var l ErrorList
+		if errors.As(verify(m), &l) {
+			errs = append(errs, l...)
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
-func translateFile(filename string, enc *ASMEncoder) error {
+func decodePath(path string) ([]*vmModule, error) {
+	if filepath.Ext(path) != ".vm" {
+		return decodeDir(path)
+	}
+	m, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []*vmModule{m}, nil
+}
+
+func decodeDir(dirname string) ([]*vmModule, error) {
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	var modules []*vmModule
+	var errs ErrorList
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".vm" {
+			continue
+		}
+		m, err := decodeFile(dirname + "/" + entry.Name())
+		var l ErrorList
+		if errors.As(err, &l) {
+			errs = append(errs, l...)
+		} else if err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return modules, nil
+}
+
+func decodeFile(filename string) (*vmModule, error) {
 	r, err := os.Open(filename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer r.Close()
 
-	d := NewVMDecoder(filepath.Base(filename), r)
+	debug, err := readJackDebug(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return decodeModule(filepath.Base(filename), r, debug)
+}
+
+// decodeModule decodes the vm source of the module, linking its commands to
+// the jack lines of debug when not nil
+func decodeModule(name string, r io.Reader, debug *jackDebug) (*vmModule, error) {
+	m := &vmModule{name: name}
+	if debug != nil {
+		m.jack, m.jackLines = filepath.Base(debug.File), make(map[int]int)
+	}
+	d := NewVMDecoder(m.name, r)
+	var errs ErrorList
 	for {
 		vmc, err := d.Decode()
 		if errors.Is(err, io.EOF) {
 			break
 		}
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			errs = append(errs, err)
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if vmc == nil {
 			continue
 		}
-		err = enc.Encode(vmc)
-		if err != nil {
-			return err
+		if debug != nil && len(m.cmds) < len(debug.Lines) {
+			m.jackLines[int(d.pc)] = debug.Lines[len(m.cmds)]
 		}
+		m.cmds = append(m.cmds, vmc)
+		m.lines = append(m.lines, int(d.pc))
 	}
-	return nil
+	if len(errs) > 0 {
+		return m, errs
+	}
+	return m, nil
 }
@@ -0,0 +1,297 @@
+package main
+
+import "strings"
+
+// optimize inlines the calls to small leaf functions and turns the calls
+// followed by a return into jumps reusing the frame of the caller. The rest of
+// calls and returns are shared, jumping to the routines written by
+// EncodeRoutines, when the program doesn't fit the rom otherwise. It runs
+// after linking, so inlined static accesses keep the segment of their module.
+// frame is the address of the frame segment
+func optimize(modules []*vmModule, frame uint16) {
+	// the arguments of every function, when all its calls agree on them
+	arity := make(map[string]int)
+	inlinable := make(map[string]*inlineFunction)
+	for _, m := range modules {
+		for _, cmd := range m.cmds {
+			if call, ok := cmd.(*callVMCommand); ok {
+				if n, seen := arity[call.funcName]; seen && n != int(call.argSize) {
+					arity[call.funcName] = -1
+				} else {
+					arity[call.funcName] = int(call.argSize)
+				}
+			}
+		}
+		start := -1
+		for i := 0; i <= len(m.cmds); i++ {
+			if i < len(m.cmds) && m.cmds[i].GetOp() != OpFunction {
+				continue
+			}
+			if start >= 0 {
+				fn := m.cmds[start].(*functionVMCommand)
+				if f := newInlineFunction(fn, m.cmds[start+1:i]); f != nil {
+					inlinable[fn.funcName] = f
+				}
+			}
+			start = i
+		}
+	}
+
+	var calls []*callVMCommand
+	var returns []*returnVMCommand
+	for _, m := range modules {
+		var cmds []VMCommand
+		var lines []int
+		callerArgs := -1
+		for i := 0; i < len(m.cmds); i++ {
+			if fn, ok := m.cmds[i].(*functionVMCommand); ok {
+				callerArgs = -1
+				if n, seen := arity[fn.funcName]; seen {
+					callerArgs = n
+				}
+			}
+			call, ok := m.cmds[i].(*callVMCommand)
+			switch {
+			case ok && inlinable[call.funcName].fits(call.argSize):
+				for _, cmd := range inlinable[call.funcName].inline(call.argSize, frame) {
+					cmds = append(cmds, cmd)
+					lines = append(lines, m.lines[i])
+				}
+			case ok && i+1 < len(m.cmds) && m.cmds[i+1].GetOp() == OpReturn:
+				cmds = append(cmds, &tailCallVMCommand{funcName: call.funcName, argSize: call.argSize, callerArgs: callerArgs, frame: frame})
+				lines = append(lines, m.lines[i])
+				i++
+			case ok:
+				calls = append(calls, call)
+				cmds = append(cmds, call)
+				lines = append(lines, m.lines[i])
+			default:
+				if ret, ok := m.cmds[i].(*returnVMCommand); ok {
+					returns = append(returns, ret)
+				}
+				cmds = append(cmds, m.cmds[i])
+				lines = append(lines, m.lines[i])
+			}
+		}
+		m.cmds, m.lines = cmds, lines
+	}
+
+	// in place calls and returns take the least cycles, so they are only
+	// shared when the program doesn't fit the rom otherwise
+	if programSize(modules) <= romSize {
+		return
+	}
+	if sharesROM(calls, translateCallRoutine()) {
+		for _, call := range calls {
+			call.shared = true
+		}
+	}
+	ret, _ := translateReturnRoutine()
+	if sharesROM(returns, ret) {
+		for _, ret := range returns {
+			ret.shared = true
+		}
+	}
+}
+
+// sharesROM reports whether sharing the routine between the calls or returns
+// takes less rom than translating them in place. Sharing always takes more
+// cycles, jumping to the routine and back
+func sharesROM(cmds interface{}, routine string) bool {
+	var inPlace, shared int
+	switch cmds := cmds.(type) {
+	case []*callVMCommand:
+		for _, call := range cmds {
+			inPlace += countASM(&callVMCommand{funcName: call.funcName, argSize: call.argSize})
+			shared += countASM(&callVMCommand{funcName: call.funcName, argSize: call.argSize, shared: true})
+		}
+	case []*returnVMCommand:
+		inPlace = len(cmds) * countASM(&returnVMCommand{})
+		shared = len(cmds) * countASM(&returnVMCommand{shared: true})
+	}
+	return shared+countInstructions(routine) < inPlace
+}
+
+// programSize returns the number of instructions the modules translate to
+func programSize(modules []*vmModule) (n int) {
+	for _, m := range modules {
+		for _, cmd := range m.cmds {
+			n += countASM(cmd)
+		}
+	}
+	return
+}
+
+func countASM(cmd VMCommand) int {
+	asm, _ := cmd.MarshalASM()
+	return countInstructions(asm)
+}
+
+// countInstructions returns the number of rom instructions of the assembly,
+// skipping label definitions and comments
+func countInstructions(asm string) (n int) {
+	for _, ln := range strings.Split(asm, "\n") {
+		ln = strings.TrimSpace(strings.Split(ln, "//")[0])
+		if ln != "" && ln[0] != '(' {
+			n++
+		}
+	}
+	return
+}
+
+// prune drops the functions unreachable from the root, which is called by
+// the bootstrap. It runs with PRUNE, after optimizing, so it drops the
+// functions whose calls were all inlined too
+func prune(modules []*vmModule, root string) {
+	calls := make(map[string][]string)
+	var fn string
+	for _, m := range modules {
+		for _, cmd := range m.cmds {
+			switch cmd := cmd.(type) {
+			case *functionVMCommand:
+				fn = cmd.funcName
+			case *callVMCommand:
+				calls[fn] = append(calls[fn], cmd.funcName)
+			case *tailCallVMCommand:
+				calls[fn] = append(calls[fn], cmd.funcName)
+			}
+		}
+	}
+	reachable := make(map[string]bool)
+	var visit func(fn string)
+	visit = func(fn string) {
+		if reachable[fn] {
+			return
+		}
+		reachable[fn] = true
+		for _, callee := range calls[fn] {
+			visit(callee)
+		}
+	}
+	visit(root)
+
+	for _, m := range modules {
+		var cmds []VMCommand
+		var lines []int
+		keep := true
+		for i, cmd := range m.cmds {
+			if fn, ok := cmd.(*functionVMCommand); ok {
+				keep = reachable[fn.funcName]
+			}
+			if keep {
+				cmds = append(cmds, cmd)
+				lines = append(lines, m.lines[i])
+			}
+		}
+		m.cmds, m.lines = cmds, lines
+	}
+}
+
+// inlineFunction is a function whose body can replace its calls. Its
+// arguments and locals are remapped to the frame segment, followed by the
+// pointers it sets, which are restored after the body like a return would
+type inlineFunction struct {
+	body     []VMCommand
+	nLocals  uint16
+	nArgs    uint16
+	pointers []uint16
+}
+
+// newInlineFunction returns the inlinable function of the given body, or nil
+// when the body is too long, branches, calls other functions or doesn't leave
+// a single value to return
+func newInlineFunction(fn *functionVMCommand, body []VMCommand) *inlineFunction {
+	if len(body) == 0 || len(body) > maxInlineCommands || body[len(body)-1].GetOp() != OpReturn {
+		return nil
+	}
+	f := &inlineFunction{body: body[:len(body)-1], nLocals: fn.localSize}
+	setPointers := make(map[uint16]bool)
+	depth := 0
+	for _, cmd := range f.body {
+		switch cmd.GetOp() {
+		case OpCall, OpReturn, OpLabel, OpGoto, OpIfGoto:
+			return nil
+		}
+		pops, pushes := stackEffect(cmd)
+		if depth < pops {
+			return nil
+		}
+		depth += pushes - pops
+
+		var seg VMMemSegment
+		var idx uint16
+		switch cmd := cmd.(type) {
+		case *pushVMCommand:
+			seg, idx = cmd.seg, cmd.segIdx
+		case *popVMCommand:
+			seg, idx = cmd.seg, cmd.segIdx
+			if seg.IsPointer() && !setPointers[idx] {
+				setPointers[idx] = true
+				f.pointers = append(f.pointers, idx)
+			}
+		}
+		switch {
+		case seg == SegArg && idx >= f.nArgs:
+			f.nArgs = idx + 1
+		case seg == SegLcl && idx >= f.nLocals:
+			return nil
+		}
+	}
+	if depth != 1 {
+		return nil
+	}
+	return f
+}
+
+// fits reports whether the function can be inlined at a call passing argSize
+// arguments
+func (f *inlineFunction) fits(argSize uint16) bool {
+	return f != nil && f.nArgs <= argSize && int(argSize+f.nLocals)+len(f.pointers) <= frameSize
+}
+
+func (f *inlineFunction) inline(argSize, frame uint16) (cmds []VMCommand) {
+	for i := int(argSize) - 1; i >= 0; i-- {
+		cmds = append(cmds, &popVMCommand{seg: SegFrame, segIdx: uint16(i), staticBase: frame})
+	}
+	slot := argSize + f.nLocals
+	for i, p := range f.pointers {
+		cmds = append(cmds,
+			&pushVMCommand{seg: SegPointer, segIdx: p},
+			&popVMCommand{seg: SegFrame, segIdx: slot + uint16(i), staticBase: frame},
+		)
+	}
+	for i := uint16(0); i < f.nLocals; i++ {
+		cmds = append(cmds,
+			&pushVMCommand{seg: SegConst, segIdx: 0},
+			&popVMCommand{seg: SegFrame, segIdx: argSize + i, staticBase: frame},
+		)
+	}
+	remap := func(seg VMMemSegment, idx, base uint16) (VMMemSegment, uint16, uint16) {
+		switch seg {
+		case SegArg:
+			return SegFrame, idx, frame
+		case SegLcl:
+			return SegFrame, argSize + idx, frame
+		}
+		return seg, idx, base
+	}
+	for _, cmd := range f.body {
+		switch cmd := cmd.(type) {
+		case *pushVMCommand:
+			seg, idx, base := remap(cmd.seg, cmd.segIdx, cmd.staticBase)
+			cmds = append(cmds, &pushVMCommand{seg: seg, segIdx: idx, staticBase: base})
+		case *popVMCommand:
+			seg, idx, base := remap(cmd.seg, cmd.segIdx, cmd.staticBase)
+			cmds = append(cmds, &popVMCommand{seg: seg, segIdx: idx, staticBase: base})
+		default:
+			cmds = append(cmds, cmd)
+		}
+	}
+	for i, p := range f.pointers {
+		cmds = append(cmds,
+			&pushVMCommand{seg: SegFrame, segIdx: slot + uint16(i), staticBase: frame},
+			&popVMCommand{seg: SegPointer, segIdx: p},
+		)
+	}
+	return
+}
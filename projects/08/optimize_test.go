@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOptimize_KeepsTemp(t *testing.T) {
+	sys := `
+function Sys.init 0
+push constant 42
+pop temp 0
+push constant 7
+call Sys.id 1
+pop temp 1
+push temp 0
+pop static 0
+label END
+goto END
+function Sys.id 0
+push argument 0
+return
+`
+	// the tail call moves the frame of Sys.tail up, past its argument
+	tail := `
+function Sys.init 0
+push constant 42
+pop temp 0
+call Sys.tail 0
+pop temp 1
+push temp 0
+pop static 0
+label END
+goto END
+function Sys.tail 0
+push constant 3
+push constant 4
+call Sys.add 2
+return
+function Sys.add 0
+push argument 0
+push argument 1
+add
+label LOOP
+push constant 0
+if-goto LOOP
+return
+`
+	tests := []struct {
+		name string
+		src  string
+		want int16
+	}{
+		{"inline", sys, 7},
+		{"tail call", tail, 7},
+	}
+	for _, tt := range tests {
+		for _, env := range [][]string{nil, {"OPTIMIZE"}} {
+			t.Run(fmt.Sprint(tt.name, env), func(t *testing.T) {
+				setenv(t, env...)
+				ram, _ := runSources(t, "Sys.vm", tt.src)
+				if ram[16] != 42 || ram[6] != tt.want {
+					t.Errorf("static 0 = %d, temp 1 = %d, want 42 and %d", ram[16], ram[6], tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestNewInlineFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		nArgs    uint16
+		pointers []uint16
+		inlined  bool
+	}{
+		{"identity", "function Main.f 0\npush argument 0\nreturn", 1, nil, true},
+		{"arguments and locals", "function Main.f 1\npush argument 2\npop local 0\npush local 0\npush argument 0\nadd\nreturn", 3, nil, true},
+		{"pointers", "function Main.f 0\npush argument 0\npop pointer 1\npush argument 1\npop pointer 0\npush that 0\npop pointer 1\npush this 0\nreturn", 2, []uint16{1, 0}, true},
+		{"call", "function Main.f 0\ncall Main.g 0\nreturn", 0, nil, false},
+		{"branch", "function Main.f 0\nlabel L\npush constant 0\nreturn", 0, nil, false},
+		{"two values", "function Main.f 0\npush constant 0\npush constant 1\nreturn", 0, nil, false},
+		{"underflow", "function Main.f 0\nadd\nreturn", 0, nil, false},
+		{"undeclared local", "function Main.f 0\npush local 0\nreturn", 0, nil, false},
+		{"no return", "function Main.f 0\npush constant 0\npop temp 0", 0, nil, false},
+		{"too long", "function Main.f 0\npush constant 0" + strings.Repeat("\nnot", maxInlineCommands) + "\nreturn", 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := decodeSources(t, "Main.vm", tt.src)[0]
+			f := newInlineFunction(m.cmds[0].(*functionVMCommand), m.cmds[1:])
+			if (f != nil) != tt.inlined {
+				t.Fatalf("newInlineFunction() = %v, want inlined %v", f, tt.inlined)
+			}
+			if f != nil && (f.nArgs != tt.nArgs || fmt.Sprint(f.pointers) != fmt.Sprint(tt.pointers)) {
+				t.Errorf("%d arguments, pointers %v, want %d and %v", f.nArgs, f.pointers, tt.nArgs, tt.pointers)
+			}
+		})
+	}
+
+	f := &inlineFunction{nArgs: 2, nLocals: 3, pointers: []uint16{0}}
+	for _, tt := range []struct {
+		argSize uint16
+		want    bool
+	}{{1, false}, {2, true}, {4, true}, {5, false}} {
+		if got := f.fits(tt.argSize); got != tt.want {
+			t.Errorf("fits(%d) = %v, want %v", tt.argSize, got, tt.want)
+		}
+	}
+}
+
+// TestOptimize_Programs runs programs with and without OPTIMIZE, which must
+// leave the same result in static 0 and the same pointers, in fewer cycles
+func TestOptimize_Programs(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int16
+	}{
+		{"tail recursion", `
+function Sys.init 0
+push constant 200
+push constant 0
+call Sys.sum 2
+pop static 0
+label END
+goto END
+function Sys.sum 0
+push argument 0
+if-goto MORE
+push argument 1
+return
+label MORE
+push argument 0
+push constant 1
+sub
+push argument 1
+push argument 0
+add
+call Sys.sum 2
+return
+`, 20100},
+		{"tail call with more arguments", `
+function Sys.init 0
+push constant 5
+call Sys.f 1
+pop static 0
+label END
+goto END
+function Sys.f 1
+push argument 0
+push argument 0
+push argument 0
+call Sys.g 3
+return
+function Sys.g 1
+push argument 0
+push argument 1
+add
+push argument 2
+sub
+pop local 0
+push local 0
+push argument 2
+add
+return
+`, 10},
+		{"inlined pointers", `
+function Sys.init 0
+push constant 3000
+pop pointer 0
+push constant 4000
+pop pointer 1
+push constant 11
+pop that 0
+push constant 5000
+push constant 2
+call Sys.at 2
+push this 0
+add
+pop static 0
+label END
+goto END
+function Sys.at 0
+push argument 0
+pop pointer 1
+push argument 1
+pop that 0
+push argument 0
+pop pointer 0
+push this 0
+push constant 4000
+pop pointer 1
+push that 0
+add
+return
+`, 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, plainCycles := runSources(t, "Sys.vm", tt.src)
+			setenv(t, "OPTIMIZE")
+			optimized, optimizedCycles := runSources(t, "Sys.vm", tt.src)
+			if plain[16] != tt.want || optimized[16] != tt.want {
+				t.Errorf("static 0 = %d, %d optimized, want %d", plain[16], optimized[16], tt.want)
+			}
+			if plain[3] != optimized[3] || plain[4] != optimized[4] {
+				t.Errorf("THIS and THAT = %d %d, %d %d optimized", plain[3], plain[4], optimized[3], optimized[4])
+			}
+			if optimizedCycles >= plainCycles {
+				t.Errorf("%d cycles optimized, %d not", optimizedCycles, plainCycles)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	src := `
+function Sys.init 0
+call Sys.used 0
+label END
+goto END
+function Sys.used 0
+push constant 1
+return
+function Sys.unused 0
+push constant 2
+return
+`
+	for _, pruned := range []bool{false, true} {
+		t.Run(fmt.Sprint(pruned), func(t *testing.T) {
+			setenv(t, "INIT")
+			if pruned {
+				setenv(t, "PRUNE")
+			}
+			asm := translateSources(t, "Sys.vm", src)
+			if got := strings.Contains(asm, "(Sys.unused)"); got == pruned {
+				t.Errorf("Sys.unused translated = %v with PRUNE = %v", got, pruned)
+			}
+			if !strings.Contains(asm, "(Sys.used)") {
+				t.Error("Sys.used dropped")
+			}
+		})
+	}
+}
+
+func TestSharesROM(t *testing.T) {
+	calls := func(n int) (cmds []*callVMCommand) {
+		for i := 0; i < n; i++ {
+			cmds = append(cmds, &callVMCommand{funcName: "Main.f", argSize: 1})
+		}
+		return
+	}
+	returns := func(n int) []*returnVMCommand {
+		return make([]*returnVMCommand, n)
+	}
+	ret, _ := translateReturnRoutine()
+	tests := []struct {
+		name    string
+		cmds    interface{}
+		routine string
+		want    bool
+	}{
+		{"one call", calls(1), translateCallRoutine(), false},
+		{"many calls", calls(10), translateCallRoutine(), true},
+		{"one return", returns(1), ret, false},
+		{"many returns", returns(10), ret, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sharesROM(tt.cmds, tt.routine); got != tt.want {
+				t.Errorf("sharesROM() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimize_CallsInPlace(t *testing.T) {
+	setenv(t, "OPTIMIZE")
+	asm := translateSources(t, "Main.vm", `
+function Main.main 0
+push constant 1
+call Main.loop 1
+pop temp 0
+push constant 0
+return
+function Main.loop 0
+label LOOP
+goto LOOP
+`)
+	if strings.Contains(asm, callRoutine) || strings.Contains(asm, returnRoutine) {
+		t.Error("calls and returns shared by a program fitting the rom")
+	}
+}
+
+func TestOptimize_TailCallCommand(t *testing.T) {
+	setenv(t, "OPTIMIZE")
+	m, err := decodeModule("Main.vm", strings.NewReader(`
+function Main.f 1
+push argument 0
+call Main.g 1
+return
+function Main.g 0
+label LOOP
+goto LOOP
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asm strings.Builder
+	_, srcmap, err := translate([]*vmModule{m}, &asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, mapping := range srcmap.Mappings {
+		if mapping.Line == 4 {
+			found = true
+			if mapping.Command != "call Main.g 1" {
+				t.Errorf("command = %q, want %q", mapping.Command, "call Main.g 1")
+			}
+		}
+	}
+	if !found || !strings.Contains(asm.String(), "// tail call") {
+		t.Error("call Main.g 1 not translated to a tail call")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourcePos is the vm command, and the jack line when known, an instruction
+// was translated from
+type sourcePos struct {
+	Module   string `json:"module,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Jack     string `json:"jack,omitempty"`
+	JackLine int    `json:"jackLine,omitempty"`
+}
+
+// sourceMapping maps the rom instructions from ROM up to the next mapping
+type sourceMapping struct {
+	ROM int `json:"rom"`
+	sourcePos
+	Command string `json:"command"`
+}
+
+// sourceMap maps the rom of the translated program back to its sources.
+// Mappings are sorted by rom address, so the source of an instruction is the
+// last mapping at or before it
+type sourceMap struct {
+	Mappings []sourceMapping `json:"mappings"`
+}
+
+func (sm *sourceMap) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(sm, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// jackDebug is the part of the debug map written by the jack compiler with -g
+// that links the vm commands to their jack lines
+type jackDebug struct {
+	File string `json:"file"`
+	// Lines holds the jack line of every command
+	Lines []int `json:"lines"`
+}
+
+// readJackDebug reads the debug map next to the vm file, returning nil when
+// there is none
+func readJackDebug(filename string) (*jackDebug, error) {
+	f, err := os.Open(strings.TrimSuffix(filename, ".vm") + ".dbg.json")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := &jackDebug{}
+	return d, json.NewDecoder(f).Decode(d)
+}
+
+// pos returns the source position of the i-th command of the module
+func (m *vmModule) pos(i int) sourcePos {
+	pos := sourcePos{Module: m.name, Line: m.lines[i]}
+	if line, ok := m.jackLines[m.lines[i]]; ok {
+		pos.Jack, pos.JackLine = m.jack, line
+	}
+	return pos
+}
+
+func sourceMapFilename(destFilename string) string {
+	return strings.TrimSuffix(destFilename, filepath.Ext(destFilename)) + ".srcmap.json"
+}
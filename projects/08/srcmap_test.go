@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountInstructions(t *testing.T) {
+	tests := []struct {
+		asm  string
+		want int
+	}{
+		{"", 0},
+		{"@SP\nM=M+1\n", 2},
+		{"// comment\n(LABEL)\n  @LABEL // jump\n0;JMP\n\n", 2},
+	}
+	for _, tt := range tests {
+		if got := countInstructions(tt.asm); got != tt.want {
+			t.Errorf("countInstructions(%q) = %d, want %d", tt.asm, got, tt.want)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	setenv(t, "INIT")
+	sys, err := decodeModule("Sys.vm", strings.NewReader(`function Sys.init 0
+push constant 6
+push constant 7
+mul
+
+call Main.f 1
+pop static 0
+label END
+goto END`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := decodeModule("Main.vm", strings.NewReader(`function Main.f 1
+// a comment
+push argument 0
+return`), &jackDebug{File: "src/Main.jack", Lines: []int{3, 4, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asm strings.Builder
+	_, srcmap, err := translate([]*vmModule{sys, main}, &asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom, labels := assemble(t, asm.String())
+
+	tests := []struct {
+		label string
+		want  sourceMapping
+	}{
+		// the function without locals takes no instruction
+		{"Sys.init", sourceMapping{sourcePos: sourcePos{Module: "Sys.vm", Line: 2}, Command: "push constant 6"}},
+		{"Sys.init$END", sourceMapping{sourcePos: sourcePos{Module: "Sys.vm", Line: 9}, Command: "goto END"}},
+		{"Main.f", sourceMapping{sourcePos: sourcePos{Module: "Main.vm", Line: 1, Jack: "Main.jack", JackLine: 3}, Command: "function Main.f 1"}},
+		{"$MUL", sourceMapping{Command: "$MUL"}},
+	}
+	for _, tt := range tests {
+		addr, ok := labels[tt.label]
+		if !ok {
+			t.Fatalf("label %s not defined", tt.label)
+		}
+		tt.want.ROM = addr
+		found := false
+		for _, mapping := range srcmap.Mappings {
+			if mapping.ROM == addr {
+				found = true
+				if mapping != tt.want {
+					t.Errorf("mapping at %s = %+v, want %+v", tt.label, mapping, tt.want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no mapping at %s", tt.label)
+		}
+	}
+
+	var lines []int
+	for i, mapping := range srcmap.Mappings {
+		if i > 0 && mapping.ROM <= srcmap.Mappings[i-1].ROM {
+			t.Fatalf("mapping %d at %d, after %d", i, mapping.ROM, srcmap.Mappings[i-1].ROM)
+		}
+		if mapping.ROM >= len(rom) {
+			t.Fatalf("mapping %d at %d, past the rom of %d", i, mapping.ROM, len(rom))
+		}
+		if mapping.Module == "Main.vm" {
+			lines = append(lines, mapping.JackLine)
+		}
+	}
+	if srcmap.Mappings[0].ROM != 0 || srcmap.Mappings[0].Command != bootstrapScope {
+		t.Errorf("first mapping = %+v, want the bootstrap at 0", srcmap.Mappings[0])
+	}
+	if len(lines) != 3 || lines[1] != 4 || lines[2] != 4 {
+		t.Errorf("jack lines of Main.vm = %v, want [3 4 4]", lines)
+	}
+}
+
+func TestReadJackDebug(t *testing.T) {
+	dir := t.TempDir()
+	vm := filepath.Join(dir, "Main.vm")
+	if err := os.WriteFile(vm, []byte("function Main.f 0\n\npush constant 0\nreturn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := readJackDebug(vm); d != nil || err != nil {
+		t.Fatalf("readJackDebug() = %v, %v without a debug map", d, err)
+	}
+	dbg := `{"file": "Main.jack", "lines": [2, 3, 3]}`
+	if err := os.WriteFile(filepath.Join(dir, "Main.dbg.json"), []byte(dbg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := decodeFile(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{2, 3, 3} {
+		if pos := m.pos(i); pos.Jack != "Main.jack" || pos.JackLine != want {
+			t.Errorf("position of command %d = %+v, want Main.jack:%d", i, pos, want)
+		}
+	}
+}
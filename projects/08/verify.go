@@ -0,0 +1,141 @@
+package main
+
+import "fmt"
+
+// verify interprets the functions of the module abstractly, following their
+// control flow to find the depth of the stack at every command. It reports
+// stack underflows, paths joining with different depths, returns with an
+// empty stack and accesses out of the segments
+func verify(m *vmModule) error {
+	var errs ErrorList
+	start := 0
+	for i := 1; i <= len(m.cmds); i++ {
+		if i == len(m.cmds) || m.cmds[i].GetOp() == OpFunction {
+			errs = append(errs, verifyFunction(m, start, i)...)
+			start = i
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// verifyFunction verifies the commands of m from start to end, which begin
+// with the declaration of their function unless they are the top level
+// commands of the module
+func verifyFunction(m *vmModule, start, end int) (errs ErrorList) {
+	errorf := func(i int, format string, args ...interface{}) {
+		errs = append(errs, &DecodeError{Module: m.name, Line: m.lines[i], Err: fmt.Errorf(format, args...)})
+	}
+	nLocals := -1
+	if fn, ok := m.cmds[start].(*functionVMCommand); ok {
+		nLocals = int(fn.localSize)
+	}
+	labels := make(map[string]int)
+	for i := start; i < end; i++ {
+		switch cmd := m.cmds[i].(type) {
+		case *labelVMCommand:
+			labels[cmd.absoluteLabelName()] = i
+		case *popVMCommand:
+			if cmd.seg == SegLcl && nLocals >= 0 && int(cmd.segIdx) >= nLocals {
+				errorf(i, "local %d out of the %d locals", cmd.segIdx, nLocals)
+			}
+		case *pushVMCommand:
+			if cmd.seg == SegLcl && nLocals >= 0 && int(cmd.segIdx) >= nLocals {
+				errorf(i, "local %d out of the %d locals", cmd.segIdx, nLocals)
+			}
+		}
+	}
+
+	depths := make([]int, end-start)
+	for i := range depths {
+		depths[i] = -1
+	}
+	var work []int
+	join := func(i, depth int) {
+		if i == end {
+			if nLocals >= 0 {
+				errorf(end-1, "control falls off the end of the function")
+			}
+			return
+		}
+		if d := depths[i-start]; d >= 0 {
+			if d != depth {
+				errorf(i, "stack depth %d joins with depth %d", depth, d)
+			}
+			return
+		}
+		depths[i-start] = depth
+		work = append(work, i)
+	}
+	join(start, 0)
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		cmd := m.cmds[i]
+		depth := depths[i-start]
+
+		pops, pushes := stackEffect(cmd)
+		if depth < pops {
+			if cmd.GetOp() == OpReturn {
+				errorf(i, "return with an empty stack")
+			} else {
+				errorf(i, "stack underflow: %s needs %d values, has %d", cmd, pops, depth)
+			}
+			depth = pops
+		}
+		depth += pushes - pops
+
+		switch cmd := cmd.(type) {
+		case *returnVMCommand:
+		case *gotoVMCommand:
+			if target, ok := labels[cmd.absoluteLabelName()]; ok {
+				join(target, depth)
+			} else {
+				errorf(i, "undefined label %s", cmd.labelName)
+			}
+		case *ifGotoVMCommand:
+			if target, ok := labels[cmd.absoluteLabelName()]; ok {
+				join(target, depth)
+			} else {
+				errorf(i, "undefined label %s", cmd.labelName)
+			}
+			join(i+1, depth)
+		default:
+			join(i+1, depth)
+		}
+	}
+	return
+}
+
+// stackEffect returns the number of values popped and then pushed by cmd
+func stackEffect(cmd VMCommand) (pops, pushes int) {
+	switch cmd := cmd.(type) {
+	case *callVMCommand:
+		return int(cmd.argSize), 1
+	case *pushVMCommand:
+		if cmd.seg.IsIndirect() {
+			return 1, 1
+		}
+	case *popVMCommand:
+		if cmd.seg.IsIndirect() {
+			return 2, 0
+		}
+	}
+	switch cmd.GetOp() {
+	case OpPush:
+		return 0, 1
+	case OpPop, OpIfGoto, OpReturn:
+		return 1, 0
+	case OpAdd, OpSub, OpEq, OpGt, OpLt, OpAnd, OpOr, OpMul, OpDiv, OpMod, OpShl, OpShr:
+		return 2, 1
+	case OpDup:
+		return 1, 2
+	case OpSwap:
+		return 2, 2
+	case OpNeg, OpNot:
+		return 1, 1
+	}
+	return 0, 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		errs []string
+	}{
+		{
+			name: "balanced branches",
+			src: `function Main.f 1
+push argument 0
+if-goto ELSE
+push constant 1
+goto END
+label ELSE
+push local 0
+label END
+return`,
+		},
+		{
+			name: "extended operations",
+			src: `function Main.f 0
+push constant 8000
+push constant 1
+swap
+pop indirect 0
+push constant 3
+dup
+mul
+return`,
+		},
+		{
+			name: "top level commands",
+			src:  "push constant 1\npop local 3",
+		},
+		{
+			name: "underflow",
+			src:  "function Main.f 0\npush constant 1\nadd\nreturn",
+			errs: []string{"Main.vm:3: stack underflow: add needs 2 values, has 1"},
+		},
+		{
+			name: "empty return",
+			src:  "function Main.f 0\nreturn",
+			errs: []string{"Main.vm:2: return with an empty stack"},
+		},
+		{
+			name: "depths joining",
+			src: `function Main.f 0
+push argument 0
+if-goto L
+push constant 1
+label L
+push constant 2
+return`,
+			errs: []string{"Main.vm:5: stack depth 1 joins with depth 0"},
+		},
+		{
+			name: "loop growing the stack",
+			src: `function Main.f 0
+push constant 0
+label LOOP
+push constant 1
+goto LOOP`,
+			errs: []string{"Main.vm:3: stack depth 2 joins with depth 1"},
+		},
+		{
+			name: "falls off the end",
+			src:  "function Main.f 0\npush constant 1",
+			errs: []string{"Main.vm:2: control falls off the end of the function"},
+		},
+		{
+			name: "undefined label",
+			src:  "function Main.f 0\ngoto L\nfunction Main.g 0\nlabel L\npush constant 0\nreturn",
+			errs: []string{"Main.vm:2: undefined label L"},
+		},
+		{
+			name: "locals",
+			src:  "function Main.f 2\npush local 1\npop local 2\npush local 3\nreturn",
+			errs: []string{"Main.vm:3: local 2 out of the 2 locals", "Main.vm:4: local 3 out of the 2 locals"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			if err := verify(decodeSources(t, "Main.vm", tt.src)[0]); err != nil {
+				for _, err := range err.(ErrorList) {
+					got = append(got, err.Error())
+				}
+			}
+			if len(got) != len(tt.errs) {
+				t.Fatalf("verify() = %q, want %q", got, tt.errs)
+			}
+			for i := range got {
+				if got[i] != tt.errs[i] {
+					t.Errorf("verify() = %q, want %q", got, tt.errs)
+				}
+			}
+		})
+	}
+}
+
+func TestVerify_Projects(t *testing.T) {
+	dirs, err := filepath.Glob("*/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		modules, err := decodePath(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = verifyAll(modules); err != nil {
+			t.Errorf("%s: %v", dir, err)
+		}
+	}
+}
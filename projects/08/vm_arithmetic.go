@@ -11,7 +11,7 @@ func (cmd *addVMCommand) MarshalASM() (s string, err error) {
 AM=M-1
 D=M
 A=A-1
-M=M+D
+M=D+M
 `, nil
 }
 
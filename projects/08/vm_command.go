@@ -17,31 +17,37 @@ type NewVMCommandInput struct {
 	segIdx    uint16
 	argSize   uint16
 	localSize uint16
-	vmPc      uint16
 	labelName string
-	module    string
 	ctx       string
+	scope     string
 }
 
 func NewVMCommand(input NewVMCommandInput) (VMCommand, error) {
 	cmd, ok := map[VMOperation]VMCommand{
-		OpPush:     &pushVMCommand{moduleName: input.module, seg: input.seg, segIdx: input.segIdx},
-		OpPop:      &popVMCommand{moduleName: input.module, seg: input.seg, segIdx: input.segIdx},
+		OpPush:     &pushVMCommand{seg: input.seg, segIdx: input.segIdx},
+		OpPop:      &popVMCommand{seg: input.seg, segIdx: input.segIdx},
 		OpAdd:      &addVMCommand{},
 		OpSub:      &subVMCommand{},
 		OpNeg:      &negVMCommand{},
-		OpEq:       &eqVMCommand{vmPc: input.vmPc},
-		OpLt:       &ltVMCommand{vmPc: input.vmPc},
-		OpGt:       &gtVMCommand{vmPc: input.vmPc},
+		OpEq:       &eqVMCommand{scope: input.scope},
+		OpLt:       &ltVMCommand{scope: input.scope},
+		OpGt:       &gtVMCommand{scope: input.scope},
 		OpAnd:      &andVMCommand{},
 		OpOr:       &orVMCommand{},
 		OpNot:      &notVMCommand{},
 		OpFunction: &functionVMCommand{funcName: input.funcName, localSize: input.localSize},
-		OpCall:     &callVMCommand{funcName: input.funcName, argSize: input.argSize, vmPc: input.vmPc},
+		OpCall:     &callVMCommand{funcName: input.funcName, argSize: input.argSize, scope: input.scope},
 		OpReturn:   &returnVMCommand{},
 		OpLabel:    &labelVMCommand{labelName: input.labelName, ctxName: input.ctx},
 		OpGoto:     &gotoVMCommand{labelName: input.labelName, ctxName: input.ctx},
 		OpIfGoto:   &ifGotoVMCommand{labelName: input.labelName, ctxName: input.ctx},
+		OpMul:      &routineVMCommand{op: OpMul, scope: input.scope},
+		OpDiv:      &routineVMCommand{op: OpDiv, scope: input.scope},
+		OpMod:      &routineVMCommand{op: OpMod, scope: input.scope},
+		OpShl:      &routineVMCommand{op: OpShl, scope: input.scope},
+		OpShr:      &routineVMCommand{op: OpShr, scope: input.scope},
+		OpDup:      &dupVMCommand{},
+		OpSwap:     &swapVMCommand{},
 	}[input.op]
 	if !ok {
 		return nil, fmt.Errorf("op not supported: %s", input.op)
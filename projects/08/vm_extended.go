@@ -0,0 +1,425 @@
+package main
+
+import "fmt"
+
+// routineVMCommand is an extended arithmetic operation, computed by jumping
+// to its shared routine with x in R13, y in R14 and the return address in
+// R15. Routines leave the result in D, and div leaves the remainder in R13
+type routineVMCommand struct {
+	op       VMOperation
+	scope    string
+	retLabel string
+}
+
+func (cmd *routineVMCommand) GetOp() VMOperation {
+	return cmd.op
+}
+
+func (cmd *routineVMCommand) MarshalASM() (s string, err error) {
+	s += fmt.Sprintf(`// R14=y, R13=x, R15=retLabel
+@SP
+AM=M-1
+D=M
+@%s
+M=D
+@SP
+A=M-1
+D=M
+@%s
+M=D
+@%s
+D=A
+@%s
+M=D
+`, internalReg2, internalReg1, cmd.retLabel, internalReg3)
+	s += translateGoto(cmd.routine())
+	s += translateDefLabel(cmd.retLabel)
+	if cmd.op == OpMod {
+		s += fmt.Sprintf("@%s\nD=M\n", internalReg1)
+	}
+	s += `@SP
+A=M-1
+M=D
+`
+	return
+}
+
+func (cmd *routineVMCommand) routine() string {
+	return routineOps[cmd.op]
+}
+
+func (cmd *routineVMCommand) allocLabels(a *labelAllocator) error {
+	cmd.retLabel = a.next(cmd.scope, "RET_"+string(cmd.op))
+	return nil
+}
+
+func (cmd *routineVMCommand) String() string {
+	return string(cmd.GetOp())
+}
+
+type dupVMCommand struct{}
+
+func (cmd *dupVMCommand) GetOp() VMOperation {
+	return OpDup
+}
+
+func (cmd *dupVMCommand) MarshalASM() (s string, err error) {
+	return `@SP
+A=M-1
+D=M
+@SP
+M=M+1
+A=M-1
+M=D
+`, nil
+}
+
+func (cmd *dupVMCommand) String() string {
+	return string(cmd.GetOp())
+}
+
+type swapVMCommand struct{}
+
+func (cmd *swapVMCommand) GetOp() VMOperation {
+	return OpSwap
+}
+
+func (cmd *swapVMCommand) MarshalASM() (s string, err error) {
+	return fmt.Sprintf(`@SP
+A=M-1
+D=M
+@%s
+M=D
+@SP
+A=M-1
+A=A-1
+D=M
+@SP
+A=M-1
+M=D
+@%s
+D=M
+@SP
+A=M-1
+A=A-1
+M=D
+`, internalReg1, internalReg1), nil
+}
+
+func (cmd *swapVMCommand) String() string {
+	return string(cmd.GetOp())
+}
+
+// scratch words of the arithmetic routines, after the statics
+const (
+	scratchX = iota
+	scratchY
+	scratchRet
+	scratchQ
+	scratchQBase
+	scratchP
+	scratchMask
+)
+
+// translateMulRoutine multiplies adding x for every set bit of y, clearing
+// them until y is 0
+func translateMulRoutine(scratch uint16) string {
+	q, mask := scratch+scratchQ, scratch+scratchMask
+	return fmt.Sprintf(`($MUL)
+@%[1]d
+M=0
+@%[2]d
+M=1
+($MUL.LOOP)
+@R14
+D=M
+@$MUL.END
+D;JEQ
+@%[2]d
+D=M
+@R14
+D=D&M
+@$MUL.NEXT
+D;JEQ
+@R14
+M=M-D
+@R13
+D=M
+@%[1]d
+M=D+M
+($MUL.NEXT)
+@R13
+D=M
+M=D+M
+@%[2]d
+D=M
+M=D+M
+@$MUL.LOOP
+0;JMP
+($MUL.END)
+@%[1]d
+D=M
+@R15
+A=M
+0;JMP
+`, q, mask)
+}
+
+// translateDivRoutine divides |x| by |y| subtracting the doublings of |y|,
+// kept above the stack, from the largest one. The quotient is truncated and
+// the remainder takes the sign of x. Dividing by 0 halts
+func translateDivRoutine(scratch uint16) string {
+	x, y, ret := scratch+scratchX, scratch+scratchY, scratch+scratchRet
+	q, qbase, p := scratch+scratchQ, scratch+scratchQBase, scratch+scratchP
+	return fmt.Sprintf(`($DIV)
+@R15
+D=M
+@%[3]d
+M=D
+@R13
+D=M
+@%[1]d
+M=D
+@R14
+D=M
+@%[2]d
+M=D
+@$DIV.ZERO
+D;JEQ
+@%[5]d
+M=0
+@R14
+D=M
+@$DIV.YPOS
+D;JGE
+@R14
+M=-M
+($DIV.YPOS)
+@R13
+D=M
+@$DIV.XPOS
+D;JGE
+@R13
+M=-M
+($DIV.XPOS)
+// |y| = 32768
+@R14
+D=M
+@$DIV.Y16
+D;JLT
+// |x| = 32768 subtracts |y| once, which leaves it positive
+@R13
+D=M
+@$DIV.CORE
+D;JGE
+@R14
+D=M
+@R13
+M=M-D
+@%[5]d
+M=1
+($DIV.CORE)
+@SP
+D=M
+@%[6]d
+M=D
+@R14
+D=M
+@%[6]d
+A=M
+M=D
+($DIV.UP)
+@%[6]d
+A=M
+D=M
+D=D+M
+@$DIV.DOWN0
+D;JLE
+@R13
+D=D-M
+@$DIV.DOWN0
+D;JGT
+@R13
+D=D+M
+@%[6]d
+AM=M+1
+M=D
+@$DIV.UP
+0;JMP
+($DIV.DOWN0)
+@%[4]d
+M=0
+($DIV.DOWN)
+@%[4]d
+D=M
+M=D+M
+@%[6]d
+A=M
+D=M
+@R13
+D=M-D
+@$DIV.SKIP
+D;JLT
+@R13
+M=D
+@%[4]d
+M=M+1
+($DIV.SKIP)
+@%[6]d
+D=M
+@SP
+D=D-M
+@$DIV.SIGNS
+D;JEQ
+@%[6]d
+M=M-1
+@$DIV.DOWN
+0;JMP
+($DIV.Y16)
+@R13
+D=M
+@$DIV.Y16X
+D;JLT
+@%[4]d
+M=0
+@$DIV.SIGNS
+0;JMP
+($DIV.Y16X)
+@R13
+M=0
+@%[4]d
+M=1
+($DIV.SIGNS)
+@%[5]d
+D=M
+@%[4]d
+M=D+M
+@%[1]d
+D=M
+@$DIV.RPOS
+D;JGE
+@R13
+M=-M
+($DIV.RPOS)
+@%[2]d
+D=M
+@$DIV.YNEG
+D;JLT
+@%[1]d
+D=M
+@$DIV.END
+D;JGE
+@$DIV.NEGQ
+0;JMP
+($DIV.YNEG)
+@%[1]d
+D=M
+@$DIV.END
+D;JLT
+($DIV.NEGQ)
+@%[4]d
+M=-M
+($DIV.END)
+@%[4]d
+D=M
+@%[3]d
+A=M
+0;JMP
+($DIV.ZERO)
+@$DIV.ZERO
+0;JMP
+`, x, y, ret, q, qbase, p)
+}
+
+// translateShlRoutine doubles x y times, stopping once it is 0
+func translateShlRoutine() string {
+	return `($SHL)
+@R14
+D=M
+@$SHL.END
+D;JEQ
+@R13
+D=M
+@$SHL.END
+D;JEQ
+@R13
+M=D+M
+@R14
+M=M-1
+@$SHL
+0;JMP
+($SHL.END)
+@R13
+D=M
+@R15
+A=M
+0;JMP
+`
+}
+
+// translateShrRoutine copies the bits of x from the y-th one down to the
+// lowest bits of the result, filling the highest ones with the sign of x
+func translateShrRoutine(scratch uint16) string {
+	q, mask := scratch+scratchQ, scratch+scratchMask
+	return fmt.Sprintf(`($SHR)
+@%[2]d
+M=1
+($SHR.ALIGN)
+@R14
+D=M
+@$SHR.BITS
+D;JEQ
+@%[2]d
+D=M
+@$SHR.BITS
+D;JEQ
+@%[2]d
+M=D+M
+@R14
+M=M-1
+@$SHR.ALIGN
+0;JMP
+($SHR.BITS)
+@%[1]d
+M=0
+@R14
+M=1
+($SHR.LOOP)
+@%[2]d
+D=M
+@$SHR.SIGN
+D;JEQ
+@R13
+D=D&M
+@$SHR.NEXT
+D;JEQ
+@R14
+D=M
+@%[1]d
+M=D|M
+($SHR.NEXT)
+@%[2]d
+D=M
+M=D+M
+@R14
+D=M
+M=D+M
+@$SHR.LOOP
+0;JMP
+($SHR.SIGN)
+@R13
+D=M
+@$SHR.END
+D;JGE
+@R14
+D=-M
+@%[1]d
+M=D|M
+($SHR.END)
+@%[1]d
+D=M
+@R15
+A=M
+0;JMP
+`, q, mask)
+}
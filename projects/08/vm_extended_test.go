@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pushInt returns the commands pushing any 16-bit value
+func pushInt(v int16) string {
+	switch {
+	case v >= 0:
+		return fmt.Sprintf("push constant %d\n", v)
+	case v == -32768:
+		return "push constant 32767\nnot\n"
+	}
+	return fmt.Sprintf("push constant %d\nneg\n", -v)
+}
+
+// TestExtended_Routines runs the operations of the shared routines on every
+// pair of a set of values, comparing them with the 16-bit arithmetic of go
+func TestExtended_Routines(t *testing.T) {
+	values := []int16{0, 1, -1, 2, -2, 3, 7, -7, 100, -100, 255, 256, 12345, -12345, 32767, -32768}
+	var shifts []int16
+	for y := int16(0); y < 16; y++ {
+		shifts = append(shifts, y)
+	}
+	tests := []struct {
+		op VMOperation
+		ys []int16
+		f  func(x, y int16) int16
+	}{
+		{OpMul, values, func(x, y int16) int16 { return x * y }},
+		{OpDiv, values, func(x, y int16) int16 { return x / y }},
+		{OpMod, values, func(x, y int16) int16 { return x % y }},
+		{OpShl, shifts, func(x, y int16) int16 { return x << uint16(y) }},
+		{OpShr, shifts, func(x, y int16) int16 { return x >> uint16(y) }},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.op), func(t *testing.T) {
+			type result struct{ x, y, want int16 }
+			var results []result
+			var src strings.Builder
+			src.WriteString("function Sys.init 0\n")
+			for _, x := range values {
+				for _, y := range tt.ys {
+					// go panics dividing by zero
+					if (tt.op == OpDiv || tt.op == OpMod) && y == 0 {
+						continue
+					}
+					fmt.Fprintf(&src, "push constant %d\n%s%s%s\npop indirect 0\n", 3000+len(results), pushInt(x), pushInt(y), tt.op)
+					results = append(results, result{x, y, tt.f(x, y)})
+				}
+			}
+			src.WriteString("label END\ngoto END\n")
+			ram, _ := runSources(t, "Sys.vm", src.String())
+			for i, r := range results {
+				if got := ram[3000+i]; got != r.want {
+					t.Errorf("%d %s %d = %d, want %d", r.x, tt.op, r.y, got, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtended_Stack(t *testing.T) {
+	ram, _ := runSources(t, "Sys.vm", `
+function Sys.init 0
+push constant 3000
+push constant 5
+dup
+add
+pop indirect 0
+push constant 1
+push constant 2
+swap
+sub
+pop static 0
+push constant 3000
+push indirect 0
+push constant 3001
+swap
+pop indirect 0
+push constant 3001
+dup
+push indirect 0
+push constant 1
+add
+pop indirect 0
+label END
+goto END
+`)
+	if ram[3000] != 10 || ram[16] != 1 || ram[3001] != 11 {
+		t.Errorf("RAM[3000] = %d, static 0 = %d, RAM[3001] = %d, want 10, 1 and 11", ram[3000], ram[16], ram[3001])
+	}
+}
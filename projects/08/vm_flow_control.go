@@ -20,6 +20,10 @@ func (cmd *labelVMCommand) absoluteLabelName() string {
 	return translateAbsLabelName(cmd.ctxName, cmd.labelName)
 }
 
+func (cmd *labelVMCommand) allocLabels(a *labelAllocator) error {
+	return a.define(cmd.absoluteLabelName())
+}
+
 func (cmd *labelVMCommand) String() string {
 	return fmt.Sprintf("%s %s", cmd.GetOp(), cmd.labelName)
 }
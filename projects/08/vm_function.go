@@ -24,14 +24,22 @@ func (cmd *functionVMCommand) MarshalASM() (s string, err error) {
 	return
 }
 
+func (cmd *functionVMCommand) allocLabels(a *labelAllocator) error {
+	return a.define(cmd.funcName)
+}
+
 func (cmd *functionVMCommand) String() string {
 	return fmt.Sprintf("%s %s %d", cmd.GetOp(), cmd.funcName, cmd.localSize)
 }
 
+// callVMCommand jumps to the call routine when shared, instead of saving the
+// frame of the caller in place
 type callVMCommand struct {
-	vmPc     uint16
 	argSize  uint16
 	funcName string
+	scope    string
+	retLabel string
+	shared   bool
 }
 
 func (cmd *callVMCommand) GetOp() VMOperation {
@@ -39,11 +47,26 @@ func (cmd *callVMCommand) GetOp() VMOperation {
 }
 
 func (cmd *callVMCommand) MarshalASM() (s string, err error) {
-	retLabel := fmt.Sprintf("RET_%d", cmd.vmPc)
-
+	if cmd.shared {
+		s += fmt.Sprintf(`// R13=argSize+5, R14=funcName, D=retLabel
+@%d
+D=A
+@%s
+M=D
+@%s
+D=A
+@%s
+M=D
+@%s
+D=A
+`, cmd.argSize+5, internalReg1, cmd.funcName, internalReg2, cmd.retLabel)
+		s += translateGoto(callRoutine)
+		s += translateDefLabel(cmd.retLabel)
+		return
+	}
 	// fill FRAME
 	s += fmt.Sprintf("// save RET label addr\n")
-	s += translatePushRegister(retLabel, ARegister)
+	s += translatePushRegister(cmd.retLabel, ARegister)
 
 	for _, addr := range [4]string{"LCL", "ARG", "THIS", "THAT"} {
 		s += fmt.Sprintf("//save %s\n", addr)
@@ -68,31 +91,199 @@ M=D
 	// GOTO funcName
 	s += "// goto  funcName\n"
 	s += translateGoto(cmd.funcName)
-	// label RET_vmPc
-	s += "// label  RET_vmPc\n"
-	s += translateDefLabel(retLabel)
+	// label retLabel
+	s += "// label  retLabel\n"
+	s += translateDefLabel(cmd.retLabel)
 	s += "// end func\n"
 	return
 }
 
+func (cmd *callVMCommand) routine() string {
+	if cmd.shared {
+		return callRoutine
+	}
+	return ""
+}
+
+func (cmd *callVMCommand) allocLabels(a *labelAllocator) error {
+	cmd.retLabel = a.next(cmd.scope, "RET")
+	return nil
+}
+
 func (cmd *callVMCommand) String() string {
 	return fmt.Sprintf("%s %s %d", cmd.GetOp(), cmd.funcName, cmd.argSize)
 }
 
-type returnVMCommand struct{}
+// translateCallRoutine translates the routine jumped to by the shared calls
+func translateCallRoutine() (s string) {
+	s += translateDefLabel(callRoutine)
+	s += "// push retLabel\n"
+	s += `@SP
+A=M
+M=D
+@SP
+M=M+1
+`
+	for _, addr := range [4]string{"LCL", "ARG", "THIS", "THAT"} {
+		s += fmt.Sprintf("//save %s\n", addr)
+		s += translatePushRegister(addr, MRegister)
+	}
+	s += fmt.Sprintf(`// ARG=SP-argSize-5
+@SP
+D=M
+@%s
+D=D-M
+@ARG
+M=D
+// LCL=SP
+@SP
+D=M
+@LCL
+M=D
+// goto funcName
+@%s
+A=M
+0;JMP
+`, internalReg1, internalReg2)
+	return
+}
+
+// translateReturnRoutine translates the routine jumped to by the shared
+// returns
+func translateReturnRoutine() (string, error) {
+	ret, err := translateReturn()
+	return translateDefLabel(returnRoutine) + ret, err
+}
+
+// tailCallVMCommand is a call followed by a return. The callee takes the
+// frame of the caller, returning straight to the caller of the caller.
+// callerArgs holds the number of arguments of the caller, or -1 if unknown,
+// and frame the address of the frame segment keeping the saved frame while
+// the arguments are moved over it
+type tailCallVMCommand struct {
+	argSize    uint16
+	funcName   string
+	callerArgs int
+	frame      uint16
+}
+
+func (cmd *tailCallVMCommand) GetOp() VMOperation {
+	return OpCall
+}
+
+func (cmd *tailCallVMCommand) MarshalASM() (s string, err error) {
+	s += "// tail call, reusing the frame of the caller\n"
+	n := cmd.argSize
+	stackAddr := func(i uint16) string {
+		return fmt.Sprintf("@SP\nD=M\n@%d\nA=D-A\n", n-i)
+	}
+	if cmd.callerArgs == int(n) {
+		// the saved frame is already in place
+		for i := uint16(0); i < n; i++ {
+			s += fmt.Sprintf("// *(ARG+%d) = *(SP-%d)\n", i, n-i)
+			s += translateCopyToArg(i, stackAddr(i))
+		}
+		s += `// SP=LCL
+@LCL
+D=M
+@SP
+M=D
+`
+		s += translateGoto(cmd.funcName)
+		return
+	}
+
+	if cmd.callerArgs > int(n) {
+		// moving the saved frame down doesn't overwrite it
+		for i := uint16(0); i < 5; i++ {
+			s += fmt.Sprintf("// *(ARG+%d) = *(LCL-%d)\n", n+i, 5-i)
+			s += translateCopyToArg(n+i, fmt.Sprintf("@LCL\nD=M\n@%d\nA=D-A\n", 5-i))
+		}
+	} else {
+		// the arguments may overwrite the saved frame, which is kept in the
+		// frame segment
+		for i := uint16(0); i < 5; i++ {
+			s += fmt.Sprintf("// frame %d = *(LCL-%d)\n", i, 5-i)
+			s += fmt.Sprintf(`@LCL
+D=M
+@%d
+A=D-A
+D=M
+@%d
+M=D
+`, 5-i, cmd.frame+i)
+		}
+	}
+	for i := uint16(0); i < n; i++ {
+		s += fmt.Sprintf("// *(ARG+%d) = *(SP-%d)\n", i, n-i)
+		s += translateCopyToArg(i, stackAddr(i))
+	}
+	if cmd.callerArgs <= int(n) {
+		for i := uint16(0); i < 5; i++ {
+			s += fmt.Sprintf("// *(ARG+%d) = frame %d\n", n+i, i)
+			s += translateCopyToArg(n+i, fmt.Sprintf("@%d\n", cmd.frame+i))
+		}
+	}
+	s += fmt.Sprintf(`// LCL=SP=ARG+argSize+5
+@ARG
+D=M
+@%d
+D=D+A
+@LCL
+M=D
+@SP
+M=D
+`, n+5)
+	s += translateGoto(cmd.funcName)
+	return
+}
+
+func (cmd *tailCallVMCommand) String() string {
+	return fmt.Sprintf("%s %s %d", cmd.GetOp(), cmd.funcName, cmd.argSize)
+}
+
+// translateCopyToArg copies to ARG+index the value at the address that srcAddr
+// leaves in A
+func translateCopyToArg(index uint16, srcAddr string) (s string) {
+	s += translateGetDynamicAddr(SegArg, index, DRegister)
+	s += fmt.Sprintf("@%s\nM=D\n", internalReg1)
+	s += srcAddr
+	s += fmt.Sprintf("D=M\n@%s\nA=M\nM=D\n", internalReg1)
+	return
+}
+
+// returnVMCommand jumps to the return routine when shared, instead of
+// restoring the frame of the caller in place
+type returnVMCommand struct {
+	shared bool
+}
 
 func (cmd *returnVMCommand) GetOp() VMOperation {
 	return OpReturn
 }
 
 func (cmd *returnVMCommand) MarshalASM() (s string, err error) {
+	if cmd.shared {
+		return translateGoto(returnRoutine), nil
+	}
+	return translateReturn()
+}
+
+func (cmd *returnVMCommand) routine() string {
+	if cmd.shared {
+		return returnRoutine
+	}
+	return ""
+}
+
+func translateReturn() (s string, err error) {
 	// FRAME = LCL
-	s += `// FRAME=LCL
+	s += fmt.Sprintf(`// FRAME=LCL
 @LCL
 D=M
-@FRAME
+@%s
 M=D
-`
+`, frameReg)
 
 	//	// RET = *(FRAME-5)
 	//	translateAssignConstantD(5)
@@ -103,12 +294,12 @@ M=D
 	//M=D
 	//`
 	s += translateAssignConstantD(5)
-		s += fmt.Sprintf(`@FRAME
+	s += fmt.Sprintf(`@%s
 A=M-D
 D=M
-@RET
+@%s
 M=D
-`)
+`, frameReg, retReg)
 
 	// *ARG0 = pop()
 	popCmd := &popVMCommand{seg: SegArg}
@@ -136,19 +327,19 @@ M=D+1
 	} {
 		s += fmt.Sprintf("// save %s = *(FRAME-%d) \n", asmSymbol, offset)
 		s += translateAssignConstantD(offset)
-		s += fmt.Sprintf(`@FRAME
+		s += fmt.Sprintf(`@%s
 A=M-D
 D=M
 @%s
 M=D
-`, asmSymbol)
+`, frameReg, asmSymbol)
 	}
 	// GOTO RET
-	s += `// goto RET
-@RET
+	s += fmt.Sprintf(`// goto RET
+@%s
 A=M
 0;JMP
-`
+`, retReg)
 	return
 }
 func (cmd *returnVMCommand) String() string {
@@ -3,7 +3,9 @@ package main
 import "fmt"
 
 type eqVMCommand struct {
-	vmPc uint16
+	scope    string
+	isLabel  string
+	endLabel string
 }
 
 func (cmd *eqVMCommand) GetOp() VMOperation {
@@ -17,21 +19,27 @@ D=M
 A=A-1
 
 D=M-D
-@IS_EQ_%d
+@%[1]s
 D;JEQ
 
 @SP
 A=M-1
 M=0
-@END_EQ_%d
+@%[2]s
 0;JMP
 
-(IS_EQ_%d)
+(%[1]s)
 @SP
 A=M-1
 M=-1
-(END_EQ_%d)
-`, cmd.vmPc, cmd.vmPc, cmd.vmPc, cmd.vmPc), nil
+(%[2]s)
+`, cmd.isLabel, cmd.endLabel), nil
+}
+
+func (cmd *eqVMCommand) allocLabels(a *labelAllocator) error {
+	cmd.isLabel = a.next(cmd.scope, "IS_EQ")
+	cmd.endLabel = a.next(cmd.scope, "END_EQ")
+	return nil
 }
 
 func (cmd *eqVMCommand) String() string {
@@ -39,7 +47,9 @@ func (cmd *eqVMCommand) String() string {
 }
 
 type gtVMCommand struct {
-	vmPc uint16
+	scope    string
+	isLabel  string
+	endLabel string
 }
 
 func (cmd *gtVMCommand) GetOp() VMOperation {
@@ -53,21 +63,27 @@ D=M
 A=A-1
 
 D=M-D
-@IS_GT_%d
+@%[1]s
 D;JGT
 
 @SP
 A=M-1
 M=0
-@END_GT_%d
+@%[2]s
 0;JMP
 
-(IS_GT_%d)
+(%[1]s)
 @SP
 A=M-1
 M=-1
-(END_GT_%d)
-`, cmd.vmPc, cmd.vmPc, cmd.vmPc, cmd.vmPc), nil
+(%[2]s)
+`, cmd.isLabel, cmd.endLabel), nil
+}
+
+func (cmd *gtVMCommand) allocLabels(a *labelAllocator) error {
+	cmd.isLabel = a.next(cmd.scope, "IS_GT")
+	cmd.endLabel = a.next(cmd.scope, "END_GT")
+	return nil
 }
 
 func (cmd *gtVMCommand) String() string {
@@ -75,7 +91,9 @@ func (cmd *gtVMCommand) String() string {
 }
 
 type ltVMCommand struct {
-	vmPc uint16
+	scope    string
+	isLabel  string
+	endLabel string
 }
 
 func (cmd *ltVMCommand) GetOp() VMOperation {
@@ -89,21 +107,27 @@ D=M
 A=A-1
 
 D=M-D
-@IS_LT_%d
+@%[1]s
 D;JLT
 
 @SP
 A=M-1
 M=0
-@END_LT_%d
+@%[2]s
 0;JMP
 
-(IS_LT_%d)
+(%[1]s)
 @SP
 A=M-1
 M=-1
-(END_LT_%d)
-`, cmd.vmPc, cmd.vmPc, cmd.vmPc, cmd.vmPc), nil
+(%[2]s)
+`, cmd.isLabel, cmd.endLabel), nil
+}
+
+func (cmd *ltVMCommand) allocLabels(a *labelAllocator) error {
+	cmd.isLabel = a.next(cmd.scope, "IS_LT")
+	cmd.endLabel = a.next(cmd.scope, "END_LT")
+	return nil
 }
 
 func (cmd *ltVMCommand) String() string {
@@ -137,7 +161,7 @@ func (cmd *andVMCommand) GetOp() VMOperation {
 func (cmd *andVMCommand) MarshalASM() (s string, err error) {
 	s += translatePopToD()
 	s += `A=A-1
-M=M&D
+M=D&M
 `
 	return
 }
@@ -155,7 +179,7 @@ func (cmd *orVMCommand) GetOp() VMOperation {
 func (cmd *orVMCommand) MarshalASM() (s string, err error) {
 	s += translatePopToD()
 	s += `A=A-1
-M=M|D
+M=D|M
 `
 	return
 }
@@ -2,10 +2,12 @@ package main
 
 import "fmt"
 
+// staticBase is the address of the static segment of the module, or of the
+// frame segment
 type pushVMCommand struct {
-	moduleName string
 	seg        VMMemSegment
 	segIdx     uint16
+	staticBase uint16
 }
 
 func (cmd *pushVMCommand) GetOp() VMOperation {
@@ -13,6 +15,20 @@ func (cmd *pushVMCommand) GetOp() VMOperation {
 }
 
 func (cmd *pushVMCommand) MarshalASM() (s string, err error) {
+	if cmd.seg.IsIndirect() {
+		// replaces the address on top of the stack with its value
+		s += "@SP\nA=M-1\nD=M\n"
+		if cmd.segIdx != 0 {
+			s += fmt.Sprintf("@%d\nD=D+A\n", cmd.segIdx)
+		}
+		s += `A=D
+D=M
+@SP
+A=M-1
+M=D
+`
+		return
+	}
 	if cmd.seg.IsVirtual() {
 		s += translateAssignConstantD(cmd.segIdx)
 	}
@@ -25,8 +41,8 @@ func (cmd *pushVMCommand) MarshalASM() (s string, err error) {
 	if cmd.seg.IsFixed() {
 		s += translateGetFixedAddr(cmd.seg, cmd.segIdx)
 	}
-	if cmd.seg.IsStatic() {
-		s += translateGetStaticAddr(cmd.moduleName, cmd.segIdx)
+	if cmd.seg.IsStatic() || cmd.seg.IsFrame() {
+		s += translateGetStaticAddr(cmd.staticBase, cmd.segIdx)
 	}
 	if !cmd.seg.IsVirtual() {
 		s += "D=M\n"
@@ -45,16 +61,18 @@ func (cmd *pushVMCommand) String() string {
 }
 
 type popVMCommand struct {
-	moduleName string
 	seg        VMMemSegment
 	segIdx     uint16
+	staticBase uint16
 }
 
 func (cmd *popVMCommand) MarshalASM() (s string, err error) {
 	if cmd.seg.IsVirtual() {
 		return "", errInvalidOperation
 	}
-	if cmd.seg.IsStateless() {
+	if cmd.seg.IsIndirect() {
+		s = cmd.marshalASMIndirect()
+	} else if cmd.seg.IsStateless() {
 		s = cmd.marshalASMStateless()
 	} else {
 		s = cmd.marshalASMStateful()
@@ -74,12 +92,32 @@ A=M
 	return
 }
 
+// marshalASMIndirect pops the value and then the address to store it at
+func (cmd *popVMCommand) marshalASMIndirect() (s string) {
+	s += translatePopToD()
+	s += fmt.Sprintf(`@%s
+M=D
+`, internalReg1)
+	s += translatePopToD()
+	if cmd.segIdx != 0 {
+		s += fmt.Sprintf("@%d\nD=D+A\n", cmd.segIdx)
+	}
+	s += fmt.Sprintf(`@%s
+M=D
+@%s
+D=M
+@%s
+A=M
+`, internalReg2, internalReg1, internalReg2)
+	return
+}
+
 func (cmd *popVMCommand) marshalASMStateless() (s string) {
 	s += translatePopToD()
 	if cmd.seg.IsPointer() {
 		s += translateGetPointerAddr(cmd.seg, cmd.segIdx)
-	} else if cmd.seg.IsStatic() {
-		s += translateGetStaticAddr(cmd.moduleName, cmd.segIdx)
+	} else if cmd.seg.IsStatic() || cmd.seg.IsFrame() {
+		s += translateGetStaticAddr(cmd.staticBase, cmd.segIdx)
 	} else if cmd.seg.IsFixed() {
 		s += translateGetFixedAddr(cmd.seg, cmd.segIdx)
 	}